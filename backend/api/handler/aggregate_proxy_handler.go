@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// collectAggregateMembers gathers the shared instances of every enabled service the user may access.
+// Services that fail to start are skipped so one broken upstream does not take down the aggregate endpoint.
+func collectAggregateMembers(c *gin.Context, userID int64, role int) ([]proxy.AggregateMember, error) {
+	services, err := model.GetEnabledServices()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := c.Request.Context()
+	apiKey := apiKeyFromContext(c)
+	members := make([]proxy.AggregateMember, 0, len(services))
+	for _, svc := range services {
+		if svc.AdminOnly && role < common.RoleAdminUser {
+			continue
+		}
+		if apiKey != nil && !apiKey.AllowsService(svc.ID) {
+			continue
+		}
+
+		var sharedInst *proxy.SharedMcpInstance
+		var instErr error
+		if usesUserSpecificInstance(svc, userID) {
+			sharedInst, instErr = getOrCreateUserSpecificInstance(ctx, svc, userID)
+			if instErr != nil && svc.Type != model.ServiceTypeStdio {
+				// Remote services never fall back to the global client, which runs under the admin's identity
+				common.SysError(fmt.Sprintf("[AggregateProxy] Skipping %s for user %d: %v", svc.Name, userID, instErr))
+				continue
+			}
+			if instErr != nil {
+				common.SysError(fmt.Sprintf("[AggregateProxy] User-specific instance failed for %s (user %d), fallback to global: %v", svc.Name, userID, instErr))
+				sharedInst = nil
+			}
+		}
+		if sharedInst == nil {
+			sharedInst, instErr = getOrCreateGlobalInstance(ctx, svc)
+			if instErr != nil {
+				common.SysError(fmt.Sprintf("[AggregateProxy] Skipping %s: %v", svc.Name, instErr))
+				continue
+			}
+		}
+		members = append(members, proxy.AggregateMember{Service: svc, Instance: sharedInst})
+	}
+	return members, nil
+}
+
+// AggregateProxyHandler handles /proxy/_all/*action, serving one MCP endpoint that merges every
+// enabled service the caller may use. Tool and prompt names are namespaced as <service>__<name>.
+func AggregateProxyHandler(c *gin.Context) {
+	action := c.Param("action")
+
+	var userID int64
+	if idVal, exists := c.Get("userID"); exists {
+		if parsedID, parseErr := parseInt64(idVal); parseErr == nil {
+			userID = parsedID
+		}
+	}
+	if userID == 0 {
+		common.SysLog("WARN: [AggregateProxy] Unauthorized access: userID not found or invalid")
+		setProxyAuthenticateHeader(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Authentication required. Please provide a valid user ID."})
+		return
+	}
+	role := c.GetInt("role")
+	c.Request = c.Request.WithContext(proxy.WithCaller(c.Request.Context(), callerFromContext(c, userID)))
+
+	members, err := collectAggregateMembers(c, userID, role)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[AggregateProxy] Failed to load services: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to load services"})
+		return
+	}
+
+	// Keep the member instances from being evicted while they serve the request or stream
+	for _, m := range members {
+		if m.Instance != nil {
+			release := proxy.AcquireInstance(m.Instance.CacheKey)
+			defer release()
+		}
+	}
+
+	proxyType := "sseproxy"
+	requestType := model.ProxyRequestTypeSSE
+	if action == "/mcp" {
+		proxyType = "httpproxy"
+		requestType = model.ProxyRequestTypeHTTP
+	}
+
+	// Each API key can have a different service scope, so it gets its own aggregate handler
+	ownerKey := fmt.Sprintf("user-%d", userID)
+	if apiKey := apiKeyFromContext(c); apiKey != nil {
+		ownerKey = fmt.Sprintf("user-%d-key-%d", userID, apiKey.ID)
+	}
+	targetHandler, aggregateTools, err := proxy.GetOrCreateAggregateHandler(c.Request.Context(), ownerKey, proxyType, members)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[AggregateProxy] Error: %v", err))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "message": "Aggregate handler unavailable: " + err.Error()})
+		return
+	}
+
+	// Resolve the target service of a namespaced tools/call so RPD limits and statistics stay per service
+	var statService *model.MCPService
+	var rpc jsonRPCRequestInfo
+	if c.Request.Method == http.MethodPost && (action == "/message" || action == "/mcp") {
+		rpc = peekJSONRPCRequest(c)
+		if tool, found := aggregateTools[rpc.ToolName]; found {
+			for _, m := range members {
+				if m.Service.ID == tool.ServiceID {
+					statService = m.Service
+					rpc.ToolName = tool.UpstreamName
+					break
+				}
+			}
+		}
+	}
+
+	if rpc.Method == "" {
+		if c.Request.Method == http.MethodGet && action == "/sse" {
+			// The SSE stream carries the responses to calls POSTed to /message
+			serveSSEStream(c, targetHandler)
+			return
+		}
+		targetHandler.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	if statService == nil {
+		serveJSONRPCRequest(c, targetHandler, proxy.AggregateServiceName, nil, userID, requestType, rpc)
+		return
+	}
+
+	if statService.RPDLimit > 0 {
+		if rpdErr := checkDailyRequestLimit(statService.ID, userID, statService.RPDLimit); rpdErr != nil {
+			common.SysLog(fmt.Sprintf("[RPD] User %d exceeded limit for %s via aggregate endpoint: %v", userID, statService.Name, rpdErr))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"success":    false,
+				"message":    rpdErr.Error(),
+				"error_code": "DAILY_LIMIT_EXCEEDED",
+			})
+			return
+		}
+	}
+
+	serveJSONRPCRequest(c, targetHandler, statService.Name, statService, userID, requestType, rpc)
+}
@@ -71,44 +71,175 @@ func getTodayTotalRequestCountFromCache() (int64, error) {
 	return totalCount, nil
 }
 
-// getTodayAverageLatencyFromDB calculates today's average latency from database records
+// getTodayAverageLatencyFromDB calculates today's average latency from the hourly stat rollups
 func getTodayAverageLatencyFromDB() (float64, error) {
-	statThing, err := model.GetProxyRequestStatThing()
+	now := time.Now()
+	startOfDay := model.StartOfStatDay(now)
+	rollups, err := model.QueryStatRollups(model.StatGranularityHour, startOfDay, startOfDay.AddDate(0, 0, 1), 0)
 	if err != nil {
-		return 0, fmt.Errorf("error accessing statistics data store: %v", err)
+		return 0, fmt.Errorf("error fetching today's statistics: %v", err)
 	}
 
-	// Get today's date range
-	today := time.Now()
-	startOfDay := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour)
+	var summary model.RollupSummary
+	for _, rollup := range rollups {
+		summary.Add(rollup)
+	}
+	return summary.AvgLatencyMs(), nil
+}
 
-	// Fetch today's stats
-	todayStats, err := statThing.Where("created_at >= ? AND created_at < ?", startOfDay, endOfDay).All()
-	if err != nil {
-		return 0, fmt.Errorf("error fetching today's statistics: %v", err)
+// statsTimeRanges are the time_range values accepted by the analytics endpoints
+var statsTimeRanges = map[string]time.Duration{
+	"last_1h":  time.Hour,
+	"last_24h": 24 * time.Hour,
+	"last_7d":  7 * 24 * time.Hour,
+	"last_30d": 30 * 24 * time.Hour,
+	"last_90d": 90 * 24 * time.Hour,
+}
+
+// statsWindow is the bucket-aligned window [From, To) an analytics query covers
+type statsWindow struct {
+	TimeRange   string
+	Granularity model.StatGranularity
+	From        time.Time
+	To          time.Time
+}
+
+// parseStatsWindow resolves time_range (default last_24h) and granularity (default hour up to 7 days, day beyond)
+// into a window aligned to bucket boundaries, whose last bucket is the current hour or day.
+func parseStatsWindow(timeRange, granularity string, now time.Time) (statsWindow, bool) {
+	if timeRange == "" {
+		timeRange = "last_24h"
+	}
+	length, ok := statsTimeRanges[timeRange]
+	if !ok {
+		return statsWindow{}, false
+	}
+	window := statsWindow{TimeRange: timeRange}
+	switch model.StatGranularity(granularity) {
+	case model.StatGranularityHour, model.StatGranularityDay:
+		window.Granularity = model.StatGranularity(granularity)
+	case "":
+		window.Granularity = model.StatGranularityHour
+		if length > 7*24*time.Hour {
+			window.Granularity = model.StatGranularityDay
+		}
+	default:
+		return statsWindow{}, false
 	}
 
-	if len(todayStats) == 0 {
-		return 0, nil
+	if window.Granularity == model.StatGranularityHour {
+		window.To = now.Truncate(time.Hour).Add(time.Hour)
+		window.From = window.To.Add(-length)
+	} else {
+		window.To = model.StartOfStatDay(now).AddDate(0, 0, 1)
+		days := int(length / (24 * time.Hour))
+		if days < 1 {
+			days = 1
+		}
+		window.From = window.To.AddDate(0, 0, -days)
 	}
+	return window, true
+}
 
-	var totalLatency int64 = 0
-	for _, stat := range todayStats {
-		totalLatency += stat.ResponseTimeMs
+// toolMetrics is the per-tool breakdown returned by GetServiceMetrics
+type toolMetrics struct {
+	ToolName            string  `json:"tool_name"`
+	TotalRequests       int64   `json:"total_requests"`
+	SuccessfulRequests  int64   `json:"successful_requests"`
+	ErrorRatePercentage float64 `json:"error_rate_percentage"`
+	JSONRPCErrors       int64   `json:"jsonrpc_errors"` // Responses carrying a JSON-RPC error
+	ToolErrors          int64   `json:"tool_errors"`    // Results with isError set
+	LatencyP50Ms        int64   `json:"latency_p50_ms"`
+	LatencyP95Ms        int64   `json:"latency_p95_ms"`
+	LatencyP99Ms        int64   `json:"latency_p99_ms"`
+	AvgRequestBytes     float64 `json:"avg_request_bytes"`
+	AvgResponseBytes    float64 `json:"avg_response_bytes"`
+}
+
+// buildToolMetrics merges rollups by tool name, slowest p95 first.
+// Records without a tool name (other methods, or written before tool names were tracked) are left out.
+func buildToolMetrics(rollups []*model.ProxyStatRollup) []toolMetrics {
+	byTool := make(map[string]*model.RollupSummary)
+	for _, rollup := range rollups {
+		if rollup.ToolName == "" {
+			continue
+		}
+		summary, ok := byTool[rollup.ToolName]
+		if !ok {
+			summary = &model.RollupSummary{}
+			byTool[rollup.ToolName] = summary
+		}
+		summary.Add(rollup)
 	}
 
-	return float64(totalLatency) / float64(len(todayStats)), nil
+	result := make([]toolMetrics, 0, len(byTool))
+	for toolName, summary := range byTool {
+		result = append(result, toolMetrics{
+			ToolName:            toolName,
+			TotalRequests:       summary.Count,
+			SuccessfulRequests:  summary.Count - summary.ErrorCount,
+			ErrorRatePercentage: summary.ErrorRatePercentage(),
+			JSONRPCErrors:       summary.JSONRPCErrors,
+			ToolErrors:          summary.ToolErrors,
+			LatencyP50Ms:        summary.LatencyPercentileMs(0.50),
+			LatencyP95Ms:        summary.LatencyPercentileMs(0.95),
+			LatencyP99Ms:        summary.LatencyPercentileMs(0.99),
+			AvgRequestBytes:     float64(summary.RequestBytes) / float64(summary.Count),
+			AvgResponseBytes:    float64(summary.ResponseBytes) / float64(summary.Count),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].LatencyP95Ms != result[j].LatencyP95Ms {
+			return result[i].LatencyP95Ms > result[j].LatencyP95Ms
+		}
+		return result[i].ToolName < result[j].ToolName
+	})
+	return result
+}
+
+// buildRequestsOverTime merges rollups into one point per bucket of the window, including empty buckets
+func buildRequestsOverTime(window statsWindow, rollups []*model.ProxyStatRollup) []map[string]interface{} {
+	byBucket := make(map[int64]*model.RollupSummary)
+	for _, rollup := range rollups {
+		key := rollup.BucketStart.Unix()
+		if byBucket[key] == nil {
+			byBucket[key] = &model.RollupSummary{}
+		}
+		byBucket[key].Add(rollup)
+	}
+
+	var points []map[string]interface{}
+	for bucket := window.From; bucket.Before(window.To); {
+		summary := byBucket[bucket.Unix()]
+		if summary == nil {
+			summary = &model.RollupSummary{}
+		}
+		points = append(points, map[string]interface{}{
+			"timestamp":      bucket,
+			"count":          summary.Count,
+			"error_count":    summary.ErrorCount,
+			"avg_latency_ms": summary.AvgLatencyMs(),
+			"latency_p95_ms": summary.LatencyPercentileMs(0.95),
+		})
+		if window.Granularity == model.StatGranularityHour {
+			bucket = bucket.Add(time.Hour)
+		} else {
+			bucket = bucket.AddDate(0, 0, 1)
+		}
+	}
+	return points
 }
 
 // GetServiceUtilization godoc
 // @Summary 获取服务使用统计
-// @Description 获取所有MCP服务的汇总使用统计数据，包括今日请求数和今日平均延迟等。
+// @Description 获取所有MCP服务的汇总使用统计数据，包括今日请求数、今日平均延迟，以及指定时间范围内的请求数、错误率和延迟。
 // @Tags Analytics
 // @Accept json
 // @Produce json
+// @Param time_range query string false "时间范围 (last_1h, last_24h, last_7d, last_30d, last_90d)，默认 last_24h"
 // @Security ApiKeyAuth
 // @Success 200 {object} common.APIResponse{data=[]map[string]interface{}} "返回服务使用统计列表"
+// @Failure 400 {object} common.APIResponse "无效的参数"
 // @Failure 500 {object} common.APIResponse "服务器内部错误"
 // @Router /api/analytics/services/utilization [get]
 func GetServiceUtilization(c *gin.Context) {
@@ -125,16 +256,37 @@ func GetServiceUtilization(c *gin.Context) {
 		return
 	}
 
-	// Get today's date range for DB queries
-	today := time.Now()
-	startOfDay := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour)
-
-	statThing, err := model.GetProxyRequestStatThing()
+	// Today's latency and the requested window are both served from rollups, one query each
+	window, ok := parseStatsWindow(c.Query("time_range"), "", time.Now())
+	if !ok {
+		common.RespErrorStr(c, http.StatusBadRequest, fmt.Sprintf("%s: invalid time_range", i18n.Translate("invalid_input", c.GetString("lang"))))
+		return
+	}
+	startOfDay := model.StartOfStatDay(time.Now())
+	todayRollups, err := model.QueryStatRollups(model.StatGranularityHour, startOfDay, startOfDay.AddDate(0, 0, 1), 0)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, "Error fetching today's statistics", err)
+		return
+	}
+	rangeRollups, err := model.QueryStatRollups(window.Granularity, window.From, window.To, 0)
 	if err != nil {
-		common.RespError(c, http.StatusInternalServerError, "Error accessing statistics data store", err)
+		common.RespError(c, http.StatusInternalServerError, "Error fetching statistics", err)
 		return
 	}
+	todayByService := make(map[int64]*model.RollupSummary)
+	for _, rollup := range todayRollups {
+		if todayByService[rollup.ServiceID] == nil {
+			todayByService[rollup.ServiceID] = &model.RollupSummary{}
+		}
+		todayByService[rollup.ServiceID].Add(rollup)
+	}
+	rangeByService := make(map[int64]*model.RollupSummary)
+	for _, rollup := range rangeRollups {
+		if rangeByService[rollup.ServiceID] == nil {
+			rangeByService[rollup.ServiceID] = &model.RollupSummary{}
+		}
+		rangeByService[rollup.ServiceID].Add(rollup)
+	}
 
 	resultStats := make([]map[string]interface{}, 0, len(allServices))
 
@@ -146,26 +298,27 @@ func GetServiceUtilization(c *gin.Context) {
 			todayRequestCount = 0
 		}
 
-		// Get today's average latency from database
-		todayStats, err := statThing.Where("service_id = ? AND created_at >= ? AND created_at < ?", service.ID, startOfDay, endOfDay).All()
-		var todayAvgLatency float64 = 0
-		if err != nil {
-			common.SysError(fmt.Sprintf("Error fetching today's stats for service %s (ID: %d): %v", service.Name, service.ID, err))
-		} else if len(todayStats) > 0 {
-			var totalLatency int64 = 0
-			for _, stat := range todayStats {
-				totalLatency += stat.ResponseTimeMs
-			}
-			todayAvgLatency = float64(totalLatency) / float64(len(todayStats))
+		today := todayByService[service.ID]
+		if today == nil {
+			today = &model.RollupSummary{}
+		}
+		inRange := rangeByService[service.ID]
+		if inRange == nil {
+			inRange = &model.RollupSummary{}
 		}
 
 		resultStats = append(resultStats, map[string]interface{}{
-			"service_id":           service.ID,
-			"service_name":         service.Name,
-			"display_name":         service.DisplayName,
-			"enabled":              service.Enabled,
-			"today_request_count":  todayRequestCount,
-			"today_avg_latency_ms": todayAvgLatency,
+			"service_id":            service.ID,
+			"service_name":          service.Name,
+			"display_name":          service.DisplayName,
+			"enabled":               service.Enabled,
+			"today_request_count":   todayRequestCount,
+			"today_avg_latency_ms":  today.AvgLatencyMs(),
+			"time_range":            window.TimeRange,
+			"request_count":         inRange.Count,
+			"error_rate_percentage": inRange.ErrorRatePercentage(),
+			"avg_latency_ms":        inRange.AvgLatencyMs(),
+			"latency_p95_ms":        inRange.LatencyPercentileMs(0.95),
 		})
 	}
 
@@ -179,12 +332,13 @@ func GetServiceUtilization(c *gin.Context) {
 
 // GetServiceMetrics godoc
 // @Summary 获取单个服务的详细性能指标
-// @Description 获取指定MCP服务的详细性能指标，例如随时间变化的请求数、延迟分布等。
+// @Description 获取指定MCP服务的详细性能指标，例如按小时或按天汇总的请求数、延迟分布（p50/p95/p99）以及按工具划分的请求数、错误率和延迟。
 // @Tags Analytics
 // @Accept json
 // @Produce json
 // @Param service_id query string true "服务ID"
-// @Param time_range query string false "时间范围 (e.g., last_24h, last_7d, last_30d)"
+// @Param time_range query string false "时间范围 (last_1h, last_24h, last_7d, last_30d, last_90d)，默认 last_24h"
+// @Param granularity query string false "汇总粒度 (hour, day)，7 天以内默认 hour，否则 day"
 // @Security ApiKeyAuth
 // @Success 200 {object} common.APIResponse{data=map[string]interface{}} "返回服务的详细性能指标"
 // @Failure 400 {object} common.APIResponse "无效的参数"
@@ -194,7 +348,6 @@ func GetServiceUtilization(c *gin.Context) {
 func GetServiceMetrics(c *gin.Context) {
 	lang := c.GetString("lang") // lang is used here for error messages
 	serviceIDStr := c.Query("service_id")
-	// timeRange := c.Query("time_range") // Placeholder for time range filtering
 
 	if serviceIDStr == "" {
 		common.RespErrorStr(c, http.StatusBadRequest, fmt.Sprintf("%s: service_id is required", i18n.Translate("invalid_service_id", lang)))
@@ -207,6 +360,12 @@ func GetServiceMetrics(c *gin.Context) {
 		return
 	}
 
+	window, ok := parseStatsWindow(c.Query("time_range"), c.Query("granularity"), time.Now())
+	if !ok {
+		common.RespErrorStr(c, http.StatusBadRequest, fmt.Sprintf("%s: invalid time_range or granularity", i18n.Translate("invalid_input", lang)))
+		return
+	}
+
 	// Fetch service details to get the name
 	mcpService, err := model.GetServiceByID(serviceID)
 	if err != nil {
@@ -215,63 +374,31 @@ func GetServiceMetrics(c *gin.Context) {
 		return
 	}
 
-	statThing, err := model.GetProxyRequestStatThing()
-	if err != nil {
-		common.RespError(c, http.StatusInternalServerError, "Error accessing statistics data store", err)
-		return
-	}
-
-	// Fetch stats for the specific service
-	// For production, consider time range filtering and ordering (e.g., by CreatedAt DESC)
-	serviceStats, err := statThing.Where("service_id = ?", serviceID).All()
+	rollups, err := model.QueryStatRollups(window.Granularity, window.From, window.To, serviceID)
 	if err != nil {
 		common.RespError(c, http.StatusInternalServerError, fmt.Sprintf("Error fetching statistics for service %s", serviceIDStr), err)
 		return
 	}
 
-	requestsOverTime := make([]map[string]interface{}, 0, len(serviceStats))
-	var latencies []int64
-	totalRequests := int64(0)
-	successfulRequests := int64(0)
-
-	for _, stat := range serviceStats {
-		requestsOverTime = append(requestsOverTime, map[string]interface{}{
-			"timestamp":  stat.CreatedAt, // Assuming CreatedAt from BaseModel is the request time
-			"count":      1,              // Each record is one request for now; can be aggregated later
-			"success":    stat.Success,
-			"latency_ms": stat.ResponseTimeMs,
-		})
-		latencies = append(latencies, stat.ResponseTimeMs)
-		totalRequests++
-		if stat.Success {
-			successfulRequests++
-		}
-	}
-
-	// Sort latencies to calculate P95
-	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
-	latencyP95Ms := int64(0)
-	if len(latencies) > 0 {
-		indexP95 := int(float64(len(latencies)) * 0.95)
-		if indexP95 >= len(latencies) {
-			indexP95 = len(latencies) - 1
-		}
-		latencyP95Ms = latencies[indexP95]
-	}
-
-	errorRatePercentage := float64(0)
-	if totalRequests > 0 {
-		errorRatePercentage = (float64(totalRequests-successfulRequests) / float64(totalRequests)) * 100
+	var summary model.RollupSummary
+	for _, rollup := range rollups {
+		summary.Add(rollup)
 	}
 
 	metrics := map[string]interface{}{
 		"service_id":            serviceIDStr,
 		"service_name":          mcpService.DisplayName, // Using DisplayName from MCPService
-		"requests_over_time":    requestsOverTime,       // This is a raw list of requests
-		"latency_p95_ms":        latencyP95Ms,
-		"error_rate_percentage": errorRatePercentage,
-		"total_requests":        totalRequests,
-		"successful_requests":   successfulRequests,
+		"time_range":            window.TimeRange,
+		"granularity":           window.Granularity,
+		"requests_over_time":    buildRequestsOverTime(window, rollups),
+		"avg_latency_ms":        summary.AvgLatencyMs(),
+		"latency_p50_ms":        summary.LatencyPercentileMs(0.50),
+		"latency_p95_ms":        summary.LatencyPercentileMs(0.95),
+		"latency_p99_ms":        summary.LatencyPercentileMs(0.99),
+		"error_rate_percentage": summary.ErrorRatePercentage(),
+		"total_requests":        summary.Count,
+		"successful_requests":   summary.Count - summary.ErrorCount,
+		"tools":                 buildToolMetrics(rollups),
 	}
 
 	common.RespSuccess(c, metrics)
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildToolMetrics(t *testing.T) {
+	cleanup := setupTestEnvironmentForProxyHandler()
+	defer cleanup()
+
+	statThing, err := model.GetProxyRequestStatThing()
+	require.NoError(t, err)
+	stats := []*model.ProxyRequestStat{
+		{Method: "tools/call", ToolName: "search", ResponseTimeMs: 10, Success: true, RequestBytes: 100, ResponseBytes: 1000},
+		{Method: "tools/call", ToolName: "search", ResponseTimeMs: 30, Success: true, RequestBytes: 100, ResponseBytes: 3000},
+		{Method: "tools/call", ToolName: "search", ResponseTimeMs: 20, Success: false, ToolIsError: true, RequestBytes: 100},
+		{Method: "tools/call", ToolName: "deploy", ResponseTimeMs: 900, Success: false, JSONRPCError: -32603},
+		{Method: "initialize", ResponseTimeMs: 5000, Success: true},
+	}
+	for _, stat := range stats {
+		stat.ServiceID = 1
+		require.NoError(t, statThing.Save(stat))
+	}
+
+	window, ok := parseStatsWindow("last_24h", "", time.Now())
+	require.True(t, ok)
+	rollups, err := model.QueryStatRollups(window.Granularity, window.From, window.To, 1)
+	require.NoError(t, err)
+
+	tools := buildToolMetrics(rollups)
+	require.Len(t, tools, 2)
+
+	assert.Equal(t, "deploy", tools[0].ToolName, "slowest tool first")
+	assert.Equal(t, int64(1), tools[0].JSONRPCErrors)
+	assert.Equal(t, float64(100), tools[0].ErrorRatePercentage)
+	assert.Equal(t, int64(900), tools[0].LatencyP95Ms, "capped at the observed maximum")
+
+	search := tools[1]
+	assert.Equal(t, int64(3), search.TotalRequests)
+	assert.Equal(t, int64(1), search.ToolErrors)
+	assert.InDelta(t, 33.33, search.ErrorRatePercentage, 0.01)
+	assert.Equal(t, int64(25), search.LatencyP50Ms, "upper bound of the histogram bucket")
+	assert.Equal(t, int64(30), search.LatencyP99Ms)
+	assert.Equal(t, float64(100), search.AvgRequestBytes)
+	assert.Equal(t, float64(4000)/3, search.AvgResponseBytes)
+
+	points := buildRequestsOverTime(window, rollups)
+	require.Len(t, points, 24, "one point per hour, including empty hours")
+	var count, errorCount int64
+	for _, point := range points {
+		count += point["count"].(int64)
+		errorCount += point["error_count"].(int64)
+	}
+	assert.Equal(t, int64(5), count)
+	assert.Equal(t, int64(2), errorCount)
+}
+
+func TestParseStatsWindow(t *testing.T) {
+	now := time.Date(2025, 3, 10, 14, 25, 0, 0, time.Local)
+
+	window, ok := parseStatsWindow("", "", now)
+	require.True(t, ok)
+	assert.Equal(t, "last_24h", window.TimeRange)
+	assert.Equal(t, model.StatGranularityHour, window.Granularity)
+	assert.Equal(t, now.Truncate(time.Hour).Add(time.Hour), window.To)
+	assert.Equal(t, 24*time.Hour, window.To.Sub(window.From))
+
+	window, ok = parseStatsWindow("last_30d", "", now)
+	require.True(t, ok)
+	assert.Equal(t, model.StatGranularityDay, window.Granularity)
+	assert.Equal(t, time.Date(2025, 3, 11, 0, 0, 0, 0, time.Local), window.To)
+	assert.Equal(t, time.Date(2025, 2, 9, 0, 0, 0, 0, time.Local), window.From)
+
+	_, ok = parseStatsWindow("last_year", "", now)
+	assert.False(t, ok)
+	_, ok = parseStatsWindow("last_7d", "minute", now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKeyRequest is the request body for creating a named API key
+type CreateAPIKeyRequest struct {
+	Name              string  `json:"name" binding:"required"`
+	ExpiresInDays     int     `json:"expires_in_days"`     // 0 means the key never expires
+	AllowedServiceIDs []int64 `json:"allowed_service_ids"` // Empty means all services
+	ReadOnly          bool    `json:"read_only"`
+}
+
+// ListAPIKeys godoc
+// @Summary 获取当前用户的 API Key 列表
+// @Description 返回当前用户的所有命名 API Key（不包含明文）
+// @Tags API Keys
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/user/api_keys [get]
+func ListAPIKeys(c *gin.Context) {
+	lang := c.GetString("lang")
+	userID := getUserIDFromContext(c)
+
+	keys, err := model.GetAPIKeysByUser(userID)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_api_keys_failed", lang), err)
+		return
+	}
+	common.RespSuccess(c, keys)
+}
+
+// CreateAPIKey godoc
+// @Summary 创建 API Key
+// @Description 为当前用户创建命名 API Key，可设置过期时间、服务范围和只读标志。明文 Key 仅在创建时返回一次
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param body body CreateAPIKeyRequest true "API Key 信息"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/user/api_keys [post]
+func CreateAPIKey(c *gin.Context) {
+	lang := c.GetString("lang")
+	userID := getUserIDFromContext(c)
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+		return
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresInDays > 0 {
+		expiresAt = time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+	}
+
+	apiKey, plaintext, err := model.CreateAPIKey(userID, req.Name, expiresAt, req.AllowedServiceIDs, req.ReadOnly)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("create_api_key_failed", lang), err)
+		return
+	}
+
+	common.RespSuccess(c, gin.H{
+		"api_key": apiKey,
+		"key":     plaintext,
+	})
+}
+
+// RevokeAPIKey godoc
+// @Summary 吊销 API Key
+// @Description 删除当前用户的指定 API Key，不影响其他 Key
+// @Tags API Keys
+// @Produce json
+// @Param id path int true "API Key ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/user/api_keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	lang := c.GetString("lang")
+	userID := getUserIDFromContext(c)
+
+	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+		return
+	}
+	if err := model.RevokeAPIKey(userID, keyID); err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("api_key_not_found", lang), err)
+		return
+	}
+	common.RespSuccessStr(c, i18n.Translate("api_key_revoked", lang))
+}
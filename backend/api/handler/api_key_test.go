@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAPIKey_ReturnsPlaintextOnceAndValidates(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", int64(1)) // root user created by InitDB
+		c.Next()
+	})
+	r.POST("/api/user/api_keys", CreateAPIKey)
+	r.GET("/api/user/api_keys", ListAPIKeys)
+
+	w := httptest.NewRecorder()
+	body := `{"name":"laptop","allowed_service_ids":[3],"read_only":true}`
+	req, _ := http.NewRequest("POST", "/api/user/api_keys", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Key string `json:"key"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Success)
+	assert.True(t, strings.HasPrefix(resp.Data.Key, model.APIKeyPrefix))
+
+	apiKey, user := model.ValidateAPIKey(resp.Data.Key)
+	if assert.NotNil(t, apiKey) && assert.NotNil(t, user) {
+		assert.Equal(t, int64(1), user.ID)
+		assert.True(t, apiKey.ReadOnly)
+		assert.True(t, apiKey.AllowsService(3))
+		assert.False(t, apiKey.AllowsService(4))
+		assert.False(t, apiKey.LastUsedAt.IsZero())
+	}
+
+	// The listing never exposes the plaintext key
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/user/api_keys", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), resp.Data.Key)
+}
+
+func TestValidateAPIKey_RejectsExpiredKey(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+
+	_, plaintext, err := model.CreateAPIKey(1, "expired", time.Now().Add(-time.Hour), nil, false)
+	assert.NoError(t, err)
+
+	apiKey, user := model.ValidateAPIKey(plaintext)
+	assert.Nil(t, apiKey)
+	assert.Nil(t, user)
+}
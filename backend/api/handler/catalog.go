@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/market"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CatalogItem is a catalog entry with whether it is installed
+type CatalogItem struct {
+	ID int64 `json:"id"`
+	model.CatalogTemplate
+	IsInstalled        bool   `json:"is_installed"`
+	InstalledServiceID *int64 `json:"installed_service_id,omitempty"`
+}
+
+// ListCatalog godoc
+// @Summary 获取推荐目录
+// @Description 获取管理员审核过的服务模板及其安装状态。普通用户看不到隐藏的条目，管理员可用 include_hidden=true 获取全部条目
+// @Tags Market
+// @Produce json
+// @Param include_hidden query bool false "是否包含隐藏条目（仅管理员）"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/mcp_market/catalog [get]
+func ListCatalog(c *gin.Context) {
+	lang := c.GetString("lang")
+	includeHidden := c.Query("include_hidden") == "true" && c.GetInt("role") >= common.RoleAdminUser
+
+	entries, err := model.GetCatalogEntries(includeHidden)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_catalog_failed", lang), err)
+		return
+	}
+	installed, err := market.GetInstalledMCPServersFromDB()
+	if err != nil {
+		common.SysError("ListCatalog: Error fetching installed server IDs: " + err.Error())
+	}
+
+	items := make([]CatalogItem, 0, len(entries))
+	for _, entry := range entries {
+		template, err := entry.Template()
+		if err != nil {
+			common.SysError(err.Error())
+			continue
+		}
+		item := CatalogItem{ID: entry.ID, CatalogTemplate: template}
+		_, packageName := template.InstallTarget()
+		if id, ok := installed[packageName]; ok {
+			item.IsInstalled = true
+			item.InstalledServiceID = &id
+		}
+		items = append(items, item)
+	}
+	common.RespSuccess(c, items)
+}
+
+// CreateCatalogEntry godoc
+// @Summary 创建推荐目录条目
+// @Tags Catalog
+// @Accept json
+// @Produce json
+// @Param entry body model.CatalogTemplate true "服务模板"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 409 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/catalog [post]
+func CreateCatalogEntry(c *gin.Context) {
+	lang := c.GetString("lang")
+
+	var template model.CatalogTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	saveCatalogEntry(c, &model.CatalogEntry{}, template)
+}
+
+// UpdateCatalogEntry godoc
+// @Summary 更新推荐目录条目
+// @Tags Catalog
+// @Accept json
+// @Produce json
+// @Param id path int true "条目ID"
+// @Param entry body model.CatalogTemplate true "服务模板"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 409 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/catalog/{id} [put]
+func UpdateCatalogEntry(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+		return
+	}
+	entry, err := model.GetCatalogEntryByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("catalog_entry_not_found", lang), err)
+		return
+	}
+
+	var template model.CatalogTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	// Copy the fetched entry so the cached one is not changed if the update is rejected
+	updated := *entry
+	saveCatalogEntry(c, &updated, template)
+}
+
+// saveCatalogEntry validates a template and stores it in the entry, shared by create and update.
+func saveCatalogEntry(c *gin.Context, entry *model.CatalogEntry, template model.CatalogTemplate) {
+	lang := c.GetString("lang")
+
+	if err := template.Validate(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_catalog_entry", lang), err)
+		return
+	}
+	if existing, err := model.GetCatalogEntryByName(template.Name); err == nil && existing != nil && existing.ID != entry.ID {
+		common.RespErrorStr(c, http.StatusConflict, i18n.Translate("catalog_entry_name_exists", lang, template.Name))
+		return
+	}
+	if err := entry.SetTemplate(template); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_catalog_entry", lang), err)
+		return
+	}
+	if err := model.SaveCatalogEntry(entry); err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("save_catalog_entry_failed", lang), err)
+		return
+	}
+	common.RespSuccess(c, CatalogItem{ID: entry.ID, CatalogTemplate: template})
+}
+
+// DeleteCatalogEntry godoc
+// @Summary 删除推荐目录条目
+// @Description 只删除目录条目，已安装的服务不受影响
+// @Tags Catalog
+// @Produce json
+// @Param id path int true "条目ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/catalog/{id} [delete]
+func DeleteCatalogEntry(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+		return
+	}
+	if err := model.DeleteCatalogEntry(id); err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("catalog_entry_not_found", lang), err)
+		return
+	}
+	common.RespSuccessStr(c, i18n.Translate("catalog_entry_deleted", lang))
+}
+
+// ExportCatalog godoc
+// @Summary 导出推荐目录
+// @Description 导出全部条目（包括隐藏条目），可导入到其他 one-mcp 实例
+// @Tags Catalog
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} model.CatalogFile
+// @Failure 500 {object} common.APIResponse
+// @Router /api/catalog/export [get]
+func ExportCatalog(c *gin.Context) {
+	lang := c.GetString("lang")
+
+	file, err := model.ExportCatalog()
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_catalog_failed", lang), err)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="one-mcp-catalog.json"`)
+	c.JSON(http.StatusOK, file)
+}
+
+// ImportCatalog godoc
+// @Summary 导入推荐目录
+// @Description 导入导出的目录文件，按名称更新已有条目。replace=true 时删除文件中没有的条目。任一条目无效时不做任何修改
+// @Tags Catalog
+// @Accept json
+// @Produce json
+// @Param file body model.CatalogFile true "目录文件"
+// @Param replace query bool false "是否删除文件中没有的条目"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Router /api/catalog/import [post]
+func ImportCatalog(c *gin.Context) {
+	lang := c.GetString("lang")
+
+	var file model.CatalogFile
+	if err := c.ShouldBindJSON(&file); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	result, err := model.ImportCatalog(&file, c.Query("replace") == "true")
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("import_catalog_failed", lang), err)
+		return
+	}
+	common.RespSuccess(c, result)
+}
+
+// catalogTemplateByName returns the template of a catalog entry the caller may see, responding with an error
+// otherwise
+func catalogTemplateByName(c *gin.Context, name string) (model.CatalogTemplate, bool) {
+	lang := c.GetString("lang")
+
+	entry, err := model.GetCatalogEntryByName(name)
+	if err != nil || (entry.Hidden && c.GetInt("role") < common.RoleAdminUser) {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("catalog_entry_not_found", lang), err)
+		return model.CatalogTemplate{}, false
+	}
+	template, err := entry.Template()
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_catalog_failed", lang), err)
+		return model.CatalogTemplate{}, false
+	}
+	return template, true
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/model"
+	"one-mcp/backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientConfigVariant is the exported configuration of one MCP client
+type ClientConfigVariant struct {
+	Client service.ClientType     `json:"client"`
+	File   string                 `json:"file"`   // Where the client reads its configuration
+	Config map[string]interface{} `json:"config"` // Ready to paste into the file
+}
+
+// ExportClientConfigRequest selects the clients, services and credential of an export
+type ExportClientConfigRequest struct {
+	Client        string   `json:"client"`          // Empty exports every client type
+	Services      []string `json:"services"`        // Empty exports every enabled service the user may use
+	Aggregate     bool     `json:"aggregate"`       // Export the single /proxy/_all/mcp endpoint
+	APIKey        string   `json:"api_key"`         // Existing omk_ key of the user to embed; empty issues a new key
+	ReadOnly      bool     `json:"read_only"`       // Issue the new key as read-only
+	ExpiresInDays int      `json:"expires_in_days"` // 0 means the issued key never expires
+}
+
+// ExportClientConfig godoc
+// @Summary 导出 MCP 客户端配置
+// @Description 为当前用户生成可直接粘贴的客户端配置（Claude Desktop、Cursor、VS Code、Windsurf 或通用 streamable HTTP），指向 one-mcp 的代理地址。
+// @Description 配置中的凭据是 API Key：传入 api_key 时引用用户已有的 Key，否则签发一个仅限所选服务的新 Key（可设为只读和过期时间），明文仅在本次响应中返回。
+// @Description 不指定 client 时返回所有客户端的配置；services 默认导出用户可用的全部已启用服务；aggregate=true 时导出单个聚合端点 /proxy/_all/mcp
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param body body ExportClientConfigRequest true "导出选项"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/user/client_config [post]
+func ExportClientConfig(c *gin.Context) {
+	lang := c.GetString("lang")
+	userID := getUserIDFromContext(c)
+
+	var req ExportClientConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang))
+		return
+	}
+
+	clients := service.ClientTypes
+	if client := service.ClientType(req.Client); client != "" {
+		if service.ClientConfigFile(client) == "" {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("unsupported_client_type", lang, string(client)))
+			return
+		}
+		clients = []service.ClientType{client}
+	}
+
+	user, err := model.GetUserById(userID, false)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, "Failed to get user info", err)
+		return
+	}
+
+	serverAddress := service.OAuthIssuer(c.Request)
+	var endpoints []service.ProxyEndpoint
+	var serviceIDs []int64 // Scope of an issued key, empty for the aggregate endpoint
+	if req.Aggregate {
+		endpoints = []service.ProxyEndpoint{service.NewProxyEndpoint(serverAddress, nil)}
+	} else {
+		services, unknown, err := exportableServices(req.Services, user.Role)
+		if err != nil {
+			common.RespError(c, http.StatusInternalServerError, i18n.Translate("export_client_config_failed", lang), err)
+			return
+		}
+		if unknown != "" {
+			common.RespErrorStr(c, http.StatusNotFound, i18n.Translate("service_not_found", lang)+": "+unknown)
+			return
+		}
+		for _, svc := range services {
+			endpoints = append(endpoints, service.NewProxyEndpoint(serverAddress, svc))
+			serviceIDs = append(serviceIDs, svc.ID)
+		}
+	}
+
+	key := req.APIKey
+	if key != "" {
+		apiKey, owner := model.ValidateAPIKey(key)
+		if apiKey == nil || owner.ID != userID {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("api_key_not_found", lang))
+			return
+		}
+	} else {
+		var expiresAt time.Time
+		if req.ExpiresInDays > 0 {
+			expiresAt = time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		}
+		name := "client-config " + time.Now().Format("2006-01-02 15:04")
+		if _, key, err = model.CreateAPIKey(userID, name, expiresAt, serviceIDs, req.ReadOnly); err != nil {
+			common.RespError(c, http.StatusInternalServerError, i18n.Translate("create_api_key_failed", lang), err)
+			return
+		}
+	}
+
+	variants := make([]ClientConfigVariant, 0, len(clients))
+	for _, client := range clients {
+		config, err := service.BuildClientConfig(client, endpoints, key)
+		if err != nil {
+			common.RespError(c, http.StatusInternalServerError, i18n.Translate("export_client_config_failed", lang), err)
+			return
+		}
+		variants = append(variants, ClientConfigVariant{Client: client, File: service.ClientConfigFile(client), Config: config})
+	}
+	common.RespSuccess(c, variants)
+}
+
+// exportableServices returns the enabled services the user may use, limited to the given names if any.
+// A requested name that is not among them is returned as unknown.
+func exportableServices(names []string, role int) (selected []*model.MCPService, unknown string, err error) {
+	services, err := model.GetEnabledServices()
+	if err != nil {
+		return nil, "", err
+	}
+	available := make(map[string]*model.MCPService, len(services))
+	var all []*model.MCPService
+	for _, svc := range services {
+		if svc.AdminOnly && role < common.RoleAdminUser {
+			continue
+		}
+		available[svc.Name] = svc
+		all = append(all, svc)
+	}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		svc, ok := available[name]
+		if !ok {
+			return nil, name, nil
+		}
+		selected = append(selected, svc)
+	}
+	if len(selected) == 0 {
+		return all, "", nil
+	}
+	return selected, "", nil
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportClientConfig(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+	common.OptionMap["ServerAddress"] = "https://mcp.example.com"
+
+	user := &model.User{Username: "exporter", Password: "exporter-password", Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+	require.NoError(t, user.Insert())
+	for _, svc := range []*model.MCPService{
+		{Name: "fetch", Type: model.ServiceTypeStdio, Command: "echo", Enabled: true},
+		{Name: "admin-tools", Type: model.ServiceTypeStdio, Command: "echo", Enabled: true, AdminOnly: true},
+		{Name: "custom", Type: model.ServiceTypeStreamableHTTP, Command: "https://upstream.example.com/mcp", Enabled: true,
+			ClientConfigTemplates: `{"cursor":{"template_string":"{\"url\":\"{{url}}?key={{key}}\",\"note\":\"{{name}}\"}"}}`},
+	} {
+		require.NoError(t, model.CreateService(svc))
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/user/client_config", func(c *gin.Context) { c.Set("user_id", user.ID) }, ExportClientConfig)
+	export := func(body string) (int, []ClientConfigVariant) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/user/client_config", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		var resp struct {
+			Data []ClientConfigVariant `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	code, variants := export(`{"read_only":true}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, variants, 5)
+	keys, err := model.GetAPIKeysByUser(user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1, "an export issues one API key")
+	assert.True(t, keys[0].ReadOnly)
+	fetch, err := model.GetServiceByName("fetch")
+	require.NoError(t, err)
+	admin, err := model.GetServiceByName("admin-tools")
+	require.NoError(t, err)
+	assert.True(t, keys[0].AllowsService(fetch.ID))
+	assert.False(t, keys[0].AllowsService(admin.ID), "the issued key is limited to the exported services")
+
+	byClient := map[string]string{}
+	for _, variant := range variants {
+		data, _ := json.Marshal(variant.Config)
+		byClient[string(variant.Client)] = string(data)
+	}
+	var entry struct {
+		Headers map[string]string `json:"headers"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(jsonField(t, byClient["vscode"], "servers", "fetch")), &entry))
+	key := strings.TrimPrefix(entry.Headers["Authorization"], "Bearer ")
+	require.True(t, strings.HasPrefix(key, model.APIKeyPrefix), "the export embeds an API key")
+	assert.True(t, keys[0].HasPlaintext(key))
+	if stored, err := model.GetUserById(user.ID, true); assert.NoError(t, err) && stored.Token != "" {
+		assert.NotContains(t, byClient["cursor"], stored.Token, "the legacy user token is not exported")
+	}
+
+	assert.NotContains(t, byClient["cursor"], "admin-tools", "admin-only services are not exported for common users")
+	assert.JSONEq(t, `{"command":"npx","args":["-y","mcp-remote","https://mcp.example.com/proxy/fetch/mcp","--header","Authorization:${ONE_MCP_AUTH_HEADER}"],"env":{"ONE_MCP_AUTH_HEADER":"Bearer `+key+`"}}`,
+		jsonField(t, byClient["claude_desktop"], "mcpServers", "fetch"))
+	assert.JSONEq(t, `{"serverUrl":"https://mcp.example.com/proxy/fetch/mcp","headers":{"Authorization":"Bearer `+key+`"}}`,
+		jsonField(t, byClient["windsurf"], "mcpServers", "fetch"))
+	// A service template replaces the generated entry
+	assert.JSONEq(t, `{"url":"https://mcp.example.com/proxy/custom/mcp?key=`+key+`","note":"custom"}`,
+		jsonField(t, byClient["cursor"], "mcpServers", "custom"))
+
+	// An existing key is referenced instead of issuing another one
+	code, variants = export(`{"client":"generic","aggregate":true,"api_key":"` + key + `"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, variants, 1)
+	data, _ := json.Marshal(variants[0].Config)
+	assert.JSONEq(t, `{"type":"streamableHttp","url":"https://mcp.example.com/proxy/_all/mcp","headers":{"Authorization":"Bearer `+key+`"}}`,
+		jsonField(t, string(data), "mcpServers", "one-mcp"))
+	keys, err = model.GetAPIKeysByUser(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	code, _ = export(`{"api_key":"omk_unknown"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = export(`{"services":["fetch","admin-tools"]}`)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = export(`{"client":"emacs"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// jsonField returns the JSON of a nested field of a JSON document
+func jsonField(t *testing.T, document string, path ...string) string {
+	var value interface{}
+	require.NoError(t, json.Unmarshal([]byte(document), &value))
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		require.True(t, ok, "%s is not an object", key)
+		value = object[key]
+	}
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	return string(data)
+}
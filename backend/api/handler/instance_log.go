@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+	"one-mcp/backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultInstanceLogPageSize = 200
+	maxInstanceLogPageSize     = 1000
+	instanceCrashLogsShown     = 5
+	instanceLogHeartbeat       = 30 * time.Second
+)
+
+// instanceCacheKeyFromRequest resolves the instance whose logs are requested: the user-specific instance
+// of the service if user_id is given, its global instance otherwise
+func instanceCacheKeyFromRequest(c *gin.Context) (string, error) {
+	serviceID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return "", err
+	}
+	if userIDStr := c.Query("user_id"); userIDStr != "" {
+		userID, err := strconv.ParseInt(userIDStr, 10, 64)
+		if err != nil || userID <= 0 {
+			return "", fmt.Errorf("invalid user_id: %s", userIDStr)
+		}
+		return proxy.UserInstanceCacheKey(userID, serviceID), nil
+	}
+	return proxy.GlobalInstanceCacheKey(serviceID), nil
+}
+
+// GetMCPServiceLogs godoc
+// @Summary 获取MCP实例的stderr日志
+// @Description 分页获取stdio服务实例写入stderr的日志（内存中保留最近的行），以及最近几次进程崩溃时保存的日志尾部。
+// @Description 默认返回最新的行；after_seq 向后翻页，before_seq 向前翻页
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param id path int true "服务ID"
+// @Param user_id query int false "用户ID，指定时返回该用户专属实例的日志"
+// @Param after_seq query int false "只返回序号大于该值的行"
+// @Param before_seq query int false "只返回序号小于该值的行"
+// @Param limit query int false "返回的最大行数，默认200，最大1000"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/logs [get]
+func GetMCPServiceLogs(c *gin.Context) {
+	lang := c.GetString("lang")
+	cacheKey, err := instanceCacheKeyFromRequest(c)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultInstanceLogPageSize)))
+	if err != nil || limit <= 0 {
+		limit = defaultInstanceLogPageSize
+	}
+	if limit > maxInstanceLogPageSize {
+		limit = maxInstanceLogPageSize
+	}
+
+	lines := make([]proxy.LogLine, 0)
+	if log, found := proxy.GetInstanceLog(cacheKey); found {
+		if afterSeq, err := strconv.ParseInt(c.Query("after_seq"), 10, 64); err == nil {
+			lines = log.Since(afterSeq, limit)
+		} else {
+			beforeSeq, _ := strconv.ParseInt(c.Query("before_seq"), 10, 64)
+			lines = log.Before(beforeSeq, limit)
+		}
+	}
+
+	crashes, err := model.GetInstanceCrashLogs(cacheKey, instanceCrashLogsShown)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_instance_logs_failed", lang), err)
+		return
+	}
+
+	common.RespSuccess(c, gin.H{
+		"cache_key": cacheKey,
+		"lines":     lines,
+		"crashes":   crashes,
+	})
+}
+
+// StreamMCPServiceLogs godoc
+// @Summary 实时订阅MCP实例的stderr日志
+// @Description 以SSE流的形式推送stdio服务实例写入stderr的日志。由于EventSource不支持自定义请求头，通过 token 查询参数认证（需要管理员权限）。
+// @Description 先推送 after_seq 之后（未指定时为最近100行）的已有日志，然后推送新的日志行
+// @Tags MCP Services
+// @Produce text/event-stream
+// @Param id path int true "服务ID"
+// @Param token query string true "JWT令牌"
+// @Param user_id query int false "用户ID，指定时订阅该用户专属实例的日志"
+// @Param after_seq query int false "从序号大于该值的行开始推送"
+// @Success 200 {string} string "SSE stream of log lines"
+// @Failure 400 {object} common.APIResponse
+// @Failure 401 {object} common.APIResponse
+// @Failure 403 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/logs/stream [get]
+func StreamMCPServiceLogs(c *gin.Context) {
+	lang := c.GetString("lang")
+
+	// Check authentication via query parameter since SSE doesn't support custom headers
+	claims, err := service.ValidateToken(c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid token"})
+		return
+	}
+	if claims.Role < common.RoleAdminUser {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "Admin access required"})
+		return
+	}
+
+	cacheKey, err := instanceCacheKeyFromRequest(c)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+		return
+	}
+
+	// Only instances that have been started keep a log; looking one up must not create it
+	log, found := proxy.GetInstanceLog(cacheKey)
+	if !found {
+		common.RespErrorStr(c, http.StatusNotFound, i18n.Translate("instance_not_found", lang))
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Streaming unsupported"})
+		return
+	}
+
+	// Subscribe before reading the backlog so no line falls in between
+	updates, unsubscribe := log.Subscribe()
+	defer unsubscribe()
+
+	// EventSource resends the id of the last event it received when it reconnects
+	afterSeqStr := c.Query("after_seq")
+	if afterSeqStr == "" {
+		afterSeqStr = c.GetHeader("Last-Event-ID")
+	}
+	var backlog []proxy.LogLine
+	if afterSeq, err := strconv.ParseInt(afterSeqStr, 10, 64); err == nil {
+		backlog = log.Since(afterSeq, maxInstanceLogPageSize)
+	} else {
+		backlog = log.Before(0, 100)
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.WriteHeader(http.StatusOK)
+
+	var lastSeq int64
+	writeLine := func(line proxy.LogLine) {
+		if line.Seq <= lastSeq {
+			return
+		}
+		lastSeq = line.Seq
+		data, err := json.Marshal(line)
+		if err != nil {
+			return
+		}
+		// SSE message format: "id: <seq>\nevent: log\ndata: <json_string>\n\n"
+		fmt.Fprintf(c.Writer, "id: %d\nevent: log\ndata: %s\n\n", line.Seq, data)
+	}
+	for _, line := range backlog {
+		writeLine(line)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(instanceLogHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case line := <-updates:
+			writeLine(line)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -227,7 +227,9 @@ func GetPackageDetails(c *gin.Context) {
 					}
 				}
 
-				// 3. 使用 finalEnvValues 更新 mcpConfig
+				// 3. 使用 finalEnvValues 更新 mcpConfig（密钥已脱敏）
+				serviceConfigOptions, _ := model.GetConfigOptionsForService(installedServiceID)
+				finalEnvValues = maskEnvVarsForResponse(finalEnvValues, secretEnvNames(installedService, serviceConfigOptions))
 				for serverKey, serverConf := range mcpConfig.MCPServers {
 					if serverConf.Env == nil {
 						serverConf.Env = make(map[string]string)
@@ -298,6 +300,81 @@ func GetPackageDetails(c *gin.Context) {
 		common.RespSuccess(c, response)
 		return
 
+	case model.PackageManagerCatalog:
+		template, ok := catalogTemplateByName(c, packageName)
+		if !ok {
+			return
+		}
+		response := map[string]interface{}{
+			"details": gin.H{
+				"name":        template.Name,
+				"description": template.Description,
+				"homepage":    template.Homepage,
+			},
+			"env_vars":     template.EnvVars,
+			"is_installed": false,
+			"template":     template,
+		}
+		installManager, installName := template.InstallTarget()
+		if services, err := model.GetServicesByPackageDetails(installManager, installName); err == nil && len(services) > 0 {
+			response["is_installed"] = true
+			response["installed_service_id"] = services[0].ID
+		}
+		common.RespSuccess(c, response)
+		return
+
+	case market.PackageManagerRegistry:
+		entry, err := market.GetRegistryServer(ctx, packageName)
+		if err != nil {
+			common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_registry_server_failed", lang), err)
+			return
+		}
+		server := entry.Server
+		// 环境变量直接取自 server.json 的声明，无需从 README 猜测
+		_, envVarDefinitions, err := server.ToMCPService()
+		if err != nil {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("registry_server_not_installable", lang, packageName))
+			return
+		}
+
+		repositoryURL := ""
+		stars := 0
+		if server.Repository != nil {
+			repositoryURL = server.Repository.URL
+			if owner, repo := market.ParseGitHubRepo(repositoryURL); owner != "" && repo != "" {
+				stars = market.FetchGitHubStars(ctx, owner, repo)
+			}
+		}
+		author := strings.SplitN(server.Name, "/", 2)[0]
+
+		response := map[string]interface{}{
+			"details": gin.H{
+				"name":           server.Name,
+				"version":        server.Version,
+				"description":    server.Description,
+				"homepage":       server.WebsiteURL,
+				"repository_url": repositoryURL,
+				"author":         author,
+				"stars":          stars,
+				"last_updated":   entry.Meta.Official.UpdatedAt,
+			},
+			"env_vars":       envVarDefinitions,
+			"is_installed":   false,
+			"server":         server,
+			"author":         author,
+			"stars":          stars,
+			"repository_url": repositoryURL,
+			"version_info":   server.Version,
+			"last_publish":   entry.Meta.Official.UpdatedAt,
+		}
+		installManager, installName := server.InstallTarget()
+		if services, err := model.GetServicesByPackageDetails(installManager, installName); err == nil && len(services) > 0 {
+			response["is_installed"] = true
+			response["installed_service_id"] = services[0].ID
+		}
+		common.RespSuccess(c, response)
+		return
+
 	default:
 		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("unsupported_package_manager", lang))
 		return
@@ -378,6 +455,29 @@ func DiscoverEnvVars(c *gin.Context) {
 			}
 		}
 
+	case model.PackageManagerCatalog:
+		template, ok := catalogTemplateByName(c, packageName)
+		if !ok {
+			return
+		}
+		common.RespSuccess(c, gin.H{"env_vars": template.EnvVars})
+		return
+
+	case market.PackageManagerRegistry:
+		// MCP Registry 的 server.json 声明了环境变量及其说明，直接返回
+		entry, err := market.GetRegistryServer(ctx, packageName)
+		if err != nil {
+			common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_registry_server_failed", lang), err)
+			return
+		}
+		_, envVarDefinitions, err := entry.Server.ToMCPService()
+		if err != nil {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("registry_server_not_installable", lang, packageName))
+			return
+		}
+		common.RespSuccess(c, gin.H{"env_vars": envVarDefinitions})
+		return
+
 	default:
 		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("unsupported_package_manager", lang))
 		return
@@ -448,6 +548,25 @@ func validateAndGetPyPIPackageInfo(ctx context.Context, packageName string) (str
 	return result.Info.Summary, nil
 }
 
+// dockerImageName returns the last path segment of an image reference without its tag or digest, e.g. fetch for
+// ghcr.io/acme/fetch:1.2
+func dockerImageName(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// dockerImageTag returns the tag of an image reference, latest if it has none or is pinned by digest
+func dockerImageTag(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.Index(name, ":"); i >= 0 && !strings.Contains(name, "@") {
+		return name[i+1:]
+	}
+	return "latest"
+}
+
 // extractPackageNameWithoutVersion extracts the package name without version specifier
 // Examples: "package@1.0.0" -> "package", "package@latest" -> "package", "package" -> "package"
 func extractPackageNameWithoutVersion(packageNameWithVersion string) string {
@@ -530,6 +649,7 @@ func InstallOrAddService(c *gin.Context) {
 		Category            model.ServiceCategory  `json:"category"`               // Optional: for creating MCPService
 		Headers             map[string]string      `json:"headers"`                // Optional: for SSE/HTTP services custom headers
 		CustomArgs          []string               `json:"custom_args"`            // Optional: for stdio services custom arguments
+		Docker              *model.DockerConfig    `json:"docker"`                 // Optional: container settings of docker images
 	}
 
 	if err := c.ShouldBindJSON(&requestBody); err != nil {
@@ -565,6 +685,50 @@ func InstallOrAddService(c *gin.Context) {
 			return
 		}
 
+		// MCP Registry 条目（按 server.json 映射）和推荐目录条目：npm/pypi 包改写为对应包管理器走常规安装流程，
+		// 远程服务和其他命令在下方直接创建
+		var templateService *model.MCPService
+		var templateEnvVars []model.EnvVarDefinition
+		switch requestBody.PackageManager {
+		case model.PackageManagerCatalog:
+			entry, err := model.GetCatalogEntryByName(requestBody.PackageName)
+			if err != nil {
+				common.RespError(c, http.StatusBadRequest, i18n.Translate("package_not_found", lang, requestBody.PackageName), err)
+				return
+			}
+			template, err := entry.Template()
+			if err == nil {
+				templateService, err = template.ToMCPService()
+			}
+			if err != nil {
+				common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_catalog_failed", lang), err)
+				return
+			}
+			templateEnvVars = template.EnvVars
+			if template.PackageManager != "" {
+				requestBody.PackageManager = template.PackageManager
+				requestBody.PackageName = template.PackageName
+			}
+		case market.PackageManagerRegistry:
+			entry, err := market.GetRegistryServer(c.Request.Context(), requestBody.PackageName)
+			if err != nil {
+				common.RespError(c, http.StatusBadRequest, i18n.Translate("package_not_found", lang, requestBody.PackageName), err)
+				return
+			}
+			templateService, templateEnvVars, err = entry.Server.ToMCPService()
+			if err != nil {
+				common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("registry_server_not_installable", lang, requestBody.PackageName))
+				return
+			}
+			if templateService.Type == model.ServiceTypeStdio {
+				requestBody.PackageManager = templateService.PackageManager
+				requestBody.PackageName = templateService.SourcePackageName
+				if requestBody.Version == "" {
+					requestBody.Version = entry.Server.PackageVersion()
+				}
+			}
+		}
+
 		// Extract package name without version for API calls
 		cleanPackageName := extractPackageNameWithoutVersion(requestBody.PackageName)
 
@@ -578,6 +742,21 @@ func InstallOrAddService(c *gin.Context) {
 			common.RespErrorStr(c, http.StatusInternalServerError, i18n.Translate("uv_not_available", lang))
 			return
 		}
+		if requestBody.PackageManager == model.PackageManagerDocker {
+			// Image references are not npm packages: keep the tag or digest
+			cleanPackageName = requestBody.PackageName
+			if err := market.ValidateDockerImage(requestBody.PackageName); err != nil {
+				common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("invalid_docker_image", lang, requestBody.PackageName))
+				return
+			}
+			if requestBody.Version == "" {
+				requestBody.Version = dockerImageTag(requestBody.PackageName)
+			}
+			if !market.CheckDockerAvailable() {
+				common.RespErrorStr(c, http.StatusInternalServerError, i18n.Translate("docker_not_available", lang))
+				return
+			}
+		}
 
 		// Check for existing services using clean package name, but also check exact match
 		existingServices, err := model.GetServicesByPackageDetails(requestBody.PackageManager, cleanPackageName)
@@ -604,14 +783,25 @@ func InstallOrAddService(c *gin.Context) {
 		displayName := requestBody.DisplayName
 		if displayName == "" {
 			displayName = requestBody.PackageName
+			if templateService != nil {
+				displayName = templateService.DisplayName
+			}
 		}
 
 		// 1. Check if package exists and get required environment variables and description
 		var requiredEnvVars []string
 		var packageDescription string
 
-		switch requestBody.PackageManager {
-		case "npm":
+		switch {
+		case templateService != nil:
+			// server.json 声明了所需环境变量，无需从 README 猜测；有默认值的不要求填写
+			packageDescription = templateService.Description
+			for _, env := range templateEnvVars {
+				if !env.Optional && env.DefaultValue == "" {
+					requiredEnvVars = append(requiredEnvVars, env.Name)
+				}
+			}
+		case requestBody.PackageManager == "npm":
 			details, err := market.GetNPMPackageDetails(c.Request.Context(), cleanPackageName)
 			if err != nil {
 				// Package not found or unable to get package info, return error immediately
@@ -637,7 +827,7 @@ func InstallOrAddService(c *gin.Context) {
 					}
 				}
 			}
-		case "pypi", "uv", "pip":
+		case requestBody.PackageManager == "pypi" || requestBody.PackageManager == "uv" || requestBody.PackageManager == "pip":
 			// PyPI package validation and get description info
 			description, err := validateAndGetPyPIPackageInfo(c.Request.Context(), cleanPackageName)
 			if err != nil {
@@ -677,6 +867,12 @@ func InstallOrAddService(c *gin.Context) {
 			serviceDescription = packageDescription
 		}
 
+		if templateService != nil && (requestBody.PackageManager == market.PackageManagerRegistry || requestBody.PackageManager == model.PackageManagerCatalog) {
+			// No package to install: remote servers and catalog commands such as docker
+			createTemplateService(c, userID, templateService, envVarsForTask, displayName, serviceDescription, requestBody.ServiceIconURL, requestBody.Category, requestBody.Headers)
+			return
+		}
+
 		newService := model.MCPService{
 			Name:                  sanitizeServiceName(requestBody.PackageName),
 			DisplayName:           displayName,
@@ -694,6 +890,17 @@ func InstallOrAddService(c *gin.Context) {
 		if newService.Category == "" {
 			newService.Category = model.CategoryAI
 		}
+		if templateService != nil {
+			// Named after the catalog entry or the registry server rather than the package
+			newService.Name = sanitizeServiceName(templateService.Name)
+		} else if requestBody.PackageManager == model.PackageManagerDocker {
+			newService.Name = sanitizeServiceName(dockerImageName(requestBody.PackageName))
+		}
+
+		if model.ValidateServiceName(newService.Name) != nil {
+			common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("service_name_reserved", lang, newService.Name))
+			return
+		}
 
 		// Check if the processed service name already exists
 		existingServiceByName, errByName := model.GetServiceByName(newService.Name)
@@ -703,6 +910,30 @@ func InstallOrAddService(c *gin.Context) {
 		}
 
 		// Set Command and ArgsJSON configuration based on package manager
+		if templateService != nil {
+			if newService.Icon == "" {
+				newService.Icon = templateService.Icon
+			}
+			if requestBody.Category == "" {
+				newService.Category = templateService.Category
+			}
+			newService.RequiredEnvVarsJSON = templateService.RequiredEnvVarsJSON
+			newService.ClientConfigTemplates = templateService.ClientConfigTemplates
+		}
+		// Pin npm and PyPI packages to an exact version so npx/uvx do not float to newer releases on restart
+		switch requestBody.PackageManager {
+		case "npm", "pypi", "uv", "pip":
+			if requestBody.Version == "" && requestBody.PackageName != cleanPackageName {
+				requestBody.Version = strings.TrimPrefix(requestBody.PackageName, cleanPackageName+"@")
+			}
+			if requestBody.Version == "" || requestBody.Version == "latest" {
+				if latest, err := market.GetLatestVersion(c.Request.Context(), requestBody.PackageManager, cleanPackageName); err == nil {
+					requestBody.Version = latest
+				} else {
+					log.Printf("[InstallOrAddService] Could not resolve the latest version of %s, leaving it unpinned: %v", requestBody.PackageName, err)
+				}
+			}
+		}
 		log.Printf("[InstallOrAddService] Setting Command and ArgsJSON for PackageManager: %s, PackageName: %s, CustomArgs: %v", requestBody.PackageManager, requestBody.PackageName, requestBody.CustomArgs)
 		switch requestBody.PackageManager {
 		case "npm":
@@ -722,10 +953,15 @@ func InstallOrAddService(c *gin.Context) {
 				if !packageNameFound {
 					args = append(args, requestBody.PackageName)
 				}
+			} else if templateService != nil {
+				// Use the arguments declared in server.json
+				newService.Command = templateService.Command
+				_ = json.Unmarshal([]byte(templateService.ArgsJSON), &args)
 			} else {
 				// Use default arguments
-				args = []string{"-y", requestBody.PackageName}
+				_, args = market.PackageCommand(requestBody.PackageManager, requestBody.PackageName)
 			}
+			args = market.PinPackageArgs(requestBody.PackageManager, cleanPackageName, requestBody.Version, args)
 			argsJSON, err := json.Marshal(args)
 			if err != nil {
 				log.Printf("[InstallOrAddService] Error marshaling args for npm package %s: %v", requestBody.PackageName, err)
@@ -739,10 +975,15 @@ func InstallOrAddService(c *gin.Context) {
 			if len(requestBody.CustomArgs) > 0 {
 				// Use custom arguments provided by user
 				args = append(args, requestBody.CustomArgs...)
+			} else if templateService != nil {
+				// Use the arguments declared in server.json
+				newService.Command = templateService.Command
+				_ = json.Unmarshal([]byte(templateService.ArgsJSON), &args)
 			} else {
 				// Use default arguments
-				args = []string{"--from", requestBody.PackageName, requestBody.PackageName}
+				_, args = market.PackageCommand(requestBody.PackageManager, requestBody.PackageName)
 			}
+			args = market.PinPackageArgs(requestBody.PackageManager, cleanPackageName, requestBody.Version, args)
 			argsJSON, err := json.Marshal(args)
 			if err != nil {
 				log.Printf("[InstallOrAddService] Error marshaling args for python package %s: %v", requestBody.PackageName, err)
@@ -750,18 +991,56 @@ func InstallOrAddService(c *gin.Context) {
 				newService.ArgsJSON = string(argsJSON)
 				log.Printf("[InstallOrAddService] Set Command='%s' and ArgsJSON='%s' for python package %s", newService.Command, newService.ArgsJSON, requestBody.PackageName)
 			}
+		case model.PackageManagerDocker:
+			// The docker run arguments are built when the service starts, ArgsJSON holds the container arguments
+			newService.Command = "docker"
+			args := requestBody.CustomArgs
+			if len(args) == 0 && templateService != nil {
+				_ = json.Unmarshal([]byte(templateService.ArgsJSON), &args)
+			}
+			if args == nil {
+				args = []string{}
+			}
+			argsJSON, _ := json.Marshal(args)
+			newService.ArgsJSON = string(argsJSON)
+			if requestBody.Docker != nil {
+				dockerJSON, err := json.Marshal(requestBody.Docker)
+				if err != nil {
+					common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_docker_json", lang), err)
+					return
+				}
+				newService.DockerJSON = string(dockerJSON)
+			} else if templateService != nil {
+				newService.DockerJSON = templateService.DockerJSON
+			}
+			if _, err := newService.GetDockerConfig(); err != nil {
+				common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_docker_json", lang), err)
+				return
+			}
+			log.Printf("[InstallOrAddService] Set Command='%s' and ArgsJSON='%s' for docker image %s", newService.Command, newService.ArgsJSON, requestBody.PackageName)
 		default:
 			log.Printf("[InstallOrAddService] Warning: Unknown package manager %s for service %s, Command field will be empty", requestBody.PackageManager, requestBody.PackageName)
 		}
 
 		// Set DefaultEnvsJSON (environment variables during installation as default configuration)
+		if templateService != nil && templateService.DefaultEnvsJSON != "" {
+			// Defaults declared in server.json, overridden by the values provided
+			var templateDefaults map[string]string
+			if err := json.Unmarshal([]byte(templateService.DefaultEnvsJSON), &templateDefaults); err == nil {
+				for name, value := range templateDefaults {
+					if _, ok := envVarsForTask[name]; !ok {
+						envVarsForTask[name] = value
+					}
+				}
+			}
+		}
 		if len(envVarsForTask) > 0 {
 			defaultEnvsJSON, err := json.Marshal(envVarsForTask)
 			if err != nil {
 				log.Printf("[InstallOrAddService] Error marshaling default envs for service %s: %v", requestBody.PackageName, err)
 			} else {
 				newService.DefaultEnvsJSON = string(defaultEnvsJSON)
-				log.Printf("[InstallOrAddService] Set DefaultEnvsJSON for service %s: %s", requestBody.PackageName, newService.DefaultEnvsJSON)
+				log.Printf("[InstallOrAddService] Set %d default envs for service %s", len(envVarsForTask), requestBody.PackageName)
 			}
 		}
 
@@ -781,7 +1060,7 @@ func InstallOrAddService(c *gin.Context) {
 			common.RespError(c, http.StatusInternalServerError, i18n.Translate("create_mcp_service_failed", lang), err)
 			return
 		}
-		log.Printf("[InstallOrAddService] Successfully created service with ID: %d, Command='%s', ArgsJSON='%s', DefaultEnvsJSON='%s'", newService.ID, newService.Command, newService.ArgsJSON, newService.DefaultEnvsJSON)
+		log.Printf("[InstallOrAddService] Successfully created service with ID: %d, Command='%s', ArgsJSON='%s'", newService.ID, newService.Command, newService.ArgsJSON)
 
 		// Note: No longer create ConfigService during installation, as installation environment variables are default configuration
 		// ConfigService is only created dynamically when users need personal configuration
@@ -824,6 +1103,109 @@ func InstallOrAddService(c *gin.Context) {
 	}
 }
 
+// createTemplateService creates and registers a service of an MCP registry server or a catalog entry that has no
+// package to install. The values provided fill the {{NAME}} header placeholders of remote services, the others are
+// left for each user's configuration; for stdio services they become the default environment.
+func createTemplateService(c *gin.Context, userID int64, svc *model.MCPService, values map[string]string, displayName, description, iconURL string, category model.ServiceCategory, headers map[string]string) {
+	lang := c.GetString("lang")
+
+	newService := *svc
+	newService.Name = sanitizeServiceName(svc.Name)
+	newService.DisplayName = displayName
+	newService.Description = description
+	newService.HealthStatus = "unknown"
+	newService.InstallerUserID = userID
+	if iconURL != "" {
+		newService.Icon = iconURL
+	}
+	if category != "" {
+		newService.Category = category
+	}
+	if newService.Name == "" {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("service_name_cannot_be_empty", lang))
+		return
+	}
+	if model.ValidateServiceName(newService.Name) != nil {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("service_name_reserved", lang, newService.Name))
+		return
+	}
+	if existing, err := model.GetServiceByName(newService.Name); err == nil && existing != nil {
+		common.RespErrorStr(c, http.StatusConflict, i18n.Translate("service_name_already_exists", lang, newService.Name))
+		return
+	}
+
+	if newService.Type == model.ServiceTypeStdio {
+		envs := map[string]string{}
+		if newService.DefaultEnvsJSON != "" {
+			if err := json.Unmarshal([]byte(newService.DefaultEnvsJSON), &envs); err != nil {
+				common.RespError(c, http.StatusInternalServerError, i18n.Translate("create_mcp_service_failed", lang), err)
+				return
+			}
+		}
+		for key, v := range values {
+			envs[key] = v
+		}
+		newService.DefaultEnvsJSON = ""
+		if len(envs) > 0 {
+			envsJSON, err := json.Marshal(envs)
+			if err != nil {
+				common.RespError(c, http.StatusInternalServerError, i18n.Translate("create_mcp_service_failed", lang), err)
+				return
+			}
+			newService.DefaultEnvsJSON = string(envsJSON)
+		}
+	}
+
+	serviceHeaders := map[string]string{}
+	if newService.HeadersJSON != "" {
+		if err := json.Unmarshal([]byte(newService.HeadersJSON), &serviceHeaders); err != nil {
+			common.RespError(c, http.StatusInternalServerError, i18n.Translate("invalid_headers", lang), err)
+			return
+		}
+	}
+	for name, value := range serviceHeaders {
+		for key, v := range values {
+			if v != "" {
+				value = strings.ReplaceAll(value, "{{"+key+"}}", v)
+			}
+		}
+		serviceHeaders[name] = value
+	}
+	for name, value := range headers {
+		serviceHeaders[name] = value
+	}
+	newService.HeadersJSON = ""
+	if len(serviceHeaders) > 0 {
+		headersJSON, err := json.Marshal(serviceHeaders)
+		if err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_headers", lang), err)
+			return
+		}
+		newService.HeadersJSON = string(headersJSON)
+	}
+
+	if err := model.CreateService(&newService); err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("create_mcp_service_failed", lang), err)
+		return
+	}
+
+	// 与自定义服务相同：注册到 ServiceManager 并立即做一次健康检查
+	serviceManager := proxy.GetServiceManager()
+	if err := serviceManager.RegisterService(c.Request.Context(), &newService); err != nil {
+		log.Printf("Warning: Failed to register service %s (ID: %d) with ServiceManager: %v", newService.Name, newService.ID, err)
+	} else if _, err := serviceManager.ForceCheckServiceHealth(newService.ID); err != nil {
+		log.Printf("Warning: Force health check failed for service %s (ID: %d): %v", newService.Name, newService.ID, err)
+	} else if err := serviceManager.UpdateMCPServiceHealth(newService.ID); err != nil {
+		log.Printf("Warning: UpdateMCPServiceHealth failed for service %s (ID: %d): %v", newService.Name, newService.ID, err)
+	}
+
+	common.RespSuccess(c, gin.H{
+		"message":        i18n.Translate("service_added_successfully", lang),
+		"mcp_service_id": newService.ID,
+		"status":         market.StatusCompleted,
+	})
+}
+
 // GetInstallationStatus godoc
 // @Summary 获取安装状态
 // @Description 获取指定服务的安装状态
@@ -943,6 +1325,9 @@ func UninstallService(c *gin.Context) {
 		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
 		return
 	}
+	if rejectManagedService(c, service) {
+		return
+	}
 
 	// 检查是否是处于安装中的服务
 	isPendingOrInstalling := false
@@ -1005,6 +1390,11 @@ func UninstallService(c *gin.Context) {
 				if err := market.UninstallPyPIPackage(c.Request.Context(), service.SourcePackageName); err != nil {
 					log.Printf("Error during pypi/uv/pip uninstall for service ID %d (%s): %v", serviceID, service.SourcePackageName, err)
 				}
+			case model.PackageManagerDocker:
+				// Removes the image unless other services or containers still use it
+				if err := market.UninstallDockerImage(c.Request.Context(), service); err != nil {
+					log.Printf("Error during docker image removal for service ID %d (%s): %v", serviceID, service.DockerImage(), err)
+				}
 			default:
 				log.Printf("Uninstall requested for service ID %d (%s) with unsupported package manager: %s. Skipping physical uninstall.", serviceID, service.SourcePackageName, service.PackageManager)
 			}
@@ -1027,6 +1417,8 @@ func UninstallService(c *gin.Context) {
 		common.RespError(c, http.StatusInternalServerError, i18n.Translate("update_service_status_failed", lang), err)
 		return
 	}
+	// 远程服务不会在上面注销，这里同样清除其熔断器
+	proxy.ResetServiceCircuitBreakers(service.ID)
 
 	// 返回成功
 	common.RespSuccessStr(c, i18n.Translate("service_uninstalled_successfully", lang))
@@ -1168,12 +1560,12 @@ func contains(slice []string, s string) bool {
 
 // SearchMCPMarket godoc
 // @Summary 搜索 MCP 市场服务
-// @Description 支持从 npm、PyPI、推荐列表聚合搜索
+// @Description 支持从推荐目录、npm、PyPI、MCP Registry 聚合搜索
 // @Tags Market
 // @Accept json
 // @Produce json
 // @Param query query string false "搜索关键词"
-// @Param sources query string false "数据源, 逗号分隔 (npm,pypi,recommended)"
+// @Param sources query string false "数据源, 逗号分隔 (npm,pypi,registry,recommended)"
 // @Param page query int false "页码"
 // @Param size query int false "每页数量"
 // @Success 200 {object} common.APIResponse
@@ -1200,34 +1592,141 @@ func SearchMCPMarket(c *gin.Context) {
 		size = s
 	}
 
-	var results []market.SearchPackageResult
-	var err error
+	sourceList := strings.Split(sources, ",")
+	for i := range sourceList {
+		sourceList[i] = strings.TrimSpace(sourceList[i])
+	}
 
-	// 目前仅实现 npm，后续可扩展 pypi/recommended
-	if strings.Contains(sources, "npm") {
-		// Use finalQuery for searching
-		npmResult, e := market.SearchNPMPackages(ctx, finalQuery, size, page)
-		if e != nil {
-			err = e
-		} else {
-			// 查询已安装包的 numeric IDs
-			installedServiceIDs, err_installed := market.GetInstalledMCPServersFromDB() // Returns map[string]int64 now
-			if err_installed != nil {
-				common.SysLog("SearchMCPMarket: Error fetching installed server IDs: " + err_installed.Error())
-				// Continue without installed info if this fails, or handle error more strictly
+	// 查询已安装包的 numeric IDs
+	installedServiceIDs, errInstalled := market.GetInstalledMCPServersFromDB()
+	if errInstalled != nil {
+		common.SysLog("SearchMCPMarket: Error fetching installed server IDs: " + errInstalled.Error())
+		// Continue without installed info
+	}
+
+	// 各数据源并发查询；任一数据源失败时返回其余数据源的结果，全部失败才报错
+	var npmResults, pypiResults, registryResults []market.SearchPackageResult
+	var npmErr, pypiErr, registryErr error
+	var wg sync.WaitGroup
+	if containsSource(sourceList, "npm") {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			npmResult, e := market.SearchNPMPackages(ctx, finalQuery, size, page)
+			if e != nil {
+				npmErr = e
+				return
+			}
+			npmResults = market.ConvertNPMToSearchResult(ctx, npmResult, installedServiceIDs)
+		}()
+	}
+	if containsSource(sourceList, "pypi") {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// PyPI 按项目名匹配，不追加 " mcp"
+			pypiResult, e := market.SearchPyPIPackages(ctx, strings.TrimSpace(originalQuery), size, page)
+			if e != nil {
+				pypiErr = e
+				return
+			}
+			pypiResults = market.ConvertPyPIToSearchResult(ctx, pypiResult, installedServiceIDs)
+		}()
+	}
+	if containsSource(sourceList, market.PackageManagerRegistry) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// MCP Registry 只收录 MCP 服务器，不追加 " mcp"
+			registryResult, e := market.SearchRegistryServers(ctx, originalQuery, size, page)
+			if e != nil {
+				registryErr = e
+				return
 			}
-			results = append(results, market.ConvertNPMToSearchResult(ctx, npmResult, installedServiceIDs)...)
+			registryResults = market.ConvertRegistryToSearchResult(ctx, registryResult, installedServiceIDs)
+		}()
+	}
+	// 推荐目录在本地数据库中，排在其他数据源之前
+	var catalogResults []market.SearchPackageResult
+	var catalogErr error
+	if containsSource(sourceList, model.PackageManagerCatalog) {
+		var templates []model.CatalogTemplate
+		templates, catalogErr = market.SearchCatalog(originalQuery)
+		if start := (page - 1) * size; start < len(templates) {
+			catalogResults = market.ConvertCatalogToSearchResult(templates[start:min(start+size, len(templates))], installedServiceIDs)
 		}
 	}
-	// TODO: 支持 pypi、recommended
+	wg.Wait()
 
-	if err != nil {
+	results := append(append(append(catalogResults, npmResults...), pypiResults...), registryResults...)
+	var err error
+	for _, e := range []error{catalogErr, npmErr, pypiErr, registryErr} {
+		if e != nil {
+			common.SysError("SearchMCPMarket: " + e.Error())
+			err = e
+		}
+	}
+	if err != nil && len(results) == 0 {
 		common.RespError(c, 500, "market_search_failed", err)
 		return
 	}
 	common.RespSuccess(c, results)
 }
 
+// secretEnvNames returns the env var names of a service that must be masked in API responses:
+// those flagged IsSecret, those with a secret config option, and those whose name looks like a credential.
+func secretEnvNames(svc *model.MCPService, configOptions []*model.ConfigService) map[string]bool {
+	names := make(map[string]bool)
+	if defs, err := svc.GetRequiredEnvVars(); err == nil {
+		for _, def := range defs {
+			if def.IsSecret {
+				names[def.Name] = true
+			}
+		}
+	}
+	for _, opt := range configOptions {
+		if opt.Type == model.ConfigTypeSecret {
+			names[opt.Key] = true
+		}
+	}
+	return names
+}
+
+// maskEnvVarsForResponse decrypts stored env values and masks the secret ones for display
+func maskEnvVarsForResponse(values map[string]string, secretNames map[string]bool) map[string]string {
+	masked := make(map[string]string, len(values))
+	for name, value := range values {
+		plaintext, err := common.DecryptSecret(value)
+		if err != nil {
+			common.SysError(fmt.Sprintf("Failed to decrypt env var %s for display: %v", name, err))
+			masked[name] = common.SecretMask
+			continue
+		}
+		if secretNames[name] || common.IsSecretName(name) {
+			plaintext = common.MaskSecret(plaintext)
+		}
+		masked[name] = plaintext
+	}
+	return masked
+}
+
+// maskHeadersJSONForResponse masks every header value, since headers usually carry credentials.
+// The result keeps the JSON string shape of headers_json.
+func maskHeadersJSONForResponse(headersJSON string) string {
+	headers, err := model.DecryptJSONMap(headersJSON)
+	if err != nil {
+		return "{}"
+	}
+	for name, value := range headers {
+		headers[name] = common.MaskSecret(value)
+	}
+	masked, err := json.Marshal(headers)
+	if err != nil {
+		return "{}"
+	}
+	return string(masked)
+}
+
 // ListInstalledMCPServices godoc
 // @Summary 列出已安装的 MCP 服务
 // @Description 查询数据库中已安装的 MCP 服务
@@ -1264,10 +1763,10 @@ func ListInstalledMCPServices(c *gin.Context) {
 		}
 
 		// 2. 如果用户已登录，获取并合并 UserConfig
+		serviceConfigOptions, _ := model.GetConfigOptionsForService(svc.ID)
 		if userID != 0 {
 			userConfigs, err_uc := model.GetUserConfigsForService(userID, svc.ID)
 			if err_uc == nil {
-				serviceConfigOptions, _ := model.GetConfigOptionsForService(svc.ID)
 				configIDToNameMap := make(map[int64]string)
 				for _, opt := range serviceConfigOptions {
 					configIDToNameMap[opt.ID] = opt.Key
@@ -1286,7 +1785,16 @@ func ListInstalledMCPServices(c *gin.Context) {
 		svcMap := make(map[string]interface{})
 		b, _ := json.Marshal(svc)
 		_ = json.Unmarshal(b, &svcMap)
-		svcMap["env_vars"] = finalEnvVars // 使用合并后的环境变量
+		svcMap["env_vars"] = maskEnvVarsForResponse(finalEnvVars, secretEnvNames(svc, serviceConfigOptions)) // 使用合并后的环境变量（密钥已脱敏）
+		// 原始的加密字段不返回给客户端
+		delete(svcMap, "DefaultEnvsJSON")
+		if svc.HeadersJSON != "" {
+			svcMap["headers_json"] = maskHeadersJSONForResponse(svc.HeadersJSON)
+		}
+		// Users only need to know whether to authorize the upstream, not its client credentials
+		delete(svcMap, "oauth_json")
+		oauthConfig, _ := svc.GetOAuthConfig()
+		svcMap["oauth_enabled"] = oauthConfig != nil
 
 		// 添加用户今日请求统计
 		if svc.RPDLimit > 0 && userID > 0 {
@@ -1404,6 +1912,12 @@ func PatchEnvVar(c *gin.Context) {
 		return
 	}
 
+	// 客户端回传的是脱敏后的值，说明未修改，不能覆盖真实值
+	if common.IsMaskedSecret(req.VarValue) {
+		common.RespSuccessStr(c, i18n.Translate("env_var_saved_successfully", lang))
+		return
+	}
+
 	// 检查用户权限
 	user, err := model.GetUserById(userID, false)
 	if err != nil {
@@ -1420,6 +1934,9 @@ func PatchEnvVar(c *gin.Context) {
 			common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
 			return
 		}
+		if rejectManagedService(c, service) {
+			return
+		}
 
 		// 解析现有的默认环境变量
 		var defaultEnvs map[string]string
@@ -1448,7 +1965,7 @@ func PatchEnvVar(c *gin.Context) {
 			return
 		}
 
-		log.Printf("[PatchEnvVar] Admin user %d updated default env %s=%s for service %d (%s)", userID, req.VarName, req.VarValue, service.ID, service.Name)
+		log.Printf("[PatchEnvVar] Admin user %d updated default env %s for service %d (%s)", userID, req.VarName, service.ID, service.Name)
 		common.RespSuccessStr(c, "Default environment variable updated successfully")
 
 	} else {
@@ -1499,11 +2016,147 @@ func PatchEnvVar(c *gin.Context) {
 			return
 		}
 
-		log.Printf("[PatchEnvVar] User %d saved personal env %s=%s for service %d", userID, req.VarName, req.VarValue, req.ServiceID)
+		log.Printf("[PatchEnvVar] User %d saved personal env %s for service %d", userID, req.VarName, req.ServiceID)
 		common.RespSuccessStr(c, i18n.Translate("env_var_saved_successfully", lang))
 	}
 }
 
+// PatchHeader godoc
+// @Summary 单独保存服务请求头
+// @Description 更新 SSE / Streamable HTTP 服务的单个请求头。管理员修改会更新服务默认请求头，普通用户修改会保存为个人配置（需服务允许用户覆盖）
+// @Tags Market
+// @Accept json
+// @Produce json
+// @Param body body map[string]interface{} true "请求体"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 403 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/mcp_market/header [patch]
+func PatchHeader(c *gin.Context) {
+	lang := c.GetString("lang")
+	var req struct {
+		ServiceID   int64  `json:"service_id" binding:"required"`
+		HeaderName  string `json:"header_name" binding:"required"`
+		HeaderValue string `json:"header_value" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	req.HeaderName = http.CanonicalHeaderKey(strings.TrimSpace(req.HeaderName))
+
+	userID := getUserIDFromContext(c)
+	if userID == 0 {
+		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
+		return
+	}
+
+	// 客户端回传的是脱敏后的值，说明未修改，不能覆盖真实值
+	if common.IsMaskedSecret(req.HeaderValue) {
+		common.RespSuccessStr(c, i18n.Translate("header_saved_successfully", lang))
+		return
+	}
+
+	user, err := model.GetUserById(userID, false)
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, "Failed to get user info", err)
+		return
+	}
+	service, err := model.GetServiceByID(req.ServiceID)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+	if service.Type == model.ServiceTypeStdio {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("headers_not_supported_for_stdio", lang))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if user.Role == common.RoleAdminUser {
+		// 管理员：更新服务的默认请求头
+		if rejectManagedService(c, service) {
+			return
+		}
+		headers := make(map[string]string)
+		if service.HeadersJSON != "" {
+			if err := json.Unmarshal([]byte(service.HeadersJSON), &headers); err != nil {
+				log.Printf("[PatchHeader] Error unmarshaling existing HeadersJSON for service %d: %v", req.ServiceID, err)
+				headers = make(map[string]string)
+			}
+		}
+		headers[req.HeaderName] = req.HeaderValue
+
+		headersJSON, err := json.Marshal(headers)
+		if err != nil {
+			common.RespError(c, http.StatusInternalServerError, "Failed to marshal headers", err)
+			return
+		}
+		service.HeadersJSON = string(headersJSON)
+		if err := model.UpdateService(service); err != nil {
+			common.RespError(c, http.StatusInternalServerError, "Failed to update service", err)
+			return
+		}
+
+		// 请求头在建立连接时生效，关闭全局实例以便下次请求时用新请求头重连
+		if err := proxy.ShutdownSharedInstance(ctx, proxy.GlobalInstanceCacheKey(service.ID)); err != nil && !errors.Is(err, proxy.ErrInstanceNotFound) {
+			common.SysError(fmt.Sprintf("[PatchHeader] Failed to shut down global instance of service %d: %v", service.ID, err))
+		}
+
+		log.Printf("[PatchHeader] Admin user %d updated default header %s for service %d (%s)", userID, req.HeaderName, service.ID, service.Name)
+		common.RespSuccessStr(c, i18n.Translate("header_saved_successfully", lang))
+		return
+	}
+
+	// 普通用户：仅当服务允许用户覆盖时保存为个人配置
+	if !service.AllowUserOverride {
+		common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("user_override_not_allowed", lang))
+		return
+	}
+	configOpt, err := model.GetHeaderOptionByKey(req.ServiceID, req.HeaderName)
+	if err != nil {
+		if !errors.Is(err, model.ErrRecordNotFound) {
+			common.RespError(c, http.StatusInternalServerError, "Failed to get config option", err)
+			return
+		}
+		newConfigOption := model.ConfigService{
+			ServiceID:   req.ServiceID,
+			Key:         req.HeaderName,
+			DisplayName: req.HeaderName,
+			Description: fmt.Sprintf("HTTP header %s for %s", req.HeaderName, service.DisplayName),
+			Type:        model.ConfigTypeSecret, // 请求头通常携带凭据
+			IsHeader:    true,
+		}
+		if errCreate := model.CreateConfigOption(&newConfigOption); errCreate != nil {
+			log.Printf("Failed to create header ConfigService for key %s, serviceID %d: %v", req.HeaderName, req.ServiceID, errCreate)
+			common.RespError(c, http.StatusInternalServerError, "Failed to create config option", errCreate)
+			return
+		}
+		configOpt = &newConfigOption
+	}
+
+	userConfig := &model.UserConfig{
+		UserID:    userID,
+		ServiceID: req.ServiceID,
+		ConfigID:  configOpt.ID,
+		Value:     req.HeaderValue,
+	}
+	if err := model.SaveUserConfig(userConfig); err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("save_user_config_failed", lang), err)
+		return
+	}
+
+	// 关闭该用户的实例，下次请求时带上新的请求头重连
+	if err := proxy.ShutdownSharedInstance(ctx, proxy.UserInstanceCacheKey(userID, req.ServiceID)); err != nil && !errors.Is(err, proxy.ErrInstanceNotFound) {
+		common.SysError(fmt.Sprintf("[PatchHeader] Failed to shut down instance of user %d for service %d: %v", userID, req.ServiceID, err))
+	}
+
+	log.Printf("[PatchHeader] User %d saved personal header %s for service %d", userID, req.HeaderName, req.ServiceID)
+	common.RespSuccessStr(c, i18n.Translate("header_saved_successfully", lang))
+}
+
 // CreateCustomService godoc
 // @Summary 创建自定义服务
 // @Description 创建一个自定义的MCP服务（支持stdio、sse、streamableHttp类型）
@@ -1542,6 +2195,12 @@ func CreateCustomService(c *gin.Context) {
 		return
 	}
 
+	// 保留名称不可用于服务（例如聚合端点 _all，或包含命名空间分隔符 __ 的名称）
+	if model.ValidateServiceName(sanitizedName) != nil {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("service_name_reserved", lang, sanitizedName))
+		return
+	}
+
 	// 检查服务名称唯一性
 	existingService, err := model.GetServiceByName(sanitizedName)
 	if err == nil && existingService != nil {
@@ -88,6 +88,32 @@ func TestSanitizeServiceName(t *testing.T) {
 	}
 }
 
+func TestDockerImageNameAndTag(t *testing.T) {
+	tests := []struct {
+		image string
+		name  string
+		tag   string
+	}{
+		{"mcp/fetch", "fetch", "latest"},
+		{"ghcr.io/acme/fetch:1.2", "fetch", "1.2"},
+		{"localhost:5000/time", "time", "latest"},
+		{"mcp/fetch@sha256:abc", "fetch", "latest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			assert.Equal(t, tt.name, dockerImageName(tt.image))
+			assert.Equal(t, tt.tag, dockerImageTag(tt.image))
+		})
+	}
+}
+
+func TestMaskHeadersJSONForResponse(t *testing.T) {
+	masked := maskHeadersJSONForResponse(`{"Authorization":"Bearer sk-1234567890","X-Team":"ops"}`)
+	assert.JSONEq(t, `{"Authorization":"******7890","X-Team":"******"}`, masked, "headers_json stays a JSON string")
+	assert.Equal(t, "{}", maskHeadersJSONForResponse(""))
+}
+
 func TestCreateCustomService_DuplicateName(t *testing.T) {
 	// 这个测试需要数据库连接，所以我们先跳过实际的数据库操作
 	// 在实际环境中，你需要设置测试数据库
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"one-mcp/backend/common"
 	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/market"
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
 	"strconv"
@@ -42,6 +43,9 @@ func UpdateMCPService(c *gin.Context) {
 		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
 		return
 	}
+	if rejectManagedService(c, service) {
+		return
+	}
 
 	// 保存原始值用于比较
 	oldPackageManager := service.PackageManager
@@ -60,6 +64,10 @@ func UpdateMCPService(c *gin.Context) {
 		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("name_and_display_name_required", lang))
 		return
 	}
+	if model.ValidateServiceName(service.Name) != nil {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("service_name_reserved", lang, service.Name))
+		return
+	}
 
 	// 验证服务类型
 	if !isValidServiceType(service.Type) {
@@ -75,6 +83,24 @@ func UpdateMCPService(c *gin.Context) {
 		}
 	}
 
+	// 验证SandboxJSON (如果提供)
+	if _, err := service.GetSandboxConfig(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_sandbox_json", lang), err)
+		return
+	}
+
+	// 验证OAuthJSON (如果提供)
+	if _, err := service.GetOAuthConfig(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_oauth_json", lang), err)
+		return
+	}
+
+	// 验证DockerJSON (如果提供)
+	if _, err := service.GetDockerConfig(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_docker_json", lang), err)
+		return
+	}
+
 	// 如果是marketplace服务（stdio类型且PackageManager不为空），验证相关字段
 	if service.Type == model.ServiceTypeStdio && service.PackageManager != "" {
 		if service.SourcePackageName == "" {
@@ -92,18 +118,18 @@ func UpdateMCPService(c *gin.Context) {
 
 	// Set Command and potentially ArgsJSON based on PackageManager
 	// This logic applies on update as well, ensuring Command/ArgsJSON are consistent with PackageManager
-	if service.PackageManager == "npm" {
-		service.Command = "npx"
+	if service.PackageManager == "npm" || service.PackageManager == "pypi" {
+		command, args := market.PackageCommand(service.PackageManager, service.SourcePackageName)
+		service.Command = command
 		if service.ArgsJSON == "" && service.SourcePackageName != "" {
-			service.ArgsJSON = fmt.Sprintf(`["-y", "%s"]`, service.SourcePackageName)
-		}
-	} else if service.PackageManager == "pypi" {
-		service.Command = "uvx"
-		if service.ArgsJSON == "" && service.SourcePackageName != "" {
-			service.ArgsJSON = fmt.Sprintf(`["-y", "%s"]`, service.SourcePackageName)
+			argsJSON, _ := json.Marshal(args)
+			service.ArgsJSON = string(argsJSON)
 		}
+	} else if service.PackageManager == model.PackageManagerDocker {
+		// The docker run arguments are built when the service starts, ArgsJSON holds the container arguments
+		service.Command = "docker"
 	} // Add else if for other package managers or if service.PackageManager == "" to potentially clear Command/ArgsJSON if they were auto-set.
-	// For now, if PackageManager is not npm or pypi, Command and ArgsJSON remain as bound from request.
+	// For now, if PackageManager is not npm, pypi or docker, Command and ArgsJSON remain as bound from request.
 
 	if err := model.UpdateService(service); err != nil {
 		common.RespError(c, http.StatusInternalServerError, i18n.Translate("update_service_failed", lang), err)
@@ -146,6 +172,9 @@ func ToggleMCPService(c *gin.Context) {
 		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
 		return
 	}
+	if rejectManagedService(c, service) {
+		return
+	}
 
 	// 切换启用状态
 	if err := model.ToggleServiceEnabled(id); err != nil {
@@ -229,7 +258,104 @@ func CheckMCPServiceHealth(c *gin.Context) {
 	common.RespSuccess(c, healthData)
 }
 
+// ListMCPInstances godoc
+// @Summary 列出运行中的MCP实例
+// @Description 列出所有运行中的共享MCP实例（全局实例和用户专属实例），包括所属用户、stdio子进程PID、创建时间、最近使用时间、进行中的请求数以及工具/提示/资源数量
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Router /api/mcp_services/instances [get]
+func ListMCPInstances(c *gin.Context) {
+	common.RespSuccess(c, proxy.ListSharedInstances())
+}
+
+// ShutdownMCPInstance godoc
+// @Summary 关闭MCP实例
+// @Description 关闭单个运行中的MCP实例（包括其stdio子进程），下一次请求时会重新创建
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param key path string true "实例缓存键"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/mcp_services/instances/{key} [delete]
+func ShutdownMCPInstance(c *gin.Context) {
+	lang := c.GetString("lang")
+	key := c.Param("key")
+
+	err := proxy.ShutdownSharedInstance(c.Request.Context(), key)
+	if errors.Is(err, proxy.ErrInstanceNotFound) {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("instance_not_found", lang), err)
+		return
+	}
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("shutdown_instance_failed", lang), err)
+		return
+	}
+	common.RespSuccessStr(c, i18n.Translate("instance_shutdown_successfully", lang))
+}
+
+// RestartMCPInstance godoc
+// @Summary 重启MCP实例
+// @Description 关闭单个MCP实例并立即以相同的配置（用户实例使用该用户的环境变量）重新创建，无需重启整个服务；也可用于重新启动因反复崩溃而停止自动重启的实例
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param key path string true "实例缓存键"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/mcp_services/instances/{key}/restart [post]
+func RestartMCPInstance(c *gin.Context) {
+	lang := c.GetString("lang")
+	key := c.Param("key")
+
+	// An instance whose process is crash looping is no longer live, but can still be restarted
+	serviceID, userID, found := proxy.InstanceOwner(key)
+	if !found {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("instance_not_found", lang), proxy.ErrInstanceNotFound)
+		return
+	}
+	service, err := model.GetServiceByID(serviceID)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := proxy.ShutdownSharedInstance(ctx, key); err != nil && !errors.Is(err, proxy.ErrInstanceNotFound) {
+		// The instance is out of the cache either way, so a failed shutdown does not prevent recreating it
+		common.SysError(fmt.Sprintf("[RestartMCPInstance] Error shutting down instance %s: %v", key, err))
+	}
+
+	var instance *proxy.SharedMcpInstance
+	if userID > 0 {
+		instance, err = getOrCreateUserSpecificInstance(ctx, service, userID)
+	} else {
+		instance, err = getOrCreateGlobalInstance(ctx, service)
+	}
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("restart_instance_failed", lang), err)
+		return
+	}
+	common.RespSuccess(c, instance.Info())
+}
+
 // 辅助函数：验证服务类型
+// rejectManagedService 拒绝在 UI 中修改配置文件声明的服务，否则下次同步配置文件时修改会被覆盖
+func rejectManagedService(c *gin.Context, service *model.MCPService) bool {
+	if !service.IsManaged() {
+		return false
+	}
+	common.RespErrorStr(c, http.StatusConflict, i18n.Translate("service_managed_by_config", c.GetString("lang"), service.Name))
+	return true
+}
+
 func isValidServiceType(sType model.ServiceType) bool {
 	return sType == model.ServiceTypeStdio ||
 		sType == model.ServiceTypeSSE ||
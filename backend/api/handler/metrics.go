@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMetrics godoc
+// @Summary Prometheus 指标
+// @Description 以 Prometheus 文本格式导出代理请求计数与延迟直方图、运行中的共享实例、服务健康状态和安装任务状态。使用管理员 Token 或 API Key 通过 Authorization: Bearer 访问
+// @Tags Metrics
+// @Produce plain
+// @Security ApiKeyAuth
+// @Success 200 {string} string "Prometheus text exposition"
+// @Failure 401 {object} common.APIResponse
+// @Failure 403 {object} common.APIResponse
+// @Router /metrics [get]
+func GetMetrics(c *gin.Context) {
+	c.Header("Content-Type", metrics.ContentType)
+	c.Status(http.StatusOK)
+	if err := metrics.WriteText(c.Writer); err != nil {
+		common.SysError("failed to write metrics: " + err.Error())
+	}
+}
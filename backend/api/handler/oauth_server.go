@@ -0,0 +1,544 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/model"
+	"one-mcp/backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setProxyAuthenticateHeader points an unauthenticated MCP client at the protected resource metadata of the
+// endpoint it called, from which it discovers the authorization server (MCP authorization, RFC 9728)
+func setProxyAuthenticateHeader(c *gin.Context) {
+	metadataURL := service.OAuthIssuer(c.Request) + "/.well-known/oauth-protected-resource" + c.Request.URL.Path
+	c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer resource_metadata="%s"`, metadataURL))
+}
+
+// oauthErrorResponse writes an error of the token and registration endpoints in the RFC 6749 format
+func oauthErrorResponse(c *gin.Context, status int, code, description string) {
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
+
+// OAuthProtectedResourceMetadata godoc
+// @Summary OAuth 受保护资源元数据
+// @Description 返回 /proxy 端点的 RFC 9728 元数据，MCP 客户端据此发现 one-mcp 的授权服务器
+// @Tags OAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/oauth-protected-resource [get]
+func OAuthProtectedResourceMetadata(c *gin.Context) {
+	issuer := service.OAuthIssuer(c.Request)
+	c.JSON(http.StatusOK, gin.H{
+		"resource":                 issuer + c.Param("resource"),
+		"authorization_servers":    []string{issuer},
+		"scopes_supported":         []string{service.OAuthScopeMCP},
+		"bearer_methods_supported": []string{"header"},
+		"resource_name":            common.GetSystemName(),
+	})
+}
+
+// OAuthAuthorizationServerMetadata godoc
+// @Summary OAuth 授权服务器元数据
+// @Description 返回 RFC 8414 授权服务器元数据：授权、令牌、动态注册与撤销端点，仅支持 S256 PKCE
+// @Tags OAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/oauth-authorization-server [get]
+func OAuthAuthorizationServerMetadata(c *gin.Context) {
+	issuer := service.OAuthIssuer(c.Request)
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                     issuer,
+		"authorization_endpoint":                     issuer + "/oauth/authorize",
+		"token_endpoint":                             issuer + "/oauth/token",
+		"registration_endpoint":                      issuer + "/oauth/register",
+		"revocation_endpoint":                        issuer + "/oauth/revoke",
+		"scopes_supported":                           []string{service.OAuthScopeMCP},
+		"response_types_supported":                   []string{"code"},
+		"grant_types_supported":                      []string{"authorization_code", "refresh_token"},
+		"code_challenge_methods_supported":           []string{service.OAuthCodeChallengeMethod},
+		"token_endpoint_auth_methods_supported":      []string{model.OAuthAuthMethodNone, model.OAuthAuthMethodClientSecretPost, model.OAuthAuthMethodClientSecretBasic},
+		"revocation_endpoint_auth_methods_supported": []string{model.OAuthAuthMethodNone, model.OAuthAuthMethodClientSecretPost, model.OAuthAuthMethodClientSecretBasic},
+	})
+}
+
+// OAuthClientRegistrationRequest is the client metadata of a dynamic client registration (RFC 7591)
+type OAuthClientRegistrationRequest struct {
+	RedirectURIs            []string `json:"redirect_uris"`
+	ClientName              string   `json:"client_name"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+}
+
+// RegisterOAuthClient godoc
+// @Summary 动态注册 OAuth 客户端
+// @Description MCP 客户端按 RFC 7591 注册自身，返回 client_id（机密客户端另返回 client_secret）
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Param body body OAuthClientRegistrationRequest true "客户端元数据"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /oauth/register [post]
+func RegisterOAuthClient(c *gin.Context) {
+	var req OAuthClientRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		oauthErrorResponse(c, http.StatusBadRequest, "invalid_client_metadata", "Invalid client metadata: "+err.Error())
+		return
+	}
+	for _, grantType := range req.GrantTypes {
+		if grantType != "authorization_code" && grantType != "refresh_token" {
+			oauthErrorResponse(c, http.StatusBadRequest, "invalid_client_metadata", "Unsupported grant type: "+grantType)
+			return
+		}
+	}
+	for _, responseType := range req.ResponseTypes {
+		if responseType != "code" {
+			oauthErrorResponse(c, http.StatusBadRequest, "invalid_client_metadata", "Unsupported response type: "+responseType)
+			return
+		}
+	}
+
+	client, secret, err := model.RegisterOAuthClient(req.ClientName, req.RedirectURIs, req.TokenEndpointAuthMethod)
+	if errors.Is(err, model.ErrOAuthInvalidRedirectURI) {
+		oauthErrorResponse(c, http.StatusBadRequest, "invalid_redirect_uri", err.Error())
+		return
+	}
+	if err != nil {
+		oauthErrorResponse(c, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+	common.SysLog(fmt.Sprintf("[OAuthServer] Registered client %s (%s)", client.ClientID, client.ClientName))
+
+	response := gin.H{
+		"client_id":                  client.ClientID,
+		"client_id_issued_at":        client.CreatedAt.Unix(),
+		"client_name":                client.ClientName,
+		"redirect_uris":              client.GetRedirectURIs(),
+		"token_endpoint_auth_method": client.TokenEndpointAuthMethod,
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+	}
+	if secret != "" {
+		response["client_secret"] = secret
+		response["client_secret_expires_at"] = 0
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// parseOAuthAuthorizationRequest validates the parameters of an authorization request. When the client and
+// redirect URI are valid but another parameter is not, the request is returned with a *service.OAuthError so
+// the error can be reported to the client; otherwise errors are shown to the user only.
+func parseOAuthAuthorizationRequest(c *gin.Context) (*service.OAuthAuthorizationRequest, error) {
+	client, err := model.GetOAuthClient(c.Query("client_id"))
+	if err != nil {
+		return nil, errors.New("unknown client_id")
+	}
+	redirectURI := c.Query("redirect_uri")
+	if redirectURI == "" {
+		if uris := client.GetRedirectURIs(); len(uris) == 1 {
+			redirectURI = uris[0]
+		}
+	}
+	if redirectURI == "" || !client.AllowsRedirectURI(redirectURI) {
+		return nil, errors.New("redirect_uri is not registered for this client")
+	}
+
+	request := &service.OAuthAuthorizationRequest{
+		ClientID:      client.ClientID,
+		ClientName:    client.ClientName,
+		RedirectURI:   redirectURI,
+		State:         c.Query("state"),
+		CodeChallenge: c.Query("code_challenge"),
+		Scope:         service.OAuthScopeMCP, // The only scope; other requested scopes are not granted
+		Resource:      c.Query("resource"),
+	}
+	if request.ClientName == "" {
+		request.ClientName = client.ClientID
+	}
+	if c.Query("response_type") != "code" {
+		return request, &service.OAuthError{Code: "unsupported_response_type", Description: "response_type must be code"}
+	}
+	if request.CodeChallenge == "" || c.Query("code_challenge_method") != service.OAuthCodeChallengeMethod {
+		return request, &service.OAuthError{Code: "invalid_request", Description: "PKCE with code_challenge_method S256 is required"}
+	}
+	if request.Resource != "" {
+		if err := service.ValidateOAuthResource(service.OAuthIssuer(c.Request), request.Resource); err != nil {
+			return request, err
+		}
+	}
+	return request, nil
+}
+
+// OAuthAuthorize godoc
+// @Summary OAuth 授权页面
+// @Description 校验 MCP 客户端的授权请求并显示授权页面；已在浏览器登录的用户可直接授权，否则先输入用户名和密码
+// @Tags OAuth
+// @Produce html
+// @Param client_id query string true "客户端ID"
+// @Param redirect_uri query string false "回调地址"
+// @Param response_type query string true "必须为 code"
+// @Param code_challenge query string true "PKCE challenge"
+// @Param code_challenge_method query string true "必须为 S256"
+// @Param state query string false "客户端 state"
+// @Param scope query string false "权限范围"
+// @Param resource query string false "RFC 8707 资源标识"
+// @Success 200 {string} string "授权页面"
+// @Failure 302
+// @Failure 400 {string} string "错误页面"
+// @Router /oauth/authorize [get]
+func OAuthAuthorize(c *gin.Context) {
+	request, err := parseOAuthAuthorizationRequest(c)
+	var oauthErr *service.OAuthError
+	if request != nil && errors.As(err, &oauthErr) {
+		redirectURL, redirectErr := service.OAuthRedirectURL(request.RedirectURI, request.State, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+		})
+		if redirectErr == nil {
+			c.Redirect(http.StatusFound, redirectURL)
+			return
+		}
+		err = redirectErr
+	}
+	if err != nil {
+		renderOAuthAuthorizePage(c, http.StatusBadRequest, oauthAuthorizePage{Fatal: err.Error()})
+		return
+	}
+
+	requestID, err := service.SaveOAuthAuthorizationRequest(c.Request.Context(), request)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[OAuthServer] Failed to save authorization request: %v", err))
+		renderOAuthAuthorizePage(c, http.StatusInternalServerError, oauthAuthorizePage{Fatal: "Failed to start the authorization"})
+		return
+	}
+	renderOAuthAuthorizePage(c, http.StatusOK, newOAuthAuthorizePage(requestID, request))
+}
+
+// OAuthAuthorizeSubmit godoc
+// @Summary 提交 OAuth 授权
+// @Description 使用用户名和密码登录并授权客户端，或拒绝授权；随后跳转回客户端的回调地址
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param request_id formData string true "授权请求ID"
+// @Param action formData string true "approve 或 deny"
+// @Param username formData string false "用户名"
+// @Param password formData string false "密码"
+// @Success 302
+// @Failure 400 {string} string "错误页面"
+// @Failure 401 {string} string "授权页面"
+// @Router /oauth/authorize [post]
+func OAuthAuthorizeSubmit(c *gin.Context) {
+	ctx := c.Request.Context()
+	requestID := c.PostForm("request_id")
+	request, err := service.GetOAuthAuthorizationRequest(ctx, requestID)
+	if err != nil {
+		renderOAuthAuthorizePage(c, http.StatusBadRequest, oauthAuthorizePage{Fatal: err.Error()})
+		return
+	}
+
+	if c.PostForm("action") == "deny" {
+		redirectURL, err := service.DenyOAuthAuthorizationRequest(ctx, requestID)
+		if err != nil {
+			renderOAuthAuthorizePage(c, http.StatusBadRequest, oauthAuthorizePage{Fatal: err.Error()})
+			return
+		}
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+
+	user := &model.User{
+		Username: c.PostForm("username"),
+		Password: c.PostForm("password"),
+	}
+	if err := user.ValidateAndFill(); err != nil {
+		page := newOAuthAuthorizePage(requestID, request)
+		page.Error = "Invalid username or password"
+		renderOAuthAuthorizePage(c, http.StatusUnauthorized, page)
+		return
+	}
+	redirectURL, err := service.ApproveOAuthAuthorizationRequest(ctx, requestID, user.ID)
+	if err != nil {
+		renderOAuthAuthorizePage(c, http.StatusBadRequest, oauthAuthorizePage{Fatal: err.Error()})
+		return
+	}
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// ApproveOAuthAuthorizationRequest is the request body of ApproveOAuthAuthorization
+type ApproveOAuthAuthorizationRequest struct {
+	RequestID string `json:"request_id" binding:"required"`
+}
+
+// ApproveOAuthAuthorization godoc
+// @Summary 以当前会话授权 OAuth 客户端
+// @Description 授权页面检测到浏览器中已登录的会话时调用，返回带授权码的客户端回调地址
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Param body body ApproveOAuthAuthorizationRequest true "授权请求"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 401 {object} common.APIResponse
+// @Router /api/oauth/authorize/approve [post]
+func ApproveOAuthAuthorization(c *gin.Context) {
+	lang := c.GetString("lang")
+	var req ApproveOAuthAuthorizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	user, err := model.GetUserById(getUserIDFromContext(c), false)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
+		return
+	}
+	redirectURL, err := service.ApproveOAuthAuthorizationRequest(c.Request.Context(), req.RequestID, user.ID)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("oauth_authorization_request_invalid", lang), err)
+		return
+	}
+	common.RespSuccess(c, gin.H{"redirect_url": redirectURL})
+}
+
+// authenticateOAuthClient identifies the client of a token or revocation request by HTTP Basic credentials or
+// form parameters. Public clients only present their client_id.
+func authenticateOAuthClient(c *gin.Context) (*model.OAuthClient, bool) {
+	clientID, clientSecret, basic := c.Request.BasicAuth()
+	if basic {
+		// Credentials are form-urlencoded before being put in the header (RFC 6749 section 2.3.1)
+		if unescaped, err := url.QueryUnescape(clientID); err == nil {
+			clientID = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(clientSecret); err == nil {
+			clientSecret = unescaped
+		}
+	} else {
+		clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	client, err := model.GetOAuthClient(clientID)
+	if err != nil {
+		return nil, false
+	}
+	if !client.IsPublic() && !client.ValidateSecret(clientSecret) {
+		return nil, false
+	}
+	return client, true
+}
+
+// OAuthToken godoc
+// @Summary OAuth 令牌端点
+// @Description 用授权码（须附 PKCE code_verifier）或刷新令牌换取访问令牌；刷新令牌每次使用后轮换
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code 或 refresh_token"
+// @Param code formData string false "授权码"
+// @Param redirect_uri formData string false "授权时使用的回调地址"
+// @Param code_verifier formData string false "PKCE verifier"
+// @Param resource formData string false "RFC 8707 资源标识，须与授权时一致"
+// @Param refresh_token formData string false "刷新令牌"
+// @Param client_id formData string false "客户端ID（未使用 HTTP Basic 认证时）"
+// @Param client_secret formData string false "客户端密钥（机密客户端）"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /oauth/token [post]
+func OAuthToken(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client, ok := authenticateOAuthClient(c)
+	if !ok {
+		oauthErrorResponse(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	var token *model.OAuthToken
+	var accessToken, refreshToken string
+	var err error
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		resource := c.PostForm("resource")
+		if resource != "" {
+			err = service.ValidateOAuthResource(service.OAuthIssuer(c.Request), resource)
+		}
+		if err == nil {
+			token, accessToken, refreshToken, err = service.ExchangeOAuthAuthorizationCode(c.Request.Context(),
+				c.PostForm("code"), client.ClientID, c.PostForm("redirect_uri"), c.PostForm("code_verifier"), resource)
+		}
+	case "refresh_token":
+		token, accessToken, refreshToken, err = model.RefreshOAuthToken(c.PostForm("refresh_token"), client.ClientID)
+		if errors.Is(err, model.ErrOAuthInvalidGrant) {
+			err = &service.OAuthError{Code: "invalid_grant", Description: "The refresh token is invalid or expired"}
+		}
+	default:
+		oauthErrorResponse(c, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		oauthErrorResponse(c, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+		return
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("[OAuthServer] Failed to issue token to client %s: %v", client.ClientID, err))
+		oauthErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to issue the token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int64(time.Until(token.ExpiresAt).Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         token.Scope,
+	})
+}
+
+// OAuthRevoke godoc
+// @Summary 撤销 OAuth 令牌
+// @Description 按 RFC 7009 撤销访问令牌或刷新令牌，同一授权的另一令牌一并失效；未知令牌同样返回 200
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "访问令牌或刷新令牌"
+// @Success 200
+// @Failure 401 {object} map[string]interface{}
+// @Router /oauth/revoke [post]
+func OAuthRevoke(c *gin.Context) {
+	client, ok := authenticateOAuthClient(c)
+	if !ok {
+		oauthErrorResponse(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+	if err := model.RevokeOAuthToken(c.PostForm("token"), client.ClientID); err != nil {
+		common.SysError(fmt.Sprintf("[OAuthServer] Failed to revoke token of client %s: %v", client.ClientID, err))
+		oauthErrorResponse(c, http.StatusServiceUnavailable, "temporarily_unavailable", "Failed to revoke the token")
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// oauthAuthorizePage is the data of the authorization page. A page with Fatal set only shows the error.
+type oauthAuthorizePage struct {
+	SystemName   string
+	RequestID    string
+	ClientName   string
+	RedirectHost string
+	Error        string
+	Fatal        string
+}
+
+func newOAuthAuthorizePage(requestID string, request *service.OAuthAuthorizationRequest) oauthAuthorizePage {
+	page := oauthAuthorizePage{RequestID: requestID, ClientName: request.ClientName}
+	if u, err := url.Parse(request.RedirectURI); err == nil {
+		page.RedirectHost = u.Scheme + "://" + u.Host
+	}
+	return page
+}
+
+func renderOAuthAuthorizePage(c *gin.Context, status int, page oauthAuthorizePage) {
+	page.SystemName = common.GetSystemName()
+	if page.SystemName == "" {
+		page.SystemName = "One MCP"
+	}
+	// The page must not be framed, or a site could trick a logged-in user into approving a client
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := oauthAuthorizeTemplate.Execute(c.Writer, page); err != nil {
+		common.SysError(fmt.Sprintf("[OAuthServer] Failed to render authorization page: %v", err))
+	}
+}
+
+// oauthAuthorizeTemplate is served by the backend rather than the frontend so MCP clients can complete the
+// flow with only the server URL. A user logged in to the web UI (JWT in localStorage) approves with one click.
+var oauthAuthorizeTemplate = template.Must(template.New("oauth_authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize - {{.SystemName}}</title>
+<style>
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Roboto,sans-serif;background:#f5f5f7;margin:0;display:flex;justify-content:center;align-items:center;min-height:100vh;color:#1d1d1f}
+.card{background:#fff;border-radius:12px;box-shadow:0 4px 24px rgba(0,0,0,.08);padding:32px;width:100%;max-width:380px}
+h1{font-size:20px;margin:0 0 8px}p{font-size:14px;color:#555;line-height:1.5}
+label{display:block;font-size:13px;margin:12px 0 4px}
+input{width:100%;box-sizing:border-box;padding:9px 10px;border:1px solid #ccc;border-radius:6px;font-size:14px}
+.actions{display:flex;gap:8px;margin-top:20px}
+button{flex:1;padding:10px;border-radius:6px;border:1px solid #ccc;background:#fff;font-size:14px;cursor:pointer}
+button.primary{background:#111;color:#fff;border-color:#111}
+.error{color:#c62828;font-size:13px;margin-top:12px}
+.hidden{display:none}
+</style>
+</head>
+<body>
+<div class="card">
+<h1>{{.SystemName}}</h1>
+{{if .Fatal}}
+<p>The authorization request cannot be completed.</p>
+<p class="error">{{.Fatal}}</p>
+{{else}}
+<p><strong>{{.ClientName}}</strong> wants to use your MCP services. After you approve, you will be returned to {{.RedirectHost}}.</p>
+<div id="session" class="hidden">
+<p>Signed in as <strong id="session-user"></strong>.</p>
+<div class="actions">
+<button type="button" id="session-approve" class="primary">Authorize</button>
+<button type="button" id="session-other">Use another account</button>
+</div>
+</div>
+<form id="login" method="post" action="/oauth/authorize">
+<input type="hidden" name="request_id" value="{{.RequestID}}">
+<label for="username">Username</label>
+<input id="username" name="username" autocomplete="username">
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password">
+<div class="actions">
+<button type="submit" name="action" value="approve" class="primary">Sign in and authorize</button>
+<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+</div>
+</form>
+<p id="error" class="error">{{.Error}}</p>
+<script>
+(function () {
+  var requestId = {{.RequestID}};
+  var token = localStorage.getItem('token');
+  if (!token) return;
+  var headers = {'Authorization': 'Bearer ' + token, 'Content-Type': 'application/json'};
+  fetch('/api/user/self', {headers: headers}).then(function (r) { return r.json(); }).then(function (res) {
+    if (!res.success || !res.data) return;
+    document.getElementById('session-user').textContent = res.data.display_name || res.data.username;
+    document.getElementById('session').classList.remove('hidden');
+    document.getElementById('login').classList.add('hidden');
+  }).catch(function () {});
+  document.getElementById('session-other').onclick = function () {
+    document.getElementById('session').classList.add('hidden');
+    document.getElementById('login').classList.remove('hidden');
+  };
+  document.getElementById('session-approve').onclick = function () {
+    fetch('/api/oauth/authorize/approve', {method: 'POST', headers: headers, body: JSON.stringify({request_id: requestId})})
+      .then(function (r) { return r.json(); }).then(function (res) {
+        if (res.success) { window.location.href = res.data.redirect_url; return; }
+        document.getElementById('error').textContent = res.message;
+      }).catch(function (e) { document.getElementById('error').textContent = String(e); });
+  };
+})();
+</script>
+{{end}}
+</div>
+</body>
+</html>
+`))
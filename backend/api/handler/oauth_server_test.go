@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"one-mcp/backend/api/middleware"
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOAuthServerTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/.well-known/oauth-authorization-server", OAuthAuthorizationServerMetadata)
+	r.GET("/.well-known/oauth-protected-resource/*resource", OAuthProtectedResourceMetadata)
+	r.POST("/oauth/register", RegisterOAuthClient)
+	r.GET("/oauth/authorize", OAuthAuthorize)
+	r.POST("/oauth/authorize", OAuthAuthorizeSubmit)
+	r.POST("/oauth/token", OAuthToken)
+	r.POST("/oauth/revoke", OAuthRevoke)
+	r.Any("/proxy/:serviceName/*action", ProxyHandler)
+	return r
+}
+
+func postOAuthForm(r *gin.Engine, path string, form url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOAuthServer_AuthorizationCodeFlow(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+	common.OptionMap["ServerAddress"] = "https://mcp.example.com"
+	r := newOAuthServerTestRouter()
+
+	// An unauthenticated MCP client is pointed at the resource metadata, and from there at the authorization server
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/proxy/_all/mcp", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource/proxy/_all/mcp"`, w.Header().Get("WWW-Authenticate"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/.well-known/oauth-protected-resource/proxy/_all/mcp", nil)
+	r.ServeHTTP(w, req)
+	var resource map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resource))
+	assert.Equal(t, "https://mcp.example.com/proxy/_all/mcp", resource["resource"])
+	assert.Equal(t, []interface{}{"https://mcp.example.com"}, resource["authorization_servers"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/.well-known/oauth-authorization-server", nil)
+	r.ServeHTTP(w, req)
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metadata))
+	assert.Equal(t, "https://mcp.example.com/oauth/token", metadata["token_endpoint"])
+	assert.Equal(t, []interface{}{"S256"}, metadata["code_challenge_methods_supported"])
+
+	// Dynamic registration of a public client; plain HTTP is only accepted for loopback redirects
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/oauth/register", strings.NewReader(`{"client_name":"Evil","redirect_uris":["http://evil.example.com/cb"]}`))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_redirect_uri")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/oauth/register", strings.NewReader(`{"client_name":"Test Client","redirect_uris":["http://127.0.0.1/callback"],"token_endpoint_auth_method":"none"}`))
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var registered map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &registered))
+	clientID, _ := registered["client_id"].(string)
+	assert.True(t, strings.HasPrefix(clientID, model.OAuthClientIDPrefix))
+	assert.NotContains(t, registered, "client_secret", "public clients get no secret")
+
+	verifier := strings.Repeat("v", 50)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	redirectURI := "http://127.0.0.1:43123/callback" // Loopback redirects may use any port
+	authorize := url.Values{
+		"client_id":     {clientID},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"state":         {"xyz"},
+	}
+
+	// Without PKCE the error is returned to the client
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/oauth/authorize?"+authorize.Encode(), nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, "invalid_request", location.Query().Get("error"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+
+	authorize.Set("code_challenge", challenge)
+	authorize.Set("code_challenge_method", "S256")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/oauth/authorize?"+authorize.Encode(), nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Test Client")
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	match := regexp.MustCompile(`name="request_id" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	require.Len(t, match, 2)
+	requestID := match[1]
+
+	w = postOAuthForm(r, "/oauth/authorize", url.Values{"request_id": {requestID}, "action": {"approve"}, "username": {"root"}, "password": {"wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postOAuthForm(r, "/oauth/authorize", url.Values{"request_id": {requestID}, "action": {"approve"}, "username": {"root"}, "password": {"123456"}})
+	require.Equal(t, http.StatusFound, w.Code)
+	location, _ = url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, "127.0.0.1:43123", location.Host)
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	// The request cannot be answered twice
+	w = postOAuthForm(r, "/oauth/authorize", url.Values{"request_id": {requestID}, "action": {"approve"}, "username": {"root"}, "password": {"123456"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {clientID},
+		"code_verifier": {verifier},
+	}
+	w = postOAuthForm(r, "/oauth/token", exchange)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var token struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Greater(t, token.ExpiresIn, int64(0))
+	_, user := model.ValidateOAuthAccessToken(token.AccessToken)
+	require.NotNil(t, user)
+	assert.Equal(t, "root", user.Username)
+
+	// Codes are single-use
+	w = postOAuthForm(r, "/oauth/token", exchange)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_grant")
+
+	// Refresh tokens are rotated and the old pair stops working
+	w = postOAuthForm(r, "/oauth/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token.RefreshToken}, "client_id": {clientID}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	oldAccessToken, oldRefreshToken := token.AccessToken, token.RefreshToken
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+	assert.NotEqual(t, oldAccessToken, token.AccessToken)
+	_, user = model.ValidateOAuthAccessToken(oldAccessToken)
+	assert.Nil(t, user)
+	w = postOAuthForm(r, "/oauth/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {oldRefreshToken}, "client_id": {clientID}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postOAuthForm(r, "/oauth/revoke", url.Values{"token": {token.AccessToken}, "client_id": {clientID}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, user = model.ValidateOAuthAccessToken(token.AccessToken)
+	assert.Nil(t, user)
+}
+
+func TestOAuthServer_ConfidentialClientMustAuthenticate(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+	r := newOAuthServerTestRouter()
+
+	client, secret, err := model.RegisterOAuthClient("Confidential", []string{"https://client.example.com/cb"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, model.OAuthAuthMethodClientSecretBasic, client.TokenEndpointAuthMethod)
+	require.NotEmpty(t, secret)
+
+	w := postOAuthForm(r, "/oauth/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"omr_unknown"}, "client_id": {client.ClientID}, "client_secret": {"wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_client")
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader("grant_type=refresh_token&refresh_token=omr_unknown"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(client.ClientID, secret)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the client authenticated, but the grant is invalid")
+	assert.Contains(t, w.Body.String(), "invalid_grant")
+}
+
+func TestOAuthServer_TokensAreBoundToTheirResource(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+	common.OptionMap["ServerAddress"] = "https://mcp.example.com"
+	r := newOAuthServerTestRouter()
+	proxyRouter := gin.New()
+	proxyRouter.Any("/proxy/:serviceName/*action", middleware.TokenAuth(), func(c *gin.Context) {
+		_, authenticated := c.Get("oauth_token")
+		c.JSON(http.StatusOK, gin.H{"authenticated": authenticated})
+	})
+
+	client, _, err := model.RegisterOAuthClient("Bound", []string{"http://127.0.0.1/callback"}, model.OAuthAuthMethodNone)
+	require.NoError(t, err)
+	verifier := strings.Repeat("r", 50)
+	sum := sha256.Sum256([]byte(verifier))
+	authorize := url.Values{
+		"client_id":             {client.ClientID},
+		"response_type":         {"code"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	// Only the MCP endpoints of this server can be requested
+	for _, resource := range []string{"https://evil.example.com/proxy", "https://mcp.example.com/api", "https://mcp.example.com/proxy/../api"} {
+		authorize.Set("resource", resource)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/oauth/authorize?"+authorize.Encode(), nil)
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusFound, w.Code, resource)
+		location, _ := url.Parse(w.Header().Get("Location"))
+		assert.Equal(t, "invalid_target", location.Query().Get("error"), resource)
+	}
+
+	authorize.Set("resource", "https://mcp.example.com/proxy/github")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/oauth/authorize?"+authorize.Encode(), nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	match := regexp.MustCompile(`name="request_id" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	require.Len(t, match, 2)
+	w = postOAuthForm(r, "/oauth/authorize", url.Values{"request_id": {match[1]}, "action": {"approve"}, "username": {"root"}, "password": {"123456"}})
+	require.Equal(t, http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"client_id":     {client.ClientID},
+		"code_verifier": {verifier},
+		"resource":      {"https://mcp.example.com/proxy/other"},
+	}
+	w = postOAuthForm(r, "/oauth/token", exchange)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_target")
+
+	// The failed exchange used up the code, so authorize again and redeem it for the same resource
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/oauth/authorize?"+authorize.Encode(), nil)
+	r.ServeHTTP(w, req)
+	match = regexp.MustCompile(`name="request_id" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	require.Len(t, match, 2)
+	w = postOAuthForm(r, "/oauth/authorize", url.Values{"request_id": {match[1]}, "action": {"approve"}, "username": {"root"}, "password": {"123456"}})
+	location, _ = url.Parse(w.Header().Get("Location"))
+	exchange.Set("code", location.Query().Get("code"))
+	exchange.Set("resource", "https://mcp.example.com/proxy/github")
+	w = postOAuthForm(r, "/oauth/token", exchange)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+	stored, _ := model.ValidateOAuthAccessToken(token.AccessToken)
+	require.NotNil(t, stored)
+	assert.Equal(t, "https://mcp.example.com/proxy/github", stored.Resource)
+
+	authenticated := func(target, authorization string) bool {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", target, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		proxyRouter.ServeHTTP(w, req)
+		var body struct {
+			Authenticated bool `json:"authenticated"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Authenticated
+	}
+	assert.True(t, authenticated("/proxy/github/mcp", "Bearer "+token.AccessToken))
+	assert.False(t, authenticated("/proxy/github2/mcp", "Bearer "+token.AccessToken), "outside the resource")
+	assert.False(t, authenticated("/proxy/_all/mcp", "Bearer "+token.AccessToken), "outside the resource")
+	assert.False(t, authenticated("/proxy/github/mcp?key="+token.AccessToken, ""), "access tokens are not accepted in the query string")
+}
@@ -3,10 +3,13 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
 	"one-mcp/backend/common"
+	"one-mcp/backend/library/declarative"
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
 	"one-mcp/backend/service"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -39,6 +42,13 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	if declarative.IsManagedOption(option.Key) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该选项由配置文件管理，请在配置文件中修改！",
+		})
+		return
+	}
 	switch option.Key {
 	case "ServerAddress":
 		proxy.ClearSSEProxyCache()
@@ -74,6 +84,58 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "MCPRegistryURL":
+		// 留空则使用官方 Registry
+		if option.Value != "" {
+			if u, err := url.Parse(option.Value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "MCP Registry 地址必须是 http 或 https 地址",
+				})
+				return
+			}
+		}
+	case "StatsRetentionDays", "StatsHourlyRetentionDays":
+		days, err := strconv.Atoi(option.Value)
+		if err != nil || days < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "保留天数必须是非负整数（0 表示永久保留）",
+			})
+			return
+		}
+		// 日汇总由小时汇总生成，小时汇总至少需要保留到当天结束
+		if option.Key == "StatsHourlyRetentionDays" && days > 0 && days < 2 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "小时汇总至少需要保留 2 天",
+			})
+			return
+		}
+	case "CircuitBreakerThreshold", "CircuitBreakerCooldownSeconds":
+		if value, err := strconv.Atoi(option.Value); err != nil || value <= 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "熔断器配置必须是正整数",
+			})
+			return
+		}
+	case "UserInstanceIdleTimeoutMinutes", "MaxUserInstances", "MaxUserInstancesPerService":
+		if value, err := strconv.Atoi(option.Value); err != nil || value < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "实例限制必须是非负整数（0 表示不限制）",
+			})
+			return
+		}
+	case "StdioMaxRestarts":
+		if value, err := strconv.Atoi(option.Value); err != nil || value <= 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "最大自动重启次数必须是正整数",
+			})
+			return
+		}
 	}
 	err = service.UpdateOption(option.Key, option.Value)
 	if err != nil {
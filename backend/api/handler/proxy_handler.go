@@ -1,11 +1,11 @@
 package handler
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -43,6 +43,26 @@ func parseInt64(value interface{}) (int64, error) {
 	}
 }
 
+// apiKeyFromContext returns the named API key used to authenticate the request, if any.
+// Requests authenticated with the legacy user token have no API key and are unscoped.
+func apiKeyFromContext(c *gin.Context) *model.APIKey {
+	if val, exists := c.Get("api_key"); exists {
+		if apiKey, ok := val.(*model.APIKey); ok {
+			return apiKey
+		}
+	}
+	return nil
+}
+
+// callerFromContext builds the proxy caller used for tool policy and read-only enforcement.
+func callerFromContext(c *gin.Context, userID int64) proxy.Caller {
+	caller := proxy.Caller{UserID: userID, Role: c.GetInt("role")}
+	if apiKey := apiKeyFromContext(c); apiKey != nil {
+		caller.ReadOnly = apiKey.ReadOnly
+	}
+	return caller
+}
+
 // checkDailyRequestLimit checks if the user has exceeded their daily request limit for the service
 func checkDailyRequestLimit(serviceID int64, userID int64, rpdLimit int) error {
 	// If RPD limit is 0, no limit is enforced
@@ -83,48 +103,163 @@ func checkDailyRequestLimit(serviceID int64, userID int64, rpdLimit int) error {
 	return nil
 }
 
-// tryGetOrCreateUserSpecificHandler attempts to find or create a handler tailored for a specific user.
-// proxyType should be "sseproxy" or "httpproxy"
-func tryGetOrCreateUserSpecificHandler(c *gin.Context, mcpDBService *model.MCPService, userID int64, proxyType string) (http.Handler, error) {
+// getOrCreateUserSpecificInstance returns the shared MCP instance running with the user's merged environment
+// variables (stdio) or headers (SSE and streamable HTTP).
+func getOrCreateUserSpecificInstance(ctx context.Context, mcpDBService *model.MCPService, userID int64) (*proxy.SharedMcpInstance, error) {
+	serviceForUser := mcpDBService
+	mergedEnvsJSON := ""
+	if mcpDBService.Type == model.ServiceTypeStdio {
+		// Fetch and merge user-specific ENVs
+		userEnvs, userEnvErr := model.GetUserSpecificEnvs(userID, mcpDBService.ID)
+		if userEnvErr != nil {
+			common.SysError(fmt.Sprintf("[ProxyHandler] Error fetching user-specific ENVs for user %d, service %s: %v", userID, mcpDBService.Name, userEnvErr))
+		}
+		mergedEnvsJSON = mergeUserValuesJSON(mcpDBService.DefaultEnvsJSON, userEnvs, mcpDBService.Name, userID)
+	} else {
+		// Build the user's headers into a copy of the service, which the client is built from
+		headers, err := userUpstreamHeaders(mcpDBService, userID)
+		if err != nil {
+			return nil, err
+		}
+		headersJSON, err := json.Marshal(headers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal headers for %s (user %d): %w", mcpDBService.Name, userID, err)
+		}
+		serviceCopy := *mcpDBService
+		serviceCopy.HeadersJSON = string(headersJSON)
+		serviceForUser = &serviceCopy
+	}
+
+	// Create user-specific shared MCP instance
+	userSharedCacheKey := proxy.UserInstanceCacheKey(userID, mcpDBService.ID)
+	instanceNameDetail := fmt.Sprintf("user-%d-shared-svc-%d", userID, mcpDBService.ID)
+
+	sharedInst, err := proxy.GetOrCreateSharedMcpInstanceWithKey(ctx, serviceForUser, userSharedCacheKey, instanceNameDetail, mergedEnvsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user-specific shared MCP instance for %s (user %d): %w", mcpDBService.Name, userID, err)
+	}
+	return sharedInst, nil
+}
 
-	// Prepare user-specific environment variables
-	currentEnvMap := make(map[string]string)
-	// Populate currentEnvMap from DefaultEnvsJSON first
-	if mcpDBService.DefaultEnvsJSON != "" && mcpDBService.DefaultEnvsJSON != "{}" {
-		if err := json.Unmarshal([]byte(mcpDBService.DefaultEnvsJSON), &currentEnvMap); err != nil {
-			common.SysError(fmt.Sprintf("[ProxyHandler] Error unmarshalling DefaultEnvsJSON for %s (user-specific): %v", mcpDBService.Name, err))
-			currentEnvMap = make(map[string]string)
+// mergeUserValuesJSON overlays a user's values on the admin defaults of a service (a JSON object such as
+// DefaultEnvsJSON or HeadersJSON). Stored defaults may be encrypted; they are decrypted when the client is built.
+func mergeUserValuesJSON(defaultsJSON string, userValues map[string]string, serviceName string, userID int64) string {
+	merged := make(map[string]string)
+	if defaultsJSON != "" && defaultsJSON != "{}" {
+		if err := json.Unmarshal([]byte(defaultsJSON), &merged); err != nil {
+			common.SysError(fmt.Sprintf("[ProxyHandler] Error unmarshalling defaults for %s (user-specific): %v", serviceName, err))
+			merged = make(map[string]string)
 		}
 	}
+	for k, v := range userValues {
+		merged[k] = v // User-specific values override the defaults
+	}
 
-	// Fetch and merge user-specific ENVs
-	userEnvs, userEnvErr := model.GetUserSpecificEnvs(userID, mcpDBService.ID)
-	if userEnvErr != nil {
-		common.SysError(fmt.Sprintf("[ProxyHandler] Error fetching user-specific ENVs for user %d, service %s: %v", userID, mcpDBService.Name, userEnvErr))
+	mergedJSON, err := json.Marshal(merged)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[ProxyHandler] Error marshalling merged values for user %d, service %s: %v. Proceeding with the defaults.", userID, serviceName, err))
+		return defaultsJSON
 	}
+	return string(mergedJSON)
+}
 
-	if len(userEnvs) > 0 {
-		for k, v := range userEnvs {
-			currentEnvMap[k] = v // User-specific ENVs override DefaultEnvsJSON
+// missingHeaderValuesError is returned when the headers of a remote service need values, e.g. a personal
+// token for "Authorization: Bearer {{API_TOKEN}}", that the user has not configured
+type missingHeaderValuesError struct {
+	serviceName string
+	names       []string
+}
+
+func (e *missingHeaderValuesError) Error() string {
+	return fmt.Sprintf("service %s needs values for %s in the user's configuration", e.serviceName, strings.Join(e.names, ", "))
+}
+
+// userUpstreamHeaders returns the headers a user's client sends to a remote service: the admin's headers,
+// overridden by the user's own, with {{NAME}} placeholders filled from the user's configuration
+func userUpstreamHeaders(mcpDBService *model.MCPService, userID int64) (map[string]string, error) {
+	headers := make(map[string]string)
+	if mcpDBService.HeadersJSON != "" && mcpDBService.HeadersJSON != "{}" {
+		decoded, err := model.DecryptJSONMap(mcpDBService.HeadersJSON)
+		if err != nil {
+			common.SysError(fmt.Sprintf("[ProxyHandler] Error decoding headers of %s (user-specific): %v", mcpDBService.Name, err))
+		} else if decoded != nil {
+			headers = decoded
 		}
 	}
 
-	// Marshal the merged env map back to JSON
-	mergedEnvsJSONBytes, marshalErr := json.Marshal(currentEnvMap)
-	if marshalErr != nil {
-		common.SysError(fmt.Sprintf("[ProxyHandler] Error marshalling merged ENVs for user %d, service %s: %v. Proceeding with original DefaultEnvsJSON.", userID, mcpDBService.Name, marshalErr))
-		mergedEnvsJSONBytes = []byte(mcpDBService.DefaultEnvsJSON)
+	userHeaders, err := model.GetUserSpecificHeaders(userID, mcpDBService.ID)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[ProxyHandler] Error fetching user-specific headers for user %d, service %s: %v", userID, mcpDBService.Name, err))
+	}
+	userEnvs, err := model.GetUserSpecificEnvs(userID, mcpDBService.ID)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[ProxyHandler] Error fetching user-specific values for user %d, service %s: %v", userID, mcpDBService.Name, err))
 	}
-	mergedEnvsJSON := string(mergedEnvsJSONBytes)
 
-	// Create user-specific shared MCP instance
-	ctx := c.Request.Context()
-	userSharedCacheKey := fmt.Sprintf("user-%d-service-%d-shared", userID, mcpDBService.ID)
-	instanceNameDetail := fmt.Sprintf("user-%d-shared-svc-%d", userID, mcpDBService.ID)
+	// Placeholders may name any of the user's values of the service
+	values := make(map[string]string, len(userEnvs)+len(userHeaders))
+	for k, v := range userEnvs {
+		values[k] = v
+	}
+	for k, v := range userHeaders {
+		headers[k] = v // User-specific headers override the admin's
+		values[k] = v
+	}
 
-	sharedInst, err := proxy.GetOrCreateSharedMcpInstanceWithKey(ctx, mcpDBService, userSharedCacheKey, instanceNameDetail, mergedEnvsJSON)
+	resolved, missing := model.ResolveHeaderTemplates(headers, values)
+	if len(missing) > 0 {
+		return nil, &missingHeaderValuesError{serviceName: mcpDBService.Name, names: missing}
+	}
+	return resolved, nil
+}
+
+// usesUserSpecificInstance reports whether a user is served by an instance of their own instead of the global
+// one: always for services using OAuth and stdio services that allow overrides, and for remote ones whose
+// headers the user sets or whose headers take {{NAME}} values from the user's configuration
+func usesUserSpecificInstance(mcpDBService *model.MCPService, userID int64) bool {
+	if userID <= 0 {
+		return false
+	}
+	if oauthConfig, err := mcpDBService.GetOAuthConfig(); err == nil && oauthConfig != nil {
+		return true // Every user connects with their own OAuth token
+	}
+	if !mcpDBService.AllowUserOverride {
+		return false
+	}
+	if mcpDBService.Type == model.ServiceTypeStdio {
+		return true
+	}
+	if userHeaders, err := model.GetUserSpecificHeaders(userID, mcpDBService.ID); err == nil && len(userHeaders) > 0 {
+		return true
+	}
+	if mcpDBService.HeadersJSON == "" || mcpDBService.HeadersJSON == "{}" {
+		return false
+	}
+	headers, err := model.DecryptJSONMap(mcpDBService.HeadersJSON)
+	return err == nil && model.HasHeaderTemplates(headers)
+}
+
+// getOrCreateGlobalInstance returns the globally shared MCP instance for the service.
+func getOrCreateGlobalInstance(ctx context.Context, mcpDBService *model.MCPService) (*proxy.SharedMcpInstance, error) {
+	// Use unified global cache key and standardized parameters (same as ServiceFactory)
+	globalSharedCacheKey := proxy.GlobalInstanceCacheKey(mcpDBService.ID)
+	instanceNameDetail := fmt.Sprintf("global-shared-svc-%d", mcpDBService.ID)
+	effectiveEnvs := mcpDBService.DefaultEnvsJSON
+
+	sharedInst, err := proxy.GetOrCreateSharedMcpInstanceWithKey(ctx, mcpDBService, globalSharedCacheKey, instanceNameDetail, effectiveEnvs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user-specific shared MCP instance for %s (user %d): %w", mcpDBService.Name, userID, err)
+		return nil, fmt.Errorf("failed to create shared MCP instance for %s: %w", mcpDBService.Name, err)
+	}
+	return sharedInst, nil
+}
+
+// tryGetOrCreateUserSpecificHandler attempts to find or create a handler tailored for a specific user.
+// proxyType should be "sseproxy" or "httpproxy"
+func tryGetOrCreateUserSpecificHandler(c *gin.Context, mcpDBService *model.MCPService, userID int64, proxyType string) (http.Handler, error) {
+	ctx := c.Request.Context()
+	sharedInst, err := getOrCreateUserSpecificInstance(ctx, mcpDBService, userID)
+	if err != nil {
+		return nil, err
 	}
 
 	var targetHandler http.Handler
@@ -149,16 +284,10 @@ func tryGetOrCreateUserSpecificHandler(c *gin.Context, mcpDBService *model.MCPSe
 // tryGetOrCreateGlobalHandler attempts to find or create a global handler for the service.
 // proxyType should be "sseproxy" or "httpproxy"
 func tryGetOrCreateGlobalHandler(c *gin.Context, mcpDBService *model.MCPService, proxyType string) (http.Handler, error) {
-
-	// Use unified global cache key and standardized parameters (same as ServiceFactory)
 	ctx := c.Request.Context()
-	globalSharedCacheKey := fmt.Sprintf("global-service-%d-shared", mcpDBService.ID)
-	instanceNameDetail := fmt.Sprintf("global-shared-svc-%d", mcpDBService.ID)
-	effectiveEnvs := mcpDBService.DefaultEnvsJSON
-
-	sharedInst, err := proxy.GetOrCreateSharedMcpInstanceWithKey(ctx, mcpDBService, globalSharedCacheKey, instanceNameDetail, effectiveEnvs)
+	sharedInst, err := getOrCreateGlobalInstance(ctx, mcpDBService)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create shared MCP instance for %s: %w", mcpDBService.Name, err)
+		return nil, err
 	}
 
 	var targetHandler http.Handler
@@ -180,6 +309,53 @@ func tryGetOrCreateGlobalHandler(c *gin.Context, mcpDBService *model.MCPService,
 	return targetHandler, nil
 }
 
+// respondCircuitOpen fails a request fast because the upstream's circuit breaker is open.
+// The body is a JSON-RPC error so MCP clients can surface it; Retry-After tells them when to try again.
+func respondCircuitOpen(c *gin.Context, serviceName string, openErr *proxy.CircuitOpenError) {
+	respondServiceUnavailable(c, serviceName, proxy.CircuitOpenErrorCode, openErr.Error(), openErr.RetryAfter, gin.H{
+		"circuit_state": proxy.CircuitOpen,
+		"last_error":    openErr.LastError,
+	})
+}
+
+// respondProcessUnavailable fails a request fast because the stdio process of the upstream crashed and is
+// waiting for its restart, or is crash looping. A crash-looping service has no Retry-After.
+func respondProcessUnavailable(c *gin.Context, serviceName string, procErr *proxy.ProcessUnavailableError) {
+	respondServiceUnavailable(c, serviceName, proxy.ProcessUnavailableErrorCode, procErr.Error(), procErr.RetryAfter, gin.H{
+		"crash_looping":  procErr.CrashLooping,
+		"last_exit_code": procErr.LastExitCode,
+	})
+}
+
+// respondServiceUnavailable writes a 503 JSON-RPC error carrying the service name and retry delay in its data
+func respondServiceUnavailable(c *gin.Context, serviceName string, code int, message string, retryAfter time.Duration, data gin.H) {
+	var rpc jsonRPCRequestInfo
+	if c.Request.Method == http.MethodPost {
+		rpc = peekJSONRPCRequest(c)
+	}
+	id := rpc.RawID
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	retryAfterSeconds := int64(math.Ceil(retryAfter.Seconds()))
+	proxy.ObserveProxyRequest(serviceName, rpc.Method, rpc.ToolName, http.StatusServiceUnavailable, 0)
+
+	if retryAfterSeconds > 0 {
+		c.Header("Retry-After", strconv.FormatInt(retryAfterSeconds, 10))
+	}
+	data["service"] = serviceName
+	data["retry_after_seconds"] = retryAfterSeconds
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error": gin.H{
+			"code":    code,
+			"message": message,
+			"data":    data,
+		},
+	})
+}
+
 // ProxyHandler handles GET and POST /proxy/:serviceName/*action
 func ProxyHandler(c *gin.Context) {
 	serviceName := c.Param("serviceName")
@@ -187,6 +363,11 @@ func ProxyHandler(c *gin.Context) {
 	requestPath := c.Request.URL.Path
 	requestMethod := c.Request.Method
 
+	if serviceName == proxy.AggregateServiceName {
+		AggregateProxyHandler(c)
+		return
+	}
+
 	// Only log if there's a query string for debugging
 	if c.Request.URL.RawQuery != "" {
 		common.SysLog(fmt.Sprintf("[ProxyHandler] %s %s?%s", requestMethod, requestPath, c.Request.URL.RawQuery))
@@ -207,6 +388,7 @@ func ProxyHandler(c *gin.Context) {
 	var targetHandler http.Handler
 	var handlerErr error
 	var userID int64
+	var instanceKey string // sharedMCPServers key of the instance serving the request, also keys its circuit breaker
 
 	if idVal, exists := c.Get("userID"); exists {
 		parsedID, parseErr := parseInt64(idVal)
@@ -222,10 +404,21 @@ func ProxyHandler(c *gin.Context) {
 	// doesn't explicitly abort the request, ProxyHandler still enforces authentication.
 	if userID == 0 {
 		common.SysLog(fmt.Sprintf("WARN: [ProxyHandler] Unauthorized access: userID not found or invalid for service %s", serviceName))
+		setProxyAuthenticateHeader(c)
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Authentication required. Please provide a valid user ID."})
 		return
 	}
 
+	// Enforce the service scope of the API key, if the request used one
+	if apiKey := apiKeyFromContext(c); apiKey != nil && !apiKey.AllowsService(mcpDBService.ID) {
+		common.SysLog(fmt.Sprintf("WARN: [ProxyHandler] API key %d of user %d is not scoped to service %s", apiKey.ID, userID, serviceName))
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "API key is not allowed to access service: " + serviceName})
+		return
+	}
+
+	// Attach the caller so the shared MCP server can enforce per-user tool policies
+	c.Request = c.Request.WithContext(proxy.WithCaller(c.Request.Context(), callerFromContext(c, userID)))
+
 	// Check daily request limit (RPD) if user is authenticated and limit is set
 	if userID > 0 && mcpDBService.RPDLimit > 0 {
 		if rpdErr := checkDailyRequestLimit(mcpDBService.ID, userID, mcpDBService.RPDLimit); rpdErr != nil {
@@ -239,7 +432,7 @@ func ProxyHandler(c *gin.Context) {
 		}
 	}
 
-	if userID > 0 && mcpDBService.AllowUserOverride && mcpDBService.Type == model.ServiceTypeStdio {
+	if usesUserSpecificInstance(mcpDBService, userID) {
 		// Determine proxy type based on action (SSE vs Streamable endpoint routing)
 		proxyType := "sseproxy" // default to SSE
 		if action == "/mcp" {
@@ -248,14 +441,35 @@ func ProxyHandler(c *gin.Context) {
 		// Note: Both /sse and /message are SSE type endpoints and use sseproxy
 
 		targetHandler, handlerErr = tryGetOrCreateUserSpecificHandler(c, mcpDBService, userID, proxyType)
-		if handlerErr != nil {
+		if handlerErr == nil {
+			instanceKey = proxy.UserInstanceCacheKey(userID, mcpDBService.ID)
+		} else if mcpDBService.Type != model.ServiceTypeStdio {
+			// The global client of a remote service runs under the admin's identity, so the user never falls back to it
+			var authErr *proxy.OAuthAuthorizationRequiredError
+			if errors.As(handlerErr, &authErr) {
+				respondUpstreamOAuthRequired(c, serviceName, authErr)
+				return
+			}
+			var missingErr *missingHeaderValuesError
+			if errors.As(handlerErr, &missingErr) {
+				common.SysLog(fmt.Sprintf("WARN: [ProxyHandler] User %d has not configured %v for %s", userID, missingErr.names, serviceName))
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success":        false,
+					"message":        missingErr.Error(),
+					"error_code":     "MISSING_USER_HEADERS",
+					"missing_values": missingErr.names,
+				})
+				return
+			}
+			common.SysError(fmt.Sprintf("[ProxyHandler] User-specific handler failed for %s (user %d): %v", serviceName, userID, handlerErr))
+		} else {
 			common.SysError(fmt.Sprintf("[ProxyHandler] User-specific handler failed for %s (user %d), fallback to global: %v", serviceName, userID, handlerErr))
 			// Clear handlerErr so global fallback logic doesn't use this error message if global succeeds
 			handlerErr = nil
 		}
 	}
 
-	if targetHandler == nil { // Fallback to Global Handler
+	if targetHandler == nil && handlerErr == nil { // Fallback to Global Handler
 
 		// Determine proxy type based on action (SSE vs Streamable endpoint routing)
 		proxyType := "sseproxy" // default to SSE for /sse and /message endpoints
@@ -269,80 +483,53 @@ func ProxyHandler(c *gin.Context) {
 		}
 
 		targetHandler, handlerErr = tryGetOrCreateGlobalHandler(c, mcpDBService, proxyType)
+		instanceKey = proxy.GlobalInstanceCacheKey(mcpDBService.ID)
 	}
 
+	// Fail fast while the upstream's circuit is open, whether or not its instance is still cached
+	var openErr *proxy.CircuitOpenError
+	if errors.As(handlerErr, &openErr) {
+		respondCircuitOpen(c, serviceName, openErr)
+		return
+	}
+	var procErr *proxy.ProcessUnavailableError
+	if errors.As(handlerErr, &procErr) {
+		respondProcessUnavailable(c, serviceName, procErr)
+		return
+	}
 	if targetHandler != nil {
-
-		// Unified logic for determining if this request should be recorded for statistics
-		shouldRecordStat := false
-		requestTypeForStat := ""
-		methodForStat := ""
-
-		if requestMethod == http.MethodPost {
-			if action == "/message" || action == "/mcp" {
-				if c.Request.Body != nil {
-					// Read the entire request body to inspect it.
-					bodyBytes, err := io.ReadAll(c.Request.Body)
-					if err != nil {
-						// Log the error, as it's unexpected.
-						common.SysError(fmt.Sprintf("[ProxyHandler] failed to read request body for stat check: %v", err))
-					}
-
-					// CRITICAL: Always restore the request body so that the downstream handler can read it.
-					// We use the bytes we read, even if there was an error, to preserve as much of the body as possible.
-					c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-					// If we successfully read the body, proceed to check if it's a "tools/call".
-					if err == nil && len(bodyBytes) > 0 {
-						var parsedBody map[string]interface{}
-						// We don't care about unmarshalling errors, as the body might not be JSON.
-						// The downstream handler is responsible for proper body parsing and error handling.
-						if json.Unmarshal(bodyBytes, &parsedBody) == nil {
-							if actualMethod, ok := parsedBody["method"].(string); ok && actualMethod == "tools/call" {
-								shouldRecordStat = true
-								methodForStat = "tools/call"
-								// requestBodyForStat = string(bodyBytes)
-								if action == "/message" {
-									requestTypeForStat = "sse"
-								} else { // action == "/mcp"
-									requestTypeForStat = "http"
-								}
-							}
-						}
-					}
-				}
-			}
+		if err := proxy.GetCircuitBreaker(instanceKey, mcpDBService.ID, mcpDBService.Name).Check(); errors.As(err, &openErr) {
+			respondCircuitOpen(c, serviceName, openErr)
+			return
 		}
+	}
 
-		if shouldRecordStat {
-			startTime := time.Now()
-
-			// It's important to serve the request using the potentially restored body
-			targetHandler.ServeHTTP(c.Writer, c.Request)
-
-			duration := time.Since(startTime)
-			statusCode := c.Writer.Status()
-			success := statusCode >= 200 && statusCode < 300
-
-			// Record the statistic to database and cache (including user-specific daily count)
-			go model.RecordRequestStat(
-				mcpDBService.ID,
-				mcpDBService.Name, // Service Name
-				userID,
-				model.ProxyRequestType(requestTypeForStat),
-				methodForStat,
-				requestPath,
-				duration.Milliseconds(),
-				statusCode,
-				success,
-			)
-
-		} else {
-			// If not recording stats, just serve the request
-			// If body was read for a non-stat HTTP/MCP call, it should have been restored already.
+	if targetHandler != nil {
+		// Keep the instance from being evicted while it serves the request or stream
+		release := proxy.AcquireInstance(instanceKey)
+		defer release()
+
+		// Inspect JSON-RPC messages so metrics are labelled by method and tool; only tools/call is recorded as a statistic
+		var rpc jsonRPCRequestInfo
+		if requestMethod == http.MethodPost && (action == "/message" || action == "/mcp") {
+			rpc = peekJSONRPCRequest(c)
+		}
+		if rpc.Method == "" {
+			if requestMethod == http.MethodGet && action == "/sse" {
+				// The SSE stream carries the responses to calls POSTed to /message
+				serveSSEStream(c, targetHandler)
+				return
+			}
+			// Not a JSON-RPC message, just serve the request
 			targetHandler.ServeHTTP(c.Writer, c.Request)
+			return
 		}
 
+		requestType := model.ProxyRequestTypeSSE
+		if action == "/mcp" {
+			requestType = model.ProxyRequestTypeHTTP
+		}
+		serveJSONRPCRequest(c, targetHandler, mcpDBService.Name, mcpDBService, userID, requestType, rpc)
 	} else {
 		finalErrMsg := "critical: unable to obtain any valid handler for service " + serviceName
 		if handlerErr != nil {
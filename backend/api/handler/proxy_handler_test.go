@@ -895,3 +895,229 @@ func TestProxyHandler_CacheConsistency(t *testing.T) {
 		// 404s are OK if they come from the handlers themselves, not the service lookup
 	}
 }
+
+func TestProxyHandler_AggregateRequiresAuth(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Any("/proxy/:serviceName/*action", ProxyHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/proxy/_all/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestNamespacedName(t *testing.T) {
+	assert.Equal(t, "github__create_issue", proxy.NamespacedName("github", "create_issue"))
+}
+
+func TestProxyHandler_CircuitOpenFailsFast(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+
+	mcpDBService := &model.MCPService{
+		Name:    "flaky-http-svc",
+		Type:    model.ServiceTypeStreamableHTTP,
+		Command: "http://127.0.0.1:1/mcp",
+		Enabled: true,
+	}
+	assert.NoError(t, model.CreateService(mcpDBService))
+	dbService, _ := model.GetServiceByName(mcpDBService.Name)
+	defer model.DeleteService(dbService.ID)
+
+	// The instance is still cached, but the upstream behind it keeps failing
+	originalGetOrCreateSharedMcpInstanceWithKey := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, originalDbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		return &proxy.SharedMcpInstance{Server: mcpserver.NewMCPServer("flaky", "1.0.0")}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = originalGetOrCreateSharedMcpInstanceWithKey }()
+
+	breaker := proxy.GetCircuitBreaker(proxy.GlobalInstanceCacheKey(dbService.ID), dbService.ID, dbService.Name)
+	defer breaker.RecordSuccess()
+	for i := 0; i < common.DefaultCircuitBreakerThreshold; i++ {
+		breaker.RecordFailure(fmt.Errorf("connection refused"))
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", int64(1))
+		c.Next()
+	})
+	r.Any("/proxy/:serviceName/*action", ProxyHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/proxy/flaky-http-svc/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":"call-7","method":"tools/call","params":{"name":"search"}}`))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	var body struct {
+		ID    string `json:"id"`
+		Error struct {
+			Code int `json:"code"`
+			Data struct {
+				CircuitState string `json:"circuit_state"`
+				LastError    string `json:"last_error"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "call-7", body.ID)
+	assert.Equal(t, proxy.CircuitOpenErrorCode, body.Error.Code)
+	assert.Equal(t, "open", body.Error.Data.CircuitState)
+	assert.Equal(t, "connection refused", body.Error.Data.LastError)
+}
+
+func TestProxyHandler_UserSpecificHeadersForStreamableHTTP(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+
+	gin.SetMode(gin.TestMode)
+	var userID int64
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", userID)
+		c.Next()
+	})
+	router.GET("/proxy/:serviceName/sse/*action", ProxyHandler)
+
+	serviceName := "user-headers-http-svc"
+	err := model.CreateService(&model.MCPService{
+		Name:              serviceName,
+		DisplayName:       "User Headers HTTP Service",
+		Type:              model.ServiceTypeStreamableHTTP,
+		Command:           "http://127.0.0.1:1/mcp",
+		AllowUserOverride: true,
+		Enabled:           true,
+		HeadersJSON:       `{"X-Tenant":"default","Authorization":"Bearer admin"}`,
+	})
+	assert.NoError(t, err)
+	dbService, _ := model.GetServiceByName(serviceName)
+	assert.NotNil(t, dbService)
+	defer model.DeleteService(dbService.ID)
+
+	// A header option and an env var option with the same key; only the header is sent upstream
+	headerOption := &model.ConfigService{ServiceID: dbService.ID, Key: "Authorization", DisplayName: "Authorization", Type: model.ConfigTypeSecret, IsHeader: true}
+	envOption := &model.ConfigService{ServiceID: dbService.ID, Key: "X-Tenant", DisplayName: "X-Tenant", Type: model.ConfigTypeString}
+	for _, opt := range []*model.ConfigService{headerOption, envOption} {
+		assert.NoError(t, model.ConfigServiceDB.Save(opt))
+		defer model.ConfigServiceDB.Delete(opt)
+	}
+	for _, uc := range []*model.UserConfig{
+		{UserID: 1, ServiceID: dbService.ID, ConfigID: headerOption.ID, Value: "Bearer user-1"},
+		{UserID: 1, ServiceID: dbService.ID, ConfigID: envOption.ID, Value: "not-a-header"},
+	} {
+		assert.NoError(t, model.SaveUserConfig(uc))
+	}
+
+	var capturedService *model.MCPService
+	var capturedCacheKey string
+	originalGetOrCreateSharedMcpInstanceWithKey := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, originalDbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		capturedService = originalDbService
+		capturedCacheKey = cacheKey
+		return &proxy.SharedMcpInstance{Server: &mcpserver.MCPServer{}}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = originalGetOrCreateSharedMcpInstanceWithKey }()
+
+	serve := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, _ := http.NewRequest("GET", "/proxy/"+serviceName+"/sse/someaction", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+	}
+
+	// A user with header overrides gets an instance of their own with the merged headers
+	userID = 1
+	serve()
+	assert.Equal(t, proxy.UserInstanceCacheKey(1, dbService.ID), capturedCacheKey)
+	if assert.NotNil(t, capturedService) {
+		var headers map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(capturedService.HeadersJSON), &headers))
+		assert.Equal(t, map[string]string{"X-Tenant": "default", "Authorization": "Bearer user-1"}, headers)
+	}
+	stored, _ := model.GetServiceByID(dbService.ID)
+	assert.Contains(t, stored.HeadersJSON, "Bearer admin", "the service itself keeps the admin headers")
+
+	// A user without overrides shares the global instance
+	userID = 2
+	serve()
+	assert.Equal(t, proxy.GlobalInstanceCacheKey(dbService.ID), capturedCacheKey)
+}
+
+func TestProxyHandler_HeaderTemplatesUseUserValues(t *testing.T) {
+	teardown := setupTestEnvironmentForProxyHandler()
+	defer teardown()
+
+	gin.SetMode(gin.TestMode)
+	var userID int64
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", userID)
+		c.Next()
+	})
+	router.GET("/proxy/:serviceName/sse/*action", ProxyHandler)
+
+	serviceName := "templated-headers-sse-svc"
+	err := model.CreateService(&model.MCPService{
+		Name:              serviceName,
+		DisplayName:       "Templated Headers SSE Service",
+		Type:              model.ServiceTypeSSE,
+		Command:           "http://127.0.0.1:1/sse",
+		AllowUserOverride: true,
+		Enabled:           true,
+		HeadersJSON:       `{"Authorization":"Bearer {{SAAS_TOKEN}}","X-Client":"one-mcp"}`,
+	})
+	assert.NoError(t, err)
+	dbService, _ := model.GetServiceByName(serviceName)
+	assert.NotNil(t, dbService)
+	defer model.DeleteService(dbService.ID)
+
+	tokenOption := &model.ConfigService{ServiceID: dbService.ID, Key: "SAAS_TOKEN", DisplayName: "SaaS token", Type: model.ConfigTypeSecret}
+	assert.NoError(t, model.ConfigServiceDB.Save(tokenOption))
+	defer model.ConfigServiceDB.Delete(tokenOption)
+	assert.NoError(t, model.SaveUserConfig(&model.UserConfig{UserID: 1, ServiceID: dbService.ID, ConfigID: tokenOption.ID, Value: "token-of-user-1"}))
+
+	var capturedService *model.MCPService
+	var capturedCacheKey string
+	originalGetOrCreateSharedMcpInstanceWithKey := proxy.GetOrCreateSharedMcpInstanceWithKey
+	proxy.GetOrCreateSharedMcpInstanceWithKey = func(ctx context.Context, originalDbService *model.MCPService, cacheKey string, instanceNameDetail string, effectiveEnvsJSONForStdio string) (*proxy.SharedMcpInstance, error) {
+		capturedService = originalDbService
+		capturedCacheKey = cacheKey
+		return &proxy.SharedMcpInstance{Server: &mcpserver.MCPServer{}}, nil
+	}
+	defer func() { proxy.GetOrCreateSharedMcpInstanceWithKey = originalGetOrCreateSharedMcpInstanceWithKey }()
+
+	serve := func() *httptest.ResponseRecorder {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/proxy/"+serviceName+"/sse/someaction", nil)
+		router.ServeHTTP(w, req.WithContext(ctx))
+		return w
+	}
+
+	// The placeholder is filled from the user's own configuration
+	userID = 1
+	serve()
+	assert.Equal(t, proxy.UserInstanceCacheKey(1, dbService.ID), capturedCacheKey)
+	if assert.NotNil(t, capturedService) {
+		var headers map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(capturedService.HeadersJSON), &headers))
+		assert.Equal(t, map[string]string{"Authorization": "Bearer token-of-user-1", "X-Client": "one-mcp"}, headers)
+	}
+
+	// A user without a token is told to configure it instead of falling back to the global client
+	userID = 2
+	capturedCacheKey = ""
+	w := serve()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "MISSING_USER_HEADERS")
+	assert.Contains(t, w.Body.String(), "SAAS_TOKEN")
+	assert.Empty(t, capturedCacheKey, "no instance is created for the user")
+}
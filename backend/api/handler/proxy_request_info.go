@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCapturedResponseBytes bounds how much of a proxied response is buffered for statistics
+const maxCapturedResponseBytes = 1 << 20
+
+// jsonRPCRequestInfo describes a proxied JSON-RPC request as seen by the proxy
+type jsonRPCRequestInfo struct {
+	Method   string          // JSON-RPC method, empty if the body is not a single JSON-RPC message
+	ID       string          // Normalized JSON-RPC id, empty for notifications
+	RawID    json.RawMessage // The id as sent, echoed in responses generated by the proxy itself
+	ToolName string          // Tool name for tools/call
+	Size     int64           // Size of the request body in bytes
+}
+
+// peekJSONRPCRequest reads the request body and returns its JSON-RPC method and, for tools/call, the tool name.
+// The body is always restored for the downstream handler. Bodies that are not JSON-RPC yield an empty method.
+func peekJSONRPCRequest(c *gin.Context) jsonRPCRequestInfo {
+	var info jsonRPCRequestInfo
+	if c.Request.Body == nil {
+		return info
+	}
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	// CRITICAL: Always restore the request body so that the downstream handler can read it.
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		common.SysError(fmt.Sprintf("[ProxyHandler] failed to read request body for stat check: %v", err))
+		return info
+	}
+	info.Size = int64(len(bodyBytes))
+	if len(bodyBytes) == 0 {
+		return info
+	}
+
+	// We don't care about unmarshalling errors (e.g. batches), the downstream handler reports them
+	var parsedBody struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Name string `json:"name"`
+		} `json:"params"`
+	}
+	if json.Unmarshal(bodyBytes, &parsedBody) != nil {
+		return info
+	}
+	info.Method = parsedBody.Method
+	info.ID = normalizeJSONRPCID(parsedBody.ID)
+	info.RawID = parsedBody.ID
+	if parsedBody.Method == "tools/call" {
+		info.ToolName = parsedBody.Params.Name
+	}
+	return info
+}
+
+// responseRecorder counts the bytes written to the client and keeps a bounded copy for inspection.
+// Flush and the other gin.ResponseWriter methods pass through, so streamed responses are unaffected.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+	size int64
+}
+
+func newResponseRecorder(w gin.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (r *responseRecorder) capture(p []byte) {
+	r.size += int64(len(p))
+	if remaining := maxCapturedResponseBytes - r.body.Len(); remaining > 0 {
+		if len(p) > remaining {
+			p = p[:remaining]
+		}
+		r.body.Write(p)
+	}
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.capture(p[:n])
+	return n, err
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	n, err := r.ResponseWriter.WriteString(s)
+	r.capture([]byte(s[:n]))
+	return n, err
+}
+
+// jsonRPCResponseOutcome is the part of a JSON-RPC response relevant for statistics
+type jsonRPCResponseOutcome struct {
+	ErrorCode   int  // JSON-RPC error code, 0 if the response has no error
+	ToolIsError bool // CallToolResult.isError
+	Found       bool // A JSON-RPC response was found in the body
+	Lost        bool // The SSE stream closed or timed out before the response was delivered
+}
+
+// normalizeJSONRPCID renders a JSON-RPC id so that requests and responses can be matched:
+// numbers and strings are kept apart ("1" vs 1) and insignificant formatting is removed.
+func normalizeJSONRPCID(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var id interface{}
+	if decoder.Decode(&id) != nil {
+		return ""
+	}
+	switch v := id.(type) {
+	case string:
+		return "s:" + v
+	case json.Number:
+		return "n:" + v.String()
+	}
+	return ""
+}
+
+// parseJSONRPCOutcome extracts the outcome of the response to request id from a response body.
+// Streamable HTTP may answer with an SSE stream, in which case the data event carrying the response is used.
+func parseJSONRPCOutcome(body []byte, id string) jsonRPCResponseOutcome {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return jsonRPCResponseOutcome{}
+	}
+	if trimmed[0] == '{' {
+		outcome, _ := decodeJSONRPCOutcome(trimmed, id)
+		return outcome
+	}
+
+	var outcome jsonRPCResponseOutcome
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxCapturedResponseBytes)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		if parsed, ok := decodeJSONRPCOutcome([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), id); ok {
+			outcome = parsed
+		}
+	}
+	return outcome
+}
+
+// decodeJSONRPCOutcome decodes a single JSON-RPC response to request id (any response if id is empty).
+// Notifications, requests and responses to other requests are ignored.
+func decodeJSONRPCOutcome(data []byte, id string) (jsonRPCResponseOutcome, bool) {
+	msg, ok := decodeJSONRPCResponse(data)
+	if !ok || (id != "" && msg.ID != id) {
+		return jsonRPCResponseOutcome{}, false
+	}
+	return msg.Outcome, true
+}
+
+// jsonRPCResponse is a decoded JSON-RPC response with its normalized id
+type jsonRPCResponse struct {
+	ID      string
+	Outcome jsonRPCResponseOutcome
+}
+
+func decodeJSONRPCResponse(data []byte) (jsonRPCResponse, bool) {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Result *struct {
+			IsError bool `json:"isError"`
+		} `json:"result"`
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &msg) != nil {
+		return jsonRPCResponse{}, false
+	}
+	response := jsonRPCResponse{ID: normalizeJSONRPCID(msg.ID)}
+	switch {
+	case msg.Error != nil:
+		response.Outcome = jsonRPCResponseOutcome{ErrorCode: msg.Error.Code, Found: true}
+	case msg.Result != nil:
+		response.Outcome = jsonRPCResponseOutcome{ToolIsError: msg.Result.IsError, Found: true}
+	default:
+		return jsonRPCResponse{}, false
+	}
+	return response, true
+}
+
+// proxyCall is a proxied JSON-RPC request waiting for its outcome to be recorded
+type proxyCall struct {
+	metricsService string
+	statService    *model.MCPService // nil when the call cannot be attributed to one service
+	userID         int64
+	requestType    model.ProxyRequestType
+	requestPath    string
+	rpc            jsonRPCRequestInfo
+	statusCode     int
+	startTime      time.Time
+}
+
+// finish observes the call in the Prometheus metrics and, for tools/call, records a ProxyRequestStat
+func (pc *proxyCall) finish(outcome jsonRPCResponseOutcome, responseBytes int64, endTime time.Time) {
+	duration := endTime.Sub(pc.startTime)
+	proxy.ObserveProxyRequest(pc.metricsService, pc.rpc.Method, pc.rpc.ToolName, pc.statusCode, duration)
+
+	if pc.statService == nil || pc.rpc.Method != "tools/call" {
+		return
+	}
+	success := pc.statusCode >= 200 && pc.statusCode < 300 && !outcome.Lost && outcome.ErrorCode == 0 && !outcome.ToolIsError
+
+	// Record the statistic to database and cache (including user-specific daily count)
+	go model.RecordRequestStat(model.ProxyRequestStat{
+		ServiceID:      pc.statService.ID,
+		ServiceName:    pc.statService.Name,
+		UserID:         pc.userID,
+		RequestType:    pc.requestType,
+		Method:         pc.rpc.Method,
+		RequestPath:    pc.requestPath,
+		ResponseTimeMs: duration.Milliseconds(),
+		StatusCode:     pc.statusCode,
+		Success:        success,
+		ToolName:       pc.rpc.ToolName,
+		JSONRPCError:   outcome.ErrorCode,
+		RequestBytes:   pc.rpc.Size,
+		ResponseBytes:  responseBytes,
+		ToolIsError:    outcome.ToolIsError,
+	})
+}
+
+// serveJSONRPCRequest serves a proxied JSON-RPC request, observes it in the Prometheus metrics under
+// metricsService and, for tools/call attributed to statService, records a ProxyRequestStat.
+// For the SSE transport the POST is only acknowledged with 202 and the result arrives on the event stream,
+// so the call is parked in sseCalls and finished when serveSSEStream sees the matching response.
+func serveJSONRPCRequest(c *gin.Context, targetHandler http.Handler, metricsService string, statService *model.MCPService, userID int64, requestType model.ProxyRequestType, rpc jsonRPCRequestInfo) {
+	recorder := newResponseRecorder(c.Writer)
+	c.Writer = recorder
+
+	call := &proxyCall{
+		metricsService: metricsService,
+		statService:    statService,
+		userID:         userID,
+		requestType:    requestType,
+		requestPath:    c.Request.URL.Path,
+		rpc:            rpc,
+		startTime:      time.Now(),
+	}
+
+	// Register before serving: the response can reach the stream before ServeHTTP returns
+	sessionID := c.Query("sessionId")
+	awaitStream := requestType == model.ProxyRequestTypeSSE && rpc.ID != "" && sessionID != ""
+	if awaitStream {
+		call.statusCode = http.StatusAccepted
+		sseCalls.add(sessionID, call)
+	}
+
+	targetHandler.ServeHTTP(recorder, c.Request)
+	statusCode := recorder.Status()
+
+	if awaitStream {
+		if statusCode == http.StatusAccepted {
+			return
+		}
+		// Rejected before reaching the MCP server (e.g. unknown session), no response will follow on the stream
+		if call = sseCalls.take(sessionID, rpc.ID); call == nil {
+			return
+		}
+	}
+	call.statusCode = statusCode
+	// A response that carries no JSON-RPC message (e.g. a plain HTTP error) is still counted via the status code
+	call.finish(parseJSONRPCOutcome(recorder.body.Bytes(), rpc.ID), recorder.size, time.Now())
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONRPCOutcome(t *testing.T) {
+	ok := parseJSONRPCOutcome([]byte(`{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"done"}]}}`), "n:1")
+	assert.Equal(t, jsonRPCResponseOutcome{Found: true}, ok)
+
+	toolErr := parseJSONRPCOutcome([]byte(`{"jsonrpc":"2.0","id":1,"result":{"content":[],"isError":true}}`), "n:1")
+	assert.True(t, toolErr.ToolIsError)
+
+	rpcErr := parseJSONRPCOutcome([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"unknown tool"}}`), "n:1")
+	assert.Equal(t, -32602, rpcErr.ErrorCode)
+
+	// Streamable HTTP answering with an event stream: notifications first, then the response
+	stream := "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\",\"params\":{}}\n\n" +
+		"event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":\"abc\",\"result\":{\"isError\":true}}\n\n"
+	assert.Equal(t, jsonRPCResponseOutcome{ToolIsError: true, Found: true}, parseJSONRPCOutcome([]byte(stream), "s:abc"))
+	assert.False(t, parseJSONRPCOutcome([]byte(stream), "n:7").Found, "responses to other requests are ignored")
+
+	assert.False(t, parseJSONRPCOutcome(nil, "n:1").Found, "SSE transport replies with an empty 202 body")
+}
+
+func TestNormalizeJSONRPCID(t *testing.T) {
+	assert.Equal(t, "n:1", normalizeJSONRPCID([]byte(` 1`)))
+	assert.Equal(t, "s:1", normalizeJSONRPCID([]byte(`"1"`)))
+	assert.Equal(t, "", normalizeJSONRPCID(nil))
+	assert.Equal(t, "", normalizeJSONRPCID([]byte(`null`)))
+}
+
+func TestSSEStreamObserverCorrelatesResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	observer := &sseStreamObserver{ResponseWriter: c.Writer}
+
+	call := &proxyCall{rpc: jsonRPCRequestInfo{Method: "tools/call", ID: "n:5", ToolName: "search"}, startTime: time.Now()}
+	sseCalls.add("sess-1", call)
+	other := &proxyCall{rpc: jsonRPCRequestInfo{Method: "tools/call", ID: "n:6"}, startTime: time.Now()}
+	sseCalls.add("sess-1", other)
+
+	// Events may be split across writes
+	_, _ = observer.Write([]byte("event: endpoint\r\ndata: /proxy/github/message?sessionId=sess-1\r\n\r\n"))
+	_, _ = observer.Write([]byte("event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":5,"))
+	_, _ = observer.Write([]byte("\"result\":{\"content\":[]}}\n\n"))
+	assert.Equal(t, "sess-1", observer.sessionID)
+	assert.Nil(t, sseCalls.take("sess-1", "n:5"), "the response finished the pending call")
+
+	// When the stream closes, calls still waiting on the session are dropped
+	dropped := sseCalls.dropSession("sess-1")
+	require.Len(t, dropped, 1)
+	assert.Same(t, other, dropped[0])
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseCallTimeout bounds how long a call POSTed to /message waits for its response on the SSE stream
+const sseCallTimeout = 10 * time.Minute
+
+// sseCallSweepInterval throttles the scan for timed out calls
+const sseCallSweepInterval = time.Minute
+
+type sseCallKey struct {
+	sessionID string
+	id        string
+}
+
+// sseCallTracker holds calls POSTed to /message until their response is seen on the session's SSE stream
+type sseCallTracker struct {
+	mu        sync.Mutex
+	pending   map[sseCallKey]*proxyCall
+	lastSweep time.Time
+}
+
+var sseCalls = &sseCallTracker{pending: make(map[sseCallKey]*proxyCall)}
+
+// add parks a call and finishes calls that have waited longer than sseCallTimeout
+func (t *sseCallTracker) add(sessionID string, call *proxyCall) {
+	now := time.Now()
+	var expired []*proxyCall
+
+	t.mu.Lock()
+	t.pending[sseCallKey{sessionID: sessionID, id: call.rpc.ID}] = call
+	if now.Sub(t.lastSweep) > sseCallSweepInterval {
+		t.lastSweep = now
+		for key, pending := range t.pending {
+			if now.Sub(pending.startTime) > sseCallTimeout {
+				expired = append(expired, pending)
+				delete(t.pending, key)
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	for _, pending := range expired {
+		pending.finish(jsonRPCResponseOutcome{Lost: true}, 0, now)
+	}
+}
+
+// take removes and returns the call waiting for the response with the given id, if any
+func (t *sseCallTracker) take(sessionID, id string) *proxyCall {
+	key := sseCallKey{sessionID: sessionID, id: id}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	call, ok := t.pending[key]
+	if !ok {
+		return nil
+	}
+	delete(t.pending, key)
+	return call
+}
+
+// dropSession removes and returns every call still waiting on a session whose stream has closed
+func (t *sseCallTracker) dropSession(sessionID string) []*proxyCall {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var dropped []*proxyCall
+	for key, call := range t.pending {
+		if key.sessionID == sessionID {
+			dropped = append(dropped, call)
+			delete(t.pending, key)
+		}
+	}
+	return dropped
+}
+
+// sseStreamObserver passes an SSE stream through to the client while parsing its events.
+// It learns the session id from the endpoint event and finishes pending calls when their response is sent.
+type sseStreamObserver struct {
+	gin.ResponseWriter
+	sessionID string
+	partial   []byte
+	event     string
+	data      []string
+}
+
+func (o *sseStreamObserver) Write(p []byte) (int, error) {
+	n, err := o.ResponseWriter.Write(p)
+	o.observe(p[:n])
+	return n, err
+}
+
+func (o *sseStreamObserver) WriteString(s string) (int, error) {
+	n, err := o.ResponseWriter.WriteString(s)
+	o.observe([]byte(s[:n]))
+	return n, err
+}
+
+func (o *sseStreamObserver) observe(p []byte) {
+	o.partial = append(o.partial, p...)
+	for {
+		i := bytes.IndexByte(o.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(o.partial[:i]), "\r")
+		o.partial = o.partial[i+1:]
+		o.processLine(line)
+	}
+	if len(o.partial) > maxCapturedResponseBytes {
+		// A line this long is not something we can correlate; drop it instead of growing without bound
+		o.partial = nil
+	}
+}
+
+func (o *sseStreamObserver) processLine(line string) {
+	switch {
+	case line == "":
+		o.dispatch()
+	case strings.HasPrefix(line, "event:"):
+		o.event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+	case strings.HasPrefix(line, "data:"):
+		o.data = append(o.data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+	}
+}
+
+func (o *sseStreamObserver) dispatch() {
+	event, data := o.event, strings.Join(o.data, "\n")
+	o.event, o.data = "", nil
+	if data == "" {
+		return
+	}
+
+	if event == "endpoint" {
+		if endpoint, err := url.Parse(data); err == nil {
+			o.sessionID = endpoint.Query().Get("sessionId")
+		}
+		return
+	}
+	if o.sessionID == "" {
+		return
+	}
+	response, ok := decodeJSONRPCResponse([]byte(data))
+	if !ok || response.ID == "" {
+		return
+	}
+	if call := sseCalls.take(o.sessionID, response.ID); call != nil {
+		call.finish(response.Outcome, int64(len(data)), time.Now())
+	}
+}
+
+// serveSSEStream serves an SSE stream through an sseStreamObserver so that calls POSTed to /message
+// are recorded with the latency and outcome of the response delivered on the stream.
+func serveSSEStream(c *gin.Context, targetHandler http.Handler) {
+	observer := &sseStreamObserver{ResponseWriter: c.Writer}
+	c.Writer = observer
+	targetHandler.ServeHTTP(observer, c.Request)
+
+	if observer.sessionID == "" {
+		return
+	}
+	now := time.Now()
+	for _, call := range sseCalls.dropSession(observer.sessionID) {
+		call.finish(jsonRPCResponseOutcome{Lost: true}, 0, now)
+	}
+}
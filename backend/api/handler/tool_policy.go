@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetToolPolicies godoc
+// @Summary 获取工具访问策略
+// @Description 获取工具允许/拒绝策略，可按 service_id 过滤
+// @Tags Tool Policies
+// @Produce json
+// @Param service_id query int false "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/tool_policies [get]
+func GetToolPolicies(c *gin.Context) {
+	lang := c.GetString("lang")
+
+	var policies []*model.ToolPolicy
+	var err error
+	if serviceIDStr := c.Query("service_id"); serviceIDStr != "" {
+		serviceID, parseErr := strconv.ParseInt(serviceIDStr, 10, 64)
+		if parseErr != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), parseErr)
+			return
+		}
+		policies, err = model.GetToolPoliciesByService(serviceID)
+	} else {
+		policies, err = model.GetAllToolPolicies()
+	}
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_tool_policies_failed", lang), err)
+		return
+	}
+	common.RespSuccess(c, policies)
+}
+
+// CreateToolPolicy godoc
+// @Summary 创建工具访问策略
+// @Description 为服务创建按服务、角色或用户生效的工具允许/拒绝策略
+// @Tags Tool Policies
+// @Accept json
+// @Produce json
+// @Param policy body model.ToolPolicy true "策略"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/tool_policies [post]
+func CreateToolPolicy(c *gin.Context) {
+	lang := c.GetString("lang")
+
+	var policy model.ToolPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	saveToolPolicy(c, &policy)
+}
+
+// UpdateToolPolicy godoc
+// @Summary 更新工具访问策略
+// @Tags Tool Policies
+// @Accept json
+// @Produce json
+// @Param id path int true "策略ID"
+// @Param policy body model.ToolPolicy true "策略"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/tool_policies/{id} [put]
+func UpdateToolPolicy(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+		return
+	}
+
+	policy, err := model.GetToolPolicyByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("tool_policy_not_found", lang), err)
+		return
+	}
+	if err := c.ShouldBindJSON(policy); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	policy.ID = id
+	saveToolPolicy(c, policy)
+}
+
+// saveToolPolicy validates and persists a policy, shared by create and update.
+func saveToolPolicy(c *gin.Context, policy *model.ToolPolicy) {
+	lang := c.GetString("lang")
+
+	if err := policy.Validate(); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_tool_policy", lang), err)
+		return
+	}
+	if _, err := model.GetServiceByID(policy.ServiceID); err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+	if err := model.SaveToolPolicy(policy); err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("save_tool_policy_failed", lang), err)
+		return
+	}
+	common.RespSuccess(c, policy)
+}
+
+// DeleteToolPolicy godoc
+// @Summary 删除工具访问策略
+// @Tags Tool Policies
+// @Produce json
+// @Param id path int true "策略ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/tool_policies/{id} [delete]
+func DeleteToolPolicy(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_param", lang), err)
+		return
+	}
+	if err := model.DeleteToolPolicy(id); err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("tool_policy_not_found", lang), err)
+		return
+	}
+	common.RespSuccessStr(c, i18n.Translate("tool_policy_deleted", lang))
+}
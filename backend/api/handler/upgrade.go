@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/model"
+	"one-mcp/backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceUpdate is an npm or PyPI service with a newer release than the installed version
+type ServiceUpdate struct {
+	ServiceID        int64  `json:"service_id"`
+	Name             string `json:"name"`
+	PackageManager   string `json:"package_manager"`
+	PackageName      string `json:"package_name"`
+	InstalledVersion string `json:"installed_version"`
+	LatestVersion    string `json:"latest_version"`
+}
+
+// CheckMCPServiceUpdates godoc
+// @Summary 检查服务更新
+// @Description 立即将已安装的 npm 和 PyPI 服务版本与最新发布版本比较（后台也会定期检查），返回有更新的服务
+// @Tags MCP Services
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/mcp_services/check_updates [post]
+func CheckMCPServiceUpdates(c *gin.Context) {
+	lang := c.GetString("lang")
+
+	service.RunVersionChecks(c.Request.Context())
+	services, err := model.GetAllServices()
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("get_service_list_failed", lang), err)
+		return
+	}
+	updates := make([]ServiceUpdate, 0)
+	for _, svc := range services {
+		if svc.Deleted || !svc.UpdateAvailable {
+			continue
+		}
+		updates = append(updates, ServiceUpdate{
+			ServiceID:        svc.ID,
+			Name:             svc.Name,
+			PackageManager:   svc.PackageManager,
+			PackageName:      svc.SourcePackageName,
+			InstalledVersion: svc.InstalledVersion,
+			LatestVersion:    svc.LatestVersion,
+		})
+	}
+	common.RespSuccess(c, updates)
+}
+
+// UpgradeMCPService godoc
+// @Summary 升级服务
+// @Description 通过安装任务将 npm 或 PyPI 服务重新安装为指定版本（默认最新版本）。新版本初始化成功后才切换并重启实例，重启后不健康则自动回滚到原版本。进度通过 /api/mcp_market/install_status/{id} 查询
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param id path int true "服务ID"
+// @Param body body object false "{\"version\": \"1.2.3\"}，为空时升级到最新版本"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 409 {object} common.APIResponse
+// @Failure 502 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/upgrade [post]
+func UpgradeMCPService(c *gin.Context) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return
+	}
+	var requestBody struct {
+		Version string `json:"version"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&requestBody); err != nil {
+			common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+			return
+		}
+	}
+
+	svc, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return
+	}
+	if rejectManagedService(c, svc) {
+		return
+	}
+
+	version, err := service.UpgradeService(c.Request.Context(), id, requestBody.Version, getUserIDFromContext(c))
+	switch {
+	case errors.Is(err, service.ErrUpgradeNotSupported):
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("upgrade_not_supported", lang), err)
+		return
+	case errors.Is(err, service.ErrUpgradeInProgress):
+		common.RespError(c, http.StatusConflict, i18n.Translate("upgrade_in_progress", lang), err)
+		return
+	case errors.Is(err, service.ErrAlreadyUpToDate):
+		common.RespError(c, http.StatusConflict, i18n.Translate("already_up_to_date", lang, svc.InstalledVersion), err)
+		return
+	case err != nil:
+		common.RespError(c, http.StatusBadGateway, i18n.Translate("upgrade_failed", lang), err)
+		return
+	}
+
+	common.RespSuccess(c, gin.H{
+		"message":          i18n.Translate("upgrade_submitted", lang, version),
+		"mcp_service_id":   id,
+		"previous_version": svc.InstalledVersion,
+		"target_version":   version,
+		"status":           "pending",
+	})
+}
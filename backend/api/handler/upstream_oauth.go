@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upstreamOAuthNonceCookie holds the nonce that binds an upstream OAuth authorization to the browser that started it
+const upstreamOAuthNonceCookie = "upstream_oauth_nonce"
+
+// upstreamOAuthCookiePath limits the nonce cookie to the callback and completion endpoints
+const upstreamOAuthCookiePath = "/api/oauth/upstream"
+
+// setUpstreamOAuthNonceCookie stores the nonce in an HttpOnly cookie; maxAge -1 clears it
+func setUpstreamOAuthNonceCookie(c *gin.Context, nonce string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(upstreamOAuthNonceCookie, nonce, maxAge, upstreamOAuthCookiePath, "", c.Request.TLS != nil, true)
+}
+
+// upstreamOAuthService loads the service of an upstream OAuth request, responding with an error if it
+// cannot be used by the current user
+func upstreamOAuthService(c *gin.Context) (*model.MCPService, int64, bool) {
+	lang := c.GetString("lang")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_service_id", lang), err)
+		return nil, 0, false
+	}
+	userID := getUserIDFromContext(c)
+	if userID == 0 {
+		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
+		return nil, 0, false
+	}
+	service, err := model.GetServiceByID(id)
+	if err != nil {
+		common.RespError(c, http.StatusNotFound, i18n.Translate("service_not_found", lang), err)
+		return nil, 0, false
+	}
+	if service.AdminOnly && c.GetInt("role") < common.RoleAdminUser {
+		common.RespErrorStr(c, http.StatusForbidden, i18n.Translate("service_not_found", lang))
+		return nil, 0, false
+	}
+	return service, userID, true
+}
+
+// GetUpstreamOAuthStatus godoc
+// @Summary 获取上游 OAuth 授权状态
+// @Description 返回当前用户是否已通过服务上游的 OAuth 授权服务器授权 one-mcp
+// @Tags MCP Services
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/oauth [get]
+func GetUpstreamOAuthStatus(c *gin.Context) {
+	service, userID, ok := upstreamOAuthService(c)
+	if !ok {
+		return
+	}
+	config, err := service.GetOAuthConfig()
+	if err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("invalid_oauth_json", c.GetString("lang")), err)
+		return
+	}
+
+	status := gin.H{"enabled": config != nil, "authorized": false}
+	if config != nil {
+		token, err := model.GetUpstreamOAuthToken(userID, service.ID)
+		if err == nil {
+			status["authorized"] = true
+			status["scope"] = token.Scope
+			status["refreshable"] = token.RefreshToken != ""
+			if !token.ExpiresAt.IsZero() {
+				status["expires_at"] = token.ExpiresAt
+			}
+		} else if !errors.Is(err, model.ErrRecordNotFound) {
+			common.RespError(c, http.StatusInternalServerError, "Failed to get OAuth token", err)
+			return
+		}
+	}
+	common.RespSuccess(c, status)
+}
+
+// AuthorizeUpstreamOAuth godoc
+// @Summary 发起上游 OAuth 授权
+// @Description 发现服务上游的 OAuth 授权服务器（必要时动态注册客户端），返回带 PKCE 的授权地址，前端将用户跳转至该地址。
+// @Description 同时设置一个 HttpOnly Cookie，只有持有该 Cookie 的浏览器中发起授权的用户才能完成授权
+// @Tags MCP Services
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 502 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/oauth/authorize [get]
+func AuthorizeUpstreamOAuth(c *gin.Context) {
+	lang := c.GetString("lang")
+	service, userID, ok := upstreamOAuthService(c)
+	if !ok {
+		return
+	}
+
+	authorizationURL, nonce, err := proxy.StartUpstreamOAuth(c.Request.Context(), service, userID)
+	if errors.Is(err, proxy.ErrUpstreamOAuthNotEnabled) {
+		common.RespErrorStr(c, http.StatusBadRequest, i18n.Translate("upstream_oauth_not_enabled", lang))
+		return
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("[UpstreamOAuth] Failed to start authorization of user %d for %s: %v", userID, service.Name, err))
+		common.RespError(c, http.StatusBadGateway, i18n.Translate("upstream_oauth_start_failed", lang), err)
+		return
+	}
+	setUpstreamOAuthNonceCookie(c, nonce, int(proxy.UpstreamOAuthStateTTL.Seconds()))
+	common.RespSuccess(c, gin.H{"authorization_url": authorizationURL, "redirect_uri": proxy.UpstreamOAuthRedirectURI()})
+}
+
+// UpstreamOAuthCallback godoc
+// @Summary 上游 OAuth 授权回调
+// @Description 授权服务器在用户授权后跳转回此地址；校验浏览器的授权 Cookie 并暂存授权码，然后跳转回服务页面，由已登录的用户确认完成授权
+// @Tags MCP Services
+// @Param code query string true "授权码"
+// @Param state query string true "发起授权时生成的 state"
+// @Success 302
+// @Router /api/oauth/upstream/callback [get]
+func UpstreamOAuthCallback(c *gin.Context) {
+	redirect := url.Values{}
+	if errParam := c.Query("error"); errParam != "" {
+		// The user denied the authorization, or the server refused it
+		redirect.Set("upstream_oauth", "error")
+		redirect.Set("message", errParam)
+		c.Redirect(http.StatusFound, "/services?"+redirect.Encode())
+		return
+	}
+
+	nonce, _ := c.Cookie(upstreamOAuthNonceCookie)
+	state := c.Query("state")
+	service, err := proxy.ReceiveUpstreamOAuthCallback(c.Request.Context(), state, c.Query("code"), nonce)
+	if service != nil {
+		redirect.Set("service", service.Name)
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("[UpstreamOAuth] Authorization callback rejected: %v", err))
+		redirect.Set("upstream_oauth", "error")
+		redirect.Set("message", err.Error())
+	} else {
+		// The code is only exchanged once the logged-in user confirms from this browser
+		redirect.Set("upstream_oauth", "confirm")
+		redirect.Set("state", state)
+	}
+	c.Redirect(http.StatusFound, "/services?"+redirect.Encode())
+}
+
+// CompleteUpstreamOAuth godoc
+// @Summary 完成上游 OAuth 授权
+// @Description 用回调暂存的授权码换取令牌并加密保存。只有发起授权的用户在同一浏览器（持有授权 Cookie）中才能完成
+// @Tags MCP Services
+// @Accept json
+// @Produce json
+// @Param body body object true "{\"state\": \"...\"}"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 403 {object} common.APIResponse
+// @Failure 502 {object} common.APIResponse
+// @Router /api/oauth/upstream/complete [post]
+func CompleteUpstreamOAuth(c *gin.Context) {
+	lang := c.GetString("lang")
+	var requestBody struct {
+		State string `json:"state" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("invalid_request_data", lang), err)
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if userID == 0 {
+		common.RespErrorStr(c, http.StatusUnauthorized, i18n.Translate("user_not_authenticated", lang))
+		return
+	}
+
+	nonce, _ := c.Cookie(upstreamOAuthNonceCookie)
+	service, err := proxy.CompleteUpstreamOAuth(c.Request.Context(), requestBody.State, nonce, userID)
+	// The state is used up either way
+	setUpstreamOAuthNonceCookie(c, "", -1)
+	switch {
+	case errors.Is(err, proxy.ErrUpstreamOAuthSessionMismatch):
+		common.SysError(fmt.Sprintf("[UpstreamOAuth] User %d tried to complete an authorization started by another session", userID))
+		common.RespError(c, http.StatusForbidden, i18n.Translate("upstream_oauth_session_mismatch", lang), err)
+		return
+	case errors.Is(err, proxy.ErrUpstreamOAuthStateInvalid):
+		common.RespError(c, http.StatusBadRequest, i18n.Translate("upstream_oauth_complete_failed", lang), err)
+		return
+	case err != nil:
+		common.SysError(fmt.Sprintf("[UpstreamOAuth] Failed to complete authorization of user %d: %v", userID, err))
+		common.RespError(c, http.StatusBadGateway, i18n.Translate("upstream_oauth_complete_failed", lang), err)
+		return
+	}
+	common.RespSuccess(c, gin.H{
+		"message":    i18n.Translate("upstream_oauth_authorized", lang, service.Name),
+		"service_id": service.ID,
+		"service":    service.Name,
+	})
+}
+
+// RevokeUpstreamOAuth godoc
+// @Summary 撤销上游 OAuth 授权
+// @Description 删除当前用户为该服务保存的 OAuth 令牌，并关闭其专属实例
+// @Tags MCP Services
+// @Produce json
+// @Param id path int true "服务ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} common.APIResponse
+// @Failure 400 {object} common.APIResponse
+// @Failure 404 {object} common.APIResponse
+// @Failure 500 {object} common.APIResponse
+// @Router /api/mcp_services/{id}/oauth [delete]
+func RevokeUpstreamOAuth(c *gin.Context) {
+	lang := c.GetString("lang")
+	service, userID, ok := upstreamOAuthService(c)
+	if !ok {
+		return
+	}
+	if err := proxy.RevokeUpstreamOAuth(c.Request.Context(), service.ID, userID); err != nil {
+		common.RespError(c, http.StatusInternalServerError, i18n.Translate("upstream_oauth_revoke_failed", lang), err)
+		return
+	}
+	common.RespSuccessStr(c, i18n.Translate("upstream_oauth_revoked", lang))
+}
+
+// respondUpstreamOAuthRequired tells a proxy client that the user has to authorize the upstream first
+func respondUpstreamOAuthRequired(c *gin.Context, serviceName string, authErr *proxy.OAuthAuthorizationRequiredError) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"success":       false,
+		"message":       fmt.Sprintf("Service %s requires OAuth authorization: %s", serviceName, authErr.Error()),
+		"error_code":    "UPSTREAM_OAUTH_REQUIRED",
+		"authorize_url": fmt.Sprintf("/api/mcp_services/%d/oauth/authorize", authErr.ServiceID),
+	})
+}
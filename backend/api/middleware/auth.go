@@ -84,19 +84,49 @@ func TokenAuth() gin.HandlerFunc {
 		var userID int64
 		var username string
 		var role int
+		var apiKey *model.APIKey
+		var oauthToken *model.OAuthToken
+
+		// authenticate accepts a named API key, an OAuth access token or the legacy per-user token. OAuth
+		// access tokens are only accepted in the Authorization header, and only for the resource they were issued for.
+		authenticate := func(tokenString string, fromQuery bool) {
+			if strings.HasPrefix(tokenString, model.OAuthAccessTokenPrefix) {
+				if fromQuery {
+					return
+				}
+				token, user := model.ValidateOAuthAccessToken(tokenString)
+				if user != nil && service.OAuthResourceCovers(token.Resource, service.OAuthIssuer(c.Request)+c.Request.URL.Path) {
+					oauthToken = token
+					userID = user.ID
+					username = user.Username
+					role = user.Role
+				}
+				return
+			}
+			if strings.HasPrefix(tokenString, model.APIKeyPrefix) {
+				key, user := model.ValidateAPIKey(tokenString)
+				if key != nil && user != nil {
+					apiKey = key
+					userID = user.ID
+					username = user.Username
+					role = user.Role
+				}
+				return
+			}
+			user := model.ValidateUserTokenByTokenString(tokenString)
+			if user != nil && user.Status == common.UserStatusEnabled {
+				userID = user.ID
+				username = user.Username
+				role = user.Role
+			}
+		}
 
 		// First, try to get user token from Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader != "" {
 			parts := strings.Split(authHeader, " ")
 			if len(parts) == 2 && parts[0] == "Bearer" {
-				tokenString := parts[1]
-				user := model.ValidateUserTokenByTokenString(tokenString)
-				if user != nil && user.Status == common.UserStatusEnabled {
-					userID = user.ID
-					username = user.Username
-					role = user.Role
-				}
+				authenticate(parts[1], false)
 			}
 		}
 
@@ -104,12 +134,7 @@ func TokenAuth() gin.HandlerFunc {
 		if userID == 0 {
 			userToken := c.Query("key")
 			if userToken != "" {
-				user := model.ValidateUserTokenByTokenString(userToken)
-				if user != nil && user.Status == common.UserStatusEnabled {
-					userID = user.ID
-					username = user.Username
-					role = user.Role
-				}
+				authenticate(userToken, true)
 			}
 		}
 
@@ -120,6 +145,12 @@ func TokenAuth() gin.HandlerFunc {
 			c.Set("user_id", userID) // Also set this for compatibility
 			c.Set("username", username)
 			c.Set("role", role)
+			if apiKey != nil {
+				c.Set("api_key", apiKey)
+			}
+			if oauthToken != nil {
+				c.Set("oauth_token", oauthToken)
+			}
 			common.SysLog(fmt.Sprintf("[TokenAuth] Authenticated user %d (%s) for proxy request", userID, username))
 		} else {
 			common.SysLog("[TokenAuth] No valid authentication found, proceeding with global access")
@@ -188,6 +219,30 @@ func JWTAuth() gin.HandlerFunc {
 	}
 }
 
+// RequireTokenUser rejects requests TokenAuth could not authenticate, for endpoints outside the proxy that
+// have no global mode. OAuth access tokens are rejected too, their mcp scope only covers the proxy endpoints.
+func RequireTokenUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt64("user_id") == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "A valid token or API key is required",
+			})
+			c.Abort()
+			return
+		}
+		if _, ok := c.Get("oauth_token"); ok {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "OAuth access tokens can only be used for the MCP proxy",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // AdminAuth middleware verifies the user has admin role
 // Note: This middleware assumes JWTAuth has already been called to set user info in context
 func AdminAuth() gin.HandlerFunc {
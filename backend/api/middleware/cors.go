@@ -11,5 +11,6 @@ func CORS() gin.HandlerFunc {
 	config.AllowCredentials = true
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"*"}
+	config.ExposeHeaders = []string{"WWW-Authenticate"} // Browser-based MCP clients discover the authorization server from it
 	return cors.New(config)
 }
@@ -22,6 +22,7 @@ func SetApiRouter(route *gin.Engine) {
 		apiRouter.GET("/oauth/github", middleware.CriticalRateLimit(), handler.GitHubOAuth)
 		apiRouter.GET("/oauth/google", middleware.CriticalRateLimit(), handler.GoogleOAuth)
 		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), handler.WeChatAuth)
+		apiRouter.GET("/oauth/upstream/callback", middleware.CriticalRateLimit(), handler.UpstreamOAuthCallback) // Checks the nonce cookie; the logged-in user completes it below
 
 		// Authentication routes
 		authRoutes := apiRouter.Group("/auth")
@@ -40,6 +41,8 @@ func SetApiRouter(route *gin.Engine) {
 			authOauthRoutes.GET("/google/bind", middleware.CriticalRateLimit(), handler.GoogleBind)
 			authOauthRoutes.GET("/wechat/bind", middleware.CriticalRateLimit(), handler.WeChatBind)
 			authOauthRoutes.GET("/email/bind", middleware.CriticalRateLimit(), handler.EmailBind)
+			authOauthRoutes.POST("/authorize/approve", middleware.CriticalRateLimit(), handler.ApproveOAuthAuthorization)
+			authOauthRoutes.POST("/upstream/complete", middleware.CriticalRateLimit(), handler.CompleteUpstreamOAuth)
 		}
 
 		// User routes - keeping legacy endpoints for backwards compatibility
@@ -58,6 +61,10 @@ func SetApiRouter(route *gin.Engine) {
 				selfRoute.PUT("/self", handler.UpdateSelf)
 				selfRoute.DELETE("/self", handler.DeleteSelf)
 				selfRoute.GET("/token", handler.GenerateToken)
+				selfRoute.GET("/api_keys", handler.ListAPIKeys)
+				selfRoute.POST("/api_keys", handler.CreateAPIKey)
+				selfRoute.DELETE("/api_keys/:id", handler.RevokeAPIKey)
+				selfRoute.POST("/client_config", handler.ExportClientConfig)
 				selfRoute.POST("/change-password", handler.ChangePassword)
 			}
 
@@ -92,6 +99,9 @@ func SetApiRouter(route *gin.Engine) {
 			mcpServiceRoute.Use(middleware.JWTAuth())
 			{
 				mcpServiceRoute.POST("/:id/health/check", handler.CheckMCPServiceHealth)
+				mcpServiceRoute.GET("/:id/oauth", handler.GetUpstreamOAuthStatus)
+				mcpServiceRoute.GET("/:id/oauth/authorize", handler.AuthorizeUpstreamOAuth)
+				mcpServiceRoute.DELETE("/:id/oauth", handler.RevokeUpstreamOAuth)
 			}
 
 			// Admin-only endpoints (write operations)
@@ -99,21 +109,52 @@ func SetApiRouter(route *gin.Engine) {
 			adminMCPServiceRoute.Use(middleware.JWTAuth())   // First authenticate with JWT
 			adminMCPServiceRoute.Use(middleware.AdminAuth()) // Then check admin privileges
 			{
+				adminMCPServiceRoute.GET("/instances", handler.ListMCPInstances)
+				adminMCPServiceRoute.DELETE("/instances/:key", handler.ShutdownMCPInstance)
+				adminMCPServiceRoute.POST("/instances/:key/restart", handler.RestartMCPInstance)
+				adminMCPServiceRoute.GET("/:id/logs", handler.GetMCPServiceLogs)
 				adminMCPServiceRoute.PUT("/:id", handler.UpdateMCPService)
 				adminMCPServiceRoute.POST("/:id/toggle", handler.ToggleMCPService)
+				adminMCPServiceRoute.POST("/check_updates", handler.CheckMCPServiceUpdates)
+				adminMCPServiceRoute.POST("/:id/upgrade", handler.UpgradeMCPService)
 			}
 		}
 
+		// Tool policy routes (Admin only)
+		toolPolicyRoute := apiRouter.Group("/tool_policies")
+		toolPolicyRoute.Use(middleware.JWTAuth())
+		toolPolicyRoute.Use(middleware.AdminAuth())
+		{
+			toolPolicyRoute.GET("/", handler.GetToolPolicies)
+			toolPolicyRoute.POST("/", handler.CreateToolPolicy)
+			toolPolicyRoute.PUT("/:id", handler.UpdateToolPolicy)
+			toolPolicyRoute.DELETE("/:id", handler.DeleteToolPolicy)
+		}
+
+		// Recommended catalog routes (Admin only), browsed through /mcp_market/catalog
+		catalogRoute := apiRouter.Group("/catalog")
+		catalogRoute.Use(middleware.JWTAuth())
+		catalogRoute.Use(middleware.AdminAuth())
+		{
+			catalogRoute.POST("/", handler.CreateCatalogEntry)
+			catalogRoute.PUT("/:id", handler.UpdateCatalogEntry)
+			catalogRoute.DELETE("/:id", handler.DeleteCatalogEntry)
+			catalogRoute.GET("/export", handler.ExportCatalog)
+			catalogRoute.POST("/import", handler.ImportCatalog)
+		}
+
 		// Market API routes
 		marketRoute := apiRouter.Group("/mcp_market")
 		marketRoute.Use(middleware.JWTAuth())
 		{
 			marketRoute.GET("/search", handler.SearchMCPMarket)
+			marketRoute.GET("/catalog", handler.ListCatalog)
 			marketRoute.GET("/discover_env_vars", handler.DiscoverEnvVars)
 			marketRoute.GET("/installed", handler.ListInstalledMCPServices)
 			marketRoute.GET("/package_details", handler.GetPackageDetails)
 			marketRoute.GET("/install_status/:id", handler.GetInstallationStatus)
 			marketRoute.PATCH("/env_var", handler.PatchEnvVar)
+			marketRoute.PATCH("/header", handler.PatchHeader)
 
 			// Admin-only endpoints
 			adminMarketRoute := marketRoute.Group("/")
@@ -130,6 +171,9 @@ func SetApiRouter(route *gin.Engine) {
 		// This must be outside the marketRoute group to avoid JWTAuth middleware
 		apiRouter.GET("/mcp_market/batch-import/progress/:task_id", handler.StreamBatchImportProgress)
 
+		// SSE endpoint for stdio server logs (no middleware, handles auth internally like the one above)
+		apiRouter.GET("/mcp_services/:id/logs/stream", handler.StreamMCPServiceLogs)
+
 		// User Config routes
 		// configRoute := apiRouter.Group("/configs")
 		// configRoute.Use(middleware.JWTAuth())
@@ -162,6 +206,24 @@ func SetApiRouter(route *gin.Engine) {
 		analyticsRoute.GET("/system/overview", handler.GetSystemOverview)
 	}
 
+	// Prometheus scrape endpoint, outside the /api group; authenticate with an admin token or API key
+	route.GET("/metrics", middleware.TokenAuth(), middleware.RequireTokenUser(), middleware.AdminAuth(), handler.GetMetrics)
+
+	// OAuth 2.1 authorization server for MCP clients, outside the /api group so clients can discover it from
+	// the server root and authorize with only the server URL
+	route.GET("/.well-known/oauth-authorization-server", handler.OAuthAuthorizationServerMetadata)
+	route.GET("/.well-known/oauth-protected-resource", handler.OAuthProtectedResourceMetadata)
+	route.GET("/.well-known/oauth-protected-resource/*resource", handler.OAuthProtectedResourceMetadata)
+	oauthServerRouter := route.Group("/oauth")
+	oauthServerRouter.Use(middleware.GlobalAPIRateLimit())
+	{
+		oauthServerRouter.POST("/register", middleware.CriticalRateLimit(), handler.RegisterOAuthClient)
+		oauthServerRouter.GET("/authorize", handler.OAuthAuthorize)
+		oauthServerRouter.POST("/authorize", middleware.CriticalRateLimit(), handler.OAuthAuthorizeSubmit)
+		oauthServerRouter.POST("/token", middleware.CriticalRateLimit(), handler.OAuthToken)
+		oauthServerRouter.POST("/revoke", middleware.CriticalRateLimit(), handler.OAuthRevoke)
+	}
+
 	// Define routes under /proxy, outside the /api group
 	proxyRouter := route.Group("/proxy")
 	proxyRouter.Use(middleware.LangMiddleware()) // Apply similar general middlewares
@@ -175,6 +237,7 @@ func SetApiRouter(route *gin.Engine) {
 		// proxyRouter.Any("/:serviceName/mcp/*action", handler.HTTPProxyHandler)
 
 		// Legacy route removed to fix routing conflict with specific routes above
+		// Note: /proxy/_all/{sse,message,mcp} is the aggregate endpoint and is dispatched inside ProxyHandler
 		proxyRouter.Any("/:serviceName/*action", handler.ProxyHandler)
 	}
 }
@@ -1,5 +1,11 @@
 package common
 
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
 // GetGitHubClientId 获取GitHub客户端ID
 func GetGitHubClientId() string {
 	return OptionMap["GitHubClientId"]
@@ -116,3 +122,72 @@ func GetEnableGzip() bool {
 	// We treat any value other than "false" as true for safety.
 	return OptionMap["EnableGzip"] != "false"
 }
+
+// GetStatsRetentionDays returns how many days raw request stats are kept once rolled up (0 keeps them forever)
+func GetStatsRetentionDays() int {
+	return getOptionInt("StatsRetentionDays", DefaultStatsRetentionDays)
+}
+
+// GetStatsHourlyRetentionDays returns how many days hourly stat rollups are kept (0 keeps them forever).
+// Daily rollups are kept forever.
+func GetStatsHourlyRetentionDays() int {
+	return getOptionInt("StatsHourlyRetentionDays", DefaultStatsHourlyRetentionDays)
+}
+
+// GetCircuitBreakerThreshold returns how many consecutive upstream failures open a service's circuit breaker
+func GetCircuitBreakerThreshold() int {
+	if threshold := getOptionInt("CircuitBreakerThreshold", DefaultCircuitBreakerThreshold); threshold > 0 {
+		return threshold
+	}
+	return DefaultCircuitBreakerThreshold
+}
+
+// GetCircuitBreakerCooldown returns how long an open circuit breaker fast-fails before letting a probe through
+func GetCircuitBreakerCooldown() time.Duration {
+	seconds := getOptionInt("CircuitBreakerCooldownSeconds", DefaultCircuitBreakerCooldownSeconds)
+	if seconds <= 0 {
+		seconds = DefaultCircuitBreakerCooldownSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// GetUserInstanceIdleTimeout returns how long a user-specific instance may stay idle before it is shut down (0 disables)
+func GetUserInstanceIdleTimeout() time.Duration {
+	return time.Duration(getOptionInt("UserInstanceIdleTimeoutMinutes", DefaultUserInstanceIdleTimeoutMinutes)) * time.Minute
+}
+
+// GetMaxUserInstances returns how many user-specific instances may run in total (0 is unlimited)
+func GetMaxUserInstances() int {
+	return getOptionInt("MaxUserInstances", DefaultMaxUserInstances)
+}
+
+// GetMaxUserInstancesPerService returns how many user-specific instances of one service may run (0 is unlimited)
+func GetMaxUserInstancesPerService() int {
+	return getOptionInt("MaxUserInstancesPerService", DefaultMaxUserInstancesPerService)
+}
+
+// GetStdioMaxRestarts returns how many consecutive crashes of a stdio process are restarted automatically
+func GetStdioMaxRestarts() int {
+	if restarts := getOptionInt("StdioMaxRestarts", DefaultStdioMaxRestarts); restarts > 0 {
+		return restarts
+	}
+	return DefaultStdioMaxRestarts
+}
+
+// GetMCPRegistryURL returns the base URL of the MCP server registry, without a trailing slash
+func GetMCPRegistryURL() string {
+	registryURL := strings.TrimRight(strings.TrimSpace(OptionMap["MCPRegistryURL"]), "/")
+	if registryURL == "" {
+		return DefaultMCPRegistryURL
+	}
+	return registryURL
+}
+
+// getOptionInt parses a non-negative integer option, falling back to def if it is unset or invalid
+func getOptionInt(key string, def int) int {
+	value, err := strconv.Atoi(OptionMap[key])
+	if err != nil || value < 0 {
+		return def
+	}
+	return value
+}
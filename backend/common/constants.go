@@ -30,6 +30,34 @@ var PasswordRegisterEnabled = true
 var RegisterEnabled = true
 var SMTPPort = 587
 
+// Default retention of request statistics, overridable by the StatsRetentionDays and StatsHourlyRetentionDays options
+const (
+	DefaultStatsRetentionDays       = 30
+	DefaultStatsHourlyRetentionDays = 90
+)
+
+// Default circuit breaker settings, overridable by the CircuitBreakerThreshold and CircuitBreakerCooldownSeconds options
+const (
+	DefaultCircuitBreakerThreshold       = 5
+	DefaultCircuitBreakerCooldownSeconds = 30
+)
+
+// Default limits of user-specific instances, overridable by the UserInstanceIdleTimeoutMinutes,
+// MaxUserInstances and MaxUserInstancesPerService options (0 disables a limit)
+const (
+	DefaultUserInstanceIdleTimeoutMinutes = 30
+	DefaultMaxUserInstances               = 100
+	DefaultMaxUserInstancesPerService     = 20
+)
+
+// DefaultStdioMaxRestarts is how many times in a row a crashed stdio process is restarted before the
+// instance is considered crash looping, overridable by the StdioMaxRestarts option
+const DefaultStdioMaxRestarts = 5
+
+// DefaultMCPRegistryURL is the official MCP server registry read by the marketplace, overridable by the
+// MCPRegistryURL option to use an internal mirror
+const DefaultMCPRegistryURL = "https://registry.modelcontextprotocol.io"
+
 // These variables are still used during initialization from environment variables
 // They will be moved to OptionMap after initialization
 var GoogleClientId = ""
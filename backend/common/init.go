@@ -15,6 +15,11 @@ var (
 	PrintHelpFlag = flag.Bool("help", false, "print help and exit")
 	LogDir        = flag.String("log-dir", "", "specify the log directory")
 	EnableGzip    = flag.Bool("gzip", true, "enable gzip compression")
+	// RotateMasterKey re-encrypts stored secrets with SECRET_MASTER_KEY, reading old values with SECRET_MASTER_KEY_OLD
+	RotateMasterKey = flag.Bool("rotate-master-key", false, "re-encrypt stored secrets with SECRET_MASTER_KEY and exit")
+	// ConfigFile declares services, options and users; it is applied at startup and on SIGHUP
+	ConfigFile   = flag.String("config", "", "apply a declarative YAML/JSON configuration file at startup and on SIGHUP")
+	ConfigDryRun = flag.Bool("config-dry-run", false, "print the changes the configuration file would make and exit")
 )
 
 // UploadPath Maybe override by ENV_VAR
@@ -23,7 +28,7 @@ var UploadPath = "upload"
 func PrintHelp() {
 	fmt.Println("Copyright (C) 2025 Buru. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/burugo/one-mcp")
-	fmt.Println("Usage: one-mcp [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: one-mcp [--port <port>] [--log-dir <log directory>] [--rotate-master-key] [--config <file> [--config-dry-run]] [--version] [--help]")
 }
 
 func init() {
@@ -53,6 +58,8 @@ func init() {
 	} else if os.Getenv("JWT_SECRET") != "" {
 		JWTRefreshSecret = os.Getenv("JWT_SECRET")
 	}
+	// Master key for envelope encryption of stored secrets; the old key is only needed during rotation
+	SetMasterKeys(os.Getenv("SECRET_MASTER_KEY"), os.Getenv("SECRET_MASTER_KEY_OLD"))
 	if os.Getenv("PORT") != "" {
 		portInt, err := strconv.Atoi(os.Getenv("PORT"))
 		if err != nil {
@@ -0,0 +1,241 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Secrets are stored with envelope encryption: every value gets its own random data key (DEK),
+// the value is sealed with the DEK and the DEK is sealed with the master key (KEK) from the environment.
+// Stored format: enc:v1:<master key id>:<base64 wrapped DEK>:<base64 ciphertext>
+// Rotating the master key only needs to re-wrap the DEKs, the value ciphertext stays unchanged.
+
+const (
+	secretPrefix = "enc:v1:"
+	// SecretMask is shown instead of secret values in API responses
+	SecretMask = "******"
+)
+
+var (
+	masterKeysMu     sync.RWMutex
+	currentMasterKey []byte
+	currentKeyID     string
+	masterKeyring    = make(map[string][]byte)
+)
+
+// deriveMasterKey turns the configured master key string into a 32-byte AES-256 key and its ID
+func deriveMasterKey(raw string) ([]byte, string) {
+	key := sha256.Sum256([]byte(raw))
+	id := sha256.Sum256(key[:])
+	return key[:], hex.EncodeToString(id[:4])
+}
+
+// SetMasterKeys configures the current master key and, optionally, previous keys that can still decrypt.
+// An empty current key disables encryption of new values (existing plaintext keeps working).
+func SetMasterKeys(current string, previous ...string) {
+	masterKeysMu.Lock()
+	defer masterKeysMu.Unlock()
+
+	currentMasterKey = nil
+	currentKeyID = ""
+	masterKeyring = make(map[string][]byte)
+	for _, raw := range previous {
+		if raw == "" {
+			continue
+		}
+		key, id := deriveMasterKey(raw)
+		masterKeyring[id] = key
+	}
+	if current != "" {
+		currentMasterKey, currentKeyID = deriveMasterKey(current)
+		masterKeyring[currentKeyID] = currentMasterKey
+	}
+}
+
+// SecretEncryptionEnabled reports whether a master key is configured
+func SecretEncryptionEnabled() bool {
+	masterKeysMu.RLock()
+	defer masterKeysMu.RUnlock()
+	return currentMasterKey != nil
+}
+
+// IsEncryptedSecret reports whether a stored value is in the encrypted format
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+func seal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// parseSecret splits a stored secret into key ID, wrapped DEK and ciphertext
+func parseSecret(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, secretPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted secret")
+	}
+	wrappedDEK, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return parts[0], wrappedDEK, ciphertext, nil
+}
+
+// unwrapDEK decrypts the data key of a stored secret with the matching master key
+func unwrapDEK(keyID string, wrappedDEK []byte) ([]byte, error) {
+	masterKeysMu.RLock()
+	kek, ok := masterKeyring[keyID]
+	masterKeysMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no master key configured for key id %s", keyID)
+	}
+	return open(kek, wrappedDEK)
+}
+
+func formatSecret(keyID string, wrappedDEK, ciphertext []byte) string {
+	return secretPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(wrappedDEK) + ":" + base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+// EncryptSecret encrypts a value with a fresh data key. Empty values, values that are already
+// encrypted and all values while no master key is configured are returned unchanged.
+func EncryptSecret(plaintext string) (string, error) {
+	if plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	masterKeysMu.RLock()
+	kek, keyID := currentMasterKey, currentKeyID
+	masterKeysMu.RUnlock()
+	if kek == nil {
+		return plaintext, nil
+	}
+
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrappedDEK, err := seal(kek, dek)
+	if err != nil {
+		return "", err
+	}
+	return formatSecret(keyID, wrappedDEK, ciphertext), nil
+}
+
+// DecryptSecret returns the plaintext of a stored value. Values that are not encrypted
+// (e.g. written before a master key was configured) are returned unchanged.
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	keyID, wrappedDEK, ciphertext, err := parseSecret(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := unwrapDEK(keyID, wrappedDEK)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dek, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// RewrapSecret re-encrypts the data key of a stored value with the current master key.
+// Plaintext values are encrypted. Used by master key rotation.
+func RewrapSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return EncryptSecret(value)
+	}
+	keyID, wrappedDEK, ciphertext, err := parseSecret(value)
+	if err != nil {
+		return "", err
+	}
+
+	masterKeysMu.RLock()
+	kek, currentID := currentMasterKey, currentKeyID
+	masterKeysMu.RUnlock()
+	if kek == nil {
+		return "", errors.New("no current master key configured")
+	}
+	if keyID == currentID {
+		return value, nil
+	}
+
+	dek, err := unwrapDEK(keyID, wrappedDEK)
+	if err != nil {
+		return "", err
+	}
+	newWrappedDEK, err := seal(kek, dek)
+	if err != nil {
+		return "", err
+	}
+	return formatSecret(currentID, newWrappedDEK, ciphertext), nil
+}
+
+// MaskSecret hides a secret for display, keeping the last 4 characters of longer values
+func MaskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 8 {
+		return SecretMask
+	}
+	return SecretMask + value[len(value)-4:]
+}
+
+// IsMaskedSecret reports whether a value submitted by a client is a mask produced by MaskSecret
+func IsMaskedSecret(value string) bool {
+	return strings.HasPrefix(value, SecretMask)
+}
+
+// IsSecretName applies the naming heuristic used for env vars without an explicit secret flag
+func IsSecretName(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.Contains(lower, "token") || strings.Contains(lower, "key") || strings.Contains(lower, "secret") || strings.Contains(lower, "password")
+}
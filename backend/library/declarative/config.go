@@ -0,0 +1,276 @@
+// Package declarative reconciles the database with a configuration file that declares services, their
+// configuration options, system options and users, so an installation can be reviewed and reproduced from git.
+package declarative
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the declarative configuration file. YAML and JSON files are both accepted; keys use the JSON names
+// of the web API. `${NAME}` in any string value is replaced by the environment variable NAME, so secrets need
+// not be committed.
+type Config struct {
+	// Prune deletes services that were declared in an earlier version of the file but no longer are. Without it
+	// they are only released, and can be edited in the UI again.
+	Prune    bool                   `json:"prune"`
+	Options  map[string]OptionValue `json:"options"`
+	Services []ServiceSpec          `json:"services"`
+	Users    []UserSpec             `json:"users"`
+}
+
+// OptionValue is the value of a system option; numbers and booleans are accepted and stored as text
+type OptionValue string
+
+func (v *OptionValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = OptionValue(s)
+		return nil
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch raw.(type) {
+	case float64, bool:
+		*v = OptionValue(strings.TrimSpace(string(data)))
+		return nil
+	}
+	return fmt.Errorf("option value must be a string, number or boolean: %s", data)
+}
+
+// ServiceSpec declares an MCPService, identified by its name
+type ServiceSpec struct {
+	Name              string                     `json:"name"`
+	DisplayName       string                     `json:"display_name"` // Defaults to the name
+	Description       string                     `json:"description"`
+	Category          model.ServiceCategory      `json:"category"`
+	Icon              string                     `json:"icon"`
+	Type              model.ServiceType          `json:"type"`
+	Command           string                     `json:"command"` // Command of a stdio service
+	URL               string                     `json:"url"`     // URL of an SSE or streamable HTTP service
+	Args              []string                   `json:"args"`
+	Enabled           *bool                      `json:"enabled"` // Defaults to true
+	DefaultOn         bool                       `json:"default_on"`
+	AdminOnly         bool                       `json:"admin_only"`
+	AllowUserOverride bool                       `json:"allow_user_override"`
+	OrderNum          int                        `json:"order_num"`
+	RPDLimit          int                        `json:"rpd_limit"`
+	PackageManager    string                     `json:"package_manager"` // npm or pypi; sets the command and args when they are omitted
+	SourcePackageName string                     `json:"source_package_name"`
+	Env               map[string]string          `json:"env"`
+	Headers           map[string]string          `json:"headers"`
+	RequiredEnvVars   []model.EnvVarDefinition   `json:"required_env_vars"`
+	Sandbox           *model.SandboxConfig       `json:"sandbox"`
+	OAuth             *model.UpstreamOAuthConfig `json:"oauth"`
+	// Options are the ConfigService entries of the service. Omitting the list leaves existing options alone;
+	// an empty list removes them.
+	Options []ConfigOptionSpec `json:"options"`
+}
+
+// ConfigOptionSpec declares a ConfigService option of a service, identified by its key
+type ConfigOptionSpec struct {
+	Key             string           `json:"key"`
+	DisplayName     string           `json:"display_name"`
+	Description     string           `json:"description"`
+	Type            model.ConfigType `json:"type"` // Defaults to string
+	DefaultValue    string           `json:"default_value"`
+	Options         []string         `json:"options"` // Choices of a select option
+	Required        bool             `json:"required"`
+	AdvancedSetting bool             `json:"advanced_setting"`
+	OrderNum        int              `json:"order_num"`
+	IsHeader        bool             `json:"is_header"`
+}
+
+// UserSpec declares a user, identified by the username
+type UserSpec struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"` // Required for new users; existing users get it when it no longer matches
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Role        string `json:"role"` // common (default), admin or root
+	Disabled    bool   `json:"disabled"`
+	// APIKeys are the declared keys of the user; keys created in the UI are left alone
+	APIKeys []APIKeySpec `json:"api_keys"`
+}
+
+// APIKeySpec declares a named API key with a known plaintext, typically `${SOME_ENV}`
+type APIKeySpec struct {
+	Name      string     `json:"name"`
+	Key       string     `json:"key"`
+	Services  []string   `json:"services"` // Names of the services the key may use, empty for all
+	ReadOnly  bool       `json:"read_only"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+var envReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references in the string values of a parsed document with environment variables.
+// Unset variables are collected as missing rather than expanded to an empty value, so a missing secret cannot
+// silently clear a stored one.
+func expandEnv(node interface{}, missing map[string]bool) interface{} {
+	switch v := node.(type) {
+	case string:
+		return envReferencePattern.ReplaceAllStringFunc(v, func(ref string) string {
+			name := envReferencePattern.FindStringSubmatch(ref)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing[name] = true
+			}
+			return value
+		})
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = expandEnv(value, missing)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = expandEnv(value, missing)
+		}
+	}
+	return node
+}
+
+// LoadConfig reads, expands and validates a configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig parses a YAML or JSON configuration document
+func ParseConfig(data []byte) (*Config, error) {
+	// YAML is a superset of JSON; decoding through JSON reuses the JSON names of the model types
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("parse configuration file: %w", err)
+	}
+	if document == nil {
+		return &Config{}, nil
+	}
+	missing := map[string]bool{}
+	document = expandEnv(document, missing)
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("environment variables referenced by the configuration file are not set: %s", strings.Join(names, ", "))
+	}
+	normalized, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("parse configuration file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(normalized))
+	decoder.DisallowUnknownFields() // Catch typos instead of ignoring a setting
+	var config Config
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("parse configuration file: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate checks the configuration without looking at the database
+func (c *Config) Validate() error {
+	services := map[string]bool{}
+	for i, spec := range c.Services {
+		if spec.Name == "" {
+			return fmt.Errorf("services[%d]: name is required", i)
+		}
+		if err := model.ValidateServiceName(spec.Name); err != nil {
+			return fmt.Errorf("services[%d]: %w", i, err)
+		}
+		if services[spec.Name] {
+			return fmt.Errorf("service %s is declared twice", spec.Name)
+		}
+		services[spec.Name] = true
+		switch spec.Type {
+		case model.ServiceTypeStdio:
+			if spec.Command == "" && spec.PackageManager != "npm" && spec.PackageManager != "pypi" {
+				return fmt.Errorf("service %s: command or package_manager npm/pypi is required for stdio services", spec.Name)
+			}
+			if spec.PackageManager != "" && spec.SourcePackageName == "" {
+				return fmt.Errorf("service %s: source_package_name is required with package_manager", spec.Name)
+			}
+			if len(spec.Headers) > 0 {
+				return fmt.Errorf("service %s: headers can only be set for SSE and streamable HTTP services", spec.Name)
+			}
+		case model.ServiceTypeSSE, model.ServiceTypeStreamableHTTP:
+			if spec.URL == "" && spec.Command == "" {
+				return fmt.Errorf("service %s: url is required for %s services", spec.Name, spec.Type)
+			}
+		default:
+			return fmt.Errorf("service %s: type must be stdio, sse or streamable_http", spec.Name)
+		}
+		keys := map[string]bool{}
+		for _, option := range spec.Options {
+			if option.Key == "" {
+				return fmt.Errorf("service %s: option key is required", spec.Name)
+			}
+			id := fmt.Sprintf("%t/%s", option.IsHeader, option.Key)
+			if keys[id] {
+				return fmt.Errorf("service %s: option %s is declared twice", spec.Name, option.Key)
+			}
+			keys[id] = true
+		}
+	}
+
+	usernames := map[string]bool{}
+	for i, spec := range c.Users {
+		if spec.Username == "" {
+			return fmt.Errorf("users[%d]: username is required", i)
+		}
+		if usernames[spec.Username] {
+			return fmt.Errorf("user %s is declared twice", spec.Username)
+		}
+		usernames[spec.Username] = true
+		if _, err := spec.role(); err != nil {
+			return fmt.Errorf("user %s: %w", spec.Username, err)
+		}
+		names := map[string]bool{}
+		for _, key := range spec.APIKeys {
+			if key.Name == "" {
+				return fmt.Errorf("user %s: api key name is required", spec.Username)
+			}
+			if names[key.Name] {
+				return fmt.Errorf("user %s: api key %s is declared twice", spec.Username, key.Name)
+			}
+			names[key.Name] = true
+			if err := (&model.APIKey{}).SetPlaintext(key.Key); err != nil {
+				return fmt.Errorf("user %s: api key %s: %w", spec.Username, key.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// role returns the role constant of the user
+func (u *UserSpec) role() (int, error) {
+	switch u.Role {
+	case "", "common":
+		return common.RoleCommonUser, nil
+	case "admin":
+		return common.RoleAdminUser, nil
+	case "root":
+		return common.RoleRootUser, nil
+	}
+	return 0, fmt.Errorf("role must be common, admin or root, got %q", u.Role)
+}
@@ -0,0 +1,613 @@
+package declarative
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/market"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+	"one-mcp/backend/service"
+)
+
+// Action is what reconciling does to a declared, or formerly declared, object
+type Action string
+
+const (
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+	ActionRelease Action = "release" // No longer declared: kept, and editable in the UI again
+)
+
+var actionSymbols = map[Action]string{ActionCreate: "+", ActionUpdate: "~", ActionDelete: "-", ActionRelease: "!"}
+
+// Change is one difference between the configuration file and the database
+type Change struct {
+	Kind   string   `json:"kind"` // service, service_option, option, user or api_key
+	Name   string   `json:"name"`
+	Action Action   `json:"action"`
+	Fields []string `json:"fields,omitempty"` // Fields an update changes
+	apply  func(ctx context.Context) error
+}
+
+func (c Change) String() string {
+	line := fmt.Sprintf("%s %s %s", actionSymbols[c.Action], c.Kind, c.Name)
+	if len(c.Fields) > 0 {
+		line += " (" + strings.Join(c.Fields, ", ") + ")"
+	}
+	if c.Action == ActionRelease {
+		line += " (no longer declared, released)"
+	}
+	return line
+}
+
+// Plan is the list of changes that brings the database in line with a configuration file
+type Plan struct {
+	Changes        []Change `json:"changes"`
+	managedOptions map[string]bool
+}
+
+// String renders the plan as a diff, one change per line
+func (p *Plan) String() string {
+	if len(p.Changes) == 0 {
+		return "No changes, the database matches the configuration file"
+	}
+	lines := make([]string, len(p.Changes))
+	for i, change := range p.Changes {
+		lines[i] = change.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Apply makes the changes in order, stopping at the first error. Reconciling again resumes where it stopped.
+func (p *Plan) Apply(ctx context.Context) error {
+	for _, change := range p.Changes {
+		if err := change.apply(ctx); err != nil {
+			return fmt.Errorf("%s %s %s: %w", change.Action, change.Kind, change.Name, err)
+		}
+		common.SysLog("[Declarative] " + change.String())
+	}
+	return nil
+}
+
+var (
+	reconcileMutex sync.Mutex
+
+	managedOptionsMutex sync.RWMutex
+	managedOptions      = map[string]bool{}
+)
+
+// IsManagedOption reports whether a system option is declared in the applied configuration file
+func IsManagedOption(key string) bool {
+	managedOptionsMutex.RLock()
+	defer managedOptionsMutex.RUnlock()
+	return managedOptions[key]
+}
+
+// Reconcile loads a configuration file and applies it to the database. With dryRun nothing is changed and the
+// returned plan shows what would be.
+func Reconcile(ctx context.Context, path string, dryRun bool) (*Plan, error) {
+	reconcileMutex.Lock()
+	defer reconcileMutex.Unlock()
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := BuildPlan(config)
+	if err != nil || dryRun {
+		return plan, err
+	}
+	if err := plan.Apply(ctx); err != nil {
+		return plan, err
+	}
+	managedOptionsMutex.Lock()
+	managedOptions = plan.managedOptions
+	managedOptionsMutex.Unlock()
+	common.SysLog(fmt.Sprintf("[Declarative] Applied %s: %d changes", path, len(plan.Changes)))
+	return plan, nil
+}
+
+// BuildPlan compares a configuration with the database
+func BuildPlan(config *Config) (*Plan, error) {
+	plan := &Plan{managedOptions: map[string]bool{}}
+	planOptions(plan, config)
+	if err := planServices(plan, config); err != nil {
+		return nil, err
+	}
+	if err := planUsers(plan, config); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func planOptions(plan *Plan, config *Config) {
+	keys := slices.Sorted(maps.Keys(config.Options))
+	common.OptionMapRWMutex.RLock()
+	current := make(map[string]string, len(keys))
+	for _, key := range keys {
+		current[key] = common.OptionMap[key]
+	}
+	common.OptionMapRWMutex.RUnlock()
+
+	for _, key := range keys {
+		plan.managedOptions[key] = true
+		value := string(config.Options[key])
+		if current[key] == value {
+			continue
+		}
+		plan.Changes = append(plan.Changes, Change{Kind: "option", Name: key, Action: ActionUpdate, apply: func(ctx context.Context) error {
+			if err := service.UpdateOption(key, value); err != nil {
+				return err
+			}
+			if key == "ServerAddress" {
+				proxy.ClearSSEProxyCache()
+			}
+			return nil
+		}})
+	}
+}
+
+// runtimeServiceFields are the fields whose change requires restarting the instances of a service
+var runtimeServiceFields = map[string]bool{
+	"type": true, "command": true, "args": true, "enabled": true, "default_on": true, "env": true,
+	"headers": true, "sandbox": true, "oauth": true,
+}
+
+func planServices(plan *Plan, config *Config) error {
+	existingServices, err := model.GetAllServices()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*model.MCPService, len(existingServices))
+	for _, svc := range existingServices {
+		byName[svc.Name] = svc
+	}
+
+	declared := map[string]bool{}
+	for _, spec := range config.Services {
+		declared[spec.Name] = true
+		existing := byName[spec.Name]
+
+		var target *model.MCPService
+		var existingOptions []*model.ConfigService
+		if existing == nil {
+			target = &model.MCPService{}
+			if _, err := applyServiceSpec(target, spec); err != nil {
+				return fmt.Errorf("service %s: %w", spec.Name, err)
+			}
+			plan.Changes = append(plan.Changes, Change{Kind: "service", Name: spec.Name, Action: ActionCreate, apply: func(ctx context.Context) error {
+				if err := model.CreateService(target); err != nil {
+					return err
+				}
+				return proxy.GetServiceManager().ReloadService(ctx, target)
+			}})
+		} else {
+			updated := *existing // The fetched model may be cached; a dry run must not touch it
+			target = &updated
+			fields, err := applyServiceSpec(target, spec)
+			if err != nil {
+				return fmt.Errorf("service %s: %w", spec.Name, err)
+			}
+			if len(fields) > 0 {
+				restart := slices.ContainsFunc(fields, func(field string) bool { return runtimeServiceFields[field] })
+				plan.Changes = append(plan.Changes, Change{Kind: "service", Name: spec.Name, Action: ActionUpdate, Fields: fields, apply: func(ctx context.Context) error {
+					if err := model.UpdateService(target); err != nil {
+						return err
+					}
+					if !restart {
+						return nil
+					}
+					return proxy.GetServiceManager().ReloadService(ctx, target)
+				}})
+			}
+			if existingOptions, err = model.GetConfigOptionsForService(existing.ID); err != nil {
+				return err
+			}
+		}
+		if spec.Options != nil {
+			planServiceOptions(plan, target, spec, existingOptions)
+		}
+	}
+
+	for _, svc := range existingServices {
+		if !svc.IsManaged() || declared[svc.Name] {
+			continue
+		}
+		stale := *svc
+		if config.Prune {
+			plan.Changes = append(plan.Changes, Change{Kind: "service", Name: svc.Name, Action: ActionDelete, apply: func(ctx context.Context) error {
+				if err := proxy.GetServiceManager().UnregisterService(ctx, stale.ID); err != nil && !errors.Is(err, proxy.ErrServiceNotFound) {
+					return err
+				}
+				proxy.ShutdownServiceInstances(stale.ID, "removed from the configuration file")
+				// Soft delete, like uninstalling from the UI
+				stale.Enabled = false
+				stale.Deleted = true
+				return model.UpdateService(&stale)
+			}})
+			continue
+		}
+		plan.Changes = append(plan.Changes, Change{Kind: "service", Name: svc.Name, Action: ActionRelease, apply: func(ctx context.Context) error {
+			stale.ManagedBy = ""
+			return model.UpdateService(&stale)
+		}})
+	}
+	return nil
+}
+
+// setField sets a field to its declared value, recording its name if it changes
+func setField[T comparable](fields *[]string, name string, field *T, value T) {
+	if *field != value {
+		*field = value
+		*fields = append(*fields, name)
+	}
+}
+
+// canonicalJSON re-encodes a stored JSON column through its type, so formatting and empty values compare equal
+func canonicalJSON[T any](raw string) string {
+	var value T
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &value) // Malformed values compare as empty and get replaced
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func marshalJSON(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// applyServiceSpec sets the declared fields of a service and returns the names of those that changed
+func applyServiceSpec(svc *model.MCPService, spec ServiceSpec) ([]string, error) {
+	var fields []string
+	displayName := spec.DisplayName
+	if displayName == "" {
+		displayName = spec.Name
+	}
+	enabled := spec.Enabled == nil || *spec.Enabled
+
+	command, args := spec.Command, spec.Args
+	switch {
+	case spec.Type != model.ServiceTypeStdio:
+		if spec.URL != "" {
+			command = spec.URL // URL is stored in Command field for SSE/HTTP
+		}
+	case spec.PackageManager == "npm" || spec.PackageManager == "pypi":
+		// The same defaults as installing the package from the market
+		defaultCommand, defaultArgs := market.PackageCommand(spec.PackageManager, spec.SourcePackageName)
+		if command == "" {
+			command = defaultCommand
+		}
+		if len(args) == 0 {
+			args = defaultArgs
+		}
+	}
+	if args == nil {
+		args = []string{}
+	}
+
+	setField(&fields, "name", &svc.Name, spec.Name)
+	setField(&fields, "display_name", &svc.DisplayName, displayName)
+	setField(&fields, "description", &svc.Description, spec.Description)
+	setField(&fields, "category", &svc.Category, spec.Category)
+	setField(&fields, "icon", &svc.Icon, spec.Icon)
+	setField(&fields, "type", &svc.Type, spec.Type)
+	setField(&fields, "command", &svc.Command, command)
+	var currentArgs []string
+	_ = json.Unmarshal([]byte(svc.ArgsJSON), &currentArgs)
+	if !slices.Equal(currentArgs, args) || svc.ArgsJSON == "" {
+		svc.ArgsJSON = marshalJSON(args)
+		fields = append(fields, "args")
+	}
+	setField(&fields, "enabled", &svc.Enabled, enabled)
+	setField(&fields, "default_on", &svc.DefaultOn, spec.DefaultOn)
+	setField(&fields, "admin_only", &svc.AdminOnly, spec.AdminOnly)
+	setField(&fields, "allow_user_override", &svc.AllowUserOverride, spec.AllowUserOverride)
+	setField(&fields, "order_num", &svc.OrderNum, spec.OrderNum)
+	setField(&fields, "rpd_limit", &svc.RPDLimit, spec.RPDLimit)
+	setField(&fields, "package_manager", &svc.PackageManager, spec.PackageManager)
+	setField(&fields, "source_package_name", &svc.SourcePackageName, spec.SourcePackageName)
+
+	if canonicalJSON[[]model.EnvVarDefinition](svc.RequiredEnvVarsJSON) != marshalJSON(spec.RequiredEnvVars) {
+		svc.RequiredEnvVarsJSON = ""
+		if spec.RequiredEnvVars != nil {
+			svc.RequiredEnvVarsJSON = marshalJSON(spec.RequiredEnvVars)
+		}
+		fields = append(fields, "required_env_vars")
+	}
+
+	// Env vars and headers are encrypted at rest; compare the plaintext
+	for _, secretMap := range []struct {
+		name     string
+		field    *string
+		declared map[string]string
+	}{{"env", &svc.DefaultEnvsJSON, spec.Env}, {"headers", &svc.HeadersJSON, spec.Headers}} {
+		current, err := model.DecryptJSONMap(*secretMap.field)
+		if err != nil {
+			return nil, fmt.Errorf("read stored %s: %w", secretMap.name, err)
+		}
+		declared := secretMap.declared
+		if declared == nil {
+			declared = map[string]string{}
+		}
+		if !maps.Equal(current, declared) {
+			*secretMap.field = marshalJSON(declared)
+			fields = append(fields, secretMap.name)
+		}
+	}
+
+	sandbox := model.SandboxConfig{}
+	if spec.Sandbox != nil {
+		sandbox = *spec.Sandbox
+	}
+	if canonicalJSON[model.SandboxConfig](svc.SandboxJSON) != marshalJSON(sandbox) {
+		svc.SandboxJSON = marshalJSON(sandbox)
+		fields = append(fields, "sandbox")
+	}
+
+	oauth := model.UpstreamOAuthConfig{}
+	if spec.OAuth != nil {
+		oauth = *spec.OAuth
+	}
+	var currentOAuth model.UpstreamOAuthConfig
+	if svc.OAuthJSON != "" {
+		_ = json.Unmarshal([]byte(svc.OAuthJSON), &currentOAuth)
+	}
+	secret, err := common.DecryptSecret(currentOAuth.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("read stored OAuth client secret: %w", err)
+	}
+	currentOAuth.ClientSecret = secret
+	if marshalJSON(currentOAuth) != marshalJSON(oauth) {
+		svc.OAuthJSON = marshalJSON(oauth)
+		fields = append(fields, "oauth")
+	}
+
+	setField(&fields, "managed_by", &svc.ManagedBy, model.ServiceManagedByConfig)
+
+	// Reuse the validation of the UI
+	if _, err := svc.GetSandboxConfig(); err != nil {
+		return nil, err
+	}
+	if _, err := svc.GetOAuthConfig(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func planServiceOptions(plan *Plan, svc *model.MCPService, spec ServiceSpec, existingOptions []*model.ConfigService) {
+	existingByKey := map[string]*model.ConfigService{}
+	for _, option := range existingOptions {
+		existingByKey[fmt.Sprintf("%t/%s", option.IsHeader, option.Key)] = option
+	}
+
+	declared := map[string]bool{}
+	for _, optionSpec := range spec.Options {
+		id := fmt.Sprintf("%t/%s", optionSpec.IsHeader, optionSpec.Key)
+		declared[id] = true
+		name := spec.Name + "/" + optionSpec.Key
+
+		target := &model.ConfigService{}
+		action := ActionCreate
+		if existing := existingByKey[id]; existing != nil {
+			updated := *existing
+			target = &updated
+			action = ActionUpdate
+		}
+		fields := applyConfigOptionSpec(target, optionSpec)
+		if action == ActionUpdate && len(fields) == 0 {
+			continue
+		}
+		if action == ActionCreate {
+			fields = nil
+		}
+		plan.Changes = append(plan.Changes, Change{Kind: "service_option", Name: name, Action: action, Fields: fields, apply: func(ctx context.Context) error {
+			target.ServiceID = svc.ID // Known once a new service is created
+			if action == ActionCreate {
+				return model.CreateConfigOption(target)
+			}
+			return model.UpdateConfigOption(target)
+		}})
+	}
+
+	for _, option := range existingOptions {
+		if declared[fmt.Sprintf("%t/%s", option.IsHeader, option.Key)] {
+			continue
+		}
+		id := option.ID
+		plan.Changes = append(plan.Changes, Change{Kind: "service_option", Name: spec.Name + "/" + option.Key, Action: ActionDelete, apply: func(ctx context.Context) error {
+			return model.DeleteConfigOption(id)
+		}})
+	}
+}
+
+// applyConfigOptionSpec sets the declared fields of a configuration option and returns the names of those
+// that changed
+func applyConfigOptionSpec(option *model.ConfigService, spec ConfigOptionSpec) []string {
+	var fields []string
+	displayName := spec.DisplayName
+	if displayName == "" {
+		displayName = spec.Key
+	}
+	configType := spec.Type
+	if configType == "" {
+		configType = model.ConfigTypeString
+	}
+	choices := ""
+	if len(spec.Options) > 0 {
+		choices = marshalJSON(spec.Options)
+	}
+	setField(&fields, "key", &option.Key, spec.Key)
+	setField(&fields, "display_name", &option.DisplayName, displayName)
+	setField(&fields, "description", &option.Description, spec.Description)
+	setField(&fields, "type", &option.Type, configType)
+	setField(&fields, "default_value", &option.DefaultValue, spec.DefaultValue)
+	setField(&fields, "options", &option.Options, choices)
+	setField(&fields, "required", &option.Required, spec.Required)
+	setField(&fields, "advanced_setting", &option.AdvancedSetting, spec.AdvancedSetting)
+	setField(&fields, "order_num", &option.OrderNum, spec.OrderNum)
+	setField(&fields, "is_header", &option.IsHeader, spec.IsHeader)
+	return fields
+}
+
+func planUsers(plan *Plan, config *Config) error {
+	serviceNames := map[int64]string{}
+	knownServices := map[string]bool{}
+	services, err := model.GetAllServices()
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		serviceNames[svc.ID] = svc.Name
+		knownServices[svc.Name] = true
+	}
+	for _, spec := range config.Services {
+		knownServices[spec.Name] = true
+	}
+
+	for _, spec := range config.Users {
+		role, _ := spec.role() // Validated when loading
+		status := common.UserStatusEnabled
+		if spec.Disabled {
+			status = common.UserStatusDisabled
+		}
+		displayName := spec.DisplayName
+		if displayName == "" {
+			displayName = spec.Username
+		}
+
+		users, err := model.UserDB.Where("username = ?", spec.Username).Fetch(0, 1)
+		if err != nil {
+			return err
+		}
+		var target *model.User
+		var existingKeys []*model.APIKey
+		if len(users) == 0 {
+			if spec.Password == "" {
+				return fmt.Errorf("user %s: password is required for new users", spec.Username)
+			}
+			target = &model.User{
+				Username:    spec.Username,
+				Password:    spec.Password,
+				DisplayName: displayName,
+				Email:       spec.Email,
+				Role:        role,
+				Status:      status,
+			}
+			plan.Changes = append(plan.Changes, Change{Kind: "user", Name: spec.Username, Action: ActionCreate, apply: func(ctx context.Context) error {
+				return target.Insert()
+			}})
+		} else {
+			updated := *users[0]
+			target = &updated
+			var fields []string
+			setField(&fields, "display_name", &target.DisplayName, displayName)
+			if spec.Email != "" {
+				setField(&fields, "email", &target.Email, spec.Email)
+			}
+			setField(&fields, "role", &target.Role, role)
+			setField(&fields, "status", &target.Status, status)
+			changePassword := spec.Password != "" && !common.ValidatePasswordAndHash(spec.Password, target.Password)
+			if changePassword {
+				target.Password = spec.Password
+				fields = append(fields, "password")
+			}
+			if len(fields) > 0 {
+				plan.Changes = append(plan.Changes, Change{Kind: "user", Name: spec.Username, Action: ActionUpdate, Fields: fields, apply: func(ctx context.Context) error {
+					return target.Update(changePassword)
+				}})
+			}
+			if existingKeys, err = model.GetAPIKeysByUser(target.ID); err != nil {
+				return err
+			}
+		}
+
+		for _, keySpec := range spec.APIKeys {
+			for _, name := range keySpec.Services {
+				if !knownServices[name] {
+					return fmt.Errorf("user %s: api key %s: unknown service %s", spec.Username, keySpec.Name, name)
+				}
+			}
+			planAPIKey(plan, target, keySpec, existingKeys, serviceNames)
+		}
+	}
+	return nil
+}
+
+func planAPIKey(plan *Plan, user *model.User, spec APIKeySpec, existingKeys []*model.APIKey, serviceNames map[int64]string) {
+	name := user.Username + "/" + spec.Name
+	expiresAt := time.Time{}
+	if spec.ExpiresAt != nil {
+		expiresAt = *spec.ExpiresAt
+	}
+	declaredServices := slices.Clone(spec.Services)
+	sort.Strings(declaredServices)
+
+	target := &model.APIKey{Name: spec.Name}
+	action := ActionCreate
+	var fields []string
+	for _, existing := range existingKeys {
+		if existing.Name != spec.Name {
+			continue
+		}
+		updated := *existing
+		target = &updated
+		action = ActionUpdate
+		if !target.HasPlaintext(spec.Key) {
+			fields = append(fields, "key")
+		}
+		if !target.ExpiresAt.Equal(expiresAt) {
+			fields = append(fields, "expires_at")
+		}
+		if target.ReadOnly != spec.ReadOnly {
+			fields = append(fields, "read_only")
+		}
+		ids, _ := target.GetAllowedServiceIDs()
+		currentServices := make([]string, 0, len(ids))
+		for _, id := range ids {
+			currentServices = append(currentServices, serviceNames[id])
+		}
+		sort.Strings(currentServices)
+		if !slices.Equal(currentServices, declaredServices) && (len(currentServices) > 0 || len(declaredServices) > 0) {
+			fields = append(fields, "services")
+		}
+		break
+	}
+	if action == ActionUpdate && len(fields) == 0 {
+		return
+	}
+
+	plan.Changes = append(plan.Changes, Change{Kind: "api_key", Name: name, Action: action, Fields: fields, apply: func(ctx context.Context) error {
+		// Services declared in the same file exist by now
+		ids := make([]int64, 0, len(spec.Services))
+		for _, serviceName := range spec.Services {
+			svc, err := model.GetServiceByName(serviceName)
+			if err != nil {
+				return fmt.Errorf("service %s: %w", serviceName, err)
+			}
+			ids = append(ids, svc.ID)
+		}
+		if err := target.SetAllowedServiceIDs(ids); err != nil {
+			return err
+		}
+		if err := target.SetPlaintext(spec.Key); err != nil {
+			return err
+		}
+		target.UserID = user.ID // Known once a new user is created
+		target.ExpiresAt = expiresAt
+		target.ReadOnly = spec.ReadOnly
+		return model.APIKeyDB.Save(target)
+	}})
+}
@@ -0,0 +1,168 @@
+package declarative
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+options:
+  SystemName: Team MCP
+  RPDLimit: 100
+services:
+  - name: fetch
+    type: stdio
+    package_manager: pypi
+    source_package_name: mcp-server-fetch
+    env:
+      FETCH_TOKEN: ${DECLARATIVE_TEST_TOKEN}
+    options:
+      - key: FETCH_TOKEN
+        required: true
+  - name: remote
+    type: streamable_http
+    url: https://mcp.example.com/mcp
+    headers:
+      Authorization: Bearer ${DECLARATIVE_TEST_TOKEN}
+users:
+  - username: alice
+    password: alice-password
+    role: admin
+    api_keys:
+      - name: ci
+        key: omk_0123456789abcdef0123
+        services: [fetch]
+`
+
+// TestMain shares one database between the tests: the model cache outlives InitDB, so tests use distinct names
+func TestMain(m *testing.M) {
+	common.SQLitePath = ":memory:"
+	if err := model.InitDB(); err != nil {
+		panic(err)
+	}
+	common.SetMasterKeys("declarative-test-key")
+	os.Exit(m.Run())
+}
+
+func writeTestConfig(t *testing.T, config string) string {
+	t.Setenv("DECLARATIVE_TEST_TOKEN", "secret-token")
+	path := filepath.Join(t.TempDir(), "one-mcp.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(config), 0600))
+	return path
+}
+
+func TestParseConfig(t *testing.T) {
+	_, err := ParseConfig([]byte("services:\n  - name: a\n    type: stdio\n    comand: echo\n"))
+	assert.ErrorContains(t, err, "unknown field", "typos are rejected")
+
+	_, err = ParseConfig([]byte("services:\n  - name: a\n    type: stdio\n    command: ${DECLARATIVE_TEST_UNSET}\n"))
+	assert.ErrorContains(t, err, "DECLARATIVE_TEST_UNSET")
+
+	_, err = ParseConfig([]byte("users:\n  - username: bob\n    api_keys:\n      - name: ci\n        key: short\n"))
+	assert.ErrorContains(t, err, "api key ci")
+
+	for _, name := range []string{"_all", "acme__tools"} {
+		_, err = ParseConfig([]byte("services:\n  - name: " + name + "\n    type: stdio\n    command: echo\n"))
+		assert.ErrorIs(t, err, model.ErrServiceNameReserved, name)
+	}
+
+	t.Setenv("DECLARATIVE_TEST_QUOTE", `a "quoted": value`)
+	config, err := ParseConfig([]byte(`{"options": {"Notice": "${DECLARATIVE_TEST_QUOTE}", "RPDLimit": 5, "RegisterEnabled": false}}`))
+	require.NoError(t, err)
+	assert.Equal(t, OptionValue(`a "quoted": value`), config.Options["Notice"])
+	assert.Equal(t, OptionValue("5"), config.Options["RPDLimit"])
+	assert.Equal(t, OptionValue("false"), config.Options["RegisterEnabled"])
+}
+
+func TestReconcile(t *testing.T) {
+	path := writeTestConfig(t, testConfig)
+	ctx := context.Background()
+
+	// A dry run only reports the changes
+	plan, err := Reconcile(ctx, path, true)
+	require.NoError(t, err)
+	assert.Contains(t, plan.String(), "+ service fetch")
+	assert.Contains(t, plan.String(), "+ api_key alice/ci")
+	_, err = model.GetServiceByName("fetch")
+	assert.Error(t, err)
+	assert.False(t, IsManagedOption("SystemName"))
+
+	_, err = Reconcile(ctx, path, false)
+	require.NoError(t, err)
+	assert.True(t, IsManagedOption("SystemName"))
+	assert.Equal(t, "Team MCP", common.OptionMap["SystemName"])
+
+	fetch, err := model.GetServiceByName("fetch")
+	require.NoError(t, err)
+	assert.True(t, fetch.IsManaged())
+	assert.True(t, fetch.Enabled)
+	assert.Equal(t, "uvx", fetch.Command)
+	assert.JSONEq(t, `["--from","mcp-server-fetch","mcp-server-fetch"]`, fetch.ArgsJSON)
+	assert.NotContains(t, fetch.DefaultEnvsJSON, "secret-token", "env values are encrypted at rest")
+	options, err := model.GetConfigOptionsForService(fetch.ID)
+	require.NoError(t, err)
+	require.Len(t, options, 1)
+	assert.Equal(t, "FETCH_TOKEN", options[0].Key)
+
+	key, user := model.ValidateAPIKey("omk_0123456789abcdef0123")
+	require.NotNil(t, user)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, common.RoleAdminUser, user.Role)
+	assert.True(t, key.AllowsService(fetch.ID))
+	assert.False(t, key.AllowsService(fetch.ID+1))
+
+	// Applying the same file again changes nothing
+	plan, err = Reconcile(ctx, path, false)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Changes, plan.String())
+
+	// Changes are reported field by field; services no longer declared are released
+	t.Setenv("DECLARATIVE_TEST_TOKEN", "rotated-token")
+	updated := strings.NewReplacer("  RPDLimit: 100\n", "", "    api_keys:\n", "    api_keys: []\n", "      - name: ci\n        key: omk_0123456789abcdef0123\n        services: [fetch]\n", "").Replace(testConfig)
+	require.NoError(t, os.WriteFile(path, []byte(updated), 0600))
+	plan, err = Reconcile(ctx, path, false)
+	require.NoError(t, err)
+	assert.Contains(t, plan.String(), "~ service fetch (env)")
+	assert.Contains(t, plan.String(), "~ service remote (headers)")
+	assert.NotContains(t, plan.String(), "api_key", "keys no longer declared are left alone")
+	assert.False(t, IsManagedOption("RPDLimit"))
+
+	fetch, err = model.GetServiceByName("fetch")
+	require.NoError(t, err)
+	envs, err := model.DecryptJSONMap(fetch.DefaultEnvsJSON)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated-token", envs["FETCH_TOKEN"])
+}
+
+func TestReconcile_ReleaseAndPrune(t *testing.T) {
+	path := writeTestConfig(t, "services:\n  - name: a\n    type: stdio\n    command: echo\n  - name: b\n    type: stdio\n    command: echo\n")
+	ctx := context.Background()
+	_, err := Reconcile(ctx, path, false) // Also releases the services of other tests
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("services:\n  - name: a\n    type: stdio\n    command: echo\n"), 0600))
+	plan, err := Reconcile(ctx, path, false)
+	require.NoError(t, err)
+	assert.Equal(t, "! service b (no longer declared, released)", plan.String())
+	b, err := model.GetServiceByName("b")
+	require.NoError(t, err)
+	assert.False(t, b.IsManaged(), "released services can be edited in the UI again")
+
+	require.NoError(t, os.WriteFile(path, []byte("prune: true\nservices: []\n"), 0600))
+	plan, err = Reconcile(ctx, path, false)
+	require.NoError(t, err)
+	assert.Equal(t, "- service a", plan.String())
+	_, err = model.GetServiceByName("a")
+	assert.Error(t, err, "pruned services are deleted")
+	_, err = model.GetServiceByName("b")
+	assert.NoError(t, err, "released services are not pruned")
+}
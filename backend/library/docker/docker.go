@@ -0,0 +1,158 @@
+// Package docker runs container images as stdio MCP servers through the docker CLI.
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"one-mcp/backend/model"
+)
+
+// Command is the docker CLI. Any CLI compatible with docker run, such as podman, works.
+var Command = "docker"
+
+// ServiceLabel labels the containers of a service with its ID, so they can be found when it is uninstalled
+const ServiceLabel = "one-mcp.service-id"
+
+// imageReference is the image reference grammar of the docker distribution: an optional registry host, lowercase
+// path components, then an optional tag and digest
+var imageReference = regexp.MustCompile(`^` +
+	`(?:(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?/)?` +
+	`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*` +
+	`(?::[\w][\w.-]{0,127})?` +
+	`(?:@[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,})?$`)
+
+// ValidateImage checks that image is an image reference, so it cannot be taken for an option of the docker CLI
+func ValidateImage(image string) error {
+	name, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	if strings.HasPrefix(image, "-") || len(name) > 255 || !imageReference.MatchString(image) {
+		return fmt.Errorf("invalid docker image reference %q", image)
+	}
+	return nil
+}
+
+// run runs the docker CLI and returns its combined output
+func run(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, Command, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return output.String(), fmt.Errorf("%s %s: %w: %s", Command, strings.Join(args, " "), err, strings.TrimSpace(output.String()))
+	}
+	return output.String(), nil
+}
+
+// Available reports whether the docker CLI is installed and reaches a daemon
+func Available() bool {
+	_, err := run(context.Background(), "version", "--format", "{{.Server.Version}}")
+	return err == nil
+}
+
+// ImageExists reports whether the image is present locally
+func ImageExists(ctx context.Context, image string) bool {
+	_, err := run(ctx, "image", "inspect", image)
+	return err == nil
+}
+
+// EnsureImage pulls the image unless it is already present locally, e.g. loaded with docker load or built on
+// the host. It reports whether the image was pulled.
+func EnsureImage(ctx context.Context, image string) (bool, error) {
+	if err := ValidateImage(image); err != nil {
+		return false, err
+	}
+	if ImageExists(ctx, image) {
+		return false, nil
+	}
+	if _, err := run(ctx, "pull", image); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveImage removes the image. An image still used by other containers or services is kept.
+func RemoveImage(ctx context.Context, image string) error {
+	if err := ValidateImage(image); err != nil {
+		return err
+	}
+	_, err := run(ctx, "image", "rm", image)
+	return err
+}
+
+// RemoveContainers force-removes the containers of a service that are left, such as those whose docker run
+// process was killed before the container exited
+func RemoveContainers(ctx context.Context, serviceID int64) error {
+	output, err := run(ctx, "ps", "-aq", "--filter", "label="+ServiceLabel+"="+strconv.FormatInt(serviceID, 10))
+	if err != nil {
+		return err
+	}
+	ids := strings.Fields(output)
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err = run(ctx, append([]string{"rm", "-f"}, ids...)...)
+	return err
+}
+
+// RunArgs returns the docker arguments running the image of a service as a stdio server. The env vars are passed
+// by name, so their values come from the environment of the docker process and stay out of its command line.
+func RunArgs(serviceID int64, image string, config *model.DockerConfig, envNames []string, args []string) ([]string, error) {
+	if err := ValidateImage(image); err != nil {
+		return nil, err
+	}
+	runArgs := []string{"run", "-i", "--rm", "--label", ServiceLabel + "=" + strconv.FormatInt(serviceID, 10)}
+
+	names := append([]string(nil), envNames...)
+	sort.Strings(names)
+	for _, name := range names {
+		runArgs = append(runArgs, "-e", name)
+	}
+
+	if config != nil {
+		for _, volume := range config.Volumes {
+			runArgs = append(runArgs, "-v", volume)
+		}
+		if config.Network != "" {
+			runArgs = append(runArgs, "--network", config.Network)
+		}
+		if config.CPUs != "" {
+			runArgs = append(runArgs, "--cpus", config.CPUs)
+		}
+		if config.MemoryMB > 0 {
+			runArgs = append(runArgs, "--memory", strconv.FormatUint(config.MemoryMB, 10)+"m")
+		}
+		if config.PidsLimit > 0 {
+			runArgs = append(runArgs, "--pids-limit", strconv.FormatUint(config.PidsLimit, 10))
+		}
+		if config.ReadOnly {
+			runArgs = append(runArgs, "--read-only")
+		}
+		if config.User != "" {
+			runArgs = append(runArgs, "--user", config.User)
+		}
+		runArgs = append(runArgs, config.ExtraArgs...)
+	}
+
+	runArgs = append(runArgs, image)
+	return append(runArgs, args...), nil
+}
+
+// EnvNames returns the names of KEY=VALUE env entries
+func EnvNames(env []string) []string {
+	names := make([]string, 0, len(env))
+	for _, entry := range env {
+		if name, _, ok := strings.Cut(entry, "="); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,168 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocker replaces the docker CLI with a script logging its arguments. Images listed in the images file are
+// present locally; pulling adds the image to it, as a local registry would.
+func fakeDocker(t *testing.T, images ...string) (logPath string) {
+	dir := t.TempDir()
+	logPath = filepath.Join(dir, "calls.log")
+	imagesPath := filepath.Join(dir, "images")
+	require.NoError(t, os.WriteFile(imagesPath, []byte(strings.Join(images, "\n")+"\n"), 0o644))
+
+	script := `#!/bin/sh
+echo "$*" >> "` + logPath + `"
+case "$1 $2" in
+"image inspect") grep -qx "$3" "` + imagesPath + `" ;;
+"image rm") grep -qx "$3" "` + imagesPath + `" || { echo "No such image: $3" >&2; exit 1; } ;;
+"ps -aq") echo abc123 ;;
+pull*) [ "$2" = "missing:1.0" ] && { echo "manifest unknown" >&2; exit 1; }; echo "$2" >> "` + imagesPath + `" ;;
+esac
+`
+	command := filepath.Join(dir, "docker")
+	require.NoError(t, os.WriteFile(command, []byte(script), 0o755))
+
+	original := Command
+	Command = command
+	t.Cleanup(func() { Command = original })
+	return logPath
+}
+
+func calls(t *testing.T, logPath string) []string {
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestEnsureImage(t *testing.T) {
+	logPath := fakeDocker(t, "ghcr.io/acme/fetch:1.2")
+	ctx := context.Background()
+
+	pulled, err := EnsureImage(ctx, "ghcr.io/acme/fetch:1.2")
+	require.NoError(t, err)
+	assert.False(t, pulled, "pre-loaded images are not pulled")
+
+	pulled, err = EnsureImage(ctx, "localhost:5000/time:latest")
+	require.NoError(t, err)
+	assert.True(t, pulled)
+	assert.True(t, ImageExists(ctx, "localhost:5000/time:latest"))
+
+	_, err = EnsureImage(ctx, "missing:1.0")
+	assert.ErrorContains(t, err, "manifest unknown")
+
+	assert.Equal(t, []string{
+		"image inspect ghcr.io/acme/fetch:1.2",
+		"image inspect localhost:5000/time:latest",
+		"pull localhost:5000/time:latest",
+		"image inspect localhost:5000/time:latest",
+		"image inspect missing:1.0",
+		"pull missing:1.0",
+	}, calls(t, logPath))
+}
+
+func TestRemoveServiceContainersAndImage(t *testing.T) {
+	logPath := fakeDocker(t, "ghcr.io/acme/fetch:1.2")
+	ctx := context.Background()
+
+	require.NoError(t, RemoveContainers(ctx, 42))
+	require.NoError(t, RemoveImage(ctx, "ghcr.io/acme/fetch:1.2"))
+	assert.Error(t, RemoveImage(ctx, "ghcr.io/acme/other:1.0"))
+
+	assert.Equal(t, []string{
+		"ps -aq --filter label=one-mcp.service-id=42",
+		"rm -f abc123",
+		"image rm ghcr.io/acme/fetch:1.2",
+		"image rm ghcr.io/acme/other:1.0",
+	}, calls(t, logPath))
+}
+
+func TestRunArgs(t *testing.T) {
+	args, err := RunArgs(7, "mcp/time", nil, nil, []string{"--local-timezone", "UTC"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run", "-i", "--rm", "--label", "one-mcp.service-id=7", "mcp/time", "--local-timezone", "UTC"}, args)
+
+	config := &model.DockerConfig{
+		Volumes:   []string{"/srv/data:/data:ro"},
+		Network:   "none",
+		CPUs:      "0.5",
+		MemoryMB:  256,
+		PidsLimit: 64,
+		ReadOnly:  true,
+		User:      "1000:1000",
+		ExtraArgs: []string{"--cap-drop", "ALL"},
+	}
+	env := []string{"TOKEN=s3cret", "API_URL=https://api.example.com"}
+	args, err = RunArgs(7, "ghcr.io/acme/fetch:1.2", config, EnvNames(env), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run", "-i", "--rm", "--label", "one-mcp.service-id=7",
+		"-e", "API_URL", "-e", "TOKEN",
+		"-v", "/srv/data:/data:ro", "--network", "none", "--cpus", "0.5", "--memory", "256m", "--pids-limit", "64",
+		"--read-only", "--user", "1000:1000", "--cap-drop", "ALL",
+		"ghcr.io/acme/fetch:1.2"}, args)
+	assert.NotContains(t, strings.Join(args, " "), "s3cret", "env values stay out of the command line")
+
+	_, err = RunArgs(7, "--privileged", nil, nil, nil)
+	assert.Error(t, err, "an image must not be taken for an option")
+}
+
+func TestValidateImage(t *testing.T) {
+	for _, image := range []string{
+		"mcp/time",
+		"alpine",
+		"ghcr.io/acme/fetch:1.2",
+		"localhost:5000/team/time:latest",
+		"registry.example.com/a__b/c-d.e:v1.0_rc",
+		"mcp/fetch@sha256:" + strings.Repeat("ab", 32),
+		"mcp/fetch:1.0@sha256:" + strings.Repeat("ab", 32),
+	} {
+		assert.NoError(t, ValidateImage(image), image)
+	}
+	for _, image := range []string{
+		"",
+		"-v",
+		"--privileged",
+		"-e=FOO",
+		"Mcp/Time",
+		"mcp/time:",
+		"mcp/time:-tag",
+		"mcp//time",
+		"mcp/time extra",
+		"mcp/fetch@sha256:abc",
+		strings.Repeat("a", 256),
+	} {
+		assert.Error(t, ValidateImage(image), image)
+	}
+}
+
+func TestDockerImageAndConfig(t *testing.T) {
+	svc := &model.MCPService{SourcePackageName: "ghcr.io/acme/fetch", InstalledVersion: "1.2"}
+	assert.Equal(t, "ghcr.io/acme/fetch:1.2", svc.DockerImage())
+	svc.InstalledVersion = "latest"
+	assert.Equal(t, "ghcr.io/acme/fetch", svc.DockerImage())
+	svc.SourcePackageName, svc.InstalledVersion = "localhost:5000/fetch:2.0", "1.2"
+	assert.Equal(t, "localhost:5000/fetch:2.0", svc.DockerImage(), "a tag in the image wins")
+	svc.SourcePackageName = "mcp/fetch@sha256:abc"
+	assert.Equal(t, "mcp/fetch@sha256:abc", svc.DockerImage())
+
+	svc.DockerJSON = `{"volumes":["/srv/data:/data"],"cpus":"1.5","memory_mb":512}`
+	config, err := svc.GetDockerConfig()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(512), config.MemoryMB)
+	svc.DockerJSON = `{"volumes":["/srv/data"]}`
+	_, err = svc.GetDockerConfig()
+	assert.Error(t, err)
+	svc.DockerJSON = `{"cpus":"-1"}`
+	_, err = svc.GetDockerConfig()
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package market
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// bundledCatalog seeds the recommended catalog on first start
+//
+//go:embed recommended_catalog.json
+var bundledCatalog []byte
+
+// catalogSeededOption 记录内置目录已导入过，之后不再导入
+const catalogSeededOption = "RecommendedCatalogSeeded"
+
+// SeedRecommendedCatalog 在首次启动时导入内置目录，并在选项表中记录已导入。之后即使管理员清空目录也不会重新导入
+func SeedRecommendedCatalog() error {
+	options, err := model.OptionDB.Where("key = ?", catalogSeededOption).Fetch(0, 1)
+	if err != nil {
+		return err
+	}
+	if len(options) > 0 {
+		return nil
+	}
+	entries, err := model.GetCatalogEntries(true)
+	if err != nil {
+		return err
+	}
+	// 升级前已有目录的实例只补记标记，不再导入
+	if len(entries) == 0 {
+		var file model.CatalogFile
+		if err := json.Unmarshal(bundledCatalog, &file); err != nil {
+			return fmt.Errorf("invalid bundled catalog: %w", err)
+		}
+		result, err := model.ImportCatalog(&file, false)
+		if err != nil {
+			return fmt.Errorf("failed to seed the recommended catalog: %w", err)
+		}
+		common.SysLog(fmt.Sprintf("Seeded the recommended catalog with %d entries", result.Created))
+	}
+	if err := model.OptionDB.Save(&model.Option{Key: catalogSeededOption, Value: "true"}); err != nil {
+		return err
+	}
+	model.UpdateOptionMap(catalogSeededOption, "true")
+	return nil
+}
+
+// SearchCatalog 在推荐目录的可见条目中按名称、显示名和描述搜索，空查询返回全部
+func SearchCatalog(query string) ([]model.CatalogTemplate, error) {
+	entries, err := model.GetCatalogEntries(false)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(strings.TrimSpace(query))
+	var templates []model.CatalogTemplate
+	for _, entry := range entries {
+		t, err := entry.Template()
+		if err != nil {
+			common.SysError(err.Error())
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(t.Name+" "+t.DisplayName+" "+t.Description), query) {
+			continue
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// ConvertCatalogToSearchResult 将推荐目录条目转换为统一格式。Name 为条目名，安装状态按其将要安装的包判断
+func ConvertCatalogToSearchResult(templates []model.CatalogTemplate, installedPackageIDs map[string]int64) []SearchPackageResult {
+	results := make([]SearchPackageResult, 0, len(templates))
+	for _, t := range templates {
+		var installedIDPtr *int64
+		_, packageName := t.InstallTarget()
+		if id, ok := installedPackageIDs[packageName]; ok {
+			installedIDCopy := id
+			installedIDPtr = &installedIDCopy
+		}
+		results = append(results, SearchPackageResult{
+			Name:               t.Name,
+			Description:        t.Description,
+			PackageManager:     model.PackageManagerCatalog,
+			Homepage:           t.Homepage,
+			IconURL:            t.Icon,
+			IsInstalled:        installedIDPtr != nil,
+			InstalledServiceID: installedIDPtr,
+		})
+	}
+	return results
+}
@@ -0,0 +1,53 @@
+package market
+
+import (
+	"encoding/json"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundledCatalogIsValid(t *testing.T) {
+	var file model.CatalogFile
+	if err := json.Unmarshal(bundledCatalog, &file); err != nil {
+		t.Fatalf("Bundled catalog is not valid JSON: %v", err)
+	}
+	if len(file.Entries) == 0 {
+		t.Fatal("Bundled catalog has no entries")
+	}
+	names := map[string]bool{}
+	for _, entry := range file.Entries {
+		if err := entry.Validate(); err != nil {
+			t.Errorf("Invalid bundled entry: %v", err)
+		}
+		if names[entry.Name] {
+			t.Errorf("Duplicate bundled entry %s", entry.Name)
+		}
+		names[entry.Name] = true
+	}
+}
+
+func TestSeedRecommendedCatalogRunsOnce(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	require.NoError(t, model.InitDB())
+	t.Cleanup(func() { common.SQLitePath = originalPath })
+
+	require.NoError(t, SeedRecommendedCatalog())
+	entries, err := model.GetCatalogEntries(true)
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+
+	// An admin who removes every bundled entry keeps an empty catalog
+	for _, entry := range entries {
+		require.NoError(t, model.DeleteCatalogEntry(entry.ID))
+	}
+	require.NoError(t, SeedRecommendedCatalog())
+	entries, err = model.GetCatalogEntries(true)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,110 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"one-mcp/backend/library/docker"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// CheckDockerAvailable checks if the docker CLI is available and reaches a daemon.
+func CheckDockerAvailable() bool {
+	return docker.Available()
+}
+
+// ValidateDockerImage checks that image is a docker image reference
+func ValidateDockerImage(image string) error {
+	return docker.ValidateImage(image)
+}
+
+// InstallDockerImage pulls the image of a docker service unless it is already present locally, then runs it once
+// as a stdio server to check that it is an MCP server. version tags the image unless its name has a tag.
+func InstallDockerImage(ctx context.Context, svc *model.MCPService, version string, args []string, envVars map[string]string) (*MCPServerInfo, error) {
+	if !CheckDockerAvailable() {
+		return nil, fmt.Errorf("docker is not available")
+	}
+	target := *svc
+	target.InstalledVersion = version
+	image := target.DockerImage()
+
+	pulled, err := docker.EnsureImage(ctx, image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	if pulled {
+		log.Printf("[InstallDockerImage] Pulled image %s for service %s", image, svc.Name)
+	} else {
+		log.Printf("[InstallDockerImage] Using local image %s for service %s", image, svc.Name)
+	}
+
+	config, err := svc.GetDockerConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker config: %w", err)
+	}
+	env := os.Environ()
+	names := make([]string, 0, len(envVars))
+	for key, value := range envVars {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+		names = append(names, key)
+	}
+	runArgs, err := docker.RunArgs(svc.ID, image, config, names, args)
+	if err != nil {
+		return nil, err
+	}
+
+	mcpClient, err := client.NewStdioMCPClient(docker.Command, env, runArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MCP client for %s: %w", image, err)
+	}
+	defer mcpClient.Close()
+
+	initCtx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{
+		Name:    "one-mcp",
+		Version: "1.0.0",
+	}
+	initRequest.Params.Capabilities = mcp.ClientCapabilities{}
+
+	initResult, err := mcpClient.Initialize(initCtx, initRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize MCP client for %s (is it an MCP server?): %w", image, err)
+	}
+
+	return &MCPServerInfo{
+		Name:            initResult.ServerInfo.Name,
+		Version:         initResult.ServerInfo.Version,
+		ProtocolVersion: initResult.ProtocolVersion,
+		Capabilities:    initResult.Capabilities,
+	}, nil
+}
+
+// UninstallDockerImage removes the containers left by a docker service and its image. The image is kept if
+// another service runs it or other containers still use it.
+func UninstallDockerImage(ctx context.Context, svc *model.MCPService) error {
+	if err := docker.RemoveContainers(ctx, svc.ID); err != nil {
+		log.Printf("[UninstallDockerImage] Failed to remove containers of service %s (ID: %d): %v", svc.Name, svc.ID, err)
+	}
+	image := svc.DockerImage()
+	services, err := model.GetAllServices()
+	if err != nil {
+		return fmt.Errorf("failed to check other services using image %s: %w", image, err)
+	}
+	for _, other := range services {
+		if other.ID != svc.ID && !other.Deleted && other.PackageManager == model.PackageManagerDocker && other.DockerImage() == image {
+			log.Printf("[UninstallDockerImage] Keeping image %s, still used by service %s (ID: %d)", image, other.Name, other.ID)
+			return nil
+		}
+	}
+	return docker.RemoveImage(ctx, image)
+}
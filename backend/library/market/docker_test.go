@@ -0,0 +1,51 @@
+package market
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/docker"
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUninstallDockerImageKeepsSharedImages(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	require.NoError(t, model.InitDB())
+	t.Cleanup(func() { common.SQLitePath = originalPath })
+
+	// The fake docker CLI only logs its arguments
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	command := filepath.Join(dir, "docker")
+	require.NoError(t, os.WriteFile(command, []byte("#!/bin/sh\necho \"$*\" >> \""+logPath+"\"\n"), 0o755))
+	originalCommand := docker.Command
+	docker.Command = command
+	t.Cleanup(func() { docker.Command = originalCommand })
+
+	first := &model.MCPService{Name: "time-a", Type: model.ServiceTypeStdio, PackageManager: model.PackageManagerDocker, SourcePackageName: "mcp/time", InstalledVersion: "1.0"}
+	second := &model.MCPService{Name: "time-b", Type: model.ServiceTypeStdio, PackageManager: model.PackageManagerDocker, SourcePackageName: "mcp/time:1.0"}
+	require.NoError(t, model.CreateService(first))
+	require.NoError(t, model.CreateService(second))
+	ctx := context.Background()
+
+	require.NoError(t, UninstallDockerImage(ctx, first))
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "image rm", "the image of another service is kept")
+
+	first.Deleted = true
+	require.NoError(t, model.UpdateService(first))
+	require.NoError(t, UninstallDockerImage(ctx, second))
+	data, err = os.ReadFile(logPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, "image rm mcp/time:1.0", lines[len(lines)-1], "the last service using the image removes it")
+}
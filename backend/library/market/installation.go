@@ -26,20 +26,22 @@ const (
 
 // InstallationTask 表示一个安装任务
 type InstallationTask struct {
-	ServiceID        int64                 // 服务ID
-	UserID           int64                 // 用户ID, 用于后续创建用户特定配置
-	PackageName      string                // 包名
-	PackageManager   string                // 包管理器
-	Version          string                // 版本
-	Command          string                // 命令
-	Args             []string              // 参数列表
-	EnvVars          map[string]string     // 环境变量
-	Status           InstallationStatus    // 状态
-	StartTime        time.Time             // 开始时间
-	EndTime          time.Time             // 结束时间
-	Output           string                // 输出信息
-	Error            string                // 错误信息
-	CompletionNotify chan InstallationTask // 完成通知
+	ServiceID        int64                  // 服务ID
+	UserID           int64                  // 用户ID, 用于后续创建用户特定配置
+	PackageName      string                 // 包名
+	PackageManager   string                 // 包管理器
+	Version          string                 // 版本
+	Command          string                 // 命令
+	Args             []string               // 参数列表
+	EnvVars          map[string]string      // 环境变量
+	Status           InstallationStatus     // 状态
+	StartTime        time.Time              // 开始时间
+	EndTime          time.Time              // 结束时间
+	Output           string                 // 输出信息
+	Error            string                 // 错误信息
+	CompletionNotify chan InstallationTask  // 完成通知
+	Upgrade          bool                   // 升级已安装的服务：失败时保留原服务（即回滚到原版本）而不删除，成功时更新固定版本的参数
+	OnInstalled      func(InstallationTask) // 服务记录更新后调用，升级时用于重启实例
 }
 
 // InstallationManager 管理安装任务
@@ -138,6 +140,17 @@ func (m *InstallationManager) runInstallationTask(task *InstallationTask) {
 		} else {
 			output = fmt.Sprintf("InstallPyPIPackage error: %v", err)
 		}
+	case model.PackageManagerDocker:
+		var svc *model.MCPService
+		svc, err = model.GetServiceByID(task.ServiceID)
+		if err == nil {
+			serverInfo, err = InstallDockerImage(ctx, svc, task.Version, task.Args, task.EnvVars)
+		}
+		if err == nil && serverInfo != nil {
+			output = fmt.Sprintf("Docker image %s initialized. Server: %s, Version: %s, Protocol: %s", task.PackageName, serverInfo.Name, serverInfo.Version, serverInfo.ProtocolVersion)
+		} else {
+			output = fmt.Sprintf("InstallDockerImage error: %v", err)
+		}
 	default:
 		err = fmt.Errorf("unsupported package manager: %s", task.PackageManager)
 		output = fmt.Sprintf("不支持的包管理器: %s", task.PackageManager)
@@ -153,14 +166,19 @@ func (m *InstallationManager) runInstallationTask(task *InstallationTask) {
 		task.Error = err.Error()
 		log.Printf("[InstallTask] 任务失败: ServiceID=%d, Package=%s, Error=%v", task.ServiceID, task.PackageName, err)
 
-		// 新增：尝试删除因此次失败安装而在数据库中预先创建的服务记录
-		log.Printf("[InstallTask] 安装失败，尝试删除预创建的服务记录: ServiceID=%d", task.ServiceID)
-		if deleteErr := model.DeleteService(task.ServiceID); deleteErr != nil {
-			log.Printf("[InstallTask] 删除服务记录失败 ServiceID=%d: %v. 原始安装错误: %v", task.ServiceID, deleteErr, err)
-			// 注意：即使删除失败，也应继续报告原始安装失败。
-			// 这里的删除失败是一个次要问题，主要问题是安装失败。
+		if task.Upgrade {
+			// 新版本未通过初始化，服务记录和参数未改动，继续使用原版本
+			log.Printf("[InstallTask] 升级失败，服务保持原版本: ServiceID=%d, Version=%s", task.ServiceID, task.Version)
 		} else {
-			log.Printf("[InstallTask] 成功删除因安装失败而产生的服务记录: ServiceID=%d", task.ServiceID)
+			// 新增：尝试删除因此次失败安装而在数据库中预先创建的服务记录
+			log.Printf("[InstallTask] 安装失败，尝试删除预创建的服务记录: ServiceID=%d", task.ServiceID)
+			if deleteErr := model.DeleteService(task.ServiceID); deleteErr != nil {
+				log.Printf("[InstallTask] 删除服务记录失败 ServiceID=%d: %v. 原始安装错误: %v", task.ServiceID, deleteErr, err)
+				// 注意：即使删除失败，也应继续报告原始安装失败。
+				// 这里的删除失败是一个次要问题，主要问题是安装失败。
+			} else {
+				log.Printf("[InstallTask] 成功删除因安装失败而产生的服务记录: ServiceID=%d", task.ServiceID)
+			}
 		}
 	} else {
 		task.Status = StatusCompleted
@@ -174,6 +192,18 @@ func (m *InstallationManager) runInstallationTask(task *InstallationTask) {
 	task.CompletionNotify <- *task
 }
 
+// PackageCommand 返回运行 npm 或 PyPI 包的默认命令和参数（npx -y pkg、uvx --from pkg pkg），
+// 市场安装、服务编辑和声明式配置共用；其他包管理器返回空命令
+func PackageCommand(packageManager, packageName string) (string, []string) {
+	switch packageManager {
+	case "npm":
+		return "npx", []string{"-y", packageName}
+	case "pypi", "uv", "pip":
+		return "uvx", []string{"--from", packageName, packageName}
+	}
+	return "", nil
+}
+
 // updateServiceStatus 更新服务状态
 func (m *InstallationManager) updateServiceStatus(task *InstallationTask, serverInfo *MCPServerInfo) {
 	serviceToUpdate, err := model.GetServiceByID(task.ServiceID)
@@ -189,7 +219,7 @@ func (m *InstallationManager) updateServiceStatus(task *InstallationTask, server
 		case "npm":
 			serviceToUpdate.Command = "npx"
 			if serviceToUpdate.ArgsJSON == "" {
-				args := []string{"-y", serviceToUpdate.SourcePackageName}
+				_, args := PackageCommand(serviceToUpdate.PackageManager, serviceToUpdate.SourcePackageName)
 				argsJSON, err := json.Marshal(args)
 				if err != nil {
 					log.Printf("[InstallationManager] Error marshaling args for npm package %s: %v", serviceToUpdate.SourcePackageName, err)
@@ -202,7 +232,7 @@ func (m *InstallationManager) updateServiceStatus(task *InstallationTask, server
 		case "pypi", "uv", "pip":
 			serviceToUpdate.Command = "uvx"
 			if serviceToUpdate.ArgsJSON == "" {
-				args := []string{"--from", serviceToUpdate.SourcePackageName, serviceToUpdate.SourcePackageName}
+				_, args := PackageCommand(serviceToUpdate.PackageManager, serviceToUpdate.SourcePackageName)
 				argsJSON, err := json.Marshal(args)
 				if err != nil {
 					log.Printf("[InstallationManager] Error marshaling args for python package %s: %v", serviceToUpdate.SourcePackageName, err)
@@ -212,16 +242,31 @@ func (m *InstallationManager) updateServiceStatus(task *InstallationTask, server
 				}
 			}
 			log.Printf("[InstallationManager] Set Command for service %s: %s", serviceToUpdate.Name, serviceToUpdate.Command)
+		case model.PackageManagerDocker:
+			// The docker run arguments are built when the service starts, ArgsJSON holds the container arguments
+			serviceToUpdate.Command = "docker"
+			log.Printf("[InstallationManager] Set Command for service %s: %s", serviceToUpdate.Name, serviceToUpdate.Command)
 		default:
 			log.Printf("[InstallationManager] Warning: Unknown package manager %s for service %s, Command field will remain empty", serviceToUpdate.PackageManager, serviceToUpdate.Name)
 		}
 	}
 
-	serviceToUpdate.Enabled = true
+	if task.Upgrade {
+		// 切换到固定新版本的参数；升级不改变服务的启用状态
+		argsJSON, err := json.Marshal(task.Args)
+		if err != nil {
+			log.Printf("[InstallationManager] Error marshaling args for upgraded service %s: %v", serviceToUpdate.Name, err)
+		} else {
+			serviceToUpdate.ArgsJSON = string(argsJSON)
+		}
+	} else {
+		serviceToUpdate.Enabled = true
+	}
 	serviceToUpdate.HealthStatus = "healthy"
 
 	if task.Version != "" {
 		serviceToUpdate.InstalledVersion = task.Version
+		serviceToUpdate.SetLatestVersion(serviceToUpdate.LatestVersion)
 	}
 
 	if serverInfo != nil {
@@ -259,7 +304,7 @@ func (m *InstallationManager) updateServiceStatus(task *InstallationTask, server
 
 	// Re-check service status before final DB update and client initialization
 	currentDBService, queryErr := model.GetServiceByID(task.ServiceID)
-	if queryErr == nil && (currentDBService.Deleted || !currentDBService.Enabled) {
+	if queryErr == nil && (currentDBService.Deleted || (!currentDBService.Enabled && !task.Upgrade)) {
 		log.Printf("[InstallationManager] Service ID %d (Name: %s) has been uninstalled or disabled. Skipping final DB update and client initialization for completed installation task.", task.ServiceID, currentDBService.Name)
 		return // Do not proceed if service has been deleted or disabled
 	}
@@ -293,6 +338,10 @@ func (m *InstallationManager) updateServiceStatus(task *InstallationTask, server
 	log.Printf("[InstallationManager] Service %s (ID: %d) will be managed by ServiceManager when enabled", serviceToUpdate.Name, serviceToUpdate.ID)
 
 	log.Printf("[InstallationManager] Service processing completed for ID: %d, Name: %s", serviceToUpdate.ID, serviceToUpdate.Name)
+
+	if task.OnInstalled != nil {
+		task.OnInstalled(*task)
+	}
 }
 
 // CleanupTask 清理任务
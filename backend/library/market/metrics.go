@@ -0,0 +1,30 @@
+package market
+
+import (
+	"one-mcp/backend/library/metrics"
+)
+
+var _ = metrics.NewGaugeFunc(
+	"one_mcp_installation_tasks",
+	"Installation tasks tracked by the InstallationManager by status.",
+	[]string{"status"},
+	collectInstallationTaskCounts,
+)
+
+func collectInstallationTaskCounts() []metrics.GaugeSample {
+	counts := map[InstallationStatus]int{
+		StatusPending:    0,
+		StatusInstalling: 0,
+		StatusCompleted:  0,
+		StatusFailed:     0,
+	}
+	for _, task := range GetInstallationManager().GetAllTasks() {
+		counts[task.Status]++
+	}
+
+	samples := make([]metrics.GaugeSample, 0, len(counts))
+	for status, count := range counts {
+		samples = append(samples, metrics.GaugeSample{LabelValues: []string{string(status)}, Value: float64(count)})
+	}
+	return samples
+}
@@ -25,10 +25,11 @@ import (
 const (
 	// NPMAPI 官方npm registry API
 	NPMAPI = "https://registry.npmjs.org/-/v1/search"
-	// NPMPackageInfo 官方npm包信息API
-	NPMPackageInfo = "https://registry.npmjs.org/"
 )
 
+// NPMPackageInfo 官方npm包信息API，是变量以便测试指向本地服务器
+var NPMPackageInfo = "https://registry.npmjs.org/"
+
 // NPMSearchResult 表示npm搜索结果
 type NPMSearchResult struct {
 	Objects []struct {
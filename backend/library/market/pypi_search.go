@@ -0,0 +1,498 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+)
+
+// PyPI has no search API: candidates are picked by name from the simple index and, best effort, from the first page
+// of the PyPI website search, which also matches keywords and classifiers. They are then confirmed and described
+// with the JSON API of each project. All are variables so tests can point them at a local server.
+var (
+	// PyPISimpleIndex PyPI 项目列表 (PEP 691 JSON)
+	PyPISimpleIndex = "https://pypi.org/simple/"
+	// PyPIJSONAPI PyPI 项目信息 API
+	PyPIJSONAPI = "https://pypi.org/pypi/"
+	// PyPISearchPage PyPI 网站搜索页面
+	PyPISearchPage = "https://pypi.org/search/"
+)
+
+// pypiMCPClassifier is the trove classifier of MCP projects
+const pypiMCPClassifier = "Framework :: MCP"
+
+const (
+	// pypiIndexTTL is how long the list of MCP-like project names is reused; the full index is tens of megabytes
+	pypiIndexTTL = 6 * time.Hour
+	// pypiIndexRetryDelay is how long a stale list is reused after a failed refresh before trying again
+	pypiIndexRetryDelay = 5 * time.Minute
+	// pypiProjectTTL is how long the JSON API metadata of a project is reused across searches and pages
+	pypiProjectTTL = time.Hour
+	// pypiMaxUnconfirmedCandidates bounds the candidates whose name alone does not say MCP and whose metadata is
+	// fetched to confirm them before paging; the rest are left out of the results
+	pypiMaxUnconfirmedCandidates = 100
+	// pypiMetadataConcurrency bounds the parallel project requests of one search page
+	pypiMetadataConcurrency = 8
+)
+
+// PyPIProjectInfo is the part of the PyPI JSON API response used by the marketplace
+type PyPIProjectInfo struct {
+	Info struct {
+		Name        string            `json:"name"`
+		Version     string            `json:"version"`
+		Summary     string            `json:"summary"`
+		Keywords    string            `json:"keywords"` // Comma or space separated
+		Classifiers []string          `json:"classifiers"`
+		HomePage    string            `json:"home_page"`
+		ProjectURLs map[string]string `json:"project_urls"`
+		License     string            `json:"license"` // Some projects put the whole license text here
+		LicenseExpr string            `json:"license_expression"`
+		Author      string            `json:"author"`
+		AuthorEmail string            `json:"author_email"`
+		PackageURL  string            `json:"package_url"`
+	} `json:"info"`
+	URLs []struct {
+		UploadTime string `json:"upload_time_iso_8601"`
+	} `json:"urls"` // Files of the latest version
+}
+
+// PyPISearchResult is one page of PyPI projects matching a search
+type PyPISearchResult struct {
+	Projects    []PyPIProjectInfo
+	Scores      []float64 // Relevance of each project, 0 to 1
+	Total       int       // Projects matching the query that are MCP servers by name or confirmed by their metadata
+	PerPage     int
+	CurrentPage int
+}
+
+var (
+	pypiIndexMutex     sync.Mutex
+	pypiIndexNames     []string
+	pypiIndexFetchedAt time.Time
+	pypiIndexFlight    common.FlightGroup[[]string]
+
+	pypiProjectMutex sync.Mutex
+	pypiProjects     = map[string]pypiCachedProject{}
+
+	pypiNameSeparators = regexp.MustCompile(`[-_.]+`)
+	pypiSearchLinks    = regexp.MustCompile(`href="/project/([^/"]+)/"`)
+)
+
+// pypiCachedProject is the metadata of a project fetched by a search
+type pypiCachedProject struct {
+	info      *PyPIProjectInfo
+	fetchedAt time.Time
+}
+
+// NormalizePyPIName returns the canonical form of a project name (PEP 503), under which PyPI treats names as equal
+func NormalizePyPIName(name string) string {
+	return strings.ToLower(pypiNameSeparators.ReplaceAllString(name, "-"))
+}
+
+// pypiNameScore rates how much a normalized project name looks like an MCP server: 3 for mcp-server-* and
+// *-mcp-server, 2 for an mcp segment such as mcp-* or *-mcp, 1 for names that merely contain mcp.
+func pypiNameScore(name string) int {
+	if strings.HasPrefix(name, "mcp-server-") || strings.HasSuffix(name, "-mcp-server") {
+		return 3
+	}
+	for _, segment := range strings.Split(name, "-") {
+		if segment == "mcp" {
+			return 2
+		}
+	}
+	if strings.Contains(name, "mcp") {
+		return 1
+	}
+	return 0
+}
+
+// getPyPIMCPNames returns the normalized names of all PyPI projects whose name contains mcp. A stale list is
+// returned at once and refreshed in the background; only the first search after start waits for the download.
+func getPyPIMCPNames() ([]string, error) {
+	pypiIndexMutex.Lock()
+	names, fresh := pypiIndexNames, time.Since(pypiIndexFetchedAt) < pypiIndexTTL
+	pypiIndexMutex.Unlock()
+	if names == nil {
+		return refreshPyPIMCPNames()
+	}
+	if !fresh {
+		go refreshPyPIMCPNames()
+	}
+	return names, nil
+}
+
+// refreshPyPIMCPNames downloads the index once for all concurrent callers. The download is not tied to the context
+// of any search, so a cancelled request does not fail it for the others waiting on it.
+func refreshPyPIMCPNames() ([]string, error) {
+	return pypiIndexFlight.Do("index", func() ([]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		fetched, err := fetchPyPIMCPNames(ctx)
+
+		pypiIndexMutex.Lock()
+		defer pypiIndexMutex.Unlock()
+		if err != nil {
+			if pypiIndexNames != nil {
+				log.Printf("[PyPI] Keeping the previous index: %v", err)
+				pypiIndexFetchedAt = time.Now().Add(pypiIndexRetryDelay - pypiIndexTTL)
+				return pypiIndexNames, nil
+			}
+			return nil, err
+		}
+		pypiIndexNames = fetched
+		pypiIndexFetchedAt = time.Now()
+		return fetched, nil
+	})
+}
+
+// fetchPyPIMCPNames downloads the simple index and returns the sorted normalized names containing mcp
+func fetchPyPIMCPNames(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", PyPISimpleIndex, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.pypi.simple.v1+json")
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch PyPI index: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("PyPI index returned error: %s, status code: %d", string(data), resp.StatusCode)
+	}
+
+	var index struct {
+		Projects []struct {
+			Name string `json:"name"`
+		} `json:"projects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to parse PyPI index: %w", err)
+	}
+	names := make([]string, 0, 1024)
+	for _, project := range index.Projects {
+		name := NormalizePyPIName(project.Name)
+		if strings.Contains(name, "mcp") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	log.Printf("[PyPI] Indexed %d MCP-like projects out of %d", len(names), len(index.Projects))
+	return names, nil
+}
+
+// searchPyPIWebNames returns the normalized names on the first page of the PyPI website search for the query
+// together with "mcp", and for the query among projects with the MCP classifier. This finds projects that are
+// only marked as MCP servers by their keywords or classifiers.
+//
+// The search page is HTML meant for browsers, not an API: it may be rate limited, put behind a challenge or change
+// its markup at any time. This lookup is therefore best effort. Failures are logged and yield no names, the results
+// then come from the simple index only, and every name found here is still confirmed with the JSON API.
+func searchPyPIWebNames(ctx context.Context, query string) []string {
+	searches := []url.Values{
+		{"q": {strings.TrimSpace(query + " mcp")}},
+		{"q": {query}, "c": {pypiMCPClassifier}},
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	seen := map[string]bool{}
+	var names []string
+	for _, params := range searches {
+		req, err := http.NewRequestWithContext(ctx, "GET", PyPISearchPage+"?"+params.Encode(), nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Accept", "text/html")
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("[PyPI] Website search failed: %v", err)
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+		resp.Body.Close()
+		if err != nil {
+			log.Printf("[PyPI] Failed to read website search: %v", err)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("[PyPI] Website search returned status code %d", resp.StatusCode)
+			continue
+		}
+		for _, match := range pypiSearchLinks.FindAllSubmatch(data, -1) {
+			name, err := url.PathUnescape(string(match[1]))
+			if err != nil {
+				continue
+			}
+			if name = NormalizePyPIName(name); !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// GetPyPIProjectInfo 获取 PyPI 项目信息
+func GetPyPIProjectInfo(ctx context.Context, name string) (*PyPIProjectInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", PyPIJSONAPI+url.PathEscape(name)+"/json", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch PyPI project %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("PyPI API returned status code %d for %s", resp.StatusCode, name)
+	}
+	var info PyPIProjectInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to parse PyPI project %s: %w", name, err)
+	}
+	return &info, nil
+}
+
+// getPyPIProjects returns the metadata of the named projects, fetched in parallel and reused for pypiProjectTTL.
+// Projects that could not be fetched are nil.
+func getPyPIProjects(ctx context.Context, names []string) []*PyPIProjectInfo {
+	projects := make([]*PyPIProjectInfo, len(names))
+	semaphore := make(chan struct{}, pypiMetadataConcurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		pypiProjectMutex.Lock()
+		cached, ok := pypiProjects[name]
+		pypiProjectMutex.Unlock()
+		if ok && time.Since(cached.fetchedAt) < pypiProjectTTL {
+			projects[i] = cached.info
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			info, err := GetPyPIProjectInfo(ctx, name)
+			if err != nil {
+				log.Printf("[PyPI] Skipping %s: %v", name, err)
+				return
+			}
+			projects[i] = info
+			pypiProjectMutex.Lock()
+			pypiProjects[name] = pypiCachedProject{info: info, fetchedAt: time.Now()}
+			pypiProjectMutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	return projects
+}
+
+// keywords splits the comma or space separated keywords of a project
+func (p *PyPIProjectInfo) keywords() []string {
+	return strings.FieldsFunc(p.Info.Keywords, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// isMCPServer reports whether the metadata of a project declares it an MCP server, through its keywords,
+// classifiers or summary
+func (p *PyPIProjectInfo) isMCPServer() bool {
+	for _, keyword := range p.keywords() {
+		if k := strings.ToLower(keyword); k == "mcp" || k == "mcp-server" || strings.Contains(k, "model context protocol") || k == "modelcontextprotocol" {
+			return true
+		}
+	}
+	for _, classifier := range p.Info.Classifiers {
+		if strings.Contains(classifier, "MCP") || strings.Contains(classifier, "Model Context Protocol") {
+			return true
+		}
+	}
+	summary := strings.ToLower(p.Info.Summary)
+	return strings.Contains(summary, "mcp") || strings.Contains(summary, "model context protocol")
+}
+
+// repositoryURL returns the source repository of a project, preferring GitHub links
+func (p *PyPIProjectInfo) repositoryURL() string {
+	candidates := []string{}
+	for _, key := range []string{"Source", "Repository", "Source Code", "GitHub", "Code", "Homepage"} {
+		if u := p.Info.ProjectURLs[key]; u != "" {
+			candidates = append(candidates, u)
+		}
+	}
+	for _, u := range p.Info.ProjectURLs {
+		candidates = append(candidates, u)
+	}
+	candidates = append(candidates, p.Info.HomePage)
+	for _, u := range candidates {
+		if strings.Contains(u, "github.com") {
+			return u
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return ""
+}
+
+// SearchPyPIPackages 搜索 PyPI 上的 MCP 服务器。候选项目来自名称包含 mcp 及查询中每个词的项目，
+// 以及 PyPI 网站搜索中关键词或分类匹配的项目；结果按名称模式（mcp-server-* 优先）排序。
+// 名称不足以表明是 MCP 服务器的候选项目在分页前用元数据确认，因此 Total 与各页只包含确认后的项目
+func SearchPyPIPackages(ctx context.Context, query string, limit int, page int) (*PyPISearchResult, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	names, err := getPyPIMCPNames()
+	if err != nil {
+		return nil, err
+	}
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_' || r == '.'
+	})
+
+	type candidate struct {
+		name  string
+		score int
+	}
+	var candidates []candidate
+	seen := map[string]bool{}
+	for _, name := range names {
+		matches := true
+		for _, term := range terms {
+			if term != "mcp" && !strings.Contains(name, term) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			seen[name] = true
+			candidates = append(candidates, candidate{name: name, score: pypiNameScore(name)})
+		}
+	}
+	// Matched by PyPI on their metadata, so only the metadata check below applies
+	for _, name := range searchPyPIWebNames(ctx, query) {
+		if !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, candidate{name: name, score: pypiNameScore(name)})
+		}
+	}
+	// Names are sorted already; a stable sort keeps them alphabetical within a score
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	// Names that only contain "mcp", possibly as part of another word, are kept when their metadata says MCP.
+	// They sort last, so confirming them first leaves the earlier pages untouched.
+	var unconfirmed []string
+	accepted := make([]candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.score >= 2 {
+			accepted = append(accepted, c)
+		} else if len(unconfirmed) < pypiMaxUnconfirmedCandidates {
+			unconfirmed = append(unconfirmed, c.name)
+		}
+	}
+	for i, project := range getPyPIProjects(ctx, unconfirmed) {
+		if project != nil && project.isMCPServer() {
+			accepted = append(accepted, candidate{name: unconfirmed[i], score: pypiNameScore(unconfirmed[i])})
+		}
+	}
+
+	result := &PyPISearchResult{Total: len(accepted), PerPage: limit, CurrentPage: page}
+	start := (page - 1) * limit
+	if start >= len(accepted) {
+		return result, nil
+	}
+	pageCandidates := accepted[start:min(start+limit, len(accepted))]
+	pageNames := make([]string, len(pageCandidates))
+	for i, c := range pageCandidates {
+		pageNames[i] = c.name
+	}
+
+	for i, project := range getPyPIProjects(ctx, pageNames) {
+		if project == nil {
+			continue
+		}
+		relevance := float64(pageCandidates[i].score) / 4
+		if project.isMCPServer() {
+			relevance += 0.25
+		}
+		result.Projects = append(result.Projects, *project)
+		result.Scores = append(result.Scores, relevance)
+	}
+	return result, nil
+}
+
+// ConvertPyPIToSearchResult 将 PyPI 搜索结果转换为统一格式
+func ConvertPyPIToSearchResult(ctx context.Context, pypiResult *PyPISearchResult, installedPackageIDs map[string]int64) []SearchPackageResult {
+	installed := make(map[string]int64, len(installedPackageIDs))
+	for name, id := range installedPackageIDs {
+		installed[NormalizePyPIName(name)] = id
+	}
+
+	results := make([]SearchPackageResult, 0, len(pypiResult.Projects))
+	for i, project := range pypiResult.Projects {
+		info := project.Info
+		repoURL := project.repositoryURL()
+		stars := 0
+		if strings.Contains(repoURL, "github.com") {
+			if owner, repo := ParseGitHubRepo(repoURL); owner != "" && repo != "" {
+				stars = FetchGitHubStars(ctx, owner, repo)
+			}
+		}
+		author := info.Author
+		if author == "" {
+			author = info.AuthorEmail
+		}
+		lastUpdated := ""
+		if len(project.URLs) > 0 {
+			lastUpdated = project.URLs[0].UploadTime
+		}
+		license := info.LicenseExpr
+		if license == "" && len(info.License) <= 64 && !strings.Contains(info.License, "\n") {
+			license = info.License
+		}
+		homepage := info.HomePage
+		if homepage == "" {
+			homepage = info.ProjectURLs["Homepage"]
+		}
+
+		var installedIDPtr *int64
+		if id, ok := installed[NormalizePyPIName(info.Name)]; ok {
+			installedIDCopy := id
+			installedIDPtr = &installedIDCopy
+		}
+
+		results = append(results, SearchPackageResult{
+			Name:               info.Name,
+			Version:            info.Version,
+			Description:        info.Summary,
+			PackageManager:     "pypi",
+			SourceURL:          info.PackageURL,
+			Homepage:           homepage,
+			RepositoryURL:      repoURL,
+			License:            license,
+			Stars:              stars,
+			LastUpdated:        lastUpdated,
+			Keywords:           project.keywords(),
+			Author:             author,
+			Score:              pypiResult.Scores[i],
+			IsInstalled:        installedIDPtr != nil,
+			InstalledServiceID: installedIDPtr,
+		})
+	}
+	return results
+}
@@ -0,0 +1,171 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFakePyPI points the PyPI URLs at a local server and returns the number of index downloads it served
+func newFakePyPI(t *testing.T) *atomic.Int32 {
+	var indexRequests atomic.Int32
+	projects := map[string]map[string]interface{}{
+		"mcp-server-fetch": {"name": "mcp-server-fetch", "version": "1.2.0", "summary": "A Model Context Protocol server for fetching web content",
+			"keywords": "mcp, llm, automation", "project_urls": map[string]string{"Repository": "https://gitlab.com/example/fetch"}, "license": "MIT"},
+		"weather-mcp": {"name": "Weather_MCP", "version": "0.3.0", "summary": "Weather forecasts",
+			"keywords": "", "classifiers": []string{"Framework :: MCP"}, "license": "Apache License\n\nVersion 2.0 ..."},
+		"pymcprotocol":  {"name": "pymcprotocol", "version": "0.3.0", "summary": "MC protocol (MELSEC) for Python"},
+		"fastmcp-fetch": {"name": "fastmcp-fetch", "version": "0.1.0", "summary": "Fetch tools for MCP clients"},
+		// Only its keywords say MCP, so it is found through the website search
+		"claude-weather": {"name": "Claude.Weather", "version": "2.0.0", "summary": "Weather tools for assistants", "keywords": "mcp weather"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/simple/", func(w http.ResponseWriter, r *http.Request) {
+		indexRequests.Add(1)
+		if r.Header.Get("Accept") != "application/vnd.pypi.simple.v1+json" {
+			t.Errorf("unexpected Accept header %q", r.Header.Get("Accept"))
+		}
+		_, _ = w.Write([]byte(`{"projects":[{"name":"requests"},{"name":"mcp-server-fetch"},{"name":"Weather_MCP"},{"name":"pymcprotocol"},{"name":"fastmcp-fetch"}]}`))
+	})
+	mux.HandleFunc("/search/", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("c") == "" && (query.Get("q") == "mcp" || strings.Contains(query.Get("q"), "Weather")) {
+			_, _ = w.Write([]byte(`<ul><li><a class="package-snippet" href="/project/Claude.Weather/">Claude.Weather</a></li></ul>`))
+		}
+	})
+	mux.HandleFunc("/pypi/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/pypi/"), "/json")
+		info, ok := projects[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"info": info,
+			"urls": []map[string]string{{"upload_time_iso_8601": "2025-05-01T10:00:00.000000Z"}},
+		})
+	})
+	server := httptest.NewServer(mux)
+
+	originalIndex, originalAPI, originalSearch := PyPISimpleIndex, PyPIJSONAPI, PyPISearchPage
+	PyPISimpleIndex, PyPIJSONAPI, PyPISearchPage = server.URL+"/simple/", server.URL+"/pypi/", server.URL+"/search/"
+	pypiIndexNames, pypiProjects = nil, map[string]pypiCachedProject{}
+	t.Cleanup(func() {
+		server.Close()
+		PyPISimpleIndex, PyPIJSONAPI, PyPISearchPage = originalIndex, originalAPI, originalSearch
+		pypiIndexNames, pypiProjects = nil, map[string]pypiCachedProject{}
+	})
+	return &indexRequests
+}
+
+func TestSearchPyPIPackages(t *testing.T) {
+	newFakePyPI(t)
+	ctx := context.Background()
+
+	result, err := SearchPyPIPackages(ctx, "", 10, 1)
+	if err != nil {
+		t.Fatalf("SearchPyPIPackages failed: %v", err)
+	}
+	if result.Total != 4 {
+		t.Errorf("Expected 4 MCP servers (pymcprotocol is not one), got %d", result.Total)
+	}
+	results := ConvertPyPIToSearchResult(ctx, result, map[string]int64{"weather_mcp": 7})
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	// mcp-server-* first, then mcp segments; other names are kept only when the metadata says MCP
+	if strings.Join(names, ",") != "mcp-server-fetch,Weather_MCP,fastmcp-fetch,Claude.Weather" {
+		t.Fatalf("Unexpected results %v", names)
+	}
+
+	fetch, weather := results[0], results[1]
+	if fetch.PackageManager != "pypi" || fetch.Version != "1.2.0" || fetch.License != "MIT" {
+		t.Errorf("Unexpected conversion %+v", fetch)
+	}
+	if fetch.RepositoryURL != "https://gitlab.com/example/fetch" || fetch.LastUpdated == "" {
+		t.Errorf("Expected repository and upload time, got %+v", fetch)
+	}
+	if len(fetch.Keywords) != 3 || fetch.Keywords[0] != "mcp" {
+		t.Errorf("Expected split keywords, got %v", fetch.Keywords)
+	}
+	if fetch.IsInstalled {
+		t.Error("mcp-server-fetch is not installed")
+	}
+	if !weather.IsInstalled || weather.InstalledServiceID == nil || *weather.InstalledServiceID != 7 {
+		t.Errorf("Expected Weather_MCP to match the installed weather_mcp, got %+v", weather)
+	}
+	if weather.License != "" {
+		t.Errorf("License texts should not be shown as the license, got %q", weather.License)
+	}
+
+	result, err = SearchPyPIPackages(ctx, "Weather", 10, 1)
+	if err != nil {
+		t.Fatalf("SearchPyPIPackages failed: %v", err)
+	}
+	if result.Total != 2 || len(result.Projects) != 2 || result.Projects[0].Info.Name != "Weather_MCP" || result.Projects[1].Info.Name != "Claude.Weather" {
+		t.Errorf("Expected Weather_MCP and Claude.Weather, got %+v", result)
+	}
+
+	result, err = SearchPyPIPackages(ctx, "", 1, 2)
+	if err != nil {
+		t.Fatalf("SearchPyPIPackages failed: %v", err)
+	}
+	if len(result.Projects) != 1 || result.Projects[0].Info.Name != "Weather_MCP" {
+		t.Errorf("Expected the second page to hold Weather_MCP, got %+v", result.Projects)
+	}
+
+	// pymcprotocol is filtered out before paging, so the last page is full
+	result, err = SearchPyPIPackages(ctx, "", 2, 2)
+	if err != nil {
+		t.Fatalf("SearchPyPIPackages failed: %v", err)
+	}
+	if result.Total != 4 || len(result.Projects) != 2 || result.Projects[0].Info.Name != "fastmcp-fetch" || result.Projects[1].Info.Name != "Claude.Weather" {
+		t.Errorf("Expected fastmcp-fetch and Claude.Weather on the second page, got %+v", result)
+	}
+}
+
+func TestGetPyPIMCPNamesDownloadsTheIndexOnce(t *testing.T) {
+	indexRequests := newFakePyPI(t)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if names, err := getPyPIMCPNames(); err != nil || len(names) != 4 {
+				t.Errorf("Expected the downloaded list, got %v, %v", names, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := indexRequests.Load(); n != 1 {
+		t.Errorf("Expected concurrent first searches to share one download, got %d", n)
+	}
+}
+
+func TestGetPyPIMCPNamesUsesStaleListDuringRefresh(t *testing.T) {
+	newFakePyPI(t)
+	pypiIndexNames = []string{"mcp-server-stale"}
+	pypiIndexFetchedAt = time.Now().Add(-2 * pypiIndexTTL)
+
+	names, err := getPyPIMCPNames()
+	if err != nil || len(names) != 1 || names[0] != "mcp-server-stale" {
+		t.Fatalf("Expected the stale list while the refresh runs, got %v, %v", names, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(names) != 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		names, err = getPyPIMCPNames()
+	}
+	if err != nil || len(names) != 4 {
+		t.Fatalf("Expected the list refreshed in the background, got %v, %v", names, err)
+	}
+}
@@ -0,0 +1,446 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// PackageManagerRegistry is the marketplace source of the MCP server registry. Installed services keep the
+// package manager of the package they run (npm or pypi); remote servers are stored with this one.
+const PackageManagerRegistry = "registry"
+
+// RegistryServer is a server.json document of the MCP server registry
+type RegistryServer struct {
+	Name        string              `json:"name"` // Reverse-DNS name, e.g. io.github.user/weather
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description"`
+	Version     string              `json:"version"`
+	WebsiteURL  string              `json:"websiteUrl,omitempty"`
+	Repository  *RegistryRepository `json:"repository,omitempty"`
+	Icons       []RegistryIcon      `json:"icons,omitempty"`
+	Packages    []RegistryPackage   `json:"packages,omitempty"`
+	Remotes     []RegistryTransport `json:"remotes,omitempty"`
+}
+
+// RegistryRepository is the source repository of a server
+type RegistryRepository struct {
+	URL       string `json:"url"`
+	Source    string `json:"source"` // e.g. github
+	Subfolder string `json:"subfolder,omitempty"`
+}
+
+// RegistryIcon is an icon of a server
+type RegistryIcon struct {
+	Src      string `json:"src"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// RegistryPackage is a package that runs a server locally
+type RegistryPackage struct {
+	RegistryType         string             `json:"registryType"` // npm, pypi, oci, nuget or mcpb
+	Identifier           string             `json:"identifier"`
+	Version              string             `json:"version,omitempty"`
+	RuntimeHint          string             `json:"runtimeHint,omitempty"` // e.g. npx or uvx
+	Transport            RegistryTransport  `json:"transport"`
+	RuntimeArguments     []RegistryArgument `json:"runtimeArguments,omitempty"`
+	PackageArguments     []RegistryArgument `json:"packageArguments,omitempty"`
+	EnvironmentVariables []RegistryInput    `json:"environmentVariables,omitempty"`
+}
+
+// RegistryTransport is how a client talks to a package or a remote server
+type RegistryTransport struct {
+	Type    string          `json:"type"`          // stdio, streamable-http or sse
+	URL     string          `json:"url,omitempty"` // For remotes and HTTP packages
+	Headers []RegistryInput `json:"headers,omitempty"`
+}
+
+// RegistryInput is an environment variable or header the server takes. Value may contain {name} references to
+// Variables.
+type RegistryInput struct {
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	IsRequired  bool                     `json:"isRequired,omitempty"`
+	IsSecret    bool                     `json:"isSecret,omitempty"`
+	Value       string                   `json:"value,omitempty"`
+	Default     string                   `json:"default,omitempty"`
+	Variables   map[string]RegistryInput `json:"variables,omitempty"`
+}
+
+// RegistryArgument is a command line argument of a package
+type RegistryArgument struct {
+	RegistryInput
+	Type string `json:"type"` // positional or named
+}
+
+// RegistryServerResponse is a server with the registry's metadata about it
+type RegistryServerResponse struct {
+	Server RegistryServer `json:"server"`
+	Meta   struct {
+		Official struct {
+			Status      string `json:"status"`
+			PublishedAt string `json:"publishedAt"`
+			UpdatedAt   string `json:"updatedAt"`
+			IsLatest    bool   `json:"isLatest"`
+		} `json:"io.modelcontextprotocol.registry/official"`
+	} `json:"_meta"`
+}
+
+// RegistryServerList is a page of servers listed by the registry
+type RegistryServerList struct {
+	Servers  []RegistryServerResponse `json:"servers"`
+	Metadata struct {
+		NextCursor string `json:"nextCursor,omitempty"`
+		Count      int    `json:"count"`
+	} `json:"metadata"`
+}
+
+// getRegistry fetches a registry API path into out
+func getRegistry(ctx context.Context, path string, query url.Values, out interface{}) error {
+	reqURL := common.GetMCPRegistryURL() + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query MCP registry: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("MCP registry returned error: %s, status code: %d", string(data), resp.StatusCode)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse MCP registry response: %w", err)
+	}
+	return nil
+}
+
+// SearchRegistryServers 搜索 MCP Registry 中的服务器（仅最新版本）。Registry 使用游标分页，第 page 页需要依次翻页获取
+func SearchRegistryServers(ctx context.Context, query string, limit int, page int) (*RegistryServerList, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if page <= 0 {
+		page = 1
+	}
+	params := url.Values{}
+	params.Set("version", "latest")
+	params.Set("limit", strconv.Itoa(limit))
+	if query = strings.TrimSpace(query); query != "" {
+		params.Set("search", query)
+	}
+
+	var result RegistryServerList
+	for current := 1; current <= page; current++ {
+		result = RegistryServerList{}
+		if err := getRegistry(ctx, "/v0/servers", params, &result); err != nil {
+			return nil, err
+		}
+		if current < page {
+			if result.Metadata.NextCursor == "" {
+				return &RegistryServerList{}, nil // Past the last page
+			}
+			params.Set("cursor", result.Metadata.NextCursor)
+		}
+	}
+	return &result, nil
+}
+
+// GetRegistryServer 获取 MCP Registry 中服务器的最新版本
+func GetRegistryServer(ctx context.Context, name string) (*RegistryServerResponse, error) {
+	var result RegistryServerResponse
+	if err := getRegistry(ctx, "/v0/servers/"+url.PathEscape(name)+"/versions/latest", nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Server.Name == "" {
+		return nil, fmt.Errorf("MCP registry has no server %s", name)
+	}
+	return &result, nil
+}
+
+// ShortName returns the last part of the server name, e.g. weather for io.github.user/weather
+func (s *RegistryServer) ShortName() string {
+	return s.Name[strings.LastIndex(s.Name, "/")+1:]
+}
+
+// localPackage returns the first package one-mcp can run as a stdio service
+func (s *RegistryServer) localPackage() *RegistryPackage {
+	for i := range s.Packages {
+		pkg := &s.Packages[i]
+		if (pkg.RegistryType == "npm" || pkg.RegistryType == "pypi") && (pkg.Transport.Type == "" || pkg.Transport.Type == "stdio") {
+			return pkg
+		}
+	}
+	return nil
+}
+
+// remote returns the remote endpoint one-mcp proxies to, preferring streamable HTTP over SSE
+func (s *RegistryServer) remote() *RegistryTransport {
+	for _, transportType := range []string{"streamable-http", "sse"} {
+		for i := range s.Remotes {
+			if s.Remotes[i].Type == transportType && s.Remotes[i].URL != "" {
+				return &s.Remotes[i]
+			}
+		}
+	}
+	return nil
+}
+
+// InstallTarget returns the package manager and package name a service of the server is installed with, as
+// stored in PackageManager and SourcePackageName
+func (s *RegistryServer) InstallTarget() (string, string) {
+	if pkg := s.localPackage(); pkg != nil {
+		return pkg.RegistryType, pkg.Identifier
+	}
+	return PackageManagerRegistry, s.Name
+}
+
+// PackageVersion returns the version of the package a service of the server runs
+func (s *RegistryServer) PackageVersion() string {
+	if pkg := s.localPackage(); pkg != nil && pkg.Version != "" {
+		return pkg.Version
+	}
+	return s.Version
+}
+
+// registryVariablePattern matches a {name} reference to a variable of an input
+var registryVariablePattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_.-]*)\}`)
+
+// appendArguments appends the arguments that have a fixed value or a default. Arguments the user would have to
+// fill in are left out; they can be added as custom arguments.
+func appendArguments(args []string, arguments []RegistryArgument) []string {
+	for _, argument := range arguments {
+		value := argument.Value
+		if value == "" {
+			value = argument.Default
+		}
+		if registryVariablePattern.MatchString(value) {
+			continue
+		}
+		switch argument.Type {
+		case "named":
+			if value == "" && argument.IsRequired {
+				continue
+			}
+			args = append(args, argument.Name)
+			if value != "" {
+				args = append(args, value)
+			}
+		default:
+			if value != "" {
+				args = append(args, value)
+			}
+		}
+	}
+	return args
+}
+
+// inputDefinition converts an input into the definition of the value the user provides
+func inputDefinition(name string, input RegistryInput) model.EnvVarDefinition {
+	defaultValue := input.Default
+	if defaultValue == "" && !registryVariablePattern.MatchString(input.Value) {
+		defaultValue = input.Value
+	}
+	return model.EnvVarDefinition{
+		Name:         name,
+		Description:  input.Description,
+		IsSecret:     input.IsSecret,
+		Optional:     !input.IsRequired,
+		DefaultValue: defaultValue,
+	}
+}
+
+// headerPlaceholderName turns a header name into the name of the value filling it, e.g. X-API-Key to X_API_KEY
+func headerPlaceholderName(header string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, header))
+}
+
+// ToMCPService maps the server to an MCPService and the values it needs from the user. A stdio package (npm or
+// pypi) is preferred; otherwise a remote endpoint is proxied, its headers taking {{NAME}} placeholders for the
+// values the user provides. The service is not saved.
+func (s *RegistryServer) ToMCPService() (*model.MCPService, []model.EnvVarDefinition, error) {
+	svc := &model.MCPService{
+		Name:                  s.ShortName(),
+		DisplayName:           s.Title,
+		Description:           s.Description,
+		Category:              model.CategoryAI,
+		ClientConfigTemplates: "{}",
+		Enabled:               true,
+	}
+	if svc.DisplayName == "" {
+		svc.DisplayName = s.ShortName()
+	}
+	if len(s.Icons) > 0 {
+		svc.Icon = s.Icons[0].Src
+	}
+	svc.PackageManager, svc.SourcePackageName = s.InstallTarget()
+
+	var definitions []model.EnvVarDefinition
+	if pkg := s.localPackage(); pkg != nil {
+		svc.Type = model.ServiceTypeStdio
+		svc.Command = pkg.RuntimeHint
+		var args []string
+		switch pkg.RegistryType {
+		case "npm":
+			if svc.Command == "" {
+				svc.Command = "npx"
+			}
+			if len(pkg.RuntimeArguments) == 0 && svc.Command == "npx" {
+				args = []string{"-y"}
+			}
+		case "pypi":
+			if svc.Command == "" {
+				svc.Command = "uvx"
+			}
+		}
+		args = appendArguments(args, pkg.RuntimeArguments)
+		args = append(args, pkg.Identifier)
+		args = appendArguments(args, pkg.PackageArguments)
+		argsJSON, err := json.Marshal(args)
+		if err != nil {
+			return nil, nil, err
+		}
+		svc.ArgsJSON = string(argsJSON)
+
+		defaults := map[string]string{}
+		for _, env := range pkg.EnvironmentVariables {
+			definition := inputDefinition(env.Name, env)
+			definitions = append(definitions, definition)
+			if definition.DefaultValue != "" {
+				defaults[env.Name] = definition.DefaultValue
+			}
+		}
+		if len(defaults) > 0 {
+			defaultsJSON, err := json.Marshal(defaults)
+			if err != nil {
+				return nil, nil, err
+			}
+			svc.DefaultEnvsJSON = string(defaultsJSON)
+		}
+	} else if remote := s.remote(); remote != nil {
+		svc.Type = model.ServiceTypeStreamableHTTP
+		if remote.Type == "sse" {
+			svc.Type = model.ServiceTypeSSE
+		}
+		svc.Command = remote.URL // URL is stored in Command field for SSE/HTTP
+
+		headers := map[string]string{}
+		for _, header := range remote.Headers {
+			if header.Value != "" && !registryVariablePattern.MatchString(header.Value) {
+				headers[header.Name] = header.Value // Fixed value
+				continue
+			}
+			if header.Value == "" {
+				// The whole value comes from the user
+				name := headerPlaceholderName(header.Name)
+				headers[header.Name] = "{{" + name + "}}"
+				definitions = append(definitions, inputDefinition(name, header))
+				continue
+			}
+			// Values such as "Bearer {token}" are filled from their variables
+			headers[header.Name] = registryVariablePattern.ReplaceAllString(header.Value, "{{$1}}")
+			for _, match := range registryVariablePattern.FindAllStringSubmatch(header.Value, -1) {
+				variable := header.Variables[match[1]]
+				if variable.Description == "" {
+					variable.Description = header.Description
+				}
+				// A variable of a required or secret header is required or secret too
+				variable.IsRequired = variable.IsRequired || header.IsRequired
+				variable.IsSecret = variable.IsSecret || header.IsSecret
+				definitions = append(definitions, inputDefinition(match[1], variable))
+			}
+		}
+		if len(headers) > 0 {
+			headersJSON, err := json.Marshal(headers)
+			if err != nil {
+				return nil, nil, err
+			}
+			svc.HeadersJSON = string(headersJSON)
+		}
+	} else {
+		return nil, nil, fmt.Errorf("server %s has no npm or pypi stdio package and no streamable HTTP or SSE remote", s.Name)
+	}
+
+	if len(definitions) > 0 {
+		if err := svc.SetRequiredEnvVars(definitions); err != nil {
+			return nil, nil, err
+		}
+	}
+	return svc, definitions, nil
+}
+
+// ConvertRegistryToSearchResult 将 MCP Registry 搜索结果转换为统一格式。Name 为 Registry 中的服务器名，
+// 安装状态按其将要安装的包判断
+func ConvertRegistryToSearchResult(ctx context.Context, registryResult *RegistryServerList, installedPackageIDs map[string]int64) []SearchPackageResult {
+	results := make([]SearchPackageResult, 0, len(registryResult.Servers))
+	for _, entry := range registryResult.Servers {
+		server := entry.Server
+		if _, _, err := server.ToMCPService(); err != nil {
+			continue // Nothing one-mcp can run or proxy, e.g. only OCI images
+		}
+
+		repoURL := ""
+		stars := 0
+		if server.Repository != nil {
+			repoURL = server.Repository.URL
+			if strings.Contains(repoURL, "github.com") {
+				if owner, repo := ParseGitHubRepo(repoURL); owner != "" && repo != "" {
+					stars = FetchGitHubStars(ctx, owner, repo)
+				}
+			}
+		}
+		iconURL := ""
+		if len(server.Icons) > 0 {
+			iconURL = server.Icons[0].Src
+		}
+
+		var installedIDPtr *int64
+		_, packageName := server.InstallTarget()
+		if id, ok := installedPackageIDs[packageName]; ok {
+			installedIDCopy := id
+			installedIDPtr = &installedIDCopy
+		}
+
+		results = append(results, SearchPackageResult{
+			Name:               server.Name,
+			Version:            server.Version,
+			Description:        server.Description,
+			PackageManager:     PackageManagerRegistry,
+			SourceURL:          common.GetMCPRegistryURL() + "/v0/servers/" + url.PathEscape(server.Name) + "/versions/latest",
+			Homepage:           server.WebsiteURL,
+			RepositoryURL:      repoURL,
+			IconURL:            iconURL,
+			Stars:              stars,
+			LastUpdated:        entry.Meta.Official.UpdatedAt,
+			Author:             strings.SplitN(server.Name, "/", 2)[0],
+			IsInstalled:        installedIDPtr != nil,
+			InstalledServiceID: installedIDPtr,
+		})
+	}
+	return results
+}
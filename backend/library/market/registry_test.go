@@ -0,0 +1,193 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+const weatherServerJSON = `{
+	"name": "io.gitlab.example/weather",
+	"title": "Weather",
+	"description": "Weather forecasts",
+	"version": "1.0.2",
+	"repository": {"url": "https://gitlab.com/example/weather", "source": "gitlab"},
+	"icons": [{"src": "https://example.com/weather.png"}],
+	"packages": [
+		{"registryType": "oci", "identifier": "docker.io/example/weather", "transport": {"type": "stdio"}},
+		{"registryType": "npm", "identifier": "@example/weather-mcp", "version": "1.0.2", "transport": {"type": "stdio"},
+		 "packageArguments": [
+			{"type": "named", "name": "--units", "default": "metric"},
+			{"type": "positional", "value": "{data_dir}", "isRequired": true}
+		 ],
+		 "environmentVariables": [
+			{"name": "WEATHER_API_KEY", "description": "API key", "isRequired": true, "isSecret": true},
+			{"name": "WEATHER_REGION", "description": "Region", "default": "eu"}
+		 ]}
+	]
+}`
+
+const searchServerJSON = `{
+	"name": "com.example/search",
+	"description": "Hosted search",
+	"version": "2.0.0",
+	"remotes": [
+		{"type": "sse", "url": "https://search.example.com/sse"},
+		{"type": "streamable-http", "url": "https://search.example.com/mcp", "headers": [
+			{"name": "X-API-Key", "description": "Search API key", "isRequired": true, "isSecret": true},
+			{"name": "Authorization", "value": "Bearer {token}", "isRequired": true, "isSecret": true,
+			 "variables": {"token": {"description": "Search token"}}},
+			{"name": "X-Client", "value": "one-mcp"}
+		]}
+	]
+}`
+
+func newFakeRegistry(t *testing.T) {
+	servers := []string{weatherServerJSON, searchServerJSON, `{"name": "com.example/image-only", "description": "OCI only", "version": "1.0.0",
+		"packages": [{"registryType": "oci", "identifier": "docker.io/example/image", "transport": {"type": "stdio"}}]}`}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mirror/v0/servers", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("version") != "latest" {
+			t.Errorf("expected version=latest, got %q", r.URL.RawQuery)
+		}
+		// One server per page with the limit of 1, otherwise all of them
+		page := "{\"servers\":["
+		switch {
+		case r.URL.Query().Get("limit") != "1":
+			for i, server := range servers {
+				if i > 0 {
+					page += ","
+				}
+				page += `{"server":` + server + `,"_meta":{"io.modelcontextprotocol.registry/official":{"updatedAt":"2025-09-01T00:00:00Z"}}}`
+			}
+			page += `],"metadata":{"count":3}}`
+		case r.URL.Query().Get("cursor") == "":
+			page += `{"server":` + servers[0] + `}],"metadata":{"nextCursor":"second","count":1}}`
+		default:
+			page += `{"server":` + servers[1] + `}],"metadata":{"count":1}}`
+		}
+		_, _ = w.Write([]byte(page))
+	})
+	mux.HandleFunc("/mirror/v0/servers/io.gitlab.example%2Fweather/versions/latest", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"server":` + weatherServerJSON + `}`))
+	})
+	server := httptest.NewServer(mux)
+
+	common.OptionMapRWMutex.Lock()
+	original := common.OptionMap["MCPRegistryURL"]
+	common.OptionMap["MCPRegistryURL"] = server.URL + "/mirror/"
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		server.Close()
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap["MCPRegistryURL"] = original
+		common.OptionMapRWMutex.Unlock()
+	})
+}
+
+func TestRegistryServerToMCPService(t *testing.T) {
+	var weather, search RegistryServer
+	if err := json.Unmarshal([]byte(weatherServerJSON), &weather); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(searchServerJSON), &search); err != nil {
+		t.Fatal(err)
+	}
+
+	svc, envVars, err := weather.ToMCPService()
+	if err != nil {
+		t.Fatalf("ToMCPService failed: %v", err)
+	}
+	if svc.Name != "weather" || svc.DisplayName != "Weather" || svc.Icon != "https://example.com/weather.png" {
+		t.Errorf("Unexpected service %+v", svc)
+	}
+	if svc.Type != model.ServiceTypeStdio || svc.PackageManager != "npm" || svc.SourcePackageName != "@example/weather-mcp" {
+		t.Errorf("Expected the npm package to be used, got %+v", svc)
+	}
+	if svc.Command != "npx" || svc.ArgsJSON != `["-y","@example/weather-mcp","--units","metric"]` {
+		t.Errorf("Unexpected command %s %s", svc.Command, svc.ArgsJSON)
+	}
+	if svc.DefaultEnvsJSON != `{"WEATHER_REGION":"eu"}` {
+		t.Errorf("Expected declared defaults, got %s", svc.DefaultEnvsJSON)
+	}
+	if len(envVars) != 2 || envVars[0].Name != "WEATHER_API_KEY" || !envVars[0].IsSecret || envVars[0].Optional || !envVars[1].Optional {
+		t.Errorf("Unexpected env vars %+v", envVars)
+	}
+	if stored, _ := svc.GetRequiredEnvVars(); len(stored) != 2 {
+		t.Errorf("Expected the env vars to be stored on the service, got %+v", stored)
+	}
+
+	svc, envVars, err = search.ToMCPService()
+	if err != nil {
+		t.Fatalf("ToMCPService failed: %v", err)
+	}
+	if svc.Type != model.ServiceTypeStreamableHTTP || svc.Command != "https://search.example.com/mcp" {
+		t.Errorf("Expected the streamable HTTP remote, got %s %s", svc.Type, svc.Command)
+	}
+	if svc.PackageManager != PackageManagerRegistry || svc.SourcePackageName != "com.example/search" {
+		t.Errorf("Unexpected install target %s %s", svc.PackageManager, svc.SourcePackageName)
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(svc.HeadersJSON), &headers); err != nil {
+		t.Fatal(err)
+	}
+	if headers["X-API-Key"] != "{{X_API_KEY}}" || headers["Authorization"] != "Bearer {{token}}" || headers["X-Client"] != "one-mcp" {
+		t.Errorf("Unexpected headers %v", headers)
+	}
+	if len(envVars) != 2 || envVars[0].Name != "X_API_KEY" || envVars[1].Name != "token" || envVars[1].Description != "Search token" ||
+		!envVars[1].IsSecret || envVars[1].Optional {
+		t.Errorf("Unexpected header values %+v", envVars)
+	}
+}
+
+func TestSearchRegistryServers(t *testing.T) {
+	newFakeRegistry(t)
+	ctx := context.Background()
+
+	result, err := SearchRegistryServers(ctx, "", 20, 1)
+	if err != nil {
+		t.Fatalf("SearchRegistryServers failed: %v", err)
+	}
+	results := ConvertRegistryToSearchResult(ctx, result, map[string]int64{"@example/weather-mcp": 3})
+	if len(results) != 2 {
+		t.Fatalf("Expected the OCI-only server to be skipped, got %+v", results)
+	}
+	weather, search := results[0], results[1]
+	if weather.Name != "io.gitlab.example/weather" || weather.PackageManager != PackageManagerRegistry || weather.Author != "io.gitlab.example" {
+		t.Errorf("Unexpected conversion %+v", weather)
+	}
+	if !weather.IsInstalled || *weather.InstalledServiceID != 3 {
+		t.Errorf("Expected weather to match its installed npm package, got %+v", weather)
+	}
+	if search.IsInstalled || search.LastUpdated == "" {
+		t.Errorf("Unexpected conversion %+v", search)
+	}
+
+	result, err = SearchRegistryServers(ctx, "", 1, 2)
+	if err != nil {
+		t.Fatalf("SearchRegistryServers failed: %v", err)
+	}
+	if len(result.Servers) != 1 || result.Servers[0].Server.Name != "com.example/search" {
+		t.Errorf("Expected the second page to hold com.example/search, got %+v", result.Servers)
+	}
+	result, err = SearchRegistryServers(ctx, "", 1, 3)
+	if err != nil || len(result.Servers) != 0 {
+		t.Errorf("Expected no servers past the last page, got %+v, %v", result, err)
+	}
+
+	entry, err := GetRegistryServer(ctx, "io.gitlab.example/weather")
+	if err != nil {
+		t.Fatalf("GetRegistryServer failed: %v", err)
+	}
+	if entry.Server.Version != "1.0.2" || entry.Server.PackageVersion() != "1.0.2" {
+		t.Errorf("Unexpected server %+v", entry.Server)
+	}
+	if _, err := GetRegistryServer(ctx, "com.example/missing"); err == nil {
+		t.Error("Expected an error for an unknown server")
+	}
+}
@@ -0,0 +1,104 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GetLatestVersion 获取 npm 或 PyPI 包的最新发布版本
+func GetLatestVersion(ctx context.Context, packageManager, packageName string) (string, error) {
+	switch packageManager {
+	case "npm":
+		return getNPMLatestVersion(ctx, npmBaseName(packageName))
+	case "pypi", "uv", "pip":
+		info, err := GetPyPIProjectInfo(ctx, pypiBaseName(packageName))
+		if err != nil {
+			return "", err
+		}
+		return info.Info.Version, nil
+	default:
+		return "", fmt.Errorf("version checks are not supported for package manager %s", packageManager)
+	}
+}
+
+// getNPMLatestVersion returns the version of the latest dist-tag of an npm package
+func getNPMLatestVersion(ctx context.Context, packageName string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", NPMPackageInfo+packageName+"/latest", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest version of %s: %w", packageName, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("npm API returned status code %d for %s", resp.StatusCode, packageName)
+	}
+	var manifest struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return "", fmt.Errorf("failed to parse latest version of %s: %w", packageName, err)
+	}
+	if manifest.Version == "" {
+		return "", fmt.Errorf("npm API returned no version for %s", packageName)
+	}
+	return manifest.Version, nil
+}
+
+// PinPackageArgs 将命令参数中的包固定到指定版本，例如 npx 的 pkg@1.2.3、uvx 的 --from pkg==1.2.3 或 pkg@1.2.3，
+// 已有的版本会被替换。version 为空或 latest 时返回原参数。
+func PinPackageArgs(packageManager, packageName, version string, args []string) []string {
+	pinned := append([]string(nil), args...)
+	if version == "" || version == "latest" {
+		return pinned
+	}
+	switch packageManager {
+	case "npm":
+		name := npmBaseName(packageName)
+		for i, arg := range pinned {
+			if !strings.HasPrefix(arg, "-") && npmBaseName(arg) == name {
+				pinned[i] = name + "@" + version
+				return pinned
+			}
+		}
+	case "pypi", "uv", "pip":
+		name := pypiBaseName(packageName)
+		for i, arg := range pinned {
+			if arg == "--from" && i+1 < len(pinned) && NormalizePyPIName(pypiBaseName(pinned[i+1])) == NormalizePyPIName(name) {
+				pinned[i+1] = name + "==" + version
+				return pinned
+			}
+		}
+		for i, arg := range pinned {
+			if !strings.HasPrefix(arg, "-") && NormalizePyPIName(pypiBaseName(arg)) == NormalizePyPIName(name) {
+				pinned[i] = name + "@" + version
+				return pinned
+			}
+		}
+	}
+	return pinned
+}
+
+// npmBaseName strips the version of an npm package spec, e.g. @scope/pkg@1.2.3 -> @scope/pkg
+func npmBaseName(spec string) string {
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		return spec[:i]
+	}
+	return spec
+}
+
+// pypiBaseName strips the version specifier or extras of a Python requirement, e.g. pkg[cli]==1.2 -> pkg
+func pypiBaseName(spec string) string {
+	if i := strings.IndexAny(spec, "[=<>!~@; "); i > 0 {
+		return spec[:i]
+	}
+	return spec
+}
@@ -0,0 +1,78 @@
+package market
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLatestVersion(t *testing.T) {
+	npm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/@modelcontextprotocol/server-filesystem/latest":
+			_, _ = w.Write([]byte(`{"name":"@modelcontextprotocol/server-filesystem","version":"2025.7.1"}`))
+		case "/mcp-time/latest":
+			_, _ = w.Write([]byte(`{"name":"mcp-time","version":"0.4.0"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	original := NPMPackageInfo
+	NPMPackageInfo = npm.URL + "/"
+	t.Cleanup(func() {
+		npm.Close()
+		NPMPackageInfo = original
+	})
+	newFakePyPI(t)
+	ctx := context.Background()
+
+	version, err := GetLatestVersion(ctx, "npm", "@modelcontextprotocol/server-filesystem")
+	require.NoError(t, err)
+	assert.Equal(t, "2025.7.1", version)
+	version, err = GetLatestVersion(ctx, "npm", "mcp-time@0.3.0")
+	require.NoError(t, err)
+	assert.Equal(t, "0.4.0", version, "the installed version of the spec is ignored")
+	_, err = GetLatestVersion(ctx, "npm", "missing")
+	assert.Error(t, err)
+
+	version, err = GetLatestVersion(ctx, "pypi", "mcp-server-fetch")
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.0", version)
+
+	_, err = GetLatestVersion(ctx, "docker", "mcp/fetch")
+	assert.Error(t, err)
+}
+
+func TestPinPackageArgs(t *testing.T) {
+	tests := []struct {
+		name           string
+		packageManager string
+		packageName    string
+		version        string
+		args           []string
+		want           []string
+	}{
+		{"npx default", "npm", "@scope/server", "1.2.3", []string{"-y", "@scope/server"}, []string{"-y", "@scope/server@1.2.3"}},
+		{"npx repins", "npm", "mcp-time", "0.4.0", []string{"-y", "mcp-time@0.3.0", "--utc"}, []string{"-y", "mcp-time@0.4.0", "--utc"}},
+		{"uvx --from", "pypi", "mcp-server-fetch", "1.2.0", []string{"--from", "mcp-server-fetch", "mcp-server-fetch"},
+			[]string{"--from", "mcp-server-fetch==1.2.0", "mcp-server-fetch"}},
+		{"uvx --from repins", "pypi", "mcp-server-fetch", "1.3.0", []string{"--from", "mcp_server_fetch==1.2.0", "mcp-server-fetch"},
+			[]string{"--from", "mcp-server-fetch==1.3.0", "mcp-server-fetch"}},
+		{"uvx tool", "pypi", "mcp-server-time", "0.6.2", []string{"mcp-server-time", "--local-timezone=UTC"},
+			[]string{"mcp-server-time@0.6.2", "--local-timezone=UTC"}},
+		{"latest is unpinned", "npm", "mcp-time", "latest", []string{"-y", "mcp-time"}, []string{"-y", "mcp-time"}},
+		{"package missing", "npm", "mcp-time", "1.0.0", []string{"-y", "other"}, []string{"-y", "other"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := append([]string(nil), tt.args...)
+			assert.Equal(t, tt.want, PinPackageArgs(tt.packageManager, tt.packageName, tt.version, tt.args))
+			assert.Equal(t, original, tt.args, "the args are copied")
+		})
+	}
+}
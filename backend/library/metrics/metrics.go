@@ -0,0 +1,265 @@
+// Package metrics implements a minimal Prometheus text exposition (format 0.0.4) registry.
+// Collectors register themselves when created and are rendered in registration order by WriteText.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Content-Type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultLatencyBuckets are histogram buckets in seconds suitable for proxied MCP requests
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// WriteText renders every registered collector in the Prometheus text format
+func WriteText(w io.Writer) error {
+	registryMu.RLock()
+	collectors := make([]collector, len(registry))
+	copy(collectors, registry)
+	registryMu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// labelKey joins label values into a map key; \xff cannot appear in valid UTF-8 label values
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders {name="value",...}; extra is appended as-is (used for the histogram "le" label)
+func formatLabels(names, values []string, extra string) string {
+	if len(names) == 0 && extra == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(labelValueEscaper.Replace(values[i]))
+		sb.WriteByte('"')
+	}
+	if extra != "" {
+		if len(names) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extra)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w *bufio.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.ReplaceAll(help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+// sortedKeys returns map keys in a stable order so scrapes are deterministic
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func checkLabelCount(name string, labels, values []string) {
+	if len(labels) != len(values) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", name, len(labels), len(values)))
+	}
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounterVec creates and registers a counter
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*counterSeries)}
+	register(c)
+	return c
+}
+
+// Inc adds 1 to the series identified by labelValues
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v (which must not be negative) to the series identified by labelValues
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	checkLabelCount(c.name, c.labels, labelValues)
+	if v < 0 {
+		return
+	}
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	series, ok := c.values[key]
+	if !ok {
+		series = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		c.values[key] = series
+	}
+	series.value += v
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		series := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, series.labelValues, ""), formatValue(series.value))
+	}
+}
+
+// HistogramVec counts observations into cumulative buckets, partitioned by labels
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec creates and registers a histogram. Buckets must be sorted ascending; +Inf is implicit.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramSeries)}
+	register(h)
+	return h
+}
+
+// Observe records a value for the series identified by labelValues
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	checkLabelCount(h.name, h.labels, labelValues)
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, ok := h.values[key]
+	if !ok {
+		series = &histogramSeries{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = series
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		series.counts[i]++
+	}
+	series.count++
+	series.sum += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		series := h.values[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += series.counts[i]
+			le := `le="` + formatValue(upper) + `"`
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, series.labelValues, le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, series.labelValues, `le="+Inf"`), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, series.labelValues, ""), formatValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, series.labelValues, ""), series.count)
+	}
+}
+
+// GaugeSample is one series reported by a GaugeFunc
+type GaugeSample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// GaugeFunc reports gauges computed at scrape time, e.g. from in-memory caches
+type GaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func() []GaugeSample
+}
+
+// NewGaugeFunc creates and registers a gauge whose samples are produced by collect on every scrape
+func NewGaugeFunc(name, help string, labels []string, collect func() []GaugeSample) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, labels: labels, collect: collect}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	samples := g.collect()
+	sort.SliceStable(samples, func(i, j int) bool {
+		return labelKey(samples[i].LabelValues) < labelKey(samples[j].LabelValues)
+	})
+	for _, s := range samples {
+		if len(s.LabelValues) != len(g.labels) {
+			continue
+		}
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, s.LabelValues, ""), formatValue(s.Value))
+	}
+}
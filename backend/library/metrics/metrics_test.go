@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func render(c collector) string {
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	c.write(w)
+	_ = w.Flush()
+	return sb.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	c := &CounterVec{name: "test_requests_total", help: "Test requests.", labels: []string{"service", "tool"}, values: make(map[string]*counterSeries)}
+	c.Inc("github", "create_issue")
+	c.Inc("github", "create_issue")
+	c.Add(3, "fetch", `say "hi"`)
+
+	out := render(c)
+	assert.Contains(t, out, "# TYPE test_requests_total counter\n")
+	assert.Contains(t, out, `test_requests_total{service="github",tool="create_issue"} 2`+"\n")
+	assert.Contains(t, out, `test_requests_total{service="fetch",tool="say \"hi\""} 3`+"\n")
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := &HistogramVec{name: "test_duration_seconds", help: "Test latency.", labels: []string{"service"}, buckets: []float64{0.1, 1}, values: make(map[string]*histogramSeries)}
+	h.Observe(0.05, "github")
+	h.Observe(0.1, "github")
+	h.Observe(0.5, "github")
+	h.Observe(5, "github")
+
+	out := render(h)
+	assert.Contains(t, out, `test_duration_seconds_bucket{service="github",le="0.1"} 2`+"\n")
+	assert.Contains(t, out, `test_duration_seconds_bucket{service="github",le="1"} 3`+"\n")
+	assert.Contains(t, out, `test_duration_seconds_bucket{service="github",le="+Inf"} 4`+"\n")
+	assert.Contains(t, out, `test_duration_seconds_sum{service="github"} 5.65`+"\n")
+	assert.Contains(t, out, `test_duration_seconds_count{service="github"} 4`+"\n")
+}
+
+func TestGaugeFunc(t *testing.T) {
+	g := &GaugeFunc{name: "test_instances", help: "Test gauge.", labels: []string{"service"}, collect: func() []GaugeSample {
+		return []GaugeSample{{LabelValues: []string{"b"}, Value: 2}, {LabelValues: []string{"a"}, Value: 1}}
+	}}
+
+	out := render(g)
+	assert.Equal(t, "# HELP test_instances Test gauge.\n# TYPE test_instances gauge\ntest_instances{service=\"a\"} 1\ntest_instances{service=\"b\"} 2\n", out)
+}
@@ -0,0 +1,339 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// AggregateServiceName is the reserved service name that exposes every enabled service behind one endpoint
+	AggregateServiceName = model.AggregateServiceName
+	// AggregateNameSeparator separates the service name from the upstream tool/prompt name, e.g. github__create_issue
+	AggregateNameSeparator = model.ServiceNameSeparator
+)
+
+// AggregateMember is one upstream service contributing capabilities to an aggregate server.
+type AggregateMember struct {
+	Service  *model.MCPService
+	Instance *SharedMcpInstance
+}
+
+// aggregateHandlerEntry caches an aggregate handler together with the member signature it was built from.
+type aggregateHandlerEntry struct {
+	handler   http.Handler
+	tools     map[string]AggregateTool
+	upstreams map[int64]*aggregateUpstream
+	signature string
+}
+
+// aggregateUpstream is the current instance of a member service. The handlers of an aggregate server look it
+// up on every call, so a recreated instance is used without rebuilding the server and dropping its sessions.
+type aggregateUpstream struct {
+	mu       sync.RWMutex
+	instance *SharedMcpInstance
+}
+
+func (u *aggregateUpstream) set(instance *SharedMcpInstance) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.instance = instance
+}
+
+func (u *aggregateUpstream) current() (mcpclient.MCPClient, *CircuitBreaker) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.instance.Client, u.instance.Breaker
+}
+
+var (
+	aggregateHandlers      = make(map[string]*aggregateHandlerEntry)
+	aggregateHandlersMutex = &sync.Mutex{}
+	aggregateBuilds        common.FlightGroup[*aggregateHandlerEntry]
+)
+
+// NamespacedName joins a service name and an upstream capability name for the aggregate server.
+func NamespacedName(serviceName, name string) string {
+	return serviceName + AggregateNameSeparator + name
+}
+
+// AggregateTool is the service and upstream tool behind a namespaced tool of an aggregate server.
+// Names are looked up rather than split, since a service or tool name may itself contain the separator.
+type AggregateTool struct {
+	ServiceID    int64
+	UpstreamName string
+}
+
+// aggregateSignature identifies the member services and the version of their configuration, so a cached
+// handler is rebuilt when a service joins, leaves or is edited, but not when one of its instances is recreated.
+func aggregateSignature(members []AggregateMember) string {
+	parts := make([]string, 0, len(members))
+	for _, m := range members {
+		parts = append(parts, fmt.Sprintf("%d@%d", m.Service.ID, m.Service.UpdatedAt.UnixNano()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// BuildAggregateMCPServer creates an MCPServer exposing the tools, prompts, resources and resource
+// templates of all members. Tool and prompt names are namespaced with the service name; resources keep
+// their URIs (the first service to register a URI wins). The returned map resolves each registered tool
+// name and must not be modified; tools missing from it are hidden and cannot be called.
+func BuildAggregateMCPServer(ctx context.Context, members []AggregateMember) (*mcpserver.MCPServer, map[string]AggregateTool) {
+	server, tools, _ := buildAggregateMCPServer(ctx, members)
+	return server, tools
+}
+
+// buildAggregateMCPServer is BuildAggregateMCPServer that also returns the upstream of each member, through
+// which the handlers of the server reach its current instance
+func buildAggregateMCPServer(ctx context.Context, members []AggregateMember) (*mcpserver.MCPServer, map[string]AggregateTool, map[int64]*aggregateUpstream) {
+	tools := make(map[string]AggregateTool)
+	policyResolver := func(toolName string) (int64, string, bool) {
+		tool, ok := tools[toolName]
+		return tool.ServiceID, tool.UpstreamName, ok
+	}
+
+	aggregateServer := mcpserver.NewMCPServer(
+		"one-mcp",
+		common.Version,
+		mcpserver.WithResourceCapabilities(true, true),
+		mcpserver.WithToolFilter(newToolPolicyFilter(policyResolver)),
+		mcpserver.WithToolHandlerMiddleware(newToolPolicyMiddleware(policyResolver)),
+	)
+
+	upstreams := make(map[int64]*aggregateUpstream)
+	registeredPrompts := make(map[string]string)
+	registeredURIs := make(map[string]string)
+	for _, m := range members {
+		if m.Instance == nil || m.Instance.Client == nil {
+			continue
+		}
+		upstream := &aggregateUpstream{instance: m.Instance}
+		upstreams[m.Service.ID] = upstream
+		if err := addNamespacedToolsToMCPServer(ctx, upstream, aggregateServer, m.Service, tools); err != nil {
+			common.SysError(fmt.Sprintf("[Aggregate] Failed to add tools for %s: %v", m.Service.Name, err))
+		}
+		if err := addNamespacedPromptsToMCPServer(ctx, upstream, aggregateServer, m.Service.Name, registeredPrompts); err != nil {
+			common.SysError(fmt.Sprintf("[Aggregate] Failed to add prompts for %s: %v", m.Service.Name, err))
+		}
+		if err := addNamespacedResourcesToMCPServer(ctx, upstream, aggregateServer, m.Service.Name, registeredURIs); err != nil {
+			common.SysError(fmt.Sprintf("[Aggregate] Failed to add resources for %s: %v", m.Service.Name, err))
+		}
+	}
+	return aggregateServer, tools, upstreams
+}
+
+func addNamespacedToolsToMCPServer(ctx context.Context, upstream *aggregateUpstream, mcpGoServer *mcpserver.MCPServer, svc *model.MCPService, registeredTools map[string]AggregateTool) error {
+	mcpGoClient, _ := upstream.current()
+	toolsRequest := mcp.ListToolsRequest{}
+	for {
+		tools, err := mcpGoClient.ListTools(ctx, toolsRequest)
+		if err != nil {
+			return err
+		}
+		if tools == nil {
+			break
+		}
+		for _, tool := range tools.Tools {
+			originalName := tool.Name
+			tool.Name = NamespacedName(svc.Name, originalName)
+			if owner, exists := registeredTools[tool.Name]; exists {
+				common.SysLog(fmt.Sprintf("WARN: [Aggregate] Tool %s from %s already provided by service %d, skipping", tool.Name, svc.Name, owner.ServiceID))
+				continue
+			}
+			registeredTools[tool.Name] = AggregateTool{ServiceID: svc.ID, UpstreamName: originalName}
+			mcpGoServer.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				client, breaker := upstream.current()
+				request.Params.Name = originalName
+				return guardToolHandler(breaker, client.CallTool)(ctx, request)
+			})
+		}
+		if tools.NextCursor == "" {
+			break
+		}
+		toolsRequest.PaginatedRequest.Params.Cursor = tools.NextCursor
+	}
+	return nil
+}
+
+func addNamespacedPromptsToMCPServer(ctx context.Context, upstream *aggregateUpstream, mcpGoServer *mcpserver.MCPServer, serviceName string, registeredPrompts map[string]string) error {
+	mcpGoClient, _ := upstream.current()
+	promptsRequest := mcp.ListPromptsRequest{}
+	for {
+		prompts, err := mcpGoClient.ListPrompts(ctx, promptsRequest)
+		if err != nil {
+			return err
+		}
+		if prompts == nil {
+			break
+		}
+		for _, prompt := range prompts.Prompts {
+			originalName := prompt.Name
+			prompt.Name = NamespacedName(serviceName, originalName)
+			if owner, exists := registeredPrompts[prompt.Name]; exists {
+				common.SysLog(fmt.Sprintf("WARN: [Aggregate] Prompt %s from %s already provided by %s, skipping", prompt.Name, serviceName, owner))
+				continue
+			}
+			registeredPrompts[prompt.Name] = serviceName
+			mcpGoServer.AddPrompt(prompt, func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+				client, _ := upstream.current()
+				request.Params.Name = originalName
+				return client.GetPrompt(ctx, request)
+			})
+		}
+		if prompts.NextCursor == "" {
+			break
+		}
+		promptsRequest.PaginatedRequest.Params.Cursor = prompts.NextCursor
+	}
+	return nil
+}
+
+func addNamespacedResourcesToMCPServer(ctx context.Context, upstream *aggregateUpstream, mcpGoServer *mcpserver.MCPServer, serviceName string, registeredURIs map[string]string) error {
+	mcpGoClient, _ := upstream.current()
+	readHandler := func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		client, _ := upstream.current()
+		readResource, e := client.ReadResource(ctx, request)
+		if e != nil {
+			return nil, e
+		}
+		return readResource.Contents, nil
+	}
+
+	resourcesRequest := mcp.ListResourcesRequest{}
+	for {
+		resources, err := mcpGoClient.ListResources(ctx, resourcesRequest)
+		if err != nil {
+			return err
+		}
+		if resources == nil {
+			break
+		}
+		for _, resource := range resources.Resources {
+			if owner, exists := registeredURIs[resource.URI]; exists {
+				common.SysLog(fmt.Sprintf("WARN: [Aggregate] Resource URI %s from %s already provided by %s, skipping", resource.URI, serviceName, owner))
+				continue
+			}
+			registeredURIs[resource.URI] = serviceName
+			resource.Name = NamespacedName(serviceName, resource.Name)
+			mcpGoServer.AddResource(resource, readHandler)
+		}
+		if resources.NextCursor == "" {
+			break
+		}
+		resourcesRequest.PaginatedRequest.Params.Cursor = resources.NextCursor
+	}
+
+	templatesRequest := mcp.ListResourceTemplatesRequest{}
+	for {
+		templates, err := mcpGoClient.ListResourceTemplates(ctx, templatesRequest)
+		if err != nil {
+			return err
+		}
+		if templates == nil {
+			break
+		}
+		for _, resourceTemplate := range templates.ResourceTemplates {
+			uriTemplate := ""
+			if resourceTemplate.URITemplate != nil && resourceTemplate.URITemplate.Template != nil {
+				uriTemplate = resourceTemplate.URITemplate.Raw()
+			}
+			if owner, exists := registeredURIs[uriTemplate]; exists {
+				common.SysLog(fmt.Sprintf("WARN: [Aggregate] Resource template %s from %s already provided by %s, skipping", uriTemplate, serviceName, owner))
+				continue
+			}
+			registeredURIs[uriTemplate] = serviceName
+			resourceTemplate.Name = NamespacedName(serviceName, resourceTemplate.Name)
+			mcpGoServer.AddResourceTemplate(resourceTemplate, readHandler)
+		}
+		if templates.NextCursor == "" {
+			break
+		}
+		templatesRequest.PaginatedRequest.Params.Cursor = templates.NextCursor
+	}
+	return nil
+}
+
+// GetOrCreateAggregateHandler returns a cached aggregate handler for the given owner key (usually one per user).
+// proxyType should be "sseproxy" or "httpproxy". The handler is rebuilt whenever the member services or their
+// configuration change; recreated member instances are picked up without a rebuild. Concurrent requests of one
+// owner share a single build, which runs without holding the cache lock.
+// The returned map resolves the namespaced tools of the handler, see BuildAggregateMCPServer.
+func GetOrCreateAggregateHandler(ctx context.Context, ownerKey string, proxyType string, members []AggregateMember) (http.Handler, map[string]AggregateTool, error) {
+	if len(members) == 0 {
+		return nil, nil, errors.New("no services available for aggregate endpoint")
+	}
+	if proxyType != "sseproxy" && proxyType != "httpproxy" {
+		return nil, nil, fmt.Errorf("unsupported proxy type for aggregate handler: %s", proxyType)
+	}
+
+	handlerCacheKey := fmt.Sprintf("%s-aggregate-%s", ownerKey, proxyType)
+	signature := aggregateSignature(members)
+
+	aggregateHandlersMutex.Lock()
+	entry, found := aggregateHandlers[handlerCacheKey]
+	aggregateHandlersMutex.Unlock()
+	if !found || entry.signature != signature {
+		var err error
+		entry, err = aggregateBuilds.Do(handlerCacheKey+"@"+signature, func() (*aggregateHandlerEntry, error) {
+			return buildAggregateHandler(ctx, handlerCacheKey, proxyType, signature, members), nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Point the handlers at the instances serving this request, which may have been recreated
+	for _, m := range members {
+		if upstream, ok := entry.upstreams[m.Service.ID]; ok && m.Instance != nil && m.Instance.Client != nil {
+			upstream.set(m.Instance)
+		}
+	}
+	return entry.handler, entry.tools, nil
+}
+
+// buildAggregateHandler builds an aggregate handler and caches it under handlerCacheKey. The build outlives a
+// cancelled request, since other requests of the owner may be waiting for it.
+func buildAggregateHandler(ctx context.Context, handlerCacheKey, proxyType, signature string, members []AggregateMember) *aggregateHandlerEntry {
+	buildCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	aggregateServer, tools, upstreams := buildAggregateMCPServer(buildCtx, members)
+
+	var handler http.Handler
+	if proxyType == "sseproxy" {
+		handler = mcpserver.NewSSEServer(aggregateServer,
+			mcpserver.WithStaticBasePath(AggregateServiceName),
+			mcpserver.WithBaseURL(common.OptionMap["ServerAddress"]+"/proxy"),
+		)
+	} else {
+		handler = mcpserver.NewStreamableHTTPServer(aggregateServer,
+			mcpserver.WithHeartbeatInterval(30*time.Second),
+		)
+	}
+
+	entry := &aggregateHandlerEntry{handler: handler, tools: tools, upstreams: upstreams, signature: signature}
+	aggregateHandlersMutex.Lock()
+	aggregateHandlers[handlerCacheKey] = entry
+	aggregateHandlersMutex.Unlock()
+	common.SysLog(fmt.Sprintf("[Aggregate] Built %s handler for %s with %d services", proxyType, handlerCacheKey, len(members)))
+	return entry
+}
+
+// ClearAggregateHandlerCache drops all cached aggregate handlers.
+func ClearAggregateHandlerCache() {
+	aggregateHandlersMutex.Lock()
+	defer aggregateHandlersMutex.Unlock()
+	aggregateHandlers = make(map[string]*aggregateHandlerEntry)
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"one-mcp/backend/model"
+
+	"github.com/burugo/thing"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newInProcessMember returns an aggregate member whose upstream serves the given tools, each answering
+// with its own name
+func newInProcessMember(t *testing.T, ctx context.Context, id int64, name string, toolNames ...string) AggregateMember {
+	upstream := mcpserver.NewMCPServer(name, "1.0.0")
+	for _, toolName := range toolNames {
+		upstream.AddTool(mcp.NewTool(toolName), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(name + ":" + request.Params.Name), nil
+		})
+	}
+	client, err := mcpclient.NewInProcessClient(upstream)
+	require.NoError(t, err)
+	require.NoError(t, client.Start(ctx))
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = client.Initialize(ctx, initRequest)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	return AggregateMember{
+		Service:  &model.MCPService{BaseModel: thing.BaseModel{ID: id}, Name: name},
+		Instance: &SharedMcpInstance{Client: client},
+	}
+}
+
+func TestBuildAggregateMCPServerResolvesRegisteredTools(t *testing.T) {
+	ctx := context.Background()
+	// Splitting "acme___x" on the first separator would attribute it to a service "acme"
+	members := []AggregateMember{
+		newInProcessMember(t, ctx, 1, "acme", "search"),
+		newInProcessMember(t, ctx, 2, "acme_", "x"),
+	}
+
+	server, tools := BuildAggregateMCPServer(ctx, members)
+	assert.Equal(t, map[string]AggregateTool{
+		"acme__search": {ServiceID: 1, UpstreamName: "search"},
+		"acme___x":     {ServiceID: 2, UpstreamName: "x"},
+	}, tools)
+
+	client, err := mcpclient.NewInProcessClient(server)
+	require.NoError(t, err)
+	require.NoError(t, client.Start(ctx))
+	defer client.Close()
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = client.Initialize(ctx, initRequest)
+	require.NoError(t, err)
+
+	callerCtx := WithCaller(ctx, Caller{UserID: 7})
+	listed, err := client.ListTools(callerCtx, mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, listed.Tools, 2)
+
+	callRequest := mcp.CallToolRequest{}
+	callRequest.Params.Name = "acme___x"
+	result, err := client.CallTool(callerCtx, callRequest)
+	require.NoError(t, err)
+	require.Len(t, result.Content, 1)
+	assert.Equal(t, "acme_:x", result.Content[0].(mcp.TextContent).Text)
+}
+
+func TestToolPolicyRejectsUnresolvedTools(t *testing.T) {
+	resolve := func(string) (int64, string, bool) { return 0, "", false }
+	ctx := WithCaller(context.Background(), Caller{UserID: 7})
+
+	filtered := newToolPolicyFilter(resolve)(ctx, []mcp.Tool{mcp.NewTool("unknown__tool")})
+	assert.Empty(t, filtered)
+
+	called := false
+	handler := newToolPolicyMiddleware(resolve)(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = true
+		return mcp.NewToolResultText("ok"), nil
+	})
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "unknown__tool"
+	_, err := handler(ctx, request)
+	assert.Error(t, err)
+	assert.False(t, called)
+}
+
+func TestBuildAggregateMCPServerSkipsCollidingPrompts(t *testing.T) {
+	ctx := context.Background()
+	// "a" + "_b" and "a_" + "b" both namespace to a___b
+	members := []AggregateMember{
+		newInProcessMemberWithPrompt(t, ctx, 1, "a", "_b"),
+		newInProcessMemberWithPrompt(t, ctx, 2, "a_", "b"),
+	}
+
+	server, _ := BuildAggregateMCPServer(ctx, members)
+	client, err := mcpclient.NewInProcessClient(server)
+	require.NoError(t, err)
+	require.NoError(t, client.Start(ctx))
+	defer client.Close()
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = client.Initialize(ctx, initRequest)
+	require.NoError(t, err)
+
+	listed, err := client.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(t, err)
+	require.Len(t, listed.Prompts, 1, "a colliding namespaced prompt is skipped")
+	result, err := client.GetPrompt(ctx, mcp.GetPromptRequest{Params: mcp.GetPromptParams{Name: "a___b"}})
+	require.NoError(t, err)
+	assert.Equal(t, "a", result.Description, "the first service keeps the name")
+}
+
+// newInProcessMemberWithPrompt returns an aggregate member whose upstream serves one prompt described with the
+// service name
+func newInProcessMemberWithPrompt(t *testing.T, ctx context.Context, id int64, name string, promptName string) AggregateMember {
+	upstream := mcpserver.NewMCPServer(name, "1.0.0")
+	upstream.AddPrompt(mcp.NewPrompt(promptName), func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		return mcp.NewGetPromptResult(name, []mcp.PromptMessage{mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(name))}), nil
+	})
+	client, err := mcpclient.NewInProcessClient(upstream)
+	require.NoError(t, err)
+	require.NoError(t, client.Start(ctx))
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = client.Initialize(ctx, initRequest)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return AggregateMember{
+		Service:  &model.MCPService{BaseModel: thing.BaseModel{ID: id}, Name: name},
+		Instance: &SharedMcpInstance{Client: client},
+	}
+}
+
+func TestAggregateHandlerFollowsRecreatedInstances(t *testing.T) {
+	ClearAggregateHandlerCache()
+	t.Cleanup(ClearAggregateHandlerCache)
+	ctx := context.Background()
+	first := newInProcessMember(t, ctx, 1, "acme", "search")
+
+	handler, tools, err := GetOrCreateAggregateHandler(ctx, "user-7", "httpproxy", []AggregateMember{first})
+	require.NoError(t, err)
+	require.Contains(t, tools, "acme__search")
+
+	// The instance is recreated, e.g. after an idle eviction: same service, same configuration
+	recreated := newInProcessMember(t, ctx, 1, "acme", "search")
+	recreated.Service = first.Service
+	again, _, err := GetOrCreateAggregateHandler(ctx, "user-7", "httpproxy", []AggregateMember{recreated})
+	require.NoError(t, err)
+	assert.Same(t, handler, again, "a recreated instance does not rebuild the handler")
+
+	aggregateHandlersMutex.Lock()
+	entry := aggregateHandlers["user-7-aggregate-httpproxy"]
+	aggregateHandlersMutex.Unlock()
+	client, _ := entry.upstreams[1].current()
+	assert.Same(t, recreated.Instance.Client, client, "calls go to the current instance")
+
+	// Editing the service rebuilds it
+	edited := *first.Service
+	edited.UpdatedAt = edited.UpdatedAt.Add(time.Second)
+	recreated.Service = &edited
+	rebuilt, _, err := GetOrCreateAggregateHandler(ctx, "user-7", "httpproxy", []AggregateMember{recreated})
+	require.NoError(t, err)
+	assert.NotSame(t, handler, rebuilt)
+}
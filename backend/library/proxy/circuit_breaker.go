@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState string
+
+const (
+	// CircuitClosed lets every request through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fast-fails every request until the cooldown has passed
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe through; its outcome closes or re-opens the circuit
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitOpenErrorCode is the JSON-RPC error code returned while a circuit is open (implementation-defined server error)
+const CircuitOpenErrorCode = -32000
+
+// maxCircuitCooldown caps the cooldown, which doubles every time a probe fails
+const maxCircuitCooldown = 10 * time.Minute
+
+// CircuitOpenError is returned instead of contacting an upstream whose circuit is open
+type CircuitOpenError struct {
+	ServiceID   int64
+	ServiceName string
+	RetryAfter  time.Duration
+	LastError   string
+}
+
+func (e *CircuitOpenError) Error() string {
+	msg := fmt.Sprintf("service %s is temporarily unavailable: circuit breaker is open, retry in %s", e.ServiceName, e.RetryAfter.Round(time.Second))
+	if e.LastError != "" {
+		msg += " (last error: " + e.LastError + ")"
+	}
+	return msg
+}
+
+// CircuitBreakerStatus is a snapshot of a CircuitBreaker, reported in ServiceHealth
+type CircuitBreakerStatus struct {
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            time.Time    `json:"opened_at,omitempty"`
+	NextProbeAt         time.Time    `json:"next_probe_at,omitempty"`
+	LastError           string       `json:"last_error,omitempty"`
+	OpenUserInstances   int          `json:"open_user_instances,omitempty"` // User-specific instances of the service with an open circuit
+}
+
+// CircuitBreaker tracks consecutive failures of one upstream instance (a service's global instance or a
+// user-specific instance). Instance creation, tool calls and health checks report their outcome to it.
+// After CircuitBreakerThreshold consecutive failures it opens and requests fail fast; once the cooldown has
+// passed one probe is let through, and the cooldown doubles every time a probe fails.
+type CircuitBreaker struct {
+	key         string
+	serviceID   int64
+	serviceName string
+	now         func() time.Time
+
+	mu             sync.Mutex
+	state          CircuitState
+	failures       int
+	openedAt       time.Time
+	cooldown       time.Duration
+	probeStartedAt time.Time
+	lastError      string
+}
+
+func newCircuitBreaker(key string, serviceID int64, serviceName string) *CircuitBreaker {
+	return &CircuitBreaker{
+		key:         key,
+		serviceID:   serviceID,
+		serviceName: serviceName,
+		now:         time.Now,
+		state:       CircuitClosed,
+	}
+}
+
+var (
+	circuitBreakers      = make(map[string]*CircuitBreaker)
+	circuitBreakersMutex = &sync.Mutex{}
+)
+
+// GetCircuitBreaker returns the circuit breaker for an instance cache key, creating a closed one if needed
+func GetCircuitBreaker(key string, serviceID int64, serviceName string) *CircuitBreaker {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+	breaker, found := circuitBreakers[key]
+	if !found {
+		breaker = newCircuitBreaker(key, serviceID, serviceName)
+		circuitBreakers[key] = breaker
+	}
+	return breaker
+}
+
+// lookupCircuitBreaker returns the circuit breaker of an instance cache key if one was created
+func lookupCircuitBreaker(key string) (*CircuitBreaker, bool) {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+	breaker, found := circuitBreakers[key]
+	return breaker, found
+}
+
+// resetCircuitBreaker forgets the failures of an instance, e.g. when an admin restarts it by hand, so
+// the next request creates it instead of failing fast
+func resetCircuitBreaker(key string) {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+	delete(circuitBreakers, key)
+}
+
+// ResetServiceCircuitBreakers forgets the failures of every instance of a service, e.g. when its
+// configuration changed or it was deleted
+func ResetServiceCircuitBreakers(serviceID int64) {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+	for key, breaker := range circuitBreakers {
+		if breaker.serviceID == serviceID {
+			delete(circuitBreakers, key)
+		}
+	}
+}
+
+// ServiceCircuitStatus returns the status of a service's global circuit breaker, together with the number
+// of its user-specific instances whose circuit is open. It returns nil if the service has no breaker yet.
+func ServiceCircuitStatus(serviceID int64) *CircuitBreakerStatus {
+	circuitBreakersMutex.Lock()
+	breakers := make([]*CircuitBreaker, 0)
+	for _, breaker := range circuitBreakers {
+		if breaker.serviceID == serviceID {
+			breakers = append(breakers, breaker)
+		}
+	}
+	circuitBreakersMutex.Unlock()
+
+	globalKey := GlobalInstanceCacheKey(serviceID)
+	var status *CircuitBreakerStatus
+	openUserInstances := 0
+	for _, breaker := range breakers {
+		snapshot := breaker.Status()
+		if breaker.key == globalKey {
+			status = &snapshot
+		} else if snapshot.State != CircuitClosed {
+			openUserInstances++
+		}
+	}
+	if status == nil && openUserInstances == 0 {
+		return nil
+	}
+	if status == nil {
+		status = &CircuitBreakerStatus{State: CircuitClosed}
+	}
+	status.OpenUserInstances = openUserInstances
+	return status
+}
+
+// Allow reports whether a request may reach the upstream. While open it returns a *CircuitOpenError;
+// after the cooldown it switches to half-open and admits one probe at a time.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	switch b.state {
+	case CircuitOpen:
+		if now.Before(b.openedAt.Add(b.cooldown)) {
+			return b.openError(b.openedAt.Add(b.cooldown).Sub(now))
+		}
+		b.state = CircuitHalfOpen
+		b.probeStartedAt = now
+		common.SysLog(fmt.Sprintf("[CircuitBreaker] %s half-open, letting a probe through", b.key))
+		return nil
+	case CircuitHalfOpen:
+		// A probe that never reports back (e.g. cancelled by the client) is given up after the cooldown
+		if now.Before(b.probeStartedAt.Add(b.cooldown)) {
+			return b.openError(b.probeStartedAt.Add(b.cooldown).Sub(now))
+		}
+		b.probeStartedAt = now
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Check is like Allow but never admits a probe; it only reports an open circuit that is still cooling down.
+// Handlers use it to fail fast before doing any work for the request.
+func (b *CircuitBreaker) Check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != CircuitOpen {
+		return nil
+	}
+	if remaining := b.openedAt.Add(b.cooldown).Sub(b.now()); remaining > 0 {
+		return b.openError(remaining)
+	}
+	return nil
+}
+
+// RecordSuccess closes the circuit and resets the failure count
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != CircuitClosed {
+		common.SysLog(fmt.Sprintf("[CircuitBreaker] %s closed after a successful request", b.key))
+	}
+	b.state = CircuitClosed
+	b.failures = 0
+	b.cooldown = 0
+	b.lastError = ""
+}
+
+// RecordFailure counts a failed request. It opens the circuit once the threshold is reached and re-opens
+// it with a doubled cooldown when a half-open probe fails. Failures reported while open are not counted.
+func (b *CircuitBreaker) RecordFailure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.lastError = err.Error()
+	}
+	switch b.state {
+	case CircuitClosed:
+		b.failures++
+		if threshold := common.GetCircuitBreakerThreshold(); b.failures >= threshold {
+			b.open(common.GetCircuitBreakerCooldown())
+		}
+	case CircuitHalfOpen:
+		b.failures++
+		cooldown := b.cooldown * 2
+		if cooldown > maxCircuitCooldown {
+			cooldown = maxCircuitCooldown
+		}
+		b.open(cooldown)
+	}
+}
+
+// open must be called with b.mu held
+func (b *CircuitBreaker) open(cooldown time.Duration) {
+	if cooldown <= 0 {
+		cooldown = common.GetCircuitBreakerCooldown()
+	}
+	b.state = CircuitOpen
+	b.openedAt = b.now()
+	b.cooldown = cooldown
+	common.SysError(fmt.Sprintf("[CircuitBreaker] %s opened after %d consecutive failures, fast-failing for %s: %s", b.key, b.failures, cooldown, b.lastError))
+}
+
+// openError must be called with b.mu held
+func (b *CircuitBreaker) openError(retryAfter time.Duration) *CircuitOpenError {
+	return &CircuitOpenError{
+		ServiceID:   b.serviceID,
+		ServiceName: b.serviceName,
+		RetryAfter:  retryAfter,
+		LastError:   b.lastError,
+	}
+}
+
+// Status returns a snapshot of the breaker
+func (b *CircuitBreaker) Status() CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := CircuitBreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if b.state != CircuitClosed {
+		status.OpenedAt = b.openedAt
+		status.NextProbeAt = b.openedAt.Add(b.cooldown)
+	}
+	return status
+}
+
+// guardToolHandler fast-fails tool calls while the breaker is open and reports call outcomes to it.
+// Errors returned by the upstream client count as failures; results with isError are regular answers.
+func guardToolHandler(breaker *CircuitBreaker, next mcpserver.ToolHandlerFunc) mcpserver.ToolHandlerFunc {
+	if breaker == nil {
+		return next
+	}
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if err := breaker.Allow(); err != nil {
+			return nil, err
+		}
+		result, err := next(ctx, request)
+		if err == nil {
+			breaker.RecordSuccess()
+		} else if ctx.Err() == nil {
+			// A call cancelled by the client says nothing about the upstream
+			breaker.RecordFailure(err)
+		}
+		return result, err
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCircuitBreaker(t *testing.T, now *time.Time) *CircuitBreaker {
+	common.OptionMap["CircuitBreakerThreshold"] = "3"
+	common.OptionMap["CircuitBreakerCooldownSeconds"] = "10"
+	t.Cleanup(func() {
+		delete(common.OptionMap, "CircuitBreakerThreshold")
+		delete(common.OptionMap, "CircuitBreakerCooldownSeconds")
+	})
+	breaker := newCircuitBreaker("global-service-1-shared", 1, "github")
+	breaker.now = func() time.Time { return *now }
+	return breaker
+}
+
+func TestCircuitBreakerOpensAndProbes(t *testing.T) {
+	now := time.Now()
+	breaker := newTestCircuitBreaker(t, &now)
+	upstreamErr := errors.New("connection refused")
+
+	breaker.RecordFailure(upstreamErr)
+	breaker.RecordFailure(upstreamErr)
+	require.NoError(t, breaker.Allow(), "below the threshold")
+	breaker.RecordFailure(upstreamErr)
+
+	err := breaker.Allow()
+	var openErr *CircuitOpenError
+	require.True(t, errors.As(err, &openErr))
+	assert.Equal(t, 10*time.Second, openErr.RetryAfter)
+	assert.Equal(t, "connection refused", openErr.LastError)
+	assert.Error(t, breaker.Check())
+
+	// After the cooldown a single probe is let through
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, breaker.Check(), "Check never admits a probe but no longer reports the circuit as cooling down")
+	require.NoError(t, breaker.Allow())
+	assert.Equal(t, CircuitHalfOpen, breaker.Status().State)
+	assert.Error(t, breaker.Allow(), "only one probe at a time")
+
+	// A failed probe re-opens the circuit with a doubled cooldown
+	breaker.RecordFailure(upstreamErr)
+	status := breaker.Status()
+	assert.Equal(t, CircuitOpen, status.State)
+	assert.Equal(t, now.Add(20*time.Second), status.NextProbeAt)
+
+	now = now.Add(20 * time.Second)
+	require.NoError(t, breaker.Allow())
+	breaker.RecordSuccess()
+	status = breaker.Status()
+	assert.Equal(t, CircuitClosed, status.State)
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Empty(t, status.LastError)
+}
+
+func TestGuardToolHandler(t *testing.T) {
+	now := time.Now()
+	breaker := newTestCircuitBreaker(t, &now)
+
+	calls := 0
+	failing := guardToolHandler(breaker, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls++
+		return nil, errors.New("upstream unavailable")
+	})
+	for i := 0; i < 5; i++ {
+		_, _ = failing(context.Background(), mcp.CallToolRequest{})
+	}
+	assert.Equal(t, 3, calls, "calls fail fast once the circuit is open")
+
+	// Tool results with isError are answers from a working upstream
+	now = now.Add(10 * time.Second)
+	answering := guardToolHandler(breaker, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultError("bad arguments"), nil
+	})
+	result, err := answering(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Equal(t, CircuitClosed, breaker.Status().State)
+}
+
+func TestCircuitBreakerResetOnShutdownAndReload(t *testing.T) {
+	common.OptionMap["CircuitBreakerThreshold"] = "1"
+	t.Cleanup(func() { delete(common.OptionMap, "CircuitBreakerThreshold") })
+	const serviceID = 9901
+	userKey := UserInstanceCacheKey(5, serviceID)
+	upstreamErr := errors.New("connection refused")
+
+	GetCircuitBreaker(userKey, serviceID, "remote").RecordFailure(upstreamErr)
+	require.Error(t, GetCircuitBreaker(userKey, serviceID, "remote").Allow())
+
+	// An instance that is down only because its circuit is open can still be restarted
+	ownerService, ownerUser, found := InstanceOwner(userKey)
+	require.True(t, found)
+	assert.Equal(t, int64(serviceID), ownerService)
+	assert.Equal(t, int64(5), ownerUser)
+
+	assert.ErrorIs(t, ShutdownSharedInstance(context.Background(), userKey), ErrInstanceNotFound)
+	assert.NoError(t, GetCircuitBreaker(userKey, serviceID, "remote").Allow(), "a manual shutdown closes the circuit")
+
+	globalKey := GlobalInstanceCacheKey(serviceID)
+	GetCircuitBreaker(globalKey, serviceID, "remote").RecordFailure(upstreamErr)
+	GetCircuitBreaker(userKey, serviceID, "remote").RecordFailure(upstreamErr)
+	ShutdownServiceInstances(serviceID, "configuration changed")
+	assert.Nil(t, ServiceCircuitStatus(serviceID), "a reload forgets every breaker of the service")
+}
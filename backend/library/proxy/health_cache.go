@@ -92,6 +92,11 @@ func (hcm *HealthCacheManager) GetServiceHealth(serviceID int64) (*ServiceHealth
 		return nil, false
 	}
 
+	// The circuit breaker and process supervisor change between health checks, so report their live state
+	applyLiveStatus(serviceID, &health)
+	// Likewise user-specific instances come and go between health checks
+	health.InstanceCount = countSharedInstances(serviceID)
+
 	// Return a copy of health status
 	return &health, true
 }
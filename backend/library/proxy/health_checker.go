@@ -123,6 +123,7 @@ func (hc *HealthChecker) checkService(service Service) {
 	defer cancel()
 
 	health, err := service.CheckHealth(ctx)
+	reportHealthToCircuit(service, health, err)
 	if err != nil {
 		log.Printf("Error checking health for service %s (ID: %d) with timeout %v: %v", service.Name(), service.ID(), timeout, err)
 		// 错误情况下仍然更新健康状态为异常
@@ -176,6 +177,7 @@ func (hc *HealthChecker) ForceCheckService(serviceID int64) (*ServiceHealth, err
 	startTimeForCheckAttempt := time.Now() // Record start time for the CheckHealth attempt
 
 	returnedHealthFromService, returnedErrFromService := service.CheckHealth(ctx)
+	reportHealthToCircuit(service, returnedHealthFromService, returnedErrFromService)
 
 	if returnedErrFromService != nil {
 		log.Printf("Health check for service ID %d (%s) resulted in an error: %v", serviceID, service.Name(), returnedErrFromService)
@@ -206,6 +208,7 @@ func (hc *HealthChecker) ForceCheckService(serviceID int64) (*ServiceHealth, err
 		hc.lastUpdateTimes[serviceID] = healthForCache.LastChecked // Ensure consistency for background checker
 		hc.servicesMu.Unlock()
 
+		applyLiveStatus(serviceID, healthForCache)
 		// Return the unhealthy status object and a nil error to the caller
 		// This indicates the error was handled by creating a valid (unhealthy) health status
 		return healthForCache, nil // Return the (unhealthy) health status and nil error to indicate handling
@@ -235,6 +238,7 @@ func (hc *HealthChecker) ForceCheckService(serviceID int64) (*ServiceHealth, err
 	hc.lastUpdateTimes[serviceID] = returnedHealthFromService.LastChecked // Ensure consistency for background checker
 	hc.servicesMu.Unlock()
 
+	applyLiveStatus(serviceID, returnedHealthFromService)
 	return returnedHealthFromService, nil
 }
 
@@ -248,7 +252,38 @@ func (hc *HealthChecker) GetServiceHealth(serviceID int64) (*ServiceHealth, erro
 		return nil, ErrServiceNotRegistered
 	}
 
-	return service.GetHealth(), nil
+	health := service.GetHealth()
+	applyLiveStatus(serviceID, health)
+	return health, nil
+}
+
+// applyLiveStatus overlays the parts of a health report that change between health checks: the circuit
+// breaker and the process supervisor of the service's global instance
+func applyLiveStatus(serviceID int64, health *ServiceHealth) {
+	health.Circuit = ServiceCircuitStatus(serviceID)
+	health.Process = ServiceProcessStatus(serviceID)
+	if health.Process != nil && health.Process.CrashLooping {
+		health.Status = StatusCrashLooping
+	}
+}
+
+// reportHealthToCircuit feeds a health check of a proxied service into the circuit breaker of its global
+// instance, so a service that recovers closes its circuit even when no client is sending requests
+func reportHealthToCircuit(service Service, health *ServiceHealth, err error) {
+	if _, ok := service.(*MonitoredProxiedService); !ok {
+		return
+	}
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		// The check was turned away by the breaker itself and did not reach the upstream
+		return
+	}
+	breaker := GetCircuitBreaker(GlobalInstanceCacheKey(service.ID()), service.ID(), service.Name())
+	if err != nil {
+		breaker.RecordFailure(err)
+	} else if health != nil && health.Status == StatusHealthy {
+		breaker.RecordSuccess()
+	}
 }
 
 // ErrServiceNotRegistered 表示服务未注册到健康检查管理器
@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+const (
+	// instanceLogCapacity is how many stderr lines are kept in memory per instance
+	instanceLogCapacity = 1000
+	// instanceLogMaxLineBytes truncates overly long stderr lines
+	instanceLogMaxLineBytes = 4096
+	// crashLogTailLines is how many of the last stderr lines are persisted when a process crashes
+	crashLogTailLines = 200
+)
+
+// LogLine is one line a stdio MCP server wrote to stderr
+type LogLine struct {
+	Seq  int64     `json:"seq"` // Increases by one per line over the lifetime of the log, across restarts of the instance
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// InstanceLog is a bounded ring buffer of the stderr lines of an instance. It is kept per instance cache key,
+// so the lines written by a process that crashed are still there after the instance is recreated.
+type InstanceLog struct {
+	mu          sync.Mutex
+	lines       []LogLine
+	start       int // Index of the oldest line in lines
+	nextSeq     int64
+	subscribers map[chan LogLine]struct{}
+}
+
+func newInstanceLog(capacity int) *InstanceLog {
+	return &InstanceLog{
+		lines:       make([]LogLine, 0, capacity),
+		nextSeq:     1,
+		subscribers: make(map[chan LogLine]struct{}),
+	}
+}
+
+var (
+	instanceLogs      = make(map[string]*InstanceLog)
+	instanceLogsMutex = &sync.Mutex{}
+)
+
+// GetInstanceLog returns the stderr log kept for an instance cache key
+func GetInstanceLog(cacheKey string) (*InstanceLog, bool) {
+	instanceLogsMutex.Lock()
+	defer instanceLogsMutex.Unlock()
+	log, found := instanceLogs[cacheKey]
+	return log, found
+}
+
+// GetOrCreateInstanceLog returns the stderr log of an instance cache key, creating an empty one if needed
+func GetOrCreateInstanceLog(cacheKey string) *InstanceLog {
+	instanceLogsMutex.Lock()
+	defer instanceLogsMutex.Unlock()
+	log, found := instanceLogs[cacheKey]
+	if !found {
+		log = newInstanceLog(instanceLogCapacity)
+		instanceLogs[cacheKey] = log
+	}
+	return log
+}
+
+// dropInstanceLog forgets the log of an instance that was shut down because it was no longer needed
+func dropInstanceLog(cacheKey string) {
+	instanceLogsMutex.Lock()
+	defer instanceLogsMutex.Unlock()
+	delete(instanceLogs, cacheKey)
+}
+
+// Append adds a line, overwriting the oldest one once the buffer is full, and passes it to subscribers
+func (l *InstanceLog) Append(text string) {
+	if len(text) > instanceLogMaxLineBytes {
+		text = text[:instanceLogMaxLineBytes] + "…"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	line := LogLine{Seq: l.nextSeq, Time: time.Now(), Text: text}
+	l.nextSeq++
+	if len(l.lines) < cap(l.lines) {
+		l.lines = append(l.lines, line)
+	} else {
+		l.lines[l.start] = line
+		l.start = (l.start + 1) % len(l.lines)
+	}
+	for ch := range l.subscribers {
+		select {
+		case ch <- line:
+		default:
+			// A slow subscriber misses lines rather than blocking the process output
+		}
+	}
+}
+
+// snapshot must be called with l.mu held; it returns the buffered lines, oldest first
+func (l *InstanceLog) snapshot() []LogLine {
+	ordered := make([]LogLine, 0, len(l.lines))
+	ordered = append(ordered, l.lines[l.start:]...)
+	return append(ordered, l.lines[:l.start]...)
+}
+
+// Since returns up to limit buffered lines with a sequence number greater than afterSeq, oldest first.
+// Lines that were already overwritten are skipped.
+func (l *InstanceLog) Since(afterSeq int64, limit int) []LogLine {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := make([]LogLine, 0)
+	for _, line := range l.snapshot() {
+		if line.Seq <= afterSeq {
+			continue
+		}
+		if len(result) >= limit {
+			break
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// Before returns up to limit buffered lines with a sequence number lower than beforeSeq, oldest first.
+// A beforeSeq of 0 returns the last lines.
+func (l *InstanceLog) Before(beforeSeq int64, limit int) []LogLine {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lines := l.snapshot()
+	end := len(lines)
+	if beforeSeq > 0 {
+		for end > 0 && lines[end-1].Seq >= beforeSeq {
+			end--
+		}
+	}
+	begin := end - limit
+	if begin < 0 {
+		begin = 0
+	}
+	return append([]LogLine(nil), lines[begin:end]...)
+}
+
+// Subscribe returns a channel receiving every line appended from now on, and a function to unsubscribe
+func (l *InstanceLog) Subscribe() (<-chan LogLine, func()) {
+	ch := make(chan LogLine, 256)
+	l.mu.Lock()
+	l.subscribers[ch] = struct{}{}
+	l.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.subscribers, ch)
+			l.mu.Unlock()
+		})
+	}
+}
+
+// captureStderr copies the stderr of the child process into its instance log until the pipe is closed.
+// Reaching EOF without a Shutdown means the process exited on its own, which is handed to the supervisor.
+func (p *stdioProcess) captureStderr(stderr io.Reader) {
+	log := GetOrCreateInstanceLog(p.cacheKey)
+	log.Append(fmt.Sprintf("[one-mcp] process started (pid %d)", p.PID()))
+
+	reader := bufio.NewReader(stderr)
+	var readErr error
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			log.Append(line)
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	// Signal before handling the exit, which waits for an instance still being created to give up
+	close(p.stderrDone)
+
+	if p.closing.Load() || !errors.Is(readErr, io.EOF) {
+		// Closed by Shutdown (which closes the pipe) rather than by the process exiting
+		return
+	}
+	handleProcessExit(p, log)
+}
+
+// persistCrashLog stores the last stderr lines of a crashed process
+func (p *stdioProcess) persistCrashLog(log *InstanceLog, reason string) {
+	if model.InstanceCrashLogDB == nil {
+		return
+	}
+	tail := log.Before(0, crashLogTailLines)
+	texts := make([]string, 0, len(tail))
+	for _, line := range tail {
+		texts = append(texts, line.Time.Format(time.RFC3339)+" "+line.Text)
+	}
+	crashLog := &model.InstanceCrashLog{
+		ServiceID:   p.serviceID,
+		ServiceName: p.serviceName,
+		UserID:      userIDFromInstanceCacheKey(p.cacheKey),
+		CacheKey:    p.cacheKey,
+		Reason:      reason,
+		StderrTail:  strings.Join(texts, "\n"),
+	}
+	if err := model.SaveInstanceCrashLog(crashLog); err != nil {
+		common.SysError(fmt.Sprintf("[InstanceLog] Failed to persist crash log of %s: %v", p.cacheKey, err))
+		return
+	}
+	common.SysError(fmt.Sprintf("[InstanceLog] %s (service %s) %s, stderr tail saved", p.cacheKey, p.serviceName, reason))
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func logTexts(lines []LogLine) []string {
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	return texts
+}
+
+func TestInstanceLogRingBuffer(t *testing.T) {
+	log := newInstanceLog(3)
+	for i := 1; i <= 5; i++ {
+		log.Append(fmt.Sprintf("line %d", i))
+	}
+
+	assert.Equal(t, []string{"line 3", "line 4", "line 5"}, logTexts(log.Before(0, 10)), "the oldest lines are overwritten")
+	assert.Equal(t, []string{"line 4", "line 5"}, logTexts(log.Before(0, 2)))
+	assert.Equal(t, []string{"line 3"}, logTexts(log.Before(4, 10)))
+	assert.Equal(t, []string{"line 3", "line 4"}, logTexts(log.Since(1, 2)), "overwritten lines are skipped")
+	assert.Empty(t, log.Since(5, 10))
+
+	updates, unsubscribe := log.Subscribe()
+	log.Append("line 6")
+	line := <-updates
+	assert.Equal(t, int64(6), line.Seq)
+	unsubscribe()
+	log.Append("line 7")
+	assert.Empty(t, updates)
+}
+
+func TestCaptureStderrRecordsCrash(t *testing.T) {
+	proc := newStdioProcess("user-9-service-9-shared", 9, "crashy")
+	t.Cleanup(func() { dropInstanceLog(proc.cacheKey) })
+
+	proc.captureStderr(strings.NewReader("starting\r\nError: missing API_KEY\n"))
+
+	log, found := GetInstanceLog(proc.cacheKey)
+	require.True(t, found)
+	texts := logTexts(log.Before(0, 10))
+	require.Len(t, texts, 4)
+	assert.Equal(t, []string{"starting", "Error: missing API_KEY"}, texts[1:3])
+	assert.Contains(t, texts[3], "exited unexpectedly")
+
+	// Output after Shutdown is not reported as a crash; the log is kept across restarts of the instance
+	restarted := newStdioProcess(proc.cacheKey, 9, "crashy")
+	restarted.closing.Store(true)
+	restarted.captureStderr(strings.NewReader("bye\n"))
+	texts = logTexts(log.Before(0, 10))
+	assert.Equal(t, "bye", texts[len(texts)-1])
+}
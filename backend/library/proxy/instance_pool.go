@@ -0,0 +1,348 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// instanceReapInterval is how often idle user-specific instances are looked for
+const instanceReapInterval = time.Minute
+
+// ErrInstanceNotFound is returned when no live instance is cached under a key
+var ErrInstanceNotFound = errors.New("instance not found")
+
+// InstanceCounts is the number of tools, prompts and resources an instance proxies from its upstream
+type InstanceCounts struct {
+	Tools             int `json:"tool_count"`
+	Prompts           int `json:"prompt_count"`
+	Resources         int `json:"resource_count"`
+	ResourceTemplates int `json:"resource_template_count"`
+}
+
+// SharedInstanceInfo describes a live SharedMcpInstance for admins
+type SharedInstanceInfo struct {
+	CacheKey       string            `json:"cache_key"`
+	ServiceID      int64             `json:"service_id"`
+	ServiceName    string            `json:"service_name"`
+	ServiceType    model.ServiceType `json:"service_type"`
+	UserID         int64             `json:"user_id,omitempty"` // 0 for the globally shared instance
+	PID            int               `json:"pid,omitempty"`     // Child process of a stdio instance
+	CreatedAt      time.Time         `json:"created_at"`
+	LastUsedAt     time.Time         `json:"last_used_at"`
+	ActiveRequests int64             `json:"active_requests"`
+	InstanceCounts
+}
+
+// Touch records that the instance has just been used
+func (s *SharedMcpInstance) Touch() {
+	s.lastUsed.Store(time.Now().UnixNano())
+}
+
+// LastUsed returns when the instance was last used
+func (s *SharedMcpInstance) LastUsed() time.Time {
+	return time.Unix(0, s.lastUsed.Load())
+}
+
+// ActiveRequests returns the number of requests and streams the instance is currently serving
+func (s *SharedMcpInstance) ActiveRequests() int64 {
+	return s.activeRequests.Load()
+}
+
+// Info returns a snapshot of the instance for admins
+func (s *SharedMcpInstance) Info() SharedInstanceInfo {
+	return SharedInstanceInfo{
+		CacheKey:       s.CacheKey,
+		ServiceID:      s.ServiceID,
+		ServiceName:    s.ServiceName,
+		ServiceType:    s.ServiceType,
+		UserID:         s.UserID,
+		PID:            s.process.PID(),
+		CreatedAt:      s.CreatedAt,
+		LastUsedAt:     s.LastUsed(),
+		ActiveRequests: s.ActiveRequests(),
+		InstanceCounts: s.Counts,
+	}
+}
+
+// isEvictable reports whether the instance may be shut down by the idle timeout or the LRU caps.
+// Only user-specific instances are evicted; the global instance is owned by the ServiceManager.
+func (s *SharedMcpInstance) isEvictable() bool {
+	return s.UserID > 0 && s.ActiveRequests() == 0
+}
+
+// userIDFromInstanceCacheKey returns the user of a UserInstanceCacheKey, 0 for any other key
+func userIDFromInstanceCacheKey(cacheKey string) int64 {
+	var userID, serviceID int64
+	if !strings.HasPrefix(cacheKey, "user-") {
+		return 0
+	}
+	if _, err := fmt.Sscanf(cacheKey, "user-%d-service-%d-shared", &userID, &serviceID); err != nil {
+		return 0
+	}
+	return userID
+}
+
+// AcquireInstance marks the instance cached under cacheKey as in use until the returned release function
+// is called. Instances in use, such as those with an open SSE stream, are never evicted.
+func AcquireInstance(cacheKey string) (release func()) {
+	sharedMCPServersMutex.Lock()
+	inst := sharedMCPServers[cacheKey]
+	sharedMCPServersMutex.Unlock()
+	if inst == nil {
+		return func() {}
+	}
+	inst.activeRequests.Add(1)
+	inst.Touch()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			inst.activeRequests.Add(-1)
+			inst.Touch()
+		})
+	}
+}
+
+// ListSharedInstances returns all live shared instances, ordered by service and cache key
+func ListSharedInstances() []SharedInstanceInfo {
+	sharedMCPServersMutex.Lock()
+	infos := make([]SharedInstanceInfo, 0, len(sharedMCPServers))
+	for _, inst := range sharedMCPServers {
+		if inst != nil {
+			infos = append(infos, inst.Info())
+		}
+	}
+	sharedMCPServersMutex.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ServiceID != infos[j].ServiceID {
+			return infos[i].ServiceID < infos[j].ServiceID
+		}
+		return infos[i].CacheKey < infos[j].CacheKey
+	})
+	return infos
+}
+
+// GetSharedInstanceInfo returns the live instance cached under cacheKey
+func GetSharedInstanceInfo(cacheKey string) (SharedInstanceInfo, bool) {
+	sharedMCPServersMutex.Lock()
+	defer sharedMCPServersMutex.Unlock()
+	inst := sharedMCPServers[cacheKey]
+	if inst == nil {
+		return SharedInstanceInfo{}, false
+	}
+	return inst.Info(), true
+}
+
+// ShutdownSharedInstance shuts down the live instance cached under cacheKey, even if it is serving requests.
+// The next request for it creates a new instance.
+func ShutdownSharedInstance(ctx context.Context, cacheKey string) error {
+	sharedMCPServersMutex.Lock()
+	inst := evictSharedInstanceLocked(cacheKey)
+	sharedMCPServersMutex.Unlock()
+	// Shutting an instance down by hand also gives it a fresh start if it was crash looping or its circuit was open
+	resetProcessSupervisor(cacheKey)
+	resetCircuitBreaker(cacheKey)
+	if inst == nil {
+		return ErrInstanceNotFound
+	}
+
+	detachGlobalInstance(inst)
+	common.SysLog(fmt.Sprintf("[InstancePool] Shutting down instance %s (service %s) on request", cacheKey, inst.ServiceName))
+	return inst.Shutdown(ctx)
+}
+
+// detachGlobalInstance makes the health checker, which keeps a reference to the global instance of a
+// service, pick up the next one once inst has been removed from the cache
+func detachGlobalInstance(inst *SharedMcpInstance) {
+	if inst.UserID != 0 {
+		return
+	}
+	if service, err := GetServiceManager().GetService(inst.ServiceID); err == nil {
+		if monitored, ok := service.(*MonitoredProxiedService); ok {
+			monitored.detachSharedInstance(inst)
+		}
+	}
+}
+
+// InstanceOwner returns the service and user (0 for the global instance) of a live instance, or of one
+// that is down because its process crashed or its circuit breaker is open
+func InstanceOwner(cacheKey string) (serviceID int64, userID int64, found bool) {
+	if info, live := GetSharedInstanceInfo(cacheKey); live {
+		return info.ServiceID, info.UserID, true
+	}
+	if supervisor, supervised := lookupProcessSupervisor(cacheKey); supervised {
+		return supervisor.serviceID, supervisor.userID, true
+	}
+	if breaker, exists := lookupCircuitBreaker(cacheKey); exists {
+		return breaker.serviceID, userIDFromInstanceCacheKey(cacheKey), true
+	}
+	return 0, 0, false
+}
+
+// countSharedInstances returns the number of live instances of a service
+func countSharedInstances(serviceID int64) int {
+	sharedMCPServersMutex.Lock()
+	defer sharedMCPServersMutex.Unlock()
+	count := 0
+	for _, inst := range sharedMCPServers {
+		if inst != nil && inst.ServiceID == serviceID {
+			count++
+		}
+	}
+	return count
+}
+
+// evictSharedInstanceLocked removes an instance and its cached proxy handlers. The caller must hold
+// sharedMCPServersMutex and shut the returned instance down once the lock is released.
+func evictSharedInstanceLocked(cacheKey string) *SharedMcpInstance {
+	inst := sharedMCPServers[cacheKey]
+	delete(sharedMCPServers, cacheKey)
+	if inst == nil {
+		return nil
+	}
+
+	sseWrappersMutex.Lock()
+	delete(initializedSSEProxyWrappers, cacheKey+"-sseproxy")
+	sseWrappersMutex.Unlock()
+	httpWrappersMutex.Lock()
+	delete(initializedHTTPProxyWrappers, cacheKey+"-httpproxy")
+	httpWrappersMutex.Unlock()
+	return inst
+}
+
+// shutdownEvictedInstances shuts down instances removed from sharedMCPServers
+func shutdownEvictedInstances(instances []*SharedMcpInstance, reason string) {
+	for _, inst := range instances {
+		common.SysLog(fmt.Sprintf("[InstancePool] Evicting instance %s (service %s, last used %s): %s",
+			inst.CacheKey, inst.ServiceName, inst.LastUsed().Format(time.RFC3339), reason))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := inst.Shutdown(ctx); err != nil {
+			common.SysError(fmt.Sprintf("[InstancePool] Error shutting down evicted instance %s: %v", inst.CacheKey, err))
+		}
+		cancel()
+		if inst.UserID > 0 {
+			dropInstanceLog(inst.CacheKey)
+		}
+	}
+}
+
+// enforceInstanceCapsLocked evicts the least recently used idle user-specific instances until the
+// per-service and global caps are respected, never evicting the instance that was just created.
+// The caller must hold sharedMCPServersMutex and shut the returned instances down.
+func enforceInstanceCapsLocked(created *SharedMcpInstance) []*SharedMcpInstance {
+	if created.UserID == 0 {
+		return nil
+	}
+
+	var evicted []*SharedMcpInstance
+	enforce := func(limit int, inScope func(*SharedMcpInstance) bool) {
+		if limit <= 0 {
+			return
+		}
+		var candidates []*SharedMcpInstance
+		count := 0
+		for _, inst := range sharedMCPServers {
+			if inst == nil || inst.UserID == 0 || !inScope(inst) {
+				continue
+			}
+			count++
+			if inst != created && inst.isEvictable() {
+				candidates = append(candidates, inst)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].LastUsed().Before(candidates[j].LastUsed()) })
+		for _, inst := range candidates {
+			if count <= limit {
+				break
+			}
+			evicted = append(evicted, evictSharedInstanceLocked(inst.CacheKey))
+			count--
+		}
+		if count > limit {
+			common.SysLog(fmt.Sprintf("[InstancePool] %d user instances exceed the cap of %d, but the others are in use", count, limit))
+		}
+	}
+
+	enforce(common.GetMaxUserInstancesPerService(), func(inst *SharedMcpInstance) bool { return inst.ServiceID == created.ServiceID })
+	enforce(common.GetMaxUserInstances(), func(inst *SharedMcpInstance) bool { return true })
+	return evicted
+}
+
+// EvictIdleInstances shuts down user-specific instances that have not been used for the idle timeout
+// and returns how many were evicted
+func EvictIdleInstances(now time.Time) int {
+	idleTimeout := common.GetUserInstanceIdleTimeout()
+	if idleTimeout <= 0 {
+		return 0
+	}
+
+	sharedMCPServersMutex.Lock()
+	var evicted []*SharedMcpInstance
+	for key, inst := range sharedMCPServers {
+		if inst != nil && inst.isEvictable() && now.Sub(inst.LastUsed()) >= idleTimeout {
+			evicted = append(evicted, evictSharedInstanceLocked(key))
+		}
+	}
+	sharedMCPServersMutex.Unlock()
+
+	shutdownEvictedInstances(evicted, fmt.Sprintf("idle for more than %s", idleTimeout))
+	return len(evicted)
+}
+
+// ShutdownUserInstances shuts down every user-specific instance, e.g. when the server stops
+func ShutdownUserInstances() {
+	sharedMCPServersMutex.Lock()
+	var evicted []*SharedMcpInstance
+	for key, inst := range sharedMCPServers {
+		if inst != nil && inst.UserID > 0 {
+			evicted = append(evicted, evictSharedInstanceLocked(key))
+		}
+	}
+	sharedMCPServersMutex.Unlock()
+
+	shutdownEvictedInstances(evicted, "server shutting down")
+}
+
+// ShutdownServiceInstances shuts down every instance of a service, global and user-specific, e.g. after its
+// configuration changed
+func ShutdownServiceInstances(serviceID int64, reason string) int {
+	sharedMCPServersMutex.Lock()
+	var evicted []*SharedMcpInstance
+	for key, inst := range sharedMCPServers {
+		if inst != nil && inst.ServiceID == serviceID {
+			evicted = append(evicted, evictSharedInstanceLocked(key))
+		}
+	}
+	sharedMCPServersMutex.Unlock()
+
+	for _, inst := range evicted {
+		detachGlobalInstance(inst)
+	}
+	// The new instances start with a closed circuit, the failures were against the old configuration
+	ResetServiceCircuitBreakers(serviceID)
+	shutdownEvictedInstances(evicted, reason)
+	return len(evicted)
+}
+
+var instanceReaperOnce sync.Once
+
+// startInstanceReaper periodically evicts idle user-specific instances
+func startInstanceReaper() {
+	instanceReaperOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(instanceReapInterval)
+			defer ticker.Stop()
+			for now := range ticker.C {
+				EvictIdleInstances(now)
+			}
+		}()
+	})
+}
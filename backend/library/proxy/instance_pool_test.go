@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addTestInstance caches an instance without a client, last used the given time ago
+func addTestInstance(t *testing.T, cacheKey string, serviceID int64, idle time.Duration) *SharedMcpInstance {
+	inst := &SharedMcpInstance{
+		CacheKey:    cacheKey,
+		ServiceID:   serviceID,
+		ServiceName: "svc",
+		UserID:      userIDFromInstanceCacheKey(cacheKey),
+		CreatedAt:   time.Now().Add(-idle),
+	}
+	inst.lastUsed.Store(time.Now().Add(-idle).UnixNano())
+	sharedMCPServersMutex.Lock()
+	sharedMCPServers[cacheKey] = inst
+	sharedMCPServersMutex.Unlock()
+	t.Cleanup(func() {
+		sharedMCPServersMutex.Lock()
+		delete(sharedMCPServers, cacheKey)
+		sharedMCPServersMutex.Unlock()
+	})
+	return inst
+}
+
+func setInstanceOptions(t *testing.T, values map[string]string) {
+	for key, value := range values {
+		common.OptionMap[key] = value
+	}
+	t.Cleanup(func() {
+		for key := range values {
+			delete(common.OptionMap, key)
+		}
+	})
+}
+
+func cachedInstanceKeys() map[string]bool {
+	sharedMCPServersMutex.Lock()
+	defer sharedMCPServersMutex.Unlock()
+	keys := make(map[string]bool, len(sharedMCPServers))
+	for key := range sharedMCPServers {
+		keys[key] = true
+	}
+	return keys
+}
+
+func TestUserIDFromInstanceCacheKey(t *testing.T) {
+	assert.Equal(t, int64(7), userIDFromInstanceCacheKey(UserInstanceCacheKey(7, 3)))
+	assert.Equal(t, int64(0), userIDFromInstanceCacheKey(GlobalInstanceCacheKey(3)))
+	assert.Equal(t, int64(0), userIDFromInstanceCacheKey("user-x-service-3-shared"))
+}
+
+func TestEnforceInstanceCapsEvictsLeastRecentlyUsed(t *testing.T) {
+	setInstanceOptions(t, map[string]string{"MaxUserInstancesPerService": "2", "MaxUserInstances": "3"})
+
+	addTestInstance(t, GlobalInstanceCacheKey(1), 1, 3*time.Hour)
+	addTestInstance(t, UserInstanceCacheKey(1, 1), 1, 2*time.Hour)
+	busy := addTestInstance(t, UserInstanceCacheKey(2, 1), 1, 3*time.Hour)
+	addTestInstance(t, UserInstanceCacheKey(3, 1), 1, time.Hour)
+	release := AcquireInstance(busy.CacheKey)
+	defer release()
+	busy.lastUsed.Store(time.Now().Add(-3 * time.Hour).UnixNano())
+
+	created := addTestInstance(t, UserInstanceCacheKey(4, 1), 1, 0)
+	sharedMCPServersMutex.Lock()
+	evicted := enforceInstanceCapsLocked(created)
+	sharedMCPServersMutex.Unlock()
+
+	// Per-service cap of 2: users 1 and 3 go (oldest first), the busy instance of user 2 stays
+	require.Len(t, evicted, 2)
+	assert.Equal(t, UserInstanceCacheKey(1, 1), evicted[0].CacheKey)
+	assert.Equal(t, UserInstanceCacheKey(3, 1), evicted[1].CacheKey)
+	keys := cachedInstanceKeys()
+	assert.True(t, keys[GlobalInstanceCacheKey(1)], "global instances are never evicted")
+	assert.True(t, keys[busy.CacheKey], "instances in use are never evicted")
+	assert.True(t, keys[created.CacheKey])
+
+	// Global cap of 3 across services
+	created.lastUsed.Store(time.Now().Add(-2 * time.Hour).UnixNano())
+	addTestInstance(t, UserInstanceCacheKey(5, 2), 2, 30*time.Minute)
+	created = addTestInstance(t, UserInstanceCacheKey(6, 2), 2, 0)
+	sharedMCPServersMutex.Lock()
+	evicted = enforceInstanceCapsLocked(created)
+	sharedMCPServersMutex.Unlock()
+	require.Len(t, evicted, 1)
+	assert.Equal(t, UserInstanceCacheKey(4, 1), evicted[0].CacheKey)
+}
+
+func TestEvictIdleInstances(t *testing.T) {
+	setInstanceOptions(t, map[string]string{"UserInstanceIdleTimeoutMinutes": "30"})
+
+	addTestInstance(t, GlobalInstanceCacheKey(1), 1, 2*time.Hour)
+	addTestInstance(t, UserInstanceCacheKey(1, 1), 1, time.Hour)
+	addTestInstance(t, UserInstanceCacheKey(2, 1), 1, 5*time.Minute)
+	streaming := addTestInstance(t, UserInstanceCacheKey(3, 1), 1, 0)
+	release := AcquireInstance(streaming.CacheKey)
+	streaming.lastUsed.Store(time.Now().Add(-time.Hour).UnixNano())
+
+	assert.Equal(t, 1, EvictIdleInstances(time.Now()))
+	keys := cachedInstanceKeys()
+	assert.False(t, keys[UserInstanceCacheKey(1, 1)])
+	assert.True(t, keys[UserInstanceCacheKey(2, 1)])
+	assert.True(t, keys[streaming.CacheKey], "an open stream keeps the instance alive")
+	assert.True(t, keys[GlobalInstanceCacheKey(1)])
+
+	release()
+	assert.Equal(t, 0, EvictIdleInstances(time.Now()), "release counts as use")
+
+	setInstanceOptions(t, map[string]string{"UserInstanceIdleTimeoutMinutes": "0"})
+	assert.Equal(t, 0, EvictIdleInstances(time.Now().Add(24*time.Hour)), "0 disables the idle timeout")
+}
+
+func TestShutdownSharedInstance(t *testing.T) {
+	inst := addTestInstance(t, UserInstanceCacheKey(1, 1), 1, 0)
+	inst.Counts = InstanceCounts{Tools: 3, Prompts: 1}
+	inst.process = &stdioProcess{}
+	cmd, err := inst.process.commandFunc(context.Background(), "sleep", nil, []string{"10"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	defer func() { _ = cmd.Process.Kill(); _ = cmd.Wait() }()
+
+	info, found := GetSharedInstanceInfo(inst.CacheKey)
+	require.True(t, found)
+	assert.Equal(t, int64(1), info.UserID)
+	assert.Equal(t, cmd.Process.Pid, info.PID)
+	assert.Equal(t, 3, info.Tools)
+
+	require.NoError(t, ShutdownSharedInstance(context.Background(), inst.CacheKey))
+	_, found = GetSharedInstanceInfo(inst.CacheKey)
+	assert.False(t, found)
+	assert.ErrorIs(t, ShutdownSharedInstance(context.Background(), inst.CacheKey), ErrInstanceNotFound)
+}
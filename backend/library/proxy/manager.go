@@ -59,6 +59,9 @@ func (m *ServiceManager) Initialize(ctx context.Context) error {
 	// 启动自动重启守护线程
 	m.StartDaemon()
 
+	// 定期回收空闲的用户专属实例
+	startInstanceReaper()
+
 	// 加载并注册所有启用的服务
 	services, err := model.GetEnabledServices()
 	if err != nil {
@@ -95,6 +98,9 @@ func (m *ServiceManager) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// 关闭所有用户专属实例
+	ShutdownUserInstances()
+
 	// 清空服务列表
 	m.services = make(map[int64]Service)
 	m.initialized = false
@@ -155,6 +161,12 @@ func (m *ServiceManager) UnregisterService(ctx context.Context, serviceID int64)
 	// 从健康检查器中移除
 	m.healthChecker.UnregisterService(serviceID)
 
+	// 取消计划中的进程自动重启
+	resetServiceProcessSupervisors(serviceID)
+
+	// 清除熔断器状态
+	ResetServiceCircuitBreakers(serviceID)
+
 	// 从健康状态缓存中移除
 	cacheManager := GetHealthCacheManager()
 	cacheManager.DeleteServiceHealth(serviceID)
@@ -165,6 +177,19 @@ func (m *ServiceManager) UnregisterService(ctx context.Context, serviceID int64)
 	return nil
 }
 
+// ReloadService 使服务使用新的配置：关闭其所有实例并重新注册；已禁用的服务只取消注册
+func (m *ServiceManager) ReloadService(ctx context.Context, mcpService *model.MCPService) error {
+	if err := m.UnregisterService(ctx, mcpService.ID); err != nil && !errors.Is(err, ErrServiceNotFound) {
+		return err
+	}
+	ShutdownServiceInstances(mcpService.ID, "configuration changed")
+	if !mcpService.Enabled || !m.initialized {
+		// Initialize registers the enabled services itself
+		return nil
+	}
+	return m.RegisterService(ctx, mcpService)
+}
+
 // GetService 获取一个服务实例
 func (m *ServiceManager) GetService(serviceID int64) (Service, error) {
 	m.mutex.RLock()
@@ -230,6 +255,9 @@ func (m *ServiceManager) RestartService(ctx context.Context, serviceID int64) er
 		}
 	}
 
+	// 手动重启时清除崩溃记录，使反复崩溃的进程可以重新启动
+	resetServiceProcessSupervisors(serviceID)
+
 	// 启动服务
 	if err := service.Start(ctx); err != nil {
 		return fmt.Errorf("failed to start service during restart: %w", err)
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"one-mcp/backend/library/metrics"
+)
+
+var (
+	proxyRequestsTotal = metrics.NewCounterVec(
+		"one_mcp_proxy_requests_total",
+		"Proxied MCP requests by service, JSON-RPC method, tool and HTTP status.",
+		"service", "method", "tool", "status",
+	)
+	proxyRequestDuration = metrics.NewHistogramVec(
+		"one_mcp_proxy_request_duration_seconds",
+		"Latency of proxied MCP requests by service, JSON-RPC method, tool and HTTP status.",
+		metrics.DefaultLatencyBuckets,
+		"service", "method", "tool", "status",
+	)
+
+	_ = metrics.NewGaugeFunc(
+		"one_mcp_shared_instances",
+		"Running shared MCP instances (global and user-specific) by service.",
+		[]string{"service"},
+		collectSharedInstanceCounts,
+	)
+	_ = metrics.NewGaugeFunc(
+		"one_mcp_service_health_status",
+		"Cached health status of each registered service; the series for the current status is 1.",
+		[]string{"service", "status"},
+		collectServiceHealth,
+	)
+)
+
+// healthStatuses lists every status exported by one_mcp_service_health_status
+var healthStatuses = []ServiceStatus{StatusUnknown, StatusHealthy, StatusUnhealthy, StatusStarting, StatusStopped, StatusCrashLooping}
+
+// otherLabelValue replaces method and tool label values that do not come from a fixed set, since they are
+// sent by clients and would otherwise create unbounded series
+const otherLabelValue = "other"
+
+// metricsMethods lists the JSON-RPC methods exported as method label values
+var metricsMethods = map[string]bool{
+	"":                                 true, // Requests without a JSON-RPC body, e.g. the SSE stream
+	"initialize":                       true,
+	"ping":                             true,
+	"tools/list":                       true,
+	"tools/call":                       true,
+	"prompts/list":                     true,
+	"prompts/get":                      true,
+	"resources/list":                   true,
+	"resources/templates/list":         true,
+	"resources/read":                   true,
+	"resources/subscribe":              true,
+	"resources/unsubscribe":            true,
+	"completion/complete":              true,
+	"logging/setLevel":                 true,
+	"notifications/initialized":        true,
+	"notifications/cancelled":          true,
+	"notifications/progress":           true,
+	"notifications/roots/list_changed": true,
+}
+
+var (
+	// metricsTools holds the tools registered from each service's upstream, the only tool label values
+	metricsTools      = make(map[string]map[string]bool)
+	metricsToolsMutex sync.RWMutex
+)
+
+// registerMetricsTool allows a tool of a service as tool label value
+func registerMetricsTool(serviceName, tool string) {
+	metricsToolsMutex.Lock()
+	defer metricsToolsMutex.Unlock()
+	tools, ok := metricsTools[serviceName]
+	if !ok {
+		tools = make(map[string]bool)
+		metricsTools[serviceName] = tools
+	}
+	tools[tool] = true
+}
+
+// metricsLabels maps the method and tool of a request to bounded label values
+func metricsLabels(serviceName, method, tool string) (string, string) {
+	if !metricsMethods[method] {
+		method = otherLabelValue
+	}
+	if tool != "" {
+		metricsToolsMutex.RLock()
+		registered := metricsTools[serviceName][tool]
+		metricsToolsMutex.RUnlock()
+		if !registered {
+			tool = otherLabelValue
+		}
+	}
+	return method, tool
+}
+
+// ObserveProxyRequest records a proxied request in the Prometheus metrics.
+// tool is empty for methods other than tools/call. Methods outside the MCP method set and tools the service
+// has not registered are recorded as "other".
+func ObserveProxyRequest(serviceName, method, tool string, statusCode int, duration time.Duration) {
+	method, tool = metricsLabels(serviceName, method, tool)
+	status := strconv.Itoa(statusCode)
+	proxyRequestsTotal.Inc(serviceName, method, tool, status)
+	proxyRequestDuration.Observe(duration.Seconds(), serviceName, method, tool, status)
+}
+
+func collectSharedInstanceCounts() []metrics.GaugeSample {
+	sharedMCPServersMutex.Lock()
+	counts := make(map[string]int)
+	for _, inst := range sharedMCPServers {
+		if inst != nil {
+			counts[inst.ServiceName]++
+		}
+	}
+	sharedMCPServersMutex.Unlock()
+
+	samples := make([]metrics.GaugeSample, 0, len(counts))
+	for name, count := range counts {
+		samples = append(samples, metrics.GaugeSample{LabelValues: []string{name}, Value: float64(count)})
+	}
+	return samples
+}
+
+func collectServiceHealth() []metrics.GaugeSample {
+	services := GetServiceManager().GetAllServices()
+	if len(services) == 0 {
+		return nil
+	}
+	healthCache := GetHealthCacheManager()
+	var samples []metrics.GaugeSample
+	for _, svc := range services {
+		current := StatusUnknown
+		if health, ok := healthCache.GetServiceHealth(svc.ID()); ok && health != nil {
+			current = health.Status
+		}
+		for _, status := range healthStatuses {
+			value := 0.0
+			if status == current {
+				value = 1
+			}
+			samples = append(samples, metrics.GaugeSample{LabelValues: []string{svc.Name(), string(status)}, Value: value})
+		}
+	}
+	return samples
+}
@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsLabelsAreBounded(t *testing.T) {
+	registerMetricsTool("github", "create_issue")
+
+	method, tool := metricsLabels("github", "tools/call", "create_issue")
+	assert.Equal(t, "tools/call", method)
+	assert.Equal(t, "create_issue", tool)
+
+	method, tool = metricsLabels("github", "tools/call", "made_up_tool")
+	assert.Equal(t, "tools/call", method)
+	assert.Equal(t, otherLabelValue, tool)
+
+	_, tool = metricsLabels("gitlab", "tools/call", "create_issue")
+	assert.Equal(t, otherLabelValue, tool, "tools are registered per service")
+
+	method, tool = metricsLabels("github", "x-random-method-123", "")
+	assert.Equal(t, otherLabelValue, method)
+	assert.Equal(t, "", tool)
+}
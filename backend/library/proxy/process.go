@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"one-mcp/backend/model"
+)
+
+// stdioProcess keeps track of the child process of a stdio instance. Its commandFunc is handed to the
+// mcp-go stdio transport, which otherwise keeps the *exec.Cmd to itself.
+type stdioProcess struct {
+	cacheKey    string
+	serviceID   int64
+	serviceName string
+	closing     atomic.Bool          // Set by Shutdown, so the process exiting afterwards is not taken for a crash
+	stderrDone  chan struct{}        // Closed once captureStderr has read everything
+	sandbox     *model.SandboxConfig // Limits of the process, nil if the service has no sandbox
+
+	mu            sync.Mutex
+	cmd           *exec.Cmd
+	releaseLimits func() // Set by commandFunc, undoes wrapSandboxCommand
+}
+
+func newStdioProcess(cacheKey string, serviceID int64, serviceName string) *stdioProcess {
+	return &stdioProcess{cacheKey: cacheKey, serviceID: serviceID, serviceName: serviceName, stderrDone: make(chan struct{})}
+}
+
+// commandFunc builds the child process like the mcp-go stdio transport does by default, but with the
+// environment and work directory of its sandbox. A process with resource limits is started through the
+// sandbox wrapper, so the limits are in place before the command runs.
+func (p *stdioProcess) commandFunc(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+	var release func()
+	if hasResourceLimits(p.sandbox) {
+		var err error
+		if command, args, release, err = wrapSandboxCommand(p.cacheKey, p.sandbox, command, args); err != nil {
+			return nil, err
+		}
+	}
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = sandboxEnv(os.Environ(), env, p.sandbox)
+	if p.sandbox != nil && p.sandbox.WorkDir != "" {
+		cmd.Dir = p.sandbox.WorkDir
+	}
+
+	p.mu.Lock()
+	p.cmd = cmd
+	p.releaseLimits = release
+	p.mu.Unlock()
+	return cmd, nil
+}
+
+// PID returns the process ID of the child process, 0 if it has not been started
+func (p *stdioProcess) PID() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil || p.cmd.Process == nil {
+		return 0
+	}
+	return p.cmd.Process.Pid
+}
+
+// ExitCode returns the exit code of the child process once it has been reaped, -1 if it has not been
+// or was killed by a signal
+func (p *stdioProcess) ExitCode() int {
+	if p == nil {
+		return -1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil || p.cmd.ProcessState == nil {
+		return -1
+	}
+	return p.cmd.ProcessState.ExitCode()
+}
+
+// waitStderr waits up to timeout for the stderr of an exiting process to be read. Closing the client closes
+// the pipe, so without waiting the last lines of a server that failed to start would be lost.
+func (p *stdioProcess) waitStderr(timeout time.Duration) {
+	if p == nil {
+		return
+	}
+	select {
+	case <-p.stderrDone:
+	case <-time.After(timeout):
+	}
+}
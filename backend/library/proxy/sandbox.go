@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"one-mcp/backend/model"
+)
+
+// SandboxExecCommand is the first argument with which one-mcp runs itself as the wrapper that applies the
+// resource limits of a sandbox before it executes the stdio process, see SandboxExec
+const SandboxExecCommand = "__sandbox-exec"
+
+// ownSecretEnv are the environment variables holding one-mcp's own secrets. They are never passed on to a
+// stdio process, whether or not its service has a sandbox.
+var ownSecretEnv = []string{
+	"JWT_SECRET", "JWT_REFRESH_SECRET", "SESSION_SECRET", "SECRET_MASTER_KEY*", "SQL_DSN", "REDIS_CONN_STRING",
+}
+
+// defaultEnvAllowlist are the environment variables of one-mcp that a sandboxed stdio process inherits: what
+// shells, package managers and TLS clients need to run. Anything else is only passed on when listed in the
+// env_allowlist of the service's sandbox.
+var defaultEnvAllowlist = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TZ", "TMPDIR", "LANG", "LC_*",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	"SSL_CERT_FILE", "SSL_CERT_DIR", "NODE_EXTRA_CA_CERTS",
+	"NODE_*", "NPM_CONFIG_*", "npm_config_*", "UV_*", "PIP_*", "PYTHON*", "VIRTUAL_ENV",
+	"DOCKER_HOST", "DOCKER_CONFIG", "DOCKER_CONTEXT", "XDG_*",
+	// Windows
+	"SYSTEMROOT", "WINDIR", "COMSPEC", "PATHEXT", "SYSTEMDRIVE", "TEMP", "TMP", "USERNAME", "USERPROFILE",
+	"HOMEDRIVE", "HOMEPATH", "APPDATA", "LOCALAPPDATA", "PROGRAMDATA", "PROGRAMFILES*", "COMMONPROGRAMFILES*",
+	"NUMBER_OF_PROCESSORS", "PROCESSOR_ARCHITECTURE", "OS",
+}
+
+// envNamesIgnoreCase is set where environment variable names are case-insensitive, e.g. Path on Windows
+var envNamesIgnoreCase = runtime.GOOS == "windows"
+
+// sandboxEnv builds the environment of a stdio process from the environment of one-mcp (inherited) and the
+// variables configured for the service (serviceEnv, always passed). Without a sandbox everything but
+// one-mcp's own secrets is inherited; with one, only defaultEnvAllowlist and its env_allowlist are.
+// A work directory also becomes HOME and TMPDIR.
+func sandboxEnv(inherited []string, serviceEnv []string, sandbox *model.SandboxConfig) []string {
+	env := make([]string, 0, len(inherited)+len(serviceEnv)+2)
+	for _, entry := range inherited {
+		name, _, _ := strings.Cut(entry, "=")
+		if envAllowed(name, ownSecretEnv) {
+			continue
+		}
+		if sandbox != nil && !envAllowed(name, defaultEnvAllowlist) && !envAllowed(name, sandbox.EnvAllowlist) {
+			continue
+		}
+		env = append(env, entry)
+	}
+	if sandbox != nil && sandbox.WorkDir != "" {
+		env = append(env, "HOME="+sandbox.WorkDir, "TMPDIR="+sandbox.WorkDir)
+	}
+	// Later entries win, so the service's own variables override inherited ones
+	return append(env, serviceEnv...)
+}
+
+// envAllowed reports whether name matches a list entry; an entry ending in * matches a prefix
+func envAllowed(name string, allowlist []string) bool {
+	if envNamesIgnoreCase {
+		name = strings.ToUpper(name)
+	}
+	for _, allowed := range allowlist {
+		if envNamesIgnoreCase {
+			allowed = strings.ToUpper(allowed)
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareSandboxWorkDir creates the work directory of a sandbox if it does not exist yet
+func prepareSandboxWorkDir(sandbox *model.SandboxConfig) error {
+	if sandbox == nil || sandbox.WorkDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(sandbox.WorkDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create sandbox work directory %s: %w", sandbox.WorkDir, err)
+	}
+	return nil
+}
+
+// hasResourceLimits reports whether a sandbox limits any resource of the process
+func hasResourceLimits(sandbox *model.SandboxConfig) bool {
+	return sandbox != nil && (sandbox.CPUSeconds > 0 || sandbox.MemoryMB > 0 || sandbox.MaxOpenFiles > 0 || sandbox.MaxProcesses > 0)
+}
+
+// releaseSandbox frees what wrapSandboxCommand set up for the process, once it has exited
+func (p *stdioProcess) releaseSandbox() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	release := p.releaseLimits
+	p.releaseLimits = nil
+	p.mu.Unlock()
+	if release != nil {
+		release()
+	}
+}
@@ -0,0 +1,212 @@
+//go:build linux
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+var (
+	sandboxCgroupOnce   sync.Once
+	sandboxCgroupParent string // Cgroup the per-process cgroups are created in, empty without cgroups v2
+)
+
+// sandboxRlimits are the rlimits the sandbox wrapper can set, by the name used on its command line
+var sandboxRlimits = map[string]int{
+	"cpu":    syscall.RLIMIT_CPU,
+	"nofile": syscall.RLIMIT_NOFILE,
+	"data":   syscall.RLIMIT_DATA,
+}
+
+// sandboxCgroupSeq numbers the per-process cgroups, which are created before the process has a PID
+var sandboxCgroupSeq atomic.Uint64
+
+// wrapSandboxCommand returns the command line that runs command through the sandbox wrapper, one-mcp
+// itself started with SandboxExecCommand. Memory and process count are limited with a cgroup v2 of its
+// own when one-mcp can create one; otherwise memory falls back to RLIMIT_DATA and the process count is
+// not limited. CPU time and open files are always rlimits. The returned function removes the cgroup once
+// the process has exited.
+func wrapSandboxCommand(cacheKey string, sandbox *model.SandboxConfig, command string, args []string) (string, []string, func(), error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to locate the sandbox wrapper: %w", err)
+	}
+
+	var cgroupDir string
+	var release func()
+	if sandbox.MemoryMB > 0 || sandbox.MaxProcesses > 0 {
+		cgroupDir, err = createProcessCgroup(cacheKey, sandbox)
+		if err == nil {
+			dir := cgroupDir
+			release = func() {
+				if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+					common.SysError(fmt.Sprintf("[Sandbox] Failed to remove cgroup %s: %v", dir, err))
+				}
+			}
+		} else if sandbox.MaxProcesses > 0 {
+			common.SysLog(fmt.Sprintf("[Sandbox] max_processes of %s is not enforced: %v", cacheKey, err))
+		}
+	}
+
+	var limits []string
+	if sandbox.CPUSeconds > 0 {
+		limits = append(limits, fmt.Sprintf("cpu=%d", sandbox.CPUSeconds))
+	}
+	if sandbox.MaxOpenFiles > 0 {
+		limits = append(limits, fmt.Sprintf("nofile=%d", sandbox.MaxOpenFiles))
+	}
+	if sandbox.MemoryMB > 0 && cgroupDir == "" {
+		// Not RLIMIT_AS: runtimes such as V8 reserve far more address space than they use
+		limits = append(limits, fmt.Sprintf("data=%d", sandbox.MemoryMB<<20))
+	}
+
+	wrapperArgs := append([]string{SandboxExecCommand, cgroupDir, strings.Join(limits, ","), command}, args...)
+	return self, wrapperArgs, release, nil
+}
+
+// SandboxExec is the sandbox wrapper: it moves itself into the cgroup and lowers the rlimits given by
+// wrapSandboxCommand, then replaces itself with the command. args are the arguments after
+// SandboxExecCommand. It only returns by exiting, without running the command if a limit cannot be applied.
+func SandboxExec(args []string) {
+	if err := sandboxExec(args); err != nil {
+		fmt.Fprintf(os.Stderr, "one-mcp sandbox: %v\n", err)
+		os.Exit(126)
+	}
+}
+
+func sandboxExec(args []string) error {
+	if len(args) < 3 {
+		return errors.New("usage: " + SandboxExecCommand + " CGROUP RLIMITS COMMAND [ARG...]")
+	}
+	cgroupDir, limits, command := args[0], args[1], args[2]
+
+	if cgroupDir != "" {
+		if err := os.WriteFile(filepath.Join(cgroupDir, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+			return fmt.Errorf("failed to join cgroup %s: %w", cgroupDir, err)
+		}
+	}
+	if limits != "" {
+		for _, limit := range strings.Split(limits, ",") {
+			name, value, _ := strings.Cut(limit, "=")
+			resource, ok := sandboxRlimits[name]
+			if !ok {
+				return fmt.Errorf("unknown rlimit %q", name)
+			}
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid rlimit %q: %w", limit, err)
+			}
+			if err := setRlimit(resource, n); err != nil {
+				return fmt.Errorf("failed to set rlimit %s: %w", name, err)
+			}
+		}
+	}
+
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, append([]string{command}, args[3:]...), os.Environ())
+}
+
+// setRlimit lowers a resource limit of the current process, keeping it within the current hard limit.
+// It goes through the syscall package, which otherwise restores the open files limit the Go runtime
+// raised at startup when it executes the command.
+func setRlimit(resource int, limit uint64) error {
+	var current syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &current); err != nil {
+		return err
+	}
+	if limit > current.Max {
+		limit = current.Max
+	}
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: limit, Max: limit})
+}
+
+// createProcessCgroup creates a cgroup with the memory and process limits of the sandbox for a process
+// that is about to start
+func createProcessCgroup(cacheKey string, sandbox *model.SandboxConfig) (string, error) {
+	sandboxCgroupOnce.Do(func() {
+		parent, err := setupSandboxCgroupParent()
+		if err != nil {
+			common.SysLog(fmt.Sprintf("[Sandbox] cgroups v2 are not available, falling back to rlimits: %v", err))
+			return
+		}
+		sandboxCgroupParent = parent
+	})
+	if sandboxCgroupParent == "" {
+		return "", errors.New("cgroups v2 are not available")
+	}
+
+	dir := filepath.Join(sandboxCgroupParent, fmt.Sprintf("stdio-%s-%d", strings.ReplaceAll(cacheKey, "/", "_"), sandboxCgroupSeq.Add(1)))
+	if err := os.Mkdir(dir, 0o755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	settings := map[string]string{}
+	if sandbox.MemoryMB > 0 {
+		settings["memory.max"] = strconv.FormatUint(sandbox.MemoryMB<<20, 10)
+	}
+	if sandbox.MaxProcesses > 0 {
+		settings["pids.max"] = strconv.FormatUint(sandbox.MaxProcesses, 10)
+	}
+	for file, value := range settings {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0o644); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// setupSandboxCgroupParent prepares the cgroup of one-mcp for per-process child cgroups. A cgroup that
+// contains processes cannot hand controllers down, so one-mcp first moves itself into a "server" leaf.
+func setupSandboxCgroupParent() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", errors.New("no cgroup v2 hierarchy mounted at " + cgroupRoot)
+	}
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	var own string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			own = filepath.Join(cgroupRoot, path)
+		}
+	}
+	if own == "" {
+		return "", errors.New("one-mcp is not in a cgroup v2")
+	}
+
+	server := filepath.Join(own, "server")
+	if filepath.Base(own) == "server" {
+		// Already moved, e.g. by an earlier run in the same container
+		own, server = filepath.Dir(own), own
+	} else {
+		if err := os.Mkdir(server, 0o755); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(server, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+			return "", fmt.Errorf("failed to move one-mcp into %s: %w", server, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(own, "cgroup.subtree_control"), []byte("+memory +pids"), 0o644); err != nil {
+		return "", fmt.Errorf("failed to enable the memory and pids controllers in %s: %w", own, err)
+	}
+	common.SysLog(fmt.Sprintf("[Sandbox] Limiting stdio processes with cgroups v2 under %s", own))
+	return own, nil
+}
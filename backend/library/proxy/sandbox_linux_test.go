@@ -0,0 +1,38 @@
+//go:build linux
+
+package proxy
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain lets the test binary act as the sandbox wrapper, which wrapSandboxCommand runs as os.Executable
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == SandboxExecCommand {
+		SandboxExec(os.Args[2:])
+	}
+	os.Exit(m.Run())
+}
+
+func TestSandboxLimitsApplyBeforeExec(t *testing.T) {
+	proc := newStdioProcess("global-service-1-shared", 1, "limited")
+	proc.sandbox = &model.SandboxConfig{CPUSeconds: 30, MaxOpenFiles: 64}
+
+	cmd, err := proc.commandFunc(context.Background(), "sh", nil, []string{"-c", "ulimit -n; ulimit -t"})
+	require.NoError(t, err)
+	assert.Equal(t, SandboxExecCommand, cmd.Args[1])
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "64\n30\n", string(output))
+}
+
+func TestSandboxExecRejectsUnknownLimits(t *testing.T) {
+	assert.Error(t, sandboxExec([]string{"", "stack=1", "true"}))
+}
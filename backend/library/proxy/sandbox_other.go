@@ -0,0 +1,24 @@
+//go:build !linux
+
+package proxy
+
+import (
+	"fmt"
+	"os"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// wrapSandboxCommand is only implemented on Linux; elsewhere only the environment and work directory of
+// a sandbox apply and the command runs unchanged
+func wrapSandboxCommand(cacheKey string, sandbox *model.SandboxConfig, command string, args []string) (string, []string, func(), error) {
+	common.SysLog(fmt.Sprintf("[Sandbox] Resource limits of %s are not enforced: only supported on Linux", cacheKey))
+	return command, args, nil, nil
+}
+
+// SandboxExec is the sandbox wrapper, which one-mcp only runs as on Linux
+func SandboxExec(args []string) {
+	fmt.Fprintln(os.Stderr, "one-mcp sandbox: only supported on Linux")
+	os.Exit(126)
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"testing"
+
+	"one-mcp/backend/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSandboxEnv(t *testing.T) {
+	inherited := []string{"PATH=/usr/bin", "HOME=/root", "JWT_SECRET=s3cret", "NPM_CONFIG_REGISTRY=https://registry.example", "LANG=C", "AWS_SECRET_ACCESS_KEY=k", "ACME_TOKEN=t"}
+	serviceEnv := []string{"API_KEY=abc"}
+
+	// Without a sandbox everything but one-mcp's own secrets is inherited
+	assert.Equal(t, []string{"PATH=/usr/bin", "HOME=/root", "NPM_CONFIG_REGISTRY=https://registry.example", "LANG=C", "AWS_SECRET_ACCESS_KEY=k", "ACME_TOKEN=t", "API_KEY=abc"},
+		sandboxEnv(append(inherited, "SECRET_MASTER_KEY_OLD=old"), serviceEnv, nil))
+
+	// With a sandbox only the default allowlist and its own allowlist are
+	sandbox := &model.SandboxConfig{EnvAllowlist: []string{"ACME_*"}, WorkDir: "/srv/mcp/fetch"}
+	assert.Equal(t, []string{"PATH=/usr/bin", "HOME=/root", "NPM_CONFIG_REGISTRY=https://registry.example", "LANG=C", "ACME_TOKEN=t", "HOME=/srv/mcp/fetch", "TMPDIR=/srv/mcp/fetch", "API_KEY=abc"},
+		sandboxEnv(inherited, serviceEnv, sandbox))
+}
+
+func TestSandboxEnvIgnoresCaseOnWindows(t *testing.T) {
+	original := envNamesIgnoreCase
+	envNamesIgnoreCase = true
+	t.Cleanup(func() { envNamesIgnoreCase = original })
+
+	inherited := []string{`Path=C:\Windows\system32`, `SystemRoot=C:\Windows`, `ComSpec=C:\Windows\system32\cmd.exe`, "Jwt_Secret=s3cret", "ACME_TOKEN=t"}
+	assert.Equal(t, []string{`Path=C:\Windows\system32`, `SystemRoot=C:\Windows`, `ComSpec=C:\Windows\system32\cmd.exe`},
+		sandboxEnv(inherited, nil, &model.SandboxConfig{MaxOpenFiles: 64}))
+	assert.Equal(t, []string{`Path=C:\Windows\system32`, `SystemRoot=C:\Windows`, `ComSpec=C:\Windows\system32\cmd.exe`, "ACME_TOKEN=t"},
+		sandboxEnv(inherited, nil, nil))
+}
+
+func TestGetSandboxConfig(t *testing.T) {
+	svc := &model.MCPService{SandboxJSON: "{}"}
+	sandbox, err := svc.GetSandboxConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, sandbox)
+
+	svc.SandboxJSON = `{"memory_mb":256,"max_open_files":128,"work_dir":"/srv/mcp"}`
+	sandbox, err = svc.GetSandboxConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(256), sandbox.MemoryMB)
+	assert.True(t, hasResourceLimits(sandbox))
+
+	svc.SandboxJSON = `{"work_dir":"relative/dir"}`
+	_, err = svc.GetSandboxConfig()
+	assert.Error(t, err)
+	svc.SandboxJSON = `{"memory_mb":-1}`
+	_, err = svc.GetSandboxConfig()
+	assert.Error(t, err)
+}
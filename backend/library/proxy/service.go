@@ -7,26 +7,43 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"one-mcp/backend/common"
+	"one-mcp/backend/library/docker"
 	"one-mcp/backend/model"
 
 	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
 	mcpserver "github.com/mark3labs/mcp-go/server"
 )
 
 // SharedMcpInstance encapsulates a shared MCPServer and its MCPClient.
 type SharedMcpInstance struct {
-	Server *mcpserver.MCPServer
-	Client mcpclient.MCPClient
-	// consider adding createdAt time.Time for future LRU cache policies
+	Server      *mcpserver.MCPServer
+	Client      mcpclient.MCPClient
+	ServiceID   int64  // Owning service, used for metrics
+	ServiceName string // Owning service name, used for metrics
+	Breaker     *CircuitBreaker
+	CacheKey    string // Key in sharedMCPServers
+	UserID      int64  // Owning user of a user-specific instance, 0 for the globally shared one
+	ServiceType model.ServiceType
+	CreatedAt   time.Time
+	Counts      InstanceCounts // Tools, prompts and resources proxied from the upstream
+
+	process        *stdioProcess // Child process of a stdio instance, nil otherwise
+	lastUsed       atomic.Int64  // Unix nanoseconds, see Touch
+	activeRequests atomic.Int64  // Requests and streams currently served, see AcquireInstance
 }
 
 // Shutdown gracefully stops the server and closes the client.
 func (s *SharedMcpInstance) Shutdown(ctx context.Context) error {
 	common.SysLog(fmt.Sprintf("Shutting down SharedMcpInstance (Server: %p, Client: %p)", s.Server, s.Client))
+	if s.process != nil {
+		s.process.closing.Store(true)
+	}
 	var firstErr error
 	// Note: Actual shutdown logic for s.Server depends on mcp-go's MCPServer API.
 	// This might involve calling a Stop() or Shutdown() method on s.Server if available.
@@ -49,6 +66,8 @@ func (s *SharedMcpInstance) Shutdown(ctx context.Context) error {
 			common.SysLog(fmt.Sprintf("MCPClient %p closed.", s.Client))
 		}
 	}
+	// Closing the client has reaped the process, so its cgroup can go
+	s.process.releaseSandbox()
 	return firstErr
 }
 
@@ -66,20 +85,24 @@ const (
 	StatusStarting ServiceStatus = "starting"
 	// StatusStopped 表示服务已停止
 	StatusStopped ServiceStatus = "stopped"
+	// StatusCrashLooping 表示进程反复崩溃，已停止自动重启
+	StatusCrashLooping ServiceStatus = "crash_looping"
 )
 
 // ServiceHealth 包含服务健康相关的信息
 type ServiceHealth struct {
-	Status        ServiceStatus `json:"status"`
-	LastChecked   time.Time     `json:"last_checked"`
-	ResponseTime  int64         `json:"response_time_ms,omitempty"` // 毫秒
-	ErrorMessage  string        `json:"error_message,omitempty"`
-	StartTime     time.Time     `json:"start_time,omitempty"`
-	SuccessCount  int64         `json:"success_count"`
-	FailureCount  int64         `json:"failure_count"`
-	UpTime        int64         `json:"up_time_seconds,omitempty"` // 秒
-	WarningLevel  int           `json:"warning_level,omitempty"`   // 0-无警告，1-轻微，2-中等，3-严重
-	InstanceCount int           `json:"instance_count,omitempty"`  // 实例数量（如有多实例）
+	Status        ServiceStatus         `json:"status"`
+	LastChecked   time.Time             `json:"last_checked"`
+	ResponseTime  int64                 `json:"response_time_ms,omitempty"` // 毫秒
+	ErrorMessage  string                `json:"error_message,omitempty"`
+	StartTime     time.Time             `json:"start_time,omitempty"`
+	SuccessCount  int64                 `json:"success_count"`
+	FailureCount  int64                 `json:"failure_count"`
+	UpTime        int64                 `json:"up_time_seconds,omitempty"` // 秒
+	WarningLevel  int                   `json:"warning_level,omitempty"`   // 0-无警告，1-轻微，2-中等，3-严重
+	InstanceCount int                   `json:"instance_count,omitempty"`  // 实例数量（如有多实例）
+	Circuit       *CircuitBreakerStatus `json:"circuit,omitempty"`         // 熔断器状态
+	Process       *ProcessStatus        `json:"process,omitempty"`         // stdio进程的重启次数与退出码
 }
 
 // Service 接口定义了所有MCP服务必须实现的方法
@@ -315,6 +338,16 @@ func NewMonitoredProxiedService(base *BaseService, instance *SharedMcpInstance,
 	}
 }
 
+// detachSharedInstance drops the reference to inst once it has been removed from the cache,
+// so the next health check uses the current instance
+func (s *MonitoredProxiedService) detachSharedInstance(inst *SharedMcpInstance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sharedInstance == inst {
+		s.sharedInstance = nil
+	}
+}
+
 // CheckHealth for MonitoredProxiedService performs deep health checking using the shared MCP instance
 func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHealth, error) {
 	s.mu.Lock()
@@ -333,20 +366,21 @@ func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHeal
 		// Ensure dbServiceConfig is available for re-creation attempt if this is the first check after a restart
 		if s.sharedInstance == nil && s.dbServiceConfig != nil {
 			common.SysLog(fmt.Sprintf("CheckHealth: Instance for %s (ID: %d) is nil, attempting re-initialization.", s.serviceName, s.serviceID))
-			cacheKey := fmt.Sprintf("global-service-%d-shared", s.dbServiceConfig.ID)
+			cacheKey := GlobalInstanceCacheKey(s.dbServiceConfig.ID)
 			instanceNameDetail := fmt.Sprintf("global-shared-svc-%d-reinit", s.dbServiceConfig.ID)
 			effectiveEnvs := s.dbServiceConfig.DefaultEnvsJSON
 
 			newInstance, recreateErr := GetOrCreateSharedMcpInstanceWithKey(ctx, s.dbServiceConfig, cacheKey, instanceNameDetail, effectiveEnvs)
 			if recreateErr != nil {
 				s.health.Status = StatusUnhealthy
-				s.health.ErrorMessage = fmt.Sprintf("Initial re-creation attempt failed: %v", recreateErr)
+				recreateErr = fmt.Errorf("Initial re-creation attempt failed: %w", recreateErr)
+				s.health.ErrorMessage = recreateErr.Error()
 				common.SysError(fmt.Sprintf("Failed to recreate shared instance for %s from CheckHealth (initial nil): %v", s.serviceName, recreateErr))
 				healthCopy.Status = s.health.Status
 				healthCopy.ErrorMessage = s.health.ErrorMessage
 				healthCopy.LastChecked = s.health.LastChecked
 				healthCopy.ResponseTime = s.health.ResponseTime
-				return &healthCopy, errors.New(s.health.ErrorMessage)
+				return &healthCopy, recreateErr
 			}
 			s.sharedInstance = newInstance
 			common.SysLog(fmt.Sprintf("Successfully re-created shared MCP instance for %s from CheckHealth (initial nil). Performing immediate re-ping.", s.serviceName))
@@ -394,7 +428,7 @@ func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHeal
 				s.health.ErrorMessage = fmt.Sprintf("Ping failed (%v) and cannot re-create client (missing config).", originalPingErr)
 				// finalErrToReturn remains originalPingErr
 			} else {
-				cacheKey := fmt.Sprintf("global-service-%d-shared", s.dbServiceConfig.ID)
+				cacheKey := GlobalInstanceCacheKey(s.dbServiceConfig.ID)
 				instanceToShutdown := s.sharedInstance
 
 				sharedMCPServersMutex.Lock()
@@ -418,8 +452,8 @@ func (s *MonitoredProxiedService) CheckHealth(ctx context.Context) (*ServiceHeal
 				newInstance, recreateErr := GetOrCreateSharedMcpInstanceWithKey(ctx, s.dbServiceConfig, cacheKey, instanceNameDetail, effectiveEnvs)
 				if recreateErr != nil {
 					s.health.Status = StatusUnhealthy
-					s.health.ErrorMessage = fmt.Sprintf("Client re-creation failed after ping error '%v': %v", originalPingErr, recreateErr)
-					finalErrToReturn = errors.New(s.health.ErrorMessage)
+					finalErrToReturn = fmt.Errorf("Client re-creation failed after ping error '%v': %w", originalPingErr, recreateErr)
+					s.health.ErrorMessage = finalErrToReturn.Error()
 					common.SysError(fmt.Sprintf("Failed to recreate shared instance for %s from CheckHealth: %v", s.serviceName, recreateErr))
 				} else {
 					s.sharedInstance = newInstance
@@ -495,7 +529,7 @@ func (s *MonitoredProxiedService) Start(ctx context.Context) error {
 		common.SysLog(fmt.Sprintf("Attempting to (re)create shared MCP instance for health monitoring for %s (ID: %d)", s.serviceName, s.serviceID))
 
 		// Use unified global cache key and standardized parameters
-		cacheKey := fmt.Sprintf("global-service-%d-shared", s.dbServiceConfig.ID)
+		cacheKey := GlobalInstanceCacheKey(s.dbServiceConfig.ID)
 		instanceNameDetail := fmt.Sprintf("global-shared-svc-%d", s.dbServiceConfig.ID)
 		effectiveEnvs := s.dbServiceConfig.DefaultEnvsJSON
 
@@ -579,13 +613,46 @@ var (
 	httpWrappersMutex            = &sync.Mutex{}
 )
 
+// GlobalInstanceCacheKey is the sharedMCPServers key of a service's globally shared instance
+func GlobalInstanceCacheKey(serviceID int64) string {
+	return fmt.Sprintf("global-service-%d-shared", serviceID)
+}
+
+// UserInstanceCacheKey is the sharedMCPServers key of a service instance running with a user's environment
+func UserInstanceCacheKey(userID int64, serviceID int64) string {
+	return fmt.Sprintf("user-%d-service-%d-shared", userID, serviceID)
+}
+
+// upstreamHeaders decodes the custom headers sent to an SSE or streamable HTTP upstream. Headers whose
+// {{NAME}} placeholders were not filled with a user's values are left out.
+func upstreamHeaders(svc *model.MCPService, transportName string) map[string]string {
+	if svc.HeadersJSON == "" || svc.HeadersJSON == "{}" {
+		return nil
+	}
+	headers, err := model.DecryptJSONMap(svc.HeadersJSON)
+	if err != nil {
+		common.SysError(fmt.Sprintf("Failed to decode HeadersJSON for %s service %s (ID: %d): %v. Proceeding without custom headers.", transportName, svc.Name, svc.ID, err))
+		return nil
+	}
+	headers, missing := model.ResolveHeaderTemplates(headers, nil)
+	if len(missing) > 0 {
+		common.SysLog(fmt.Sprintf("%s service %s (ID: %d): headers needing per-user values %v are not sent", transportName, svc.Name, svc.ID, missing))
+	}
+	return headers
+}
+
 // createActualMcpGoServerAndClientUncached creates and initializes an mcp-go client and server instance.
-// For Stdio clients, client.Start() is not called.
+// For Stdio clients, client.Start() is not called and the child process is tracked in proc.
+// Tool calls are guarded by breaker, and the number of proxied tools, prompts and resources is stored in counts.
 // It returns the mcp-go server, the mcp-go client, and an error.
 func createActualMcpGoServerAndClientUncached(
 	ctx context.Context,
 	serviceConfigForInstance *model.MCPService,
 	instanceNameDetail string,
+	breaker *CircuitBreaker,
+	proc *stdioProcess,
+	counts *InstanceCounts,
+	userID int64,
 ) (*mcpserver.MCPServer, mcpclient.MCPClient, error) {
 
 	var mcpGoClient mcpclient.MCPClient
@@ -613,17 +680,49 @@ func createActualMcpGoServerAndClientUncached(
 		}
 		stdioConf.Env = []string{}
 		if serviceConfigForInstance.DefaultEnvsJSON != "" && serviceConfigForInstance.DefaultEnvsJSON != "{}" {
-			var defaultEnvs map[string]string
-			if errJson := json.Unmarshal([]byte(serviceConfigForInstance.DefaultEnvsJSON), &defaultEnvs); errJson != nil {
-				common.SysError(fmt.Sprintf("Failed to unmarshal DefaultEnvsJSON for %s (ID: %d, Stdio): %v. Proceeding without them.", serviceConfigForInstance.Name, serviceConfigForInstance.ID, errJson))
+			// Values may be encrypted at rest; decrypt them only for the child process environment
+			defaultEnvs, errJson := model.DecryptJSONMap(serviceConfigForInstance.DefaultEnvsJSON)
+			if errJson != nil {
+				common.SysError(fmt.Sprintf("Failed to decode DefaultEnvsJSON for %s (ID: %d, Stdio): %v. Proceeding without them.", serviceConfigForInstance.Name, serviceConfigForInstance.ID, errJson))
 			} else {
 				for key, value := range defaultEnvs {
 					stdioConf.Env = append(stdioConf.Env, fmt.Sprintf("%s=%s", key, value))
 				}
 			}
 		}
-		common.SysLog(fmt.Sprintf("Stdio config for %s: Command=%s, Args=%v, Env=%v", serviceConfigForInstance.Name, stdioConf.Command, stdioConf.Args, stdioConf.Env))
-		mcpGoClient, err = mcpclient.NewStdioMCPClient(stdioConf.Command, stdioConf.Env, stdioConf.Args...)
+		// Unlike a malformed env, a broken sandbox must not let the process run without its limits
+		sandbox, errSandbox := serviceConfigForInstance.GetSandboxConfig()
+		if errSandbox != nil {
+			return nil, nil, fmt.Errorf("invalid sandbox config for service %s (ID: %d): %w", serviceConfigForInstance.Name, serviceConfigForInstance.ID, errSandbox)
+		}
+		if errSandbox = prepareSandboxWorkDir(sandbox); errSandbox != nil {
+			return nil, nil, errSandbox
+		}
+		proc.sandbox = sandbox
+		if serviceConfigForInstance.PackageManager == model.PackageManagerDocker {
+			// The container gets the env vars by name from the environment of docker run
+			dockerConfig, errDocker := serviceConfigForInstance.GetDockerConfig()
+			if errDocker != nil {
+				return nil, nil, fmt.Errorf("invalid docker config for service %s (ID: %d): %w", serviceConfigForInstance.Name, serviceConfigForInstance.ID, errDocker)
+			}
+			runArgs, errDocker := docker.RunArgs(serviceConfigForInstance.ID, serviceConfigForInstance.DockerImage(), dockerConfig, docker.EnvNames(stdioConf.Env), stdioConf.Args)
+			if errDocker != nil {
+				return nil, nil, fmt.Errorf("invalid docker image for service %s (ID: %d): %w", serviceConfigForInstance.Name, serviceConfigForInstance.ID, errDocker)
+			}
+			stdioConf.Command = docker.Command
+			stdioConf.Args = runArgs
+		}
+		common.SysLog(fmt.Sprintf("Stdio config for %s: Command=%s, Args=%v, Env=%d vars", serviceConfigForInstance.Name, stdioConf.Command, stdioConf.Args, len(stdioConf.Env)))
+		stdioClient, stdioErr := mcpclient.NewStdioMCPClientWithOptions(stdioConf.Command, stdioConf.Env, stdioConf.Args, transport.WithCommandFunc(proc.commandFunc))
+		if stdioErr != nil {
+			proc.releaseSandbox()
+		} else {
+			// Nothing else reads the stderr pipe; keep it in the instance log instead of losing it
+			if stderr, ok := mcpclient.GetStderr(stdioClient); ok {
+				go proc.captureStderr(stderr)
+			}
+		}
+		mcpGoClient, err = stdioClient, stdioErr
 		needManualStart = false
 
 	case model.ServiceTypeSSE:
@@ -631,14 +730,15 @@ func createActualMcpGoServerAndClientUncached(
 		if url == "" {
 			return nil, nil, fmt.Errorf("URL (from Command field) is empty for SSE service %s (ID: %d)", serviceConfigForInstance.Name, serviceConfigForInstance.ID)
 		}
-		var headers map[string]string
-		if serviceConfigForInstance.HeadersJSON != "" && serviceConfigForInstance.HeadersJSON != "{}" {
-			if errJson := json.Unmarshal([]byte(serviceConfigForInstance.HeadersJSON), &headers); errJson != nil {
-				common.SysError(fmt.Sprintf("Failed to unmarshal HeadersJSON for SSE service %s (ID: %d): %v. Proceeding without custom headers.", serviceConfigForInstance.Name, serviceConfigForInstance.ID, errJson))
-			}
+		headers := upstreamHeaders(serviceConfigForInstance, "SSE")
+		oauthConfig, oauthErr := upstreamOAuthConfig(serviceConfigForInstance, userID)
+		if oauthErr != nil {
+			return nil, nil, oauthErr
 		}
-		common.SysLog(fmt.Sprintf("SSE config for %s: URL=%s, Headers=%v", serviceConfigForInstance.Name, url, headers))
-		if len(headers) > 0 {
+		common.SysLog(fmt.Sprintf("SSE config for %s: URL=%s, Headers=%d, OAuth=%t", serviceConfigForInstance.Name, url, len(headers), oauthConfig != nil))
+		if oauthConfig != nil {
+			mcpGoClient, err = mcpclient.NewOAuthSSEClient(url, *oauthConfig, transport.WithHeaders(headers))
+		} else if len(headers) > 0 {
 			mcpGoClient, err = mcpclient.NewSSEMCPClient(url, mcpclient.WithHeaders(headers))
 		} else {
 			mcpGoClient, err = mcpclient.NewSSEMCPClient(url)
@@ -650,22 +750,16 @@ func createActualMcpGoServerAndClientUncached(
 		if url == "" {
 			return nil, nil, fmt.Errorf("URL (from Command field) is empty for StreamableHTTP service %s (ID: %d)", serviceConfigForInstance.Name, serviceConfigForInstance.ID)
 		}
-		var headers map[string]string
-		if serviceConfigForInstance.HeadersJSON != "" && serviceConfigForInstance.HeadersJSON != "{}" {
-			if errJson := json.Unmarshal([]byte(serviceConfigForInstance.HeadersJSON), &headers); errJson != nil {
-				common.SysError(fmt.Sprintf("Failed to unmarshal HeadersJSON for StreamableHTTP service %s (ID: %d): %v. Proceeding without custom headers.", serviceConfigForInstance.Name, serviceConfigForInstance.ID, errJson))
-			}
+		headers := upstreamHeaders(serviceConfigForInstance, "StreamableHTTP")
+		oauthConfig, oauthErr := upstreamOAuthConfig(serviceConfigForInstance, userID)
+		if oauthErr != nil {
+			return nil, nil, oauthErr
 		}
-		common.SysLog(fmt.Sprintf("StreamableHTTP config for %s: URL=%s, Headers (raw)=%v", serviceConfigForInstance.Name, url, headers))
-		if len(headers) > 0 {
-			// TODO: Correctly apply HTTP headers.
-			// tdd.md and mcp-go patterns suggest `transport.WithHTTPHeaders(headers)`,
-			// which would require importing "github.com/mark3labs/mcp-go/client/transport".
-			// Due to current tool limitations on adding imports, this is omitted.
-			// mcpclient.WithHeaders is likely not the correct option for HTTP stream transport headers.
-			common.SysLog(fmt.Sprintf("WARNING: Custom headers for StreamableHTTP service %s are NOT being applied due to missing transport.WithHTTPHeaders option.", serviceConfigForInstance.Name))
-			// Call without header options as the correct option builder is unavailable without new imports.
-			mcpGoClient, err = mcpclient.NewStreamableHttpClient(url)
+		common.SysLog(fmt.Sprintf("StreamableHTTP config for %s: URL=%s, Headers=%d, OAuth=%t", serviceConfigForInstance.Name, url, len(headers), oauthConfig != nil))
+		if oauthConfig != nil {
+			mcpGoClient, err = mcpclient.NewOAuthStreamableHttpClient(url, *oauthConfig, transport.WithHTTPHeaders(headers))
+		} else if len(headers) > 0 {
+			mcpGoClient, err = mcpclient.NewStreamableHttpClient(url, transport.WithHTTPHeaders(headers))
 		} else {
 			mcpGoClient, err = mcpclient.NewStreamableHttpClient(url)
 		}
@@ -698,6 +792,9 @@ func createActualMcpGoServerAndClientUncached(
 			if closeErr := mcpGoClient.Close(); closeErr != nil {
 				common.SysError(fmt.Sprintf("Failed to close mcp-go client for %s (%s) after Start() error: %v", serviceConfigForInstance.Name, instanceNameDetail, closeErr))
 			}
+			if errors.Is(startErr, transport.ErrOAuthAuthorizationRequired) {
+				return nil, nil, &OAuthAuthorizationRequiredError{ServiceID: serviceConfigForInstance.ID, ServiceName: serviceConfigForInstance.Name, UserID: userID}
+			}
 			return nil, nil, errors.New(errMsg)
 		}
 
@@ -720,10 +817,13 @@ func createActualMcpGoServerAndClientUncached(
 		}()
 	}
 
+	policyResolver := singleServiceResolver(serviceConfigForInstance.ID)
 	mcpGoServer := mcpserver.NewMCPServer(
 		serviceConfigForInstance.Name,
 		serviceConfigForInstance.InstalledVersion,
 		mcpserver.WithResourceCapabilities(true, true),
+		mcpserver.WithToolFilter(newToolPolicyFilter(policyResolver)),
+		mcpserver.WithToolHandlerMiddleware(newToolPolicyMiddleware(policyResolver)),
 	)
 
 	clientInfo := mcp.Implementation{
@@ -737,26 +837,33 @@ func createActualMcpGoServerAndClientUncached(
 
 	_, err = mcpGoClient.Initialize(ctx, initRequest)
 	if err != nil {
+		// A stdio server that failed to start has usually exited already; keep what it wrote to stderr
+		proc.waitStderr(time.Second)
 		closeErr := mcpGoClient.Close()
+		proc.releaseSandbox()
 		if closeErr != nil {
 			common.SysError(fmt.Sprintf("Failed to close mcp-go client for %s (%s) after initialization error: %v", serviceConfigForInstance.Name, instanceNameDetail, closeErr))
 		}
 		errMsg := fmt.Sprintf("Failed to initialize mcp-go client for %s (%s): %v", serviceConfigForInstance.Name, instanceNameDetail, err)
 		common.SysError(errMsg)
+		if errors.Is(err, transport.ErrOAuthAuthorizationRequired) {
+			// The token was revoked and could not be refreshed
+			return nil, nil, &OAuthAuthorizationRequiredError{ServiceID: serviceConfigForInstance.ID, ServiceName: serviceConfigForInstance.Name, UserID: userID}
+		}
 		return nil, nil, errors.New(errMsg)
 	}
 
 	// Populate server with resources from client
-	if err := addClientToolsToMCPServer(ctx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name); err != nil {
+	if err := addClientToolsToMCPServer(ctx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name, breaker, &counts.Tools); err != nil {
 		common.SysError(fmt.Sprintf("Failed to add tools for %s (%s): %v", serviceConfigForInstance.Name, instanceNameDetail, err))
 	}
-	if err := addClientPromptsToMCPServer(ctx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name); err != nil {
+	if err := addClientPromptsToMCPServer(ctx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name, &counts.Prompts); err != nil {
 		common.SysError(fmt.Sprintf("Failed to add prompts for %s (%s): %v", serviceConfigForInstance.Name, instanceNameDetail, err))
 	}
-	if err := addClientResourcesToMCPServer(ctx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name); err != nil {
+	if err := addClientResourcesToMCPServer(ctx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name, &counts.Resources); err != nil {
 		common.SysError(fmt.Sprintf("Failed to add resources for %s (%s): %v", serviceConfigForInstance.Name, instanceNameDetail, err))
 	}
-	if err := addClientResourceTemplatesToMCPServer(ctx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name); err != nil {
+	if err := addClientResourceTemplatesToMCPServer(ctx, mcpGoClient, mcpGoServer, serviceConfigForInstance.Name, &counts.ResourceTemplates); err != nil {
 		common.SysError(fmt.Sprintf("Failed to add resource templates for %s (%s): %v", serviceConfigForInstance.Name, instanceNameDetail, err))
 	}
 
@@ -821,7 +928,7 @@ func ServiceFactory(mcpDBService *model.MCPService) (Service, error) {
 
 		ctx := context.Background()
 		// Use unified global cache key and standardized parameters
-		cacheKey := fmt.Sprintf("global-service-%d-shared", mcpDBService.ID)
+		cacheKey := GlobalInstanceCacheKey(mcpDBService.ID)
 		instanceNameDetail := fmt.Sprintf("global-shared-svc-%d", mcpDBService.ID)
 		effectiveEnvs := mcpDBService.DefaultEnvsJSON
 
@@ -844,7 +951,7 @@ func ServiceFactory(mcpDBService *model.MCPService) (Service, error) {
 
 // --- Helper functions to add resources to mcp-go server (adapted from user's example) ---
 
-func addClientToolsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string) error {
+func addClientToolsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string, breaker *CircuitBreaker, added *int) error {
 	toolsRequest := mcp.ListToolsRequest{}
 	for {
 		tools, err := mcpGoClient.ListTools(ctx, toolsRequest)
@@ -859,7 +966,9 @@ func addClientToolsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPCli
 		common.SysLog(fmt.Sprintf("Listed %d tools for %s", len(tools.Tools), mcpServerName))
 		for _, tool := range tools.Tools {
 			common.SysLog(fmt.Sprintf("Adding tool %s to %s", tool.Name, mcpServerName))
-			mcpGoServer.AddTool(tool, mcpGoClient.CallTool)
+			mcpGoServer.AddTool(tool, guardToolHandler(breaker, mcpGoClient.CallTool))
+			registerMetricsTool(mcpServerName, tool.Name)
+			*added++
 		}
 		if tools.NextCursor == "" {
 			break
@@ -869,7 +978,7 @@ func addClientToolsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPCli
 	return nil
 }
 
-func addClientPromptsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string) error {
+func addClientPromptsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string, added *int) error {
 	promptsRequest := mcp.ListPromptsRequest{}
 	for {
 		prompts, err := mcpGoClient.ListPrompts(ctx, promptsRequest)
@@ -885,6 +994,7 @@ func addClientPromptsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPC
 		for _, prompt := range prompts.Prompts {
 			common.SysLog(fmt.Sprintf("Adding prompt %s to %s", prompt.Name, mcpServerName))
 			mcpGoServer.AddPrompt(prompt, mcpGoClient.GetPrompt)
+			*added++
 		}
 		if prompts.NextCursor == "" {
 			break
@@ -906,7 +1016,7 @@ func addClientPromptsToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPC
 
 // --- New Helper Functions ---
 
-func addClientResourcesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string) error {
+func addClientResourcesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string, added *int) error {
 	resourcesRequest := mcp.ListResourcesRequest{}
 	for {
 		resources, err := mcpGoClient.ListResources(ctx, resourcesRequest)
@@ -930,6 +1040,7 @@ func addClientResourcesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MC
 				}
 				return readResource.Contents, nil
 			})
+			*added++
 		}
 		if resources.NextCursor == "" {
 			break
@@ -939,7 +1050,7 @@ func addClientResourcesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MC
 	return nil
 }
 
-func addClientResourceTemplatesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string) error {
+func addClientResourceTemplatesToMCPServer(ctx context.Context, mcpGoClient mcpclient.MCPClient, mcpGoServer *mcpserver.MCPServer, mcpServerName string, added *int) error {
 	resourceTemplatesRequest := mcp.ListResourceTemplatesRequest{}
 	for {
 		resourceTemplates, err := mcpGoClient.ListResourceTemplates(ctx, resourceTemplatesRequest)
@@ -967,6 +1078,7 @@ func addClientResourceTemplatesToMCPServer(ctx context.Context, mcpGoClient mcpc
 				}
 				return readResource.Contents, nil
 			})
+			*added++
 		}
 		if resourceTemplates.NextCursor == "" {
 			break
@@ -990,9 +1102,23 @@ func getOrCreateSharedMcpInstanceWithKeyInternal(ctx context.Context, originalDb
 	defer sharedMCPServersMutex.Unlock()
 
 	if inst, found := sharedMCPServers[cacheKey]; found && inst != nil {
+		inst.Touch()
 		return inst, nil
 	}
 
+	// Fail fast instead of waiting for client creation to time out against an upstream that keeps failing
+	breaker := GetCircuitBreaker(cacheKey, originalDbService.ID, originalDbService.Name)
+	if err := breaker.Allow(); err != nil {
+		return nil, err
+	}
+	// Likewise for a process that crashed and is waiting for its restart backoff or is crash looping
+	supervisor, supervised := lookupProcessSupervisor(cacheKey)
+	if supervised {
+		if err := supervisor.Check(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Prepare service config for creation
 	serviceConfigForCreation := *originalDbService // Shallow copy
 
@@ -1002,27 +1128,69 @@ func getOrCreateSharedMcpInstanceWithKeyInternal(ctx context.Context, originalDb
 	}
 
 	// Create the actual server and client
-	srv, cli, err := createActualMcpGoServerAndClientUncached(ctx, &serviceConfigForCreation, instanceNameDetail)
+	var proc *stdioProcess
+	if originalDbService.Type == model.ServiceTypeStdio {
+		proc = newStdioProcess(cacheKey, originalDbService.ID, originalDbService.Name)
+	}
+	var counts InstanceCounts
+	srv, cli, err := createActualMcpGoServerAndClientUncached(ctx, &serviceConfigForCreation, instanceNameDetail, breaker, proc, &counts, userIDFromInstanceCacheKey(cacheKey))
 	if err != nil {
+		// A user who has not authorized the upstream yet says nothing about its health
+		var authErr *OAuthAuthorizationRequiredError
+		if !errors.As(err, &authErr) {
+			breaker.RecordFailure(err)
+		}
+		if supervised {
+			supervisor.restartFailed(proc.ExitCode())
+		}
 		return nil, fmt.Errorf("failed to create MCP server and client for %s: %w", originalDbService.Name, err)
 	}
 
+	breaker.RecordSuccess()
+	if supervised {
+		supervisor.restarted()
+	}
+
 	// Create shared instance
 	instance := &SharedMcpInstance{
-		Server: srv,
-		Client: cli,
+		Server:      srv,
+		Client:      cli,
+		ServiceID:   originalDbService.ID,
+		ServiceName: originalDbService.Name,
+		Breaker:     breaker,
+		CacheKey:    cacheKey,
+		UserID:      userIDFromInstanceCacheKey(cacheKey),
+		ServiceType: originalDbService.Type,
+		CreatedAt:   time.Now(),
+		Counts:      counts,
+		process:     proc,
 	}
+	instance.Touch()
 
 	// Store in cache
 	sharedMCPServers[cacheKey] = instance
 	common.SysLog(fmt.Sprintf("Created new SharedMcpInstance for %s", originalDbService.Name))
 
+	// Make room for the new instance by evicting the least recently used idle user instances
+	if evicted := enforceInstanceCapsLocked(instance); len(evicted) > 0 {
+		go shutdownEvictedInstances(evicted, "instance cap reached")
+	}
+
 	return instance, nil
 }
 
+// instanceHandlerCacheKey keys cached proxy handlers by the instance they serve, so user-specific instances
+// get their own handler and an evicted instance's handlers can be dropped with it
+func instanceHandlerCacheKey(mcpDBService *model.MCPService, sharedInst *SharedMcpInstance, proxyType string) string {
+	if sharedInst == nil || sharedInst.CacheKey == "" {
+		return fmt.Sprintf("service-%d-%s", mcpDBService.ID, proxyType)
+	}
+	return sharedInst.CacheKey + "-" + proxyType
+}
+
 // GetOrCreateProxyToSSEHandler creates or retrieves a cached SSE http.Handler using shared MCP instance
 func GetOrCreateProxyToSSEHandler(ctx context.Context, mcpDBService *model.MCPService, sharedInst *SharedMcpInstance) (http.Handler, error) {
-	handlerCacheKey := fmt.Sprintf("service-%d-sseproxy", mcpDBService.ID)
+	handlerCacheKey := instanceHandlerCacheKey(mcpDBService, sharedInst, "sseproxy")
 
 	sseWrappersMutex.Lock()
 	defer sseWrappersMutex.Unlock()
@@ -1046,7 +1214,7 @@ func GetOrCreateProxyToSSEHandler(ctx context.Context, mcpDBService *model.MCPSe
 
 // GetOrCreateProxyToHTTPHandler creates or retrieves a cached HTTP/MCP http.Handler using shared MCP instance
 func GetOrCreateProxyToHTTPHandler(ctx context.Context, mcpDBService *model.MCPService, sharedInst *SharedMcpInstance) (http.Handler, error) {
-	handlerCacheKey := fmt.Sprintf("service-%d-httpproxy", mcpDBService.ID)
+	handlerCacheKey := instanceHandlerCacheKey(mcpDBService, sharedInst, "httpproxy")
 
 	httpWrappersMutex.Lock()
 	defer httpWrappersMutex.Unlock()
@@ -1077,4 +1245,5 @@ func ClearSSEProxyCache() {
 		common.SysLog(fmt.Sprintf("Clearing %d cached SSE proxy handlers due to configuration change.", len(initializedSSEProxyWrappers)))
 		initializedSSEProxyWrappers = make(map[string]http.Handler)
 	}
+	ClearAggregateHandlerCache()
 }
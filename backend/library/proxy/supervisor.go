@@ -0,0 +1,344 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+const (
+	// processRestartBaseBackoff is the delay before restarting a process that crashed once
+	processRestartBaseBackoff = time.Second
+	// processRestartMaxBackoff caps the delay, which doubles with every consecutive crash
+	processRestartMaxBackoff = 5 * time.Minute
+	// processStableUptime is how long a process has to run for its crash not to count as consecutive
+	processStableUptime = time.Minute
+	// processRestartTimeout bounds the creation of a restarted instance
+	processRestartTimeout = 2 * time.Minute
+)
+
+// ProcessUnavailableErrorCode is the JSON-RPC error code returned while a crashed process is down,
+// the same implementation-defined server error as an open circuit
+const ProcessUnavailableErrorCode = CircuitOpenErrorCode
+
+// ProcessUnavailableError is returned instead of starting a stdio process that is waiting for its restart
+// backoff or was given up on because it keeps crashing
+type ProcessUnavailableError struct {
+	ServiceID    int64
+	ServiceName  string
+	CrashLooping bool
+	Crashes      int
+	LastExitCode int
+	RetryAfter   time.Duration // Zero when crash looping
+}
+
+func (e *ProcessUnavailableError) Error() string {
+	if e.CrashLooping {
+		return fmt.Sprintf("service %s is crash looping: its process exited %d times in a row (last exit code %d) and is no longer restarted automatically",
+			e.ServiceName, e.Crashes, e.LastExitCode)
+	}
+	return fmt.Sprintf("service %s is restarting after its process exited with code %d, retry in %s",
+		e.ServiceName, e.LastExitCode, e.RetryAfter.Round(time.Second))
+}
+
+// ProcessStatus is a snapshot of a ProcessSupervisor, reported in ServiceHealth
+type ProcessStatus struct {
+	Restarts           int       `json:"restart_count"`
+	ConsecutiveCrashes int       `json:"consecutive_crashes"`
+	LastExitCode       int       `json:"last_exit_code"` // -1 if the process was killed by a signal
+	LastExitAt         time.Time `json:"last_exit_at"`
+	NextRestartAt      time.Time `json:"next_restart_at,omitempty"`
+	CrashLooping       bool      `json:"crash_looping"`
+}
+
+// ProcessSupervisor restarts the stdio process of one instance (a service's global instance or a
+// user-specific instance) after it exits on its own. Restarts are delayed by a backoff that doubles with
+// every consecutive crash; a process that ran for processStableUptime resets it. After more than
+// StdioMaxRestarts consecutive crashes the instance is crash looping and stays down until an admin
+// restarts it. Global instances are recreated when the backoff has passed, user-specific ones by their
+// next request.
+type ProcessSupervisor struct {
+	key         string
+	serviceID   int64
+	serviceName string
+	userID      int64
+	now         func() time.Time
+
+	mu             sync.Mutex
+	restarts       int
+	crashes        int
+	lastExitCode   int
+	lastExitAt     time.Time
+	pendingRestart bool
+	nextRestartAt  time.Time
+	crashLooping   bool
+	timer          *time.Timer
+}
+
+func newProcessSupervisor(key string, serviceID int64, serviceName string) *ProcessSupervisor {
+	return &ProcessSupervisor{
+		key:         key,
+		serviceID:   serviceID,
+		serviceName: serviceName,
+		userID:      userIDFromInstanceCacheKey(key),
+		now:         time.Now,
+	}
+}
+
+var (
+	processSupervisors      = make(map[string]*ProcessSupervisor)
+	processSupervisorsMutex = &sync.Mutex{}
+)
+
+// getProcessSupervisor returns the supervisor for an instance cache key, creating one if needed
+func getProcessSupervisor(key string, serviceID int64, serviceName string) *ProcessSupervisor {
+	processSupervisorsMutex.Lock()
+	defer processSupervisorsMutex.Unlock()
+	supervisor, found := processSupervisors[key]
+	if !found {
+		supervisor = newProcessSupervisor(key, serviceID, serviceName)
+		processSupervisors[key] = supervisor
+	}
+	return supervisor
+}
+
+// lookupProcessSupervisor returns the supervisor of an instance cache key if its process ever crashed
+func lookupProcessSupervisor(key string) (*ProcessSupervisor, bool) {
+	processSupervisorsMutex.Lock()
+	defer processSupervisorsMutex.Unlock()
+	supervisor, found := processSupervisors[key]
+	return supervisor, found
+}
+
+// resetProcessSupervisor forgets the crashes of an instance, e.g. when an admin restarts it by hand
+func resetProcessSupervisor(key string) {
+	processSupervisorsMutex.Lock()
+	supervisor := processSupervisors[key]
+	delete(processSupervisors, key)
+	processSupervisorsMutex.Unlock()
+	if supervisor != nil {
+		supervisor.stop()
+	}
+}
+
+// resetServiceProcessSupervisors forgets the crashes of every instance of a service
+func resetServiceProcessSupervisors(serviceID int64) {
+	processSupervisorsMutex.Lock()
+	var supervisors []*ProcessSupervisor
+	for key, supervisor := range processSupervisors {
+		if supervisor.serviceID == serviceID {
+			supervisors = append(supervisors, supervisor)
+			delete(processSupervisors, key)
+		}
+	}
+	processSupervisorsMutex.Unlock()
+	for _, supervisor := range supervisors {
+		supervisor.stop()
+	}
+}
+
+// ServiceProcessStatus returns the status of the supervisor of a service's global instance,
+// nil if its process never crashed
+func ServiceProcessStatus(serviceID int64) *ProcessStatus {
+	supervisor, found := lookupProcessSupervisor(GlobalInstanceCacheKey(serviceID))
+	if !found {
+		return nil
+	}
+	status := supervisor.Status()
+	return &status
+}
+
+// Check returns a *ProcessUnavailableError while the instance is crash looping or its restart backoff has
+// not passed yet
+func (s *ProcessSupervisor) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.crashLooping {
+		return s.unavailableError(0)
+	}
+	if s.pendingRestart {
+		if remaining := s.nextRestartAt.Sub(s.now()); remaining > 0 {
+			return s.unavailableError(remaining)
+		}
+	}
+	return nil
+}
+
+// recordExit counts a process that exited on its own after running for uptime. It returns the backoff
+// before the process may be restarted, and false once the instance is crash looping.
+func (s *ProcessSupervisor) recordExit(exitCode int, uptime time.Duration) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if uptime >= processStableUptime {
+		s.crashes = 0
+	}
+	s.crashes++
+	s.lastExitCode = exitCode
+	s.lastExitAt = s.now()
+
+	if maxRestarts := common.GetStdioMaxRestarts(); s.crashes > maxRestarts {
+		s.crashLooping = true
+		s.pendingRestart = false
+		s.nextRestartAt = time.Time{}
+		common.SysError(fmt.Sprintf("[ProcessSupervisor] %s (service %s) is crash looping: exited %d times in a row, last with code %d; giving up on restarting it",
+			s.key, s.serviceName, s.crashes, exitCode))
+		return 0, false
+	}
+
+	backoff := processRestartBaseBackoff << (s.crashes - 1)
+	if backoff > processRestartMaxBackoff || backoff <= 0 {
+		backoff = processRestartMaxBackoff
+	}
+	s.pendingRestart = true
+	s.nextRestartAt = s.lastExitAt.Add(backoff)
+	common.SysError(fmt.Sprintf("[ProcessSupervisor] %s (service %s) exited with code %d after %s, restarting in %s (%d/%d)",
+		s.key, s.serviceName, exitCode, uptime.Round(time.Second), backoff, s.crashes, common.GetStdioMaxRestarts()))
+	return backoff, true
+}
+
+// exited records an exit and schedules the restart of a global instance; user-specific instances are
+// recreated by their next request once the backoff has passed
+func (s *ProcessSupervisor) exited(exitCode int, uptime time.Duration) {
+	backoff, restart := s.recordExit(exitCode, uptime)
+	if !restart || s.userID > 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(backoff, func() { restartGlobalInstance(s.serviceID) })
+}
+
+// restarted records that the instance was recreated after a crash
+func (s *ProcessSupervisor) restarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pendingRestart {
+		return
+	}
+	s.restarts++
+	s.pendingRestart = false
+	s.nextRestartAt = time.Time{}
+	common.SysLog(fmt.Sprintf("[ProcessSupervisor] %s (service %s) restarted (restart #%d)", s.key, s.serviceName, s.restarts))
+}
+
+// restartFailed counts a restart whose process did not come up as another consecutive crash
+func (s *ProcessSupervisor) restartFailed(exitCode int) {
+	s.mu.Lock()
+	pending := s.pendingRestart
+	s.mu.Unlock()
+	if pending {
+		s.exited(exitCode, 0)
+	}
+}
+
+// stop cancels a scheduled restart
+func (s *ProcessSupervisor) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// unavailableError must be called with s.mu held
+func (s *ProcessSupervisor) unavailableError(retryAfter time.Duration) *ProcessUnavailableError {
+	return &ProcessUnavailableError{
+		ServiceID:    s.serviceID,
+		ServiceName:  s.serviceName,
+		CrashLooping: s.crashLooping,
+		Crashes:      s.crashes,
+		LastExitCode: s.lastExitCode,
+		RetryAfter:   retryAfter,
+	}
+}
+
+// Status returns a snapshot of the supervisor
+func (s *ProcessSupervisor) Status() ProcessStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ProcessStatus{
+		Restarts:           s.restarts,
+		ConsecutiveCrashes: s.crashes,
+		LastExitCode:       s.lastExitCode,
+		LastExitAt:         s.lastExitAt,
+		NextRestartAt:      s.nextRestartAt,
+		CrashLooping:       s.crashLooping,
+	}
+}
+
+// handleProcessExit is called once the stderr of a stdio process reached EOF without a Shutdown, i.e. the
+// process exited on its own. It takes the instance out of the cache right away instead of waiting for a
+// health check to notice, records the exit and hands the restart to the instance's supervisor.
+func handleProcessExit(p *stdioProcess, log *InstanceLog) {
+	// Waits for an instance that is still being created, whose creation then fails and is accounted for there
+	sharedMCPServersMutex.Lock()
+	inst := sharedMCPServers[p.cacheKey]
+	if inst != nil && inst.process == p {
+		evictSharedInstanceLocked(p.cacheKey)
+	} else {
+		inst = nil
+	}
+	sharedMCPServersMutex.Unlock()
+
+	if inst == nil {
+		reason := "process exited unexpectedly during startup"
+		log.Append("[one-mcp] " + reason)
+		p.persistCrashLog(log, reason)
+		return
+	}
+
+	detachGlobalInstance(inst)
+	// Closing the client reaps the process, which makes its exit code available
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := inst.Shutdown(ctx); err != nil {
+		common.SysError(fmt.Sprintf("[ProcessSupervisor] Error cleaning up exited instance %s: %v", p.cacheKey, err))
+	}
+	cancel()
+
+	exitCode := p.ExitCode()
+	reason := fmt.Sprintf("process exited unexpectedly with code %d", exitCode)
+	log.Append("[one-mcp] " + reason)
+	p.persistCrashLog(log, reason)
+
+	getProcessSupervisor(p.cacheKey, p.serviceID, p.serviceName).exited(exitCode, time.Since(inst.CreatedAt))
+	if inst.UserID == 0 {
+		// Report the service as down right away rather than at the next scheduled health check
+		if _, err := GetServiceManager().ForceCheckServiceHealth(inst.ServiceID); err != nil {
+			common.SysError(fmt.Sprintf("[ProcessSupervisor] Failed to refresh health of service %s: %v", p.serviceName, err))
+		}
+	}
+}
+
+// restartGlobalInstance recreates the global instance of a service whose process crashed, with its current
+// configuration. A process that fails to come up again counts as another crash.
+func restartGlobalInstance(serviceID int64) {
+	if _, err := GetServiceManager().GetService(serviceID); err != nil {
+		// Unregistered (disabled or deleted) in the meantime
+		return
+	}
+	dbService, err := model.GetServiceByID(serviceID)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[ProcessSupervisor] Cannot restart service %d: %v", serviceID, err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), processRestartTimeout)
+	defer cancel()
+	cacheKey := GlobalInstanceCacheKey(serviceID)
+	instanceNameDetail := fmt.Sprintf("global-shared-svc-%d-restarted", serviceID)
+	if _, err := getOrCreateSharedMcpInstanceWithKeyInternal(ctx, dbService, cacheKey, instanceNameDetail, dbService.DefaultEnvsJSON); err != nil {
+		common.SysError(fmt.Sprintf("[ProcessSupervisor] Failed to restart service %s: %v", dbService.Name, err))
+	}
+	// Lets the health checker pick up the new instance, or report why there is none
+	if _, err := GetServiceManager().ForceCheckServiceHealth(serviceID); err != nil {
+		common.SysError(fmt.Sprintf("[ProcessSupervisor] Failed to refresh health of service %s: %v", dbService.Name, err))
+	}
+}
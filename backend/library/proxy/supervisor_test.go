@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProcessSupervisor(t *testing.T, now *time.Time) *ProcessSupervisor {
+	common.OptionMap["StdioMaxRestarts"] = "3"
+	t.Cleanup(func() { delete(common.OptionMap, "StdioMaxRestarts") })
+	supervisor := newProcessSupervisor("user-7-service-3-shared", 3, "crashy")
+	supervisor.now = func() time.Time { return *now }
+	return supervisor
+}
+
+func TestProcessSupervisorBacksOffAndCrashLoops(t *testing.T) {
+	now := time.Now()
+	supervisor := newTestProcessSupervisor(t, &now)
+
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		backoff, restart := supervisor.recordExit(1, time.Second)
+		require.True(t, restart)
+		assert.Equal(t, want, backoff, "crash %d", i+1)
+
+		err := supervisor.Check()
+		var procErr *ProcessUnavailableError
+		require.True(t, errors.As(err, &procErr), "restarts wait for the backoff")
+		assert.False(t, procErr.CrashLooping)
+		assert.Equal(t, want, procErr.RetryAfter)
+
+		now = now.Add(want)
+		require.NoError(t, supervisor.Check())
+		supervisor.restarted()
+	}
+	assert.Equal(t, 3, supervisor.Status().Restarts)
+
+	// One crash more than StdioMaxRestarts gives up on the process
+	_, restart := supervisor.recordExit(137, time.Second)
+	assert.False(t, restart)
+	var procErr *ProcessUnavailableError
+	require.True(t, errors.As(supervisor.Check(), &procErr))
+	assert.True(t, procErr.CrashLooping)
+	assert.Contains(t, procErr.Error(), "crash looping")
+
+	status := supervisor.Status()
+	assert.True(t, status.CrashLooping)
+	assert.Equal(t, 4, status.ConsecutiveCrashes)
+	assert.Equal(t, 137, status.LastExitCode)
+	assert.True(t, status.NextRestartAt.IsZero())
+}
+
+func TestProcessSupervisorStableRunResetsBackoff(t *testing.T) {
+	now := time.Now()
+	supervisor := newTestProcessSupervisor(t, &now)
+
+	supervisor.recordExit(1, time.Second)
+	supervisor.recordExit(1, time.Second)
+	backoff, restart := supervisor.recordExit(1, processStableUptime)
+	require.True(t, restart)
+	assert.Equal(t, time.Second, backoff, "a process that ran for a while starts over")
+	assert.Equal(t, 1, supervisor.Status().ConsecutiveCrashes)
+
+	// A restart that does not come up counts as another crash; without a pending restart it is not counted
+	supervisor.restartFailed(1)
+	assert.Equal(t, 2, supervisor.Status().ConsecutiveCrashes)
+	supervisor.restarted()
+	supervisor.restartFailed(1)
+	assert.Equal(t, 2, supervisor.Status().ConsecutiveCrashes)
+}
+
+func TestProcessExitEvictsInstance(t *testing.T) {
+	const cacheKey = "user-8-service-4-shared"
+	proc := newStdioProcess(cacheKey, 4, "crashy")
+	inst := &SharedMcpInstance{ServiceID: 4, ServiceName: "crashy", CacheKey: cacheKey, UserID: 8, CreatedAt: time.Now(), process: proc}
+	sharedMCPServersMutex.Lock()
+	sharedMCPServers[cacheKey] = inst
+	sharedMCPServersMutex.Unlock()
+	t.Cleanup(func() {
+		resetProcessSupervisor(cacheKey)
+		dropInstanceLog(cacheKey)
+	})
+
+	proc.captureStderr(strings.NewReader("panic: out of memory\n"))
+
+	_, live := GetSharedInstanceInfo(cacheKey)
+	assert.False(t, live, "the crashed instance is evicted right away")
+	assert.True(t, proc.closing.Load(), "and shut down to reap its process")
+
+	supervisor, supervised := lookupProcessSupervisor(cacheKey)
+	require.True(t, supervised)
+	assert.Equal(t, 1, supervisor.Status().ConsecutiveCrashes)
+	var procErr *ProcessUnavailableError
+	assert.True(t, errors.As(supervisor.Check(), &procErr), "not recreated before the backoff has passed")
+
+	serviceID, userID, found := InstanceOwner(cacheKey)
+	assert.True(t, found, "a crashed instance can still be restarted by an admin")
+	assert.Equal(t, int64(4), serviceID)
+	assert.Equal(t, int64(8), userID)
+}
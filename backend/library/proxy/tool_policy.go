@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+type callerContextKey struct{}
+
+// Caller identifies the authenticated user on whose behalf an MCP request is served.
+type Caller struct {
+	UserID   int64
+	Role     int
+	ReadOnly bool // Set for read-only API keys, which may list but not call tools
+}
+
+// WithCaller stores the caller in the context so shared MCP servers can apply per-user tool policies.
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+// CallerFromContext returns the caller stored by WithCaller, if any.
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerContextKey{}).(Caller)
+	return caller, ok
+}
+
+// serviceResolver maps a tool name as exposed by an MCPServer to the owning service ID and upstream tool name.
+// Tools it cannot resolve are hidden and rejected.
+type serviceResolver func(toolName string) (serviceID int64, upstreamName string, ok bool)
+
+// singleServiceResolver is used by per-service servers where tool names are not namespaced.
+func singleServiceResolver(serviceID int64) serviceResolver {
+	return func(toolName string) (int64, string, bool) {
+		return serviceID, toolName, true
+	}
+}
+
+// isToolAllowedForCaller evaluates tool policies for the caller in ctx.
+// Requests without a caller (e.g. internal health checks) are not filtered.
+func isToolAllowedForCaller(ctx context.Context, serviceID int64, toolName string, cache map[int64][]*model.ToolPolicy) bool {
+	caller, ok := CallerFromContext(ctx)
+	if !ok || model.ToolPolicyDB == nil {
+		return true
+	}
+	policies, cached := cache[serviceID]
+	if !cached {
+		var err error
+		policies, err = model.GetToolPoliciesByService(serviceID)
+		if err != nil {
+			// Fail closed: a policy lookup error must not expose tools the admin meant to block
+			common.SysError(fmt.Sprintf("[ToolPolicy] Failed to load policies for service %d: %v", serviceID, err))
+			return false
+		}
+		if cache != nil {
+			cache[serviceID] = policies
+		}
+	}
+	return model.IsToolAllowed(policies, caller.UserID, caller.Role, toolName)
+}
+
+// newToolPolicyFilter hides tools the caller is not permitted to use from tools/list.
+func newToolPolicyFilter(resolve serviceResolver) mcpserver.ToolFilterFunc {
+	return func(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+		if _, ok := CallerFromContext(ctx); !ok {
+			return tools
+		}
+		cache := make(map[int64][]*model.ToolPolicy)
+		filtered := make([]mcp.Tool, 0, len(tools))
+		for _, tool := range tools {
+			serviceID, upstreamName, ok := resolve(tool.Name)
+			if ok && isToolAllowedForCaller(ctx, serviceID, upstreamName, cache) {
+				filtered = append(filtered, tool)
+			}
+		}
+		return filtered
+	}
+}
+
+// newToolPolicyMiddleware rejects tools/call for blocked tools before the request reaches the upstream client.
+// The returned error is surfaced to the MCP client as a JSON-RPC error.
+func newToolPolicyMiddleware(resolve serviceResolver) mcpserver.ToolHandlerMiddleware {
+	return func(next mcpserver.ToolHandlerFunc) mcpserver.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if caller, ok := CallerFromContext(ctx); ok && caller.ReadOnly {
+				return nil, fmt.Errorf("tool '%s' cannot be called with a read-only API key", request.Params.Name)
+			}
+			serviceID, upstreamName, ok := resolve(request.Params.Name)
+			if !ok || !isToolAllowedForCaller(ctx, serviceID, upstreamName, nil) {
+				caller, _ := CallerFromContext(ctx)
+				common.SysLog(fmt.Sprintf("[ToolPolicy] Blocked tools/call %s for user %d", request.Params.Name, caller.UserID))
+				return nil, fmt.Errorf("tool '%s' is not permitted by policy", request.Params.Name)
+			}
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/burugo/thing"
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+const (
+	// UpstreamOAuthStateTTL is how long a user has to complete an authorization they started
+	UpstreamOAuthStateTTL = 10 * time.Minute
+	// upstreamOAuthExpirySkew refreshes access tokens a little before they expire
+	upstreamOAuthExpirySkew = 30 * time.Second
+	// UpstreamOAuthCallbackPath is where the authorization server redirects users back to one-mcp
+	UpstreamOAuthCallbackPath = "/api/oauth/upstream/callback"
+)
+
+// ErrUpstreamOAuthNotEnabled is returned when authorization is started for a service without OAuth
+var ErrUpstreamOAuthNotEnabled = errors.New("OAuth is not enabled for this service")
+
+// ErrUpstreamOAuthStateInvalid is returned for a callback whose state is unknown, expired or already used
+var ErrUpstreamOAuthStateInvalid = errors.New("invalid or expired OAuth state")
+
+// ErrUpstreamOAuthSessionMismatch is returned when an authorization is finished by another browser or user than
+// the one who started it, e.g. a victim opening an authorization URL started by an attacker
+var ErrUpstreamOAuthSessionMismatch = errors.New("the OAuth authorization was started by another session")
+
+// OAuthAuthorizationRequiredError is returned when a user has not authorized one-mcp with the OAuth server of
+// a remote service, or the authorization was revoked and the token could not be refreshed
+type OAuthAuthorizationRequiredError struct {
+	ServiceID   int64
+	ServiceName string
+	UserID      int64
+}
+
+func (e *OAuthAuthorizationRequiredError) Error() string {
+	if e.UserID == 0 {
+		return fmt.Sprintf("service %s uses OAuth and can only be used by authorized users", e.ServiceName)
+	}
+	return fmt.Sprintf("user %d has not authorized service %s with its OAuth server", e.UserID, e.ServiceName)
+}
+
+// pendingUpstreamAuthorization is kept in the cache between redirecting a user to the authorization server
+// and the completion of the authorization, keyed by the OAuth state
+type pendingUpstreamAuthorization struct {
+	UserID       int64  `json:"user_id"`
+	ServiceID    int64  `json:"service_id"`
+	CodeVerifier string `json:"code_verifier"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"` // Encrypted like other secrets, the cache may be Redis
+	NonceHash    string `json:"nonce_hash"`              // SHA-256 of the nonce cookie of the browser that started it
+	Code         string `json:"code,omitempty"`          // Authorization code received by the callback
+}
+
+// upstreamTokenStore is the mcp-go token store of a user's client, backed by UpstreamOAuthToken so tokens
+// refreshed by the transport are persisted
+type upstreamTokenStore struct {
+	userID       int64
+	serviceID    int64
+	clientID     string
+	clientSecret string
+}
+
+func (s *upstreamTokenStore) GetToken() (*transport.Token, error) {
+	stored, err := model.GetUpstreamOAuthToken(s.userID, s.serviceID)
+	if err != nil {
+		return nil, err
+	}
+	token := &transport.Token{
+		AccessToken:  stored.AccessToken,
+		TokenType:    stored.TokenType,
+		RefreshToken: stored.RefreshToken,
+		Scope:        stored.Scope,
+	}
+	if !stored.ExpiresAt.IsZero() {
+		token.ExpiresAt = stored.ExpiresAt.Add(-upstreamOAuthExpirySkew)
+	}
+	return token, nil
+}
+
+func (s *upstreamTokenStore) SaveToken(token *transport.Token) error {
+	return model.SaveUpstreamOAuthToken(&model.UpstreamOAuthToken{
+		UserID:       s.userID,
+		ServiceID:    s.serviceID,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		TokenType:    token.TokenType,
+		Scope:        token.Scope,
+		ExpiresAt:    token.ExpiresAt,
+		ClientID:     s.clientID,
+		ClientSecret: s.clientSecret,
+	})
+}
+
+// UpstreamOAuthRedirectURI returns the redirect URI one-mcp registers with authorization servers
+func UpstreamOAuthRedirectURI() string {
+	return strings.TrimRight(common.GetServerAddress(), "/") + UpstreamOAuthCallbackPath
+}
+
+// upstreamOAuthConfig returns the mcp-go OAuth configuration of a user's client for a remote service, nil
+// if the service does not use OAuth
+func upstreamOAuthConfig(svc *model.MCPService, userID int64) (*transport.OAuthConfig, error) {
+	config, err := svc.GetOAuthConfig()
+	if err != nil || config == nil {
+		return nil, err
+	}
+	if userID == 0 {
+		return nil, &OAuthAuthorizationRequiredError{ServiceID: svc.ID, ServiceName: svc.Name}
+	}
+	token, err := model.GetUpstreamOAuthToken(userID, svc.ID)
+	if errors.Is(err, model.ErrRecordNotFound) {
+		return nil, &OAuthAuthorizationRequiredError{ServiceID: svc.ID, ServiceName: svc.Name, UserID: userID}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, clientSecret := config.ClientID, config.ClientSecret
+	if clientID == "" {
+		// Dynamically registered during authorization
+		clientID, clientSecret = token.ClientID, token.ClientSecret
+	}
+	return &transport.OAuthConfig{
+		ClientID:              clientID,
+		ClientSecret:          clientSecret,
+		RedirectURI:           UpstreamOAuthRedirectURI(),
+		Scopes:                config.Scopes,
+		TokenStore:            &upstreamTokenStore{userID: userID, serviceID: svc.ID, clientID: clientID, clientSecret: clientSecret},
+		AuthServerMetadataURL: config.AuthServerMetadataURL,
+		PKCEEnabled:           true,
+	}, nil
+}
+
+// newUpstreamOAuthHandler creates an mcp-go OAuth handler that discovers the authorization server from the
+// upstream's origin, the way the transports do
+func newUpstreamOAuthHandler(svc *model.MCPService, config transport.OAuthConfig) (*transport.OAuthHandler, error) {
+	upstreamURL, err := url.Parse(svc.Command) // URL is stored in Command field for SSE/HTTP
+	if err != nil || upstreamURL.Scheme == "" || upstreamURL.Host == "" {
+		return nil, fmt.Errorf("invalid URL of service %s: %s", svc.Name, svc.Command)
+	}
+	handler := transport.NewOAuthHandler(config)
+	handler.SetBaseURL(fmt.Sprintf("%s://%s", upstreamURL.Scheme, upstreamURL.Host))
+	return handler, nil
+}
+
+// StartUpstreamOAuth begins the authorization of a user with the OAuth server of a remote service: it
+// discovers the server, registers a client if the service has none, and returns the URL to send the user
+// to with a nonce to keep in an HttpOnly cookie of the user's browser. The PKCE verifier is kept until the
+// authorization is completed, which requires the same nonce and user.
+func StartUpstreamOAuth(ctx context.Context, svc *model.MCPService, userID int64) (string, string, error) {
+	config, err := svc.GetOAuthConfig()
+	if err != nil {
+		return "", "", err
+	}
+	if config == nil {
+		return "", "", ErrUpstreamOAuthNotEnabled
+	}
+	if thing.Cache() == nil {
+		return "", "", errors.New("cache is not available to keep the OAuth state")
+	}
+
+	handler, err := newUpstreamOAuthHandler(svc, transport.OAuthConfig{
+		ClientID:              config.ClientID,
+		ClientSecret:          config.ClientSecret,
+		RedirectURI:           UpstreamOAuthRedirectURI(),
+		Scopes:                config.Scopes,
+		AuthServerMetadataURL: config.AuthServerMetadataURL,
+		PKCEEnabled:           true,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if config.ClientID == "" {
+		if err := handler.RegisterClient(ctx, "one-mcp"); err != nil {
+			return "", "", fmt.Errorf("failed to register an OAuth client for %s: %w", svc.Name, err)
+		}
+	}
+
+	codeVerifier, err := transport.GenerateCodeVerifier()
+	if err != nil {
+		return "", "", err
+	}
+	state, err := transport.GenerateState()
+	if err != nil {
+		return "", "", err
+	}
+	authorizationURL, err := handler.GetAuthorizationURL(ctx, state, transport.GenerateCodeChallenge(codeVerifier))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build the authorization URL for %s: %w", svc.Name, err)
+	}
+
+	nonce, err := transport.GenerateState()
+	if err != nil {
+		return "", "", err
+	}
+	clientSecret, err := common.EncryptSecret(handler.GetClientSecret())
+	if err != nil {
+		return "", "", err
+	}
+	err = savePendingUpstreamAuthorization(ctx, state, &pendingUpstreamAuthorization{
+		UserID:       userID,
+		ServiceID:    svc.ID,
+		CodeVerifier: codeVerifier,
+		ClientID:     handler.GetClientID(),
+		ClientSecret: clientSecret,
+		NonceHash:    hashUpstreamOAuthNonce(nonce),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authorizationURL, nonce, nil
+}
+
+// ReceiveUpstreamOAuthCallback keeps the authorization code of a callback until the user completes the
+// authorization. The browser must present the nonce of the one that started it; otherwise the state is dropped.
+func ReceiveUpstreamOAuthCallback(ctx context.Context, state, code, nonce string) (*model.MCPService, error) {
+	pending, err := loadPendingUpstreamAuthorization(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if !pending.matchesNonce(nonce) || code == "" {
+		deletePendingUpstreamAuthorization(ctx, state)
+		return nil, ErrUpstreamOAuthSessionMismatch
+	}
+	pending.Code = code
+	if err := savePendingUpstreamAuthorization(ctx, state, pending); err != nil {
+		return nil, err
+	}
+	return model.GetServiceByID(pending.ServiceID)
+}
+
+// CompleteUpstreamOAuth exchanges the authorization code received for a state for a token and stores it. Only
+// the user who started the authorization, from the browser holding its nonce, can complete it. The user's
+// client is shut down so the next request connects with the token.
+func CompleteUpstreamOAuth(ctx context.Context, state, nonce string, userID int64) (*model.MCPService, error) {
+	pending, err := loadPendingUpstreamAuthorization(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	// A state can only be used once
+	deletePendingUpstreamAuthorization(ctx, state)
+	if !pending.matchesNonce(nonce) || pending.UserID != userID {
+		return nil, ErrUpstreamOAuthSessionMismatch
+	}
+	if pending.Code == "" {
+		return nil, ErrUpstreamOAuthStateInvalid
+	}
+	clientSecret, err := common.DecryptSecret(pending.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	svc, err := model.GetServiceByID(pending.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := svc.GetOAuthConfig()
+	if err != nil {
+		return svc, err
+	}
+	if config == nil {
+		return svc, ErrUpstreamOAuthNotEnabled
+	}
+
+	handler, err := newUpstreamOAuthHandler(svc, transport.OAuthConfig{
+		ClientID:              pending.ClientID,
+		ClientSecret:          clientSecret,
+		RedirectURI:           UpstreamOAuthRedirectURI(),
+		Scopes:                config.Scopes,
+		TokenStore:            &upstreamTokenStore{userID: pending.UserID, serviceID: svc.ID, clientID: pending.ClientID, clientSecret: clientSecret},
+		AuthServerMetadataURL: config.AuthServerMetadataURL,
+		PKCEEnabled:           true,
+	})
+	if err != nil {
+		return svc, err
+	}
+	// The handler only accepts the state it issued; the state itself was already checked against the cache
+	if _, err := handler.GetAuthorizationURL(ctx, state, ""); err != nil {
+		return svc, err
+	}
+	if err := handler.ProcessAuthorizationResponse(ctx, pending.Code, state, pending.CodeVerifier); err != nil {
+		return svc, fmt.Errorf("failed to exchange the authorization code for %s: %w", svc.Name, err)
+	}
+
+	if err := ShutdownSharedInstance(ctx, UserInstanceCacheKey(pending.UserID, svc.ID)); err != nil && !errors.Is(err, ErrInstanceNotFound) {
+		common.SysError(fmt.Sprintf("[UpstreamOAuth] Failed to shut down instance of user %d for %s: %v", pending.UserID, svc.Name, err))
+	}
+	common.SysLog(fmt.Sprintf("[UpstreamOAuth] User %d authorized service %s", pending.UserID, svc.Name))
+	return svc, nil
+}
+
+// RevokeUpstreamOAuth forgets the token of a user for a service and shuts down the user's client
+func RevokeUpstreamOAuth(ctx context.Context, serviceID, userID int64) error {
+	if err := model.DeleteUpstreamOAuthToken(userID, serviceID); err != nil {
+		return err
+	}
+	if err := ShutdownSharedInstance(ctx, UserInstanceCacheKey(userID, serviceID)); err != nil && !errors.Is(err, ErrInstanceNotFound) {
+		return err
+	}
+	return nil
+}
+
+func upstreamOAuthStateKey(state string) string {
+	return "upstream_oauth_state:" + state
+}
+
+func hashUpstreamOAuthNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *pendingUpstreamAuthorization) matchesNonce(nonce string) bool {
+	return nonce != "" && subtle.ConstantTimeCompare([]byte(hashUpstreamOAuthNonce(nonce)), []byte(p.NonceHash)) == 1
+}
+
+func loadPendingUpstreamAuthorization(ctx context.Context, state string) (*pendingUpstreamAuthorization, error) {
+	cacheClient := thing.Cache()
+	if cacheClient == nil || state == "" {
+		return nil, ErrUpstreamOAuthStateInvalid
+	}
+	raw, err := cacheClient.Get(ctx, upstreamOAuthStateKey(state))
+	if err != nil || raw == "" {
+		return nil, ErrUpstreamOAuthStateInvalid
+	}
+	var pending pendingUpstreamAuthorization
+	if err := json.Unmarshal([]byte(raw), &pending); err != nil {
+		return nil, ErrUpstreamOAuthStateInvalid
+	}
+	return &pending, nil
+}
+
+func savePendingUpstreamAuthorization(ctx context.Context, state string, pending *pendingUpstreamAuthorization) error {
+	cacheClient := thing.Cache()
+	if cacheClient == nil {
+		return errors.New("cache is not available to keep the OAuth state")
+	}
+	raw, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	if err := cacheClient.Set(ctx, upstreamOAuthStateKey(state), string(raw), UpstreamOAuthStateTTL); err != nil {
+		return fmt.Errorf("failed to keep the OAuth state: %w", err)
+	}
+	return nil
+}
+
+func deletePendingUpstreamAuthorization(ctx context.Context, state string) {
+	if cacheClient := thing.Cache(); cacheClient != nil {
+		if err := cacheClient.Delete(ctx, upstreamOAuthStateKey(state)); err != nil {
+			common.SysError(fmt.Sprintf("[UpstreamOAuth] Failed to delete OAuth state: %v", err))
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuthorizationServer issues codes for any authorization and checks the PKCE verifier on exchange
+type fakeAuthorizationServer struct {
+	mu            sync.Mutex
+	codeChallenge string
+	refreshes     int
+}
+
+func (s *fakeAuthorizationServer) handler(t *testing.T, baseURL func() string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(transport.AuthServerMetadata{
+			Issuer:                baseURL(),
+			AuthorizationEndpoint: baseURL() + "/authorize",
+			TokenEndpoint:         baseURL() + "/token",
+			RegistrationEndpoint:  baseURL() + "/register",
+		})
+	})
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"client_id": "registered-client"})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "registered-client", r.Form.Get("client_id"))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			assert.Equal(t, "the-code", r.Form.Get("code"))
+			assert.Equal(t, s.codeChallenge, transport.GenerateCodeChallenge(r.Form.Get("code_verifier")), "PKCE verifier matches the challenge")
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-1", "refresh_token": "refresh-1", "token_type": "bearer", "expires_in": 3600})
+		case "refresh_token":
+			assert.Equal(t, "refresh-1", r.Form.Get("refresh_token"))
+			s.refreshes++
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-2", "token_type": "bearer", "expires_in": 3600})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	return mux
+}
+
+func TestUpstreamOAuthFlow(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	defer func() { common.SQLitePath = originalPath }()
+	require.NoError(t, model.InitDB())
+	common.SetMasterKeys("upstream-oauth-test-key")
+	defer common.SetMasterKeys("")
+
+	authServer := &fakeAuthorizationServer{}
+	var server *httptest.Server
+	server = httptest.NewServer(authServer.handler(t, func() string { return server.URL }))
+	defer server.Close()
+
+	svc := &model.MCPService{
+		Name:      "oauth-upstream",
+		Type:      model.ServiceTypeStreamableHTTP,
+		Command:   server.URL + "/mcp",
+		Enabled:   true,
+		OAuthJSON: `{"enabled":true,"scopes":["read"],"auth_server_metadata_url":"` + server.URL + `/.well-known/oauth-authorization-server"}`,
+	}
+	require.NoError(t, model.CreateService(svc))
+	const userID = int64(5)
+
+	// Without a token the user's client cannot be built, and the global client never can
+	_, err := upstreamOAuthConfig(svc, userID)
+	var authErr *OAuthAuthorizationRequiredError
+	require.True(t, errors.As(err, &authErr))
+	assert.Equal(t, svc.ID, authErr.ServiceID)
+	_, err = upstreamOAuthConfig(svc, 0)
+	assert.True(t, errors.As(err, &authErr))
+
+	ctx := context.Background()
+	authorizationURL, nonce, err := StartUpstreamOAuth(ctx, svc, userID)
+	require.NoError(t, err)
+	require.NotEmpty(t, nonce)
+	parsed, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+	assert.Equal(t, server.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	assert.Equal(t, "registered-client", query.Get("client_id"), "a client is registered when the service has none")
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, UpstreamOAuthRedirectURI(), query.Get("redirect_uri"))
+	authServer.codeChallenge = query.Get("code_challenge")
+	state := query.Get("state")
+	startAuthorization := func() (string, string) {
+		authorizationURL, nonce, err := StartUpstreamOAuth(ctx, svc, userID)
+		require.NoError(t, err)
+		parsed, err := url.Parse(authorizationURL)
+		require.NoError(t, err)
+		authServer.codeChallenge = parsed.Query().Get("code_challenge")
+		return parsed.Query().Get("state"), nonce
+	}
+
+	_, err = ReceiveUpstreamOAuthCallback(ctx, "forged-state", "the-code", nonce)
+	assert.ErrorIs(t, err, ErrUpstreamOAuthStateInvalid)
+
+	// A victim's browser opening an authorization started by someone else has no matching nonce
+	// and burns the state
+	_, victimNonce := startAuthorization()
+	_, err = ReceiveUpstreamOAuthCallback(ctx, state, "the-code", victimNonce)
+	assert.ErrorIs(t, err, ErrUpstreamOAuthSessionMismatch)
+	_, err = ReceiveUpstreamOAuthCallback(ctx, state, "the-code", nonce)
+	assert.ErrorIs(t, err, ErrUpstreamOAuthStateInvalid, "a rejected state cannot be retried")
+
+	state, nonce = startAuthorization()
+	received, err := ReceiveUpstreamOAuthCallback(ctx, state, "the-code", nonce)
+	require.NoError(t, err)
+	assert.Equal(t, svc.ID, received.ID)
+
+	// Another user logged in to the browser cannot complete it
+	_, err = CompleteUpstreamOAuth(ctx, state, nonce, userID+1)
+	assert.ErrorIs(t, err, ErrUpstreamOAuthSessionMismatch)
+	_, err = model.GetUpstreamOAuthToken(userID+1, svc.ID)
+	assert.ErrorIs(t, err, model.ErrRecordNotFound)
+
+	state, nonce = startAuthorization()
+	_, err = CompleteUpstreamOAuth(ctx, state, nonce, userID)
+	assert.ErrorIs(t, err, ErrUpstreamOAuthStateInvalid, "the callback has not delivered a code yet")
+
+	state, nonce = startAuthorization()
+	_, err = ReceiveUpstreamOAuthCallback(ctx, state, "the-code", nonce)
+	require.NoError(t, err)
+	completed, err := CompleteUpstreamOAuth(ctx, state, nonce, userID)
+	require.NoError(t, err)
+	assert.Equal(t, svc.ID, completed.ID)
+	_, err = CompleteUpstreamOAuth(ctx, state, nonce, userID)
+	assert.ErrorIs(t, err, ErrUpstreamOAuthStateInvalid, "a state can only be used once")
+
+	stored, err := model.UpstreamOAuthTokenDB.Where("user_id = ? AND service_id = ?", userID, svc.ID).Fetch(0, 1)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.True(t, common.IsEncryptedSecret(stored[0].AccessToken), "tokens are encrypted at rest")
+
+	// The user's client authenticates with the stored token
+	oauthConfig, err := upstreamOAuthConfig(svc, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "registered-client", oauthConfig.ClientID)
+	handler, err := newUpstreamOAuthHandler(svc, *oauthConfig)
+	require.NoError(t, err)
+	header, err := handler.GetAuthorizationHeader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer access-1", header)
+
+	// An expired token is refreshed and the new one persisted
+	token, err := model.GetUpstreamOAuthToken(userID, svc.ID)
+	require.NoError(t, err)
+	token.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, model.SaveUpstreamOAuthToken(token))
+	header, err = handler.GetAuthorizationHeader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer access-2", header)
+	assert.Equal(t, 1, authServer.refreshes)
+	refreshed, err := model.GetUpstreamOAuthToken(userID, svc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "access-2", refreshed.AccessToken)
+	assert.Equal(t, "refresh-1", refreshed.RefreshToken, "the refresh token is kept when none is returned")
+	assert.Equal(t, "registered-client", refreshed.ClientID)
+
+	require.NoError(t, RevokeUpstreamOAuth(ctx, svc.ID, userID))
+	_, err = model.GetUpstreamOAuthToken(userID, svc.ID)
+	assert.ErrorIs(t, err, model.ErrRecordNotFound)
+}
@@ -0,0 +1,192 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/burugo/thing"
+)
+
+// APIKeyPrefix is prepended to generated keys so they are recognisable in client configs and logs
+const APIKeyPrefix = "omk_"
+
+// apiKeyLastUsedInterval throttles LastUsedAt writes for keys used on every proxy request
+const apiKeyLastUsedInterval = time.Minute
+
+// APIKey is a named, optionally scoped credential for the proxy endpoints.
+// Only the SHA-256 hash of the key is stored; the plaintext is returned once on creation.
+type APIKey struct {
+	thing.BaseModel
+	UserID                int64     `db:"user_id,index:idx_api_key_user" json:"user_id"`
+	Name                  string    `db:"name" json:"name"`
+	KeyHash               string    `db:"key_hash,index:idx_api_key_hash" json:"-"`
+	KeyPrefix             string    `db:"key_prefix" json:"key_prefix"`                        // First characters of the key for display
+	ExpiresAt             time.Time `db:"expires_at" json:"expires_at"`                        // Zero value means never expires
+	LastUsedAt            time.Time `db:"last_used_at" json:"last_used_at"`                    // Zero value means never used
+	AllowedServiceIDsJSON string    `db:"allowed_service_ids" json:"allowed_service_ids_json"` // JSON array of service IDs, empty means all services
+	ReadOnly              bool      `db:"read_only" json:"read_only"`                          // Read-only keys cannot call tools
+}
+
+// TableName sets the table name for the APIKey model
+func (k *APIKey) TableName() string {
+	return "api_keys"
+}
+
+var APIKeyDB *thing.Thing[*APIKey]
+
+// APIKeyInit initializes the APIKeyDB
+func APIKeyInit() error {
+	var err error
+	APIKeyDB, err = thing.Use[*APIKey]()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// hashAPIKey returns the hex-encoded SHA-256 hash of a plaintext key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsExpired reports whether the key has passed its expiry time
+func (k *APIKey) IsExpired() bool {
+	return !k.ExpiresAt.IsZero() && time.Now().After(k.ExpiresAt)
+}
+
+// GetAllowedServiceIDs returns the service scope of the key; an empty slice means all services
+func (k *APIKey) GetAllowedServiceIDs() ([]int64, error) {
+	if k.AllowedServiceIDsJSON == "" {
+		return []int64{}, nil
+	}
+	var ids []int64
+	if err := json.Unmarshal([]byte(k.AllowedServiceIDsJSON), &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// SetAllowedServiceIDs stores the service scope of the key
+func (k *APIKey) SetAllowedServiceIDs(ids []int64) error {
+	if len(ids) == 0 {
+		k.AllowedServiceIDsJSON = ""
+		return nil
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	k.AllowedServiceIDsJSON = string(data)
+	return nil
+}
+
+// AllowsService reports whether the key may access the given service
+func (k *APIKey) AllowsService(serviceID int64) bool {
+	ids, err := k.GetAllowedServiceIDs()
+	if err != nil {
+		// A corrupted scope must not widen access
+		return false
+	}
+	if len(ids) == 0 {
+		return true
+	}
+	for _, id := range ids {
+		if id == serviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPlaintext makes the key authenticate with a plaintext chosen by the caller, e.g. one declared in the
+// configuration file. The plaintext must carry APIKeyPrefix so TokenAuth recognises it.
+func (k *APIKey) SetPlaintext(plaintext string) error {
+	if !strings.HasPrefix(plaintext, APIKeyPrefix) || len(plaintext) < len(APIKeyPrefix)+16 {
+		return fmt.Errorf("api key must start with %s and have at least 16 characters after it", APIKeyPrefix)
+	}
+	k.KeyHash = hashAPIKey(plaintext)
+	k.KeyPrefix = plaintext[:len(APIKeyPrefix)+6]
+	return nil
+}
+
+// HasPlaintext reports whether the key authenticates with the plaintext
+func (k *APIKey) HasPlaintext(plaintext string) bool {
+	return k.KeyHash == hashAPIKey(plaintext)
+}
+
+// CreateAPIKey generates a new key for the user and returns the saved record with the plaintext key
+func CreateAPIKey(userID int64, name string, expiresAt time.Time, allowedServiceIDs []int64, readOnly bool) (*APIKey, string, error) {
+	if name == "" {
+		return nil, "", errors.New("api key name is required")
+	}
+	plaintext := APIKeyPrefix + common.GetUUID()
+	apiKey := &APIKey{
+		UserID:    userID,
+		Name:      name,
+		KeyHash:   hashAPIKey(plaintext),
+		KeyPrefix: plaintext[:len(APIKeyPrefix)+6],
+		ExpiresAt: expiresAt,
+		ReadOnly:  readOnly,
+	}
+	if err := apiKey.SetAllowedServiceIDs(allowedServiceIDs); err != nil {
+		return nil, "", err
+	}
+	if err := APIKeyDB.Save(apiKey); err != nil {
+		return nil, "", err
+	}
+	return apiKey, plaintext, nil
+}
+
+// GetAPIKeysByUser returns all keys of a user
+func GetAPIKeysByUser(userID int64) ([]*APIKey, error) {
+	return APIKeyDB.Where("user_id = ?", userID).Order("id DESC").All()
+}
+
+// RevokeAPIKey deletes a key owned by the user
+func RevokeAPIKey(userID, keyID int64) error {
+	apiKey, err := APIKeyDB.ByID(keyID)
+	if err != nil {
+		return err
+	}
+	if apiKey.UserID != userID {
+		return errors.New("api_key_not_found")
+	}
+	return APIKeyDB.Delete(apiKey)
+}
+
+// ValidateAPIKey looks up a plaintext key and returns it with its enabled owner.
+// Expired keys and keys of disabled users are rejected. LastUsedAt is refreshed at most once per minute.
+func ValidateAPIKey(key string) (*APIKey, *User) {
+	if key == "" {
+		return nil, nil
+	}
+	keys, err := APIKeyDB.Where("key_hash = ?", hashAPIKey(key)).Fetch(0, 1)
+	if err != nil || len(keys) == 0 {
+		return nil, nil
+	}
+	apiKey := keys[0]
+	if apiKey.IsExpired() {
+		return nil, nil
+	}
+
+	user, err := UserDB.ByID(apiKey.UserID)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		return nil, nil
+	}
+
+	if time.Since(apiKey.LastUsedAt) > apiKeyLastUsedInterval {
+		apiKey.LastUsedAt = time.Now()
+		if err := APIKeyDB.Save(apiKey); err != nil {
+			common.SysError("failed to update api key last used time: " + err.Error())
+		}
+	}
+	return apiKey, user
+}
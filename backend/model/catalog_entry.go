@@ -0,0 +1,367 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/burugo/thing"
+)
+
+// PackageManagerCatalog marks services installed from a catalog entry that runs no npm or PyPI package; their
+// SourcePackageName is the name of the entry
+const PackageManagerCatalog = "recommended"
+
+// CatalogTemplate is a vetted service template of the recommended catalog. It is the form entries take in the
+// API, in the bundled catalog and in exported catalog files.
+type CatalogTemplate struct {
+	Name                  string                          `json:"name"` // Name of the installed service
+	DisplayName           string                          `json:"display_name,omitempty"`
+	Description           string                          `json:"description,omitempty"`
+	Category              ServiceCategory                 `json:"category,omitempty"`
+	Icon                  string                          `json:"icon,omitempty"`
+	Homepage              string                          `json:"homepage,omitempty"`
+	Type                  ServiceType                     `json:"type"`
+	PackageManager        string                          `json:"package_manager,omitempty"` // npm, pypi or docker to install the package or pull the image before running it
+	PackageName           string                          `json:"package_name,omitempty"`
+	Command               string                          `json:"command"` // URL for SSE and streamable HTTP services
+	Args                  []string                        `json:"args,omitempty"`
+	EnvVars               []EnvVarDefinition              `json:"env_vars,omitempty"`
+	Headers               map[string]string               `json:"headers,omitempty"` // May contain {{NAME}} placeholders of EnvVars
+	ClientConfigTemplates map[string]ClientTemplateDetail `json:"client_config_templates,omitempty"`
+	Hidden                bool                            `json:"hidden,omitempty"` // Only admins see hidden entries
+	OrderNum              int                             `json:"order_num,omitempty"`
+}
+
+// CatalogFile is an exported catalog, also the format of the bundled catalog
+type CatalogFile struct {
+	Entries []CatalogTemplate `json:"entries"`
+}
+
+// CatalogEntry is a stored catalog template
+type CatalogEntry struct {
+	thing.BaseModel
+	Name                  string          `db:"name,index:idx_catalog_entry_name" json:"name"`
+	DisplayName           string          `db:"display_name" json:"display_name"`
+	Description           string          `db:"description" json:"description"`
+	Category              ServiceCategory `db:"category" json:"category"`
+	Icon                  string          `db:"icon" json:"icon"`
+	Homepage              string          `db:"homepage" json:"homepage"`
+	Type                  ServiceType     `db:"type" json:"type"`
+	PackageManager        string          `db:"package_manager" json:"package_manager"`
+	PackageName           string          `db:"package_name" json:"package_name"`
+	Command               string          `db:"command" json:"command"`
+	ArgsJSON              string          `db:"args_json" json:"args_json"`
+	EnvVarsJSON           string          `db:"env_vars_json" json:"env_vars_json"`
+	HeadersJSON           string          `db:"headers_json" json:"headers_json"`
+	ClientConfigTemplates string          `db:"client_config_templates" json:"client_config_templates"`
+	Hidden                bool            `db:"hidden" json:"hidden"`
+	OrderNum              int             `db:"order_num" json:"order_num"`
+}
+
+// TableName sets the table name for the CatalogEntry model
+func (e *CatalogEntry) TableName() string {
+	return "catalog_entries"
+}
+
+var CatalogEntryDB *thing.Thing[*CatalogEntry]
+
+// CatalogEntryInit initializes the CatalogEntryDB
+func CatalogEntryInit() error {
+	var err error
+	CatalogEntryDB, err = thing.Use[*CatalogEntry]()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate checks that the template names a service and can run it
+func (t *CatalogTemplate) Validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errors.New("name is required")
+	}
+	if strings.ContainsAny(t.Name, "/ \t\r\n") {
+		return fmt.Errorf("name %q must not contain spaces or slashes", t.Name)
+	}
+	if strings.TrimSpace(t.Command) == "" {
+		return fmt.Errorf("%s: command is required", t.Name)
+	}
+	switch t.Type {
+	case ServiceTypeStdio:
+	case ServiceTypeSSE, ServiceTypeStreamableHTTP:
+		if u, err := url.Parse(t.Command); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s: command must be the http or https URL of the server", t.Name)
+		}
+	default:
+		return fmt.Errorf("%s: type must be stdio, sse or streamable_http", t.Name)
+	}
+	switch t.PackageManager {
+	case "":
+	case "npm", "pypi", PackageManagerDocker:
+		if t.Type != ServiceTypeStdio || t.PackageName == "" {
+			return fmt.Errorf("%s: a %s package needs a stdio type and package_name", t.Name, t.PackageManager)
+		}
+	default:
+		return fmt.Errorf("%s: package_manager must be npm, pypi or docker", t.Name)
+	}
+	for _, env := range t.EnvVars {
+		if env.Name == "" {
+			return fmt.Errorf("%s: env var without a name", t.Name)
+		}
+	}
+	return nil
+}
+
+// Template returns the template stored in the entry
+func (e *CatalogEntry) Template() (CatalogTemplate, error) {
+	t := CatalogTemplate{
+		Name:           e.Name,
+		DisplayName:    e.DisplayName,
+		Description:    e.Description,
+		Category:       e.Category,
+		Icon:           e.Icon,
+		Homepage:       e.Homepage,
+		Type:           e.Type,
+		PackageManager: e.PackageManager,
+		PackageName:    e.PackageName,
+		Command:        e.Command,
+		Hidden:         e.Hidden,
+		OrderNum:       e.OrderNum,
+	}
+	for _, field := range []struct {
+		data string
+		out  interface{}
+	}{
+		{e.ArgsJSON, &t.Args},
+		{e.EnvVarsJSON, &t.EnvVars},
+		{e.HeadersJSON, &t.Headers},
+		{e.ClientConfigTemplates, &t.ClientConfigTemplates},
+	} {
+		if field.data == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(field.data), field.out); err != nil {
+			return t, fmt.Errorf("invalid catalog entry %s: %w", e.Name, err)
+		}
+	}
+	return t, nil
+}
+
+// SetTemplate replaces the content of the entry with the template
+func (e *CatalogEntry) SetTemplate(t CatalogTemplate) error {
+	e.Name = t.Name
+	e.DisplayName = t.DisplayName
+	e.Description = t.Description
+	e.Category = t.Category
+	e.Icon = t.Icon
+	e.Homepage = t.Homepage
+	e.Type = t.Type
+	e.PackageManager = t.PackageManager
+	e.PackageName = t.PackageName
+	e.Command = t.Command
+	e.Hidden = t.Hidden
+	e.OrderNum = t.OrderNum
+	for _, field := range []struct {
+		value interface{}
+		empty bool
+		out   *string
+	}{
+		{t.Args, len(t.Args) == 0, &e.ArgsJSON},
+		{t.EnvVars, len(t.EnvVars) == 0, &e.EnvVarsJSON},
+		{t.Headers, len(t.Headers) == 0, &e.HeadersJSON},
+		{t.ClientConfigTemplates, len(t.ClientConfigTemplates) == 0, &e.ClientConfigTemplates},
+	} {
+		*field.out = ""
+		if field.empty {
+			continue
+		}
+		data, err := json.Marshal(field.value)
+		if err != nil {
+			return err
+		}
+		*field.out = string(data)
+	}
+	return nil
+}
+
+// InstallTarget returns the package manager and package name a service of the template is installed with, as
+// stored in PackageManager and SourcePackageName
+func (t *CatalogTemplate) InstallTarget() (string, string) {
+	if t.PackageManager != "" {
+		return t.PackageManager, t.PackageName
+	}
+	return PackageManagerCatalog, t.Name
+}
+
+// ToMCPService maps the template to an MCPService. Default values of the env vars become its default
+// environment. The service is not saved.
+func (t *CatalogTemplate) ToMCPService() (*MCPService, error) {
+	svc := &MCPService{
+		Name:                  t.Name,
+		DisplayName:           t.DisplayName,
+		Description:           t.Description,
+		Category:              t.Category,
+		Icon:                  t.Icon,
+		Type:                  t.Type,
+		Command:               t.Command,
+		ClientConfigTemplates: "{}",
+		Enabled:               true,
+	}
+	if svc.DisplayName == "" {
+		svc.DisplayName = t.Name
+	}
+	if svc.Category == "" {
+		svc.Category = CategoryUtil
+	}
+	svc.PackageManager, svc.SourcePackageName = t.InstallTarget()
+	if len(t.Args) > 0 {
+		data, err := json.Marshal(t.Args)
+		if err != nil {
+			return nil, err
+		}
+		svc.ArgsJSON = string(data)
+	}
+	if err := svc.SetRequiredEnvVars(t.EnvVars); err != nil {
+		return nil, err
+	}
+	defaults := map[string]string{}
+	for _, env := range t.EnvVars {
+		if env.DefaultValue != "" {
+			defaults[env.Name] = env.DefaultValue
+		}
+	}
+	if len(defaults) > 0 {
+		data, err := json.Marshal(defaults)
+		if err != nil {
+			return nil, err
+		}
+		svc.DefaultEnvsJSON = string(data)
+	}
+	if len(t.Headers) > 0 {
+		data, err := json.Marshal(t.Headers)
+		if err != nil {
+			return nil, err
+		}
+		svc.HeadersJSON = string(data)
+	}
+	if len(t.ClientConfigTemplates) > 0 {
+		if err := svc.SetClientConfigTemplates(t.ClientConfigTemplates); err != nil {
+			return nil, err
+		}
+	}
+	return svc, nil
+}
+
+// GetCatalogEntries returns the catalog in display order, without the hidden entries unless includeHidden
+func GetCatalogEntries(includeHidden bool) ([]*CatalogEntry, error) {
+	if includeHidden {
+		return CatalogEntryDB.Order("order_num ASC, name ASC").All()
+	}
+	return CatalogEntryDB.Where("hidden = ?", false).Order("order_num ASC, name ASC").All()
+}
+
+// GetCatalogEntryByID returns a catalog entry by its ID
+func GetCatalogEntryByID(id int64) (*CatalogEntry, error) {
+	return CatalogEntryDB.ByID(id)
+}
+
+// GetCatalogEntryByName returns a catalog entry by its name
+func GetCatalogEntryByName(name string) (*CatalogEntry, error) {
+	return CatalogEntryDB.Where("name = ?", name).First()
+}
+
+// SaveCatalogEntry creates or updates a catalog entry
+func SaveCatalogEntry(entry *CatalogEntry) error {
+	return CatalogEntryDB.Save(entry)
+}
+
+// DeleteCatalogEntry deletes a catalog entry
+func DeleteCatalogEntry(id int64) error {
+	entry, err := CatalogEntryDB.ByID(id)
+	if err != nil {
+		return err
+	}
+	return CatalogEntryDB.Delete(entry)
+}
+
+// CatalogImportResult counts the entries changed by an import
+type CatalogImportResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// ImportCatalog creates the templates of the file, updating the entries of the same name. With replace, entries
+// not in the file are deleted. Nothing is changed if a template is invalid or a name is repeated.
+func ImportCatalog(file *CatalogFile, replace bool) (*CatalogImportResult, error) {
+	names := make(map[string]bool, len(file.Entries))
+	for i := range file.Entries {
+		if err := file.Entries[i].Validate(); err != nil {
+			return nil, err
+		}
+		if names[file.Entries[i].Name] {
+			return nil, fmt.Errorf("%s: duplicate entry", file.Entries[i].Name)
+		}
+		names[file.Entries[i].Name] = true
+	}
+
+	existing, err := GetCatalogEntries(true)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*CatalogEntry, len(existing))
+	for _, entry := range existing {
+		byName[entry.Name] = entry
+	}
+
+	result := &CatalogImportResult{}
+	for _, t := range file.Entries {
+		entry := &CatalogEntry{}
+		if current, ok := byName[t.Name]; ok {
+			// Copy the fetched entry so the cached one is not changed if saving fails
+			copied := *current
+			entry = &copied
+			result.Updated++
+		} else {
+			result.Created++
+		}
+		if err := entry.SetTemplate(t); err != nil {
+			return nil, err
+		}
+		if err := SaveCatalogEntry(entry); err != nil {
+			return nil, err
+		}
+	}
+	if replace {
+		for _, entry := range existing {
+			if names[entry.Name] {
+				continue
+			}
+			if err := CatalogEntryDB.Delete(entry); err != nil {
+				return nil, err
+			}
+			result.Deleted++
+		}
+	}
+	return result, nil
+}
+
+// ExportCatalog returns every catalog entry, hidden ones included
+func ExportCatalog() (*CatalogFile, error) {
+	entries, err := GetCatalogEntries(true)
+	if err != nil {
+		return nil, err
+	}
+	file := &CatalogFile{Entries: make([]CatalogTemplate, 0, len(entries))}
+	for _, entry := range entries {
+		t, err := entry.Template()
+		if err != nil {
+			return nil, err
+		}
+		file.Entries = append(file.Entries, t)
+	}
+	return file, nil
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportCatalog(t *testing.T) {
+	setupStatsTestDB(t)
+
+	fetch := CatalogTemplate{Name: "catalog-fetch", Type: ServiceTypeStdio, PackageManager: "pypi", PackageName: "mcp-server-fetch",
+		Command: "uvx", Args: []string{"mcp-server-fetch"}}
+	search := CatalogTemplate{Name: "catalog-search", Type: ServiceTypeStreamableHTTP, Command: "https://search.example.com/mcp",
+		EnvVars: []EnvVarDefinition{{Name: "SEARCH_TOKEN", IsSecret: true}, {Name: "SEARCH_REGION", Optional: true, DefaultValue: "eu"}},
+		Headers: map[string]string{"Authorization": "Bearer {{SEARCH_TOKEN}}"}, Hidden: true, OrderNum: 1,
+		ClientConfigTemplates: map[string]ClientTemplateDetail{"cursor": {TemplateString: `{"url":"{{url}}"}`}}}
+
+	result, err := ImportCatalog(&CatalogFile{Entries: []CatalogTemplate{fetch, search}}, false)
+	require.NoError(t, err)
+	assert.Equal(t, CatalogImportResult{Created: 2}, *result)
+
+	visible, err := GetCatalogEntries(false)
+	require.NoError(t, err)
+	require.Len(t, visible, 1, "hidden entries are only listed for admins")
+	assert.Equal(t, "catalog-fetch", visible[0].Name)
+
+	exported, err := ExportCatalog()
+	require.NoError(t, err)
+	require.Len(t, exported.Entries, 2)
+	assert.Equal(t, fetch, exported.Entries[0], "entries round-trip through export")
+	assert.Equal(t, search, exported.Entries[1])
+
+	svc, err := search.ToMCPService()
+	require.NoError(t, err)
+	assert.Equal(t, PackageManagerCatalog, svc.PackageManager)
+	assert.Equal(t, "catalog-search", svc.SourcePackageName)
+	assert.Equal(t, CategoryUtil, svc.Category)
+	assert.JSONEq(t, `{"SEARCH_REGION":"eu"}`, svc.DefaultEnvsJSON)
+	assert.JSONEq(t, `{"Authorization":"Bearer {{SEARCH_TOKEN}}"}`, svc.HeadersJSON)
+	envVars, err := svc.GetRequiredEnvVars()
+	require.NoError(t, err)
+	assert.Len(t, envVars, 2)
+
+	// Replacing updates by name and removes entries missing from the file
+	fetch.Description = "Fetch web pages"
+	result, err = ImportCatalog(&CatalogFile{Entries: []CatalogTemplate{fetch}}, true)
+	require.NoError(t, err)
+	assert.Equal(t, CatalogImportResult{Updated: 1, Deleted: 1}, *result)
+	entry, err := GetCatalogEntryByName("catalog-fetch")
+	require.NoError(t, err)
+	assert.Equal(t, "Fetch web pages", entry.Description)
+
+	// Invalid files change nothing
+	_, err = ImportCatalog(&CatalogFile{Entries: []CatalogTemplate{{Name: "catalog-bad", Type: ServiceTypeSSE, Command: "search.example.com"}}}, true)
+	assert.Error(t, err)
+	_, err = ImportCatalog(&CatalogFile{Entries: []CatalogTemplate{fetch, fetch}}, true)
+	assert.Error(t, err)
+	all, err := GetCatalogEntries(true)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
@@ -35,6 +35,7 @@ type ConfigService struct {
 	Required        bool       `db:"required"`
 	AdvancedSetting bool       `db:"advanced_setting"`
 	OrderNum        int        `db:"order_num"`
+	IsHeader        bool       `db:"is_header"` // An HTTP header sent to a remote service rather than an env var of a stdio process
 }
 
 // TableName sets the table name for the ConfigService model
@@ -64,16 +65,28 @@ func GetConfigOptionByID(id int64) (*ConfigService, error) {
 	return ConfigServiceDB.ByID(id)
 }
 
-// GetConfigOptionByKey returns a specific configuration option by service ID and key
+// GetConfigOptionByKey returns a specific (env var) configuration option by service ID and key
 func GetConfigOptionByKey(serviceID int64, key string) (*ConfigService, error) {
-	configs, err := ConfigServiceDB.Where("service_id = ? AND key = ?", serviceID, key).Fetch(0, 1)
+	return getConfigOptionByKey(serviceID, key, false)
+}
+
+// GetHeaderOptionByKey returns the header option of a service with the given (canonical) header name
+func GetHeaderOptionByKey(serviceID int64, key string) (*ConfigService, error) {
+	return getConfigOptionByKey(serviceID, key, true)
+}
+
+// getConfigOptionByKey filters on IsHeader in Go, since rows created before the column existed may hold NULL
+func getConfigOptionByKey(serviceID int64, key string, header bool) (*ConfigService, error) {
+	configs, err := ConfigServiceDB.Where("service_id = ? AND key = ?", serviceID, key).All()
 	if err != nil {
 		return nil, err
 	}
-	if len(configs) == 0 {
-		return nil, ErrRecordNotFound
+	for _, config := range configs {
+		if config.IsHeader == header {
+			return config, nil
+		}
 	}
-	return configs[0], nil
+	return nil, ErrRecordNotFound
 }
 
 // CreateConfigOption creates a new service configuration option
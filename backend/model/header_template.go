@@ -0,0 +1,49 @@
+package model
+
+import (
+	"regexp"
+	"sort"
+)
+
+// headerPlaceholderPattern matches a {{NAME}} placeholder in a header value, e.g. "Bearer {{GITHUB_TOKEN}}"
+var headerPlaceholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// HasHeaderTemplates reports whether any header value contains a {{NAME}} placeholder
+func HasHeaderTemplates(headers map[string]string) bool {
+	for _, value := range headers {
+		if headerPlaceholderPattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveHeaderTemplates fills the {{NAME}} placeholders of header values from values, e.g. a user's
+// configuration of the service. A header with a placeholder that has no (or an empty) value is left out
+// rather than sent with the placeholder; the names of such values are returned sorted.
+func ResolveHeaderTemplates(headers map[string]string, values map[string]string) (map[string]string, []string) {
+	resolved := make(map[string]string, len(headers))
+	missingSet := make(map[string]struct{})
+	for name, value := range headers {
+		complete := true
+		resolved[name] = headerPlaceholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+			key := headerPlaceholderPattern.FindStringSubmatch(placeholder)[1]
+			if v := values[key]; v != "" {
+				return v
+			}
+			missingSet[key] = struct{}{}
+			complete = false
+			return placeholder
+		})
+		if !complete {
+			delete(resolved, name)
+		}
+	}
+
+	var missing []string
+	for key := range missingSet {
+		missing = append(missing, key)
+	}
+	sort.Strings(missing)
+	return resolved, missing
+}
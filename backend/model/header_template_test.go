@@ -0,0 +1,25 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveHeaderTemplates(t *testing.T) {
+	headers := map[string]string{
+		"Authorization": "Bearer {{ API_TOKEN }}",
+		"X-Workspace":   "{{WORKSPACE}}/{{REGION}}",
+		"X-Client":      "one-mcp",
+	}
+	assert.True(t, HasHeaderTemplates(headers))
+	assert.False(t, HasHeaderTemplates(map[string]string{"X-Client": "one-mcp"}))
+
+	resolved, missing := ResolveHeaderTemplates(headers, map[string]string{"API_TOKEN": "secret", "WORKSPACE": "acme"})
+	assert.Equal(t, map[string]string{"Authorization": "Bearer secret", "X-Client": "one-mcp"}, resolved, "a header with an unfilled placeholder is left out")
+	assert.Equal(t, []string{"REGION"}, missing)
+
+	resolved, missing = ResolveHeaderTemplates(headers, nil)
+	assert.Equal(t, map[string]string{"X-Client": "one-mcp"}, resolved)
+	assert.Equal(t, []string{"API_TOKEN", "REGION", "WORKSPACE"}, missing)
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"github.com/burugo/thing"
+)
+
+// maxCrashLogsPerInstance is how many crash logs are kept for each instance
+const maxCrashLogsPerInstance = 10
+
+// InstanceCrashLog keeps the stderr tail of a stdio MCP server process that exited unexpectedly,
+// so it can be inspected after the in-memory log of the instance is gone
+type InstanceCrashLog struct {
+	thing.BaseModel
+	ServiceID   int64  `db:"service_id,index:idx_crash_log_service" json:"service_id"`
+	ServiceName string `db:"service_name" json:"service_name"`
+	UserID      int64  `db:"user_id" json:"user_id"` // 0 for the globally shared instance
+	CacheKey    string `db:"cache_key,index:idx_crash_log_cache_key" json:"cache_key"`
+	Reason      string `db:"reason" json:"reason"`
+	StderrTail  string `db:"stderr_tail" json:"stderr_tail"` // Last lines written to stderr, newline separated
+}
+
+// TableName sets the table name for the InstanceCrashLog model
+func (l *InstanceCrashLog) TableName() string {
+	return "instance_crash_logs"
+}
+
+var InstanceCrashLogDB *thing.Thing[*InstanceCrashLog]
+
+// InstanceCrashLogInit initializes the InstanceCrashLogDB
+func InstanceCrashLogInit() error {
+	var err error
+	InstanceCrashLogDB, err = thing.Use[*InstanceCrashLog]()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SaveInstanceCrashLog stores a crash log and drops the oldest ones of the same instance
+func SaveInstanceCrashLog(crashLog *InstanceCrashLog) error {
+	if err := InstanceCrashLogDB.Save(crashLog); err != nil {
+		return err
+	}
+	stale, err := InstanceCrashLogDB.Where("cache_key = ?", crashLog.CacheKey).Order("id DESC").Fetch(maxCrashLogsPerInstance, 1000)
+	if err != nil {
+		return err
+	}
+	for _, old := range stale {
+		if err := InstanceCrashLogDB.Delete(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetInstanceCrashLogs returns the most recent crash logs of an instance, newest first
+func GetInstanceCrashLogs(cacheKey string, limit int) ([]*InstanceCrashLog, error) {
+	return InstanceCrashLogDB.Where("cache_key = ?", cacheKey).Order("id DESC").Fetch(0, limit)
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveInstanceCrashLogKeepsNewest(t *testing.T) {
+	setupStatsTestDB(t)
+
+	for i := 1; i <= maxCrashLogsPerInstance+2; i++ {
+		require.NoError(t, SaveInstanceCrashLog(&InstanceCrashLog{ServiceID: 1, CacheKey: "global-service-1-shared", Reason: fmt.Sprintf("crash %d", i)}))
+	}
+	require.NoError(t, SaveInstanceCrashLog(&InstanceCrashLog{ServiceID: 1, CacheKey: "user-2-service-1-shared", Reason: "other"}))
+
+	logs, err := GetInstanceCrashLogs("global-service-1-shared", 100)
+	require.NoError(t, err)
+	require.Len(t, logs, maxCrashLogsPerInstance)
+	assert.Equal(t, fmt.Sprintf("crash %d", maxCrashLogsPerInstance+2), logs[0].Reason, "newest first")
+
+	logs, err = GetInstanceCrashLogs("user-2-service-1-shared", 100)
+	require.NoError(t, err)
+	assert.Len(t, logs, 1)
+}
@@ -61,11 +61,14 @@ func InitDB() (err error) {
 
 	// 1. AutoMigrate all models first
 	thing.AllowDropColumn = true
-	err = thing.AutoMigrate(&User{}, &Option{}, &MCPService{}, &UserConfig{}, &ConfigService{}, &ProxyRequestStat{})
+	err = thing.AutoMigrate(&User{}, &Option{}, &MCPService{}, &UserConfig{}, &ConfigService{}, &ProxyRequestStat{}, &ProxyStatRollup{}, &ToolPolicy{}, &APIKey{}, &InstanceCrashLog{}, &UpstreamOAuthToken{}, &OAuthClient{}, &OAuthToken{}, &CatalogEntry{})
 	if err != nil {
 		return err
 	}
 
+	// Encrypt secret columns transparently on every save
+	registerSecretHooks()
+
 	// 2. Initialize all ORM instances
 	if err := UserInit(); err != nil {
 		return err
@@ -85,6 +88,27 @@ func InitDB() (err error) {
 	if err := UserConfigInit(); err != nil {
 		return err
 	}
+	if err := ToolPolicyInit(); err != nil {
+		return err
+	}
+	if err := APIKeyInit(); err != nil {
+		return err
+	}
+	if err := ProxyStatRollupInit(); err != nil {
+		return err
+	}
+	if err := InstanceCrashLogInit(); err != nil {
+		return err
+	}
+	if err := UpstreamOAuthTokenInit(); err != nil {
+		return err
+	}
+	if err := OAuthServerInit(); err != nil {
+		return err
+	}
+	if err := CatalogEntryInit(); err != nil {
+		return err
+	}
 
 	// 3. Perform data-dependent operations like creating a root account
 	return createRootAccountIfNeed()
@@ -4,8 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"one-mcp/backend/common"
+
 	"github.com/burugo/thing"
 )
 
@@ -73,6 +79,69 @@ type MCPService struct {
 	DefaultEnvsJSON       string          `db:"default_envs_json,default:'{}'"`
 	HeadersJSON           string          `json:"headers_json,omitempty" db:"headers_json,default:'{}'"` // JSON string for custom request headers map[string]string
 	RPDLimit              int             `json:"rpd_limit,omitempty" db:"rpd_limit,default:0"`          // 每日请求次数限制(0表示不限制)
+	SandboxJSON           string          `json:"sandbox_json,omitempty" db:"sandbox_json,default:'{}'"` // JSON SandboxConfig for the process of a stdio service
+	OAuthJSON             string          `json:"oauth_json,omitempty" db:"oauth_json,default:'{}'"`     // JSON UpstreamOAuthConfig of an SSE or streamable HTTP service
+	ManagedBy             string          `json:"managed_by,omitempty" db:"managed_by"`                  // ServiceManagedByConfig when declared in the configuration file, empty if edited in the UI
+	DockerJSON            string          `json:"docker_json,omitempty" db:"docker_json,default:'{}'"`   // JSON DockerConfig of a service running a container image
+	LatestVersion         string          `json:"latest_version,omitempty" db:"latest_version"`          // Newest released version of an npm or PyPI package when last checked
+	UpdateAvailable       bool            `json:"update_available" db:"update_available"`                // LatestVersion is newer than InstalledVersion
+}
+
+// PackageManagerDocker marks stdio services running a container image with docker run -i. SourcePackageName is
+// the image and ArgsJSON the arguments passed to its entrypoint.
+const PackageManagerDocker = "docker"
+
+const (
+	// AggregateServiceName is reserved for the endpoint that merges every enabled service, /proxy/_all
+	AggregateServiceName = "_all"
+	// ServiceNameSeparator joins a service name and a tool or prompt name on the aggregate endpoint, so it
+	// cannot appear in a service name
+	ServiceNameSeparator = "__"
+)
+
+// ErrServiceNameReserved is returned when saving a service whose name is empty, reserved or contains
+// ServiceNameSeparator
+var ErrServiceNameReserved = errors.New("service name is reserved")
+
+// ServiceManagedByConfig marks services declared in the declarative configuration file; the UI cannot edit them
+const ServiceManagedByConfig = "config"
+
+// UpstreamOAuthConfig makes users of a remote service authorize one-mcp with the upstream's OAuth 2.1
+// authorization server; each user's client then sends their own access token.
+type UpstreamOAuthConfig struct {
+	Enabled               bool     `json:"enabled"`
+	ClientID              string   `json:"client_id,omitempty"`                // Empty registers a client dynamically for each user
+	ClientSecret          string   `json:"client_secret,omitempty"`            // Only for confidential clients, encrypted at rest
+	Scopes                []string `json:"scopes,omitempty"`                   // Scopes requested during authorization
+	AuthServerMetadataURL string   `json:"auth_server_metadata_url,omitempty"` // Empty discovers it from the upstream URL
+}
+
+// SandboxConfig limits the resources and environment of the process of a stdio service.
+// Zero values leave a limit unset.
+type SandboxConfig struct {
+	CPUSeconds   uint64   `json:"cpu_seconds,omitempty"`    // CPU time after which the process is killed
+	MemoryMB     uint64   `json:"memory_mb,omitempty"`      // Memory of the process (and its children, with cgroups v2)
+	MaxOpenFiles uint64   `json:"max_open_files,omitempty"` // Open file descriptors per process
+	MaxProcesses uint64   `json:"max_processes,omitempty"`  // Processes and threads, only enforced with cgroups v2
+	WorkDir      string   `json:"work_dir,omitempty"`       // Absolute working directory, also HOME and TMPDIR; files outside it stay accessible
+	EnvAllowlist []string `json:"env_allowlist,omitempty"`  // one-mcp environment variables passed on besides the defaults; a trailing * matches a prefix
+}
+
+// DockerConfig sets how the container of a docker service runs. Zero values keep the docker defaults.
+type DockerConfig struct {
+	Volumes   []string `json:"volumes,omitempty"`    // Bind mounts or named volumes, e.g. /srv/data:/data:ro
+	Network   string   `json:"network,omitempty"`    // Network to join, none to disable networking
+	CPUs      string   `json:"cpus,omitempty"`       // CPUs the container may use, e.g. 0.5
+	MemoryMB  uint64   `json:"memory_mb,omitempty"`  // Memory of the container
+	PidsLimit uint64   `json:"pids_limit,omitempty"` // Processes and threads in the container
+	ReadOnly  bool     `json:"read_only,omitempty"`  // Mount the root filesystem read-only
+	User      string   `json:"user,omitempty"`       // User the entrypoint runs as, e.g. 1000:1000
+	ExtraArgs []string `json:"extra_args,omitempty"` // Other docker run options, placed before the image
+}
+
+// IsManaged reports whether the service is declared in the configuration file
+func (s *MCPService) IsManaged() bool {
+	return s.ManagedBy != ""
 }
 
 // TableName sets the table name for the MCPService model
@@ -148,6 +217,90 @@ func (s *MCPService) GetRequiredEnvVars() ([]EnvVarDefinition, error) {
 	return envVars, nil
 }
 
+// GetSandboxConfig returns the sandbox of the service, nil if none is configured
+func (s *MCPService) GetSandboxConfig() (*SandboxConfig, error) {
+	if s.SandboxJSON == "" || s.SandboxJSON == "{}" {
+		return nil, nil
+	}
+	var sandbox SandboxConfig
+	if err := json.Unmarshal([]byte(s.SandboxJSON), &sandbox); err != nil {
+		return nil, err
+	}
+	if sandbox.WorkDir != "" && !filepath.IsAbs(sandbox.WorkDir) {
+		return nil, fmt.Errorf("sandbox work_dir must be an absolute path: %s", sandbox.WorkDir)
+	}
+	for _, name := range sandbox.EnvAllowlist {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			return nil, fmt.Errorf("invalid environment variable name in sandbox env_allowlist: %q", name)
+		}
+	}
+	return &sandbox, nil
+}
+
+// GetDockerConfig returns the container settings of the service, nil if none are configured
+func (s *MCPService) GetDockerConfig() (*DockerConfig, error) {
+	if s.DockerJSON == "" || s.DockerJSON == "{}" {
+		return nil, nil
+	}
+	var config DockerConfig
+	if err := json.Unmarshal([]byte(s.DockerJSON), &config); err != nil {
+		return nil, err
+	}
+	for _, volume := range config.Volumes {
+		if !strings.Contains(volume, ":") {
+			return nil, fmt.Errorf("docker volume must be source:target[:options]: %q", volume)
+		}
+	}
+	if config.CPUs != "" {
+		if cpus, err := strconv.ParseFloat(config.CPUs, 64); err != nil || cpus <= 0 {
+			return nil, fmt.Errorf("docker cpus must be a positive number: %q", config.CPUs)
+		}
+	}
+	return &config, nil
+}
+
+// DockerImage returns the image a docker service runs: SourcePackageName, tagged with InstalledVersion unless
+// it already has a tag or digest
+func (s *MCPService) DockerImage() string {
+	image := s.SourcePackageName
+	if s.InstalledVersion == "" || s.InstalledVersion == "latest" || s.InstalledVersion == "installing" || strings.Contains(image, "@") {
+		return image
+	}
+	if strings.Contains(image[strings.LastIndex(image, "/")+1:], ":") {
+		return image
+	}
+	return image + ":" + s.InstalledVersion
+}
+
+// GetOAuthConfig returns the upstream OAuth configuration of the service with its client secret decrypted,
+// nil if OAuth is not enabled
+func (s *MCPService) GetOAuthConfig() (*UpstreamOAuthConfig, error) {
+	if s.OAuthJSON == "" || s.OAuthJSON == "{}" {
+		return nil, nil
+	}
+	var config UpstreamOAuthConfig
+	if err := json.Unmarshal([]byte(s.OAuthJSON), &config); err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return nil, nil
+	}
+	if s.Type != ServiceTypeSSE && s.Type != ServiceTypeStreamableHTTP {
+		return nil, fmt.Errorf("OAuth is only supported for SSE and streamable HTTP services")
+	}
+	if config.AuthServerMetadataURL != "" {
+		if u, err := url.Parse(config.AuthServerMetadataURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("invalid OAuth auth_server_metadata_url: %s", config.AuthServerMetadataURL)
+		}
+	}
+	secret, err := common.DecryptSecret(config.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt OAuth client secret: %w", err)
+	}
+	config.ClientSecret = secret
+	return &config, nil
+}
+
 var MCPServiceDB *thing.Thing[*MCPService]
 
 // MCPServiceInit initializes the MCPServiceDB
@@ -185,13 +338,28 @@ func GetServiceByName(name string) (*MCPService, error) {
 	return MCPServiceDB.Where("name = ?", name).First()
 }
 
+// ValidateServiceName rejects names that cannot be told apart on the aggregate endpoint
+func ValidateServiceName(name string) error {
+	if name == "" || name == AggregateServiceName || strings.Contains(name, ServiceNameSeparator) {
+		return fmt.Errorf("%w: %q", ErrServiceNameReserved, name)
+	}
+	return nil
+}
+
 // CreateService creates a new MCP service
 func CreateService(service *MCPService) error {
+	if err := ValidateServiceName(service.Name); err != nil {
+		return err
+	}
 	return MCPServiceDB.Save(service)
 }
 
-// UpdateService updates an existing MCP service
+// UpdateService updates an existing MCP service. Services named before names were validated can
+// still be deleted.
 func UpdateService(service *MCPService) error {
+	if err := ValidateServiceName(service.Name); err != nil && !service.Deleted {
+		return err
+	}
 	return MCPServiceDB.Save(service)
 }
 
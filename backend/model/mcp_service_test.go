@@ -0,0 +1,31 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateServiceName(t *testing.T) {
+	assert.NoError(t, ValidateServiceName("github"))
+	assert.NoError(t, ValidateServiceName("my_service-2"))
+	assert.ErrorIs(t, ValidateServiceName(""), ErrServiceNameReserved)
+	assert.ErrorIs(t, ValidateServiceName(AggregateServiceName), ErrServiceNameReserved)
+	assert.ErrorIs(t, ValidateServiceName("acme__x"), ErrServiceNameReserved, "the separator would make tool names ambiguous")
+
+	assert.ErrorIs(t, CreateService(&MCPService{Name: "_all"}), ErrServiceNameReserved)
+	assert.ErrorIs(t, UpdateService(&MCPService{Name: "acme__x"}), ErrServiceNameReserved)
+}
+
+func TestUpdateServiceDeletesLegacyNames(t *testing.T) {
+	setupStatsTestDB(t)
+
+	// Saved directly, as services were before names were validated
+	legacy := &MCPService{Name: "acme__x", Type: ServiceTypeStdio}
+	require.NoError(t, MCPServiceDB.Save(legacy))
+	assert.ErrorIs(t, UpdateService(legacy), ErrServiceNameReserved)
+
+	legacy.Deleted = true
+	assert.NoError(t, UpdateService(legacy), "legacy services can still be deleted")
+}
@@ -0,0 +1,322 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/burugo/thing"
+)
+
+const (
+	// OAuthClientIDPrefix, OAuthAccessTokenPrefix and OAuthRefreshTokenPrefix make credentials issued to MCP
+	// clients recognisable, like APIKeyPrefix
+	OAuthClientIDPrefix     = "omc_"
+	OAuthAccessTokenPrefix  = "oma_"
+	OAuthRefreshTokenPrefix = "omr_"
+
+	// OAuthAccessTokenTTL and OAuthRefreshTokenTTL are the lifetimes of tokens issued to MCP clients
+	OAuthAccessTokenTTL  = time.Hour
+	OAuthRefreshTokenTTL = 30 * 24 * time.Hour
+
+	// Token endpoint authentication methods supported for registered clients (RFC 7591)
+	OAuthAuthMethodNone              = "none"
+	OAuthAuthMethodClientSecretPost  = "client_secret_post"
+	OAuthAuthMethodClientSecretBasic = "client_secret_basic"
+)
+
+// ErrOAuthInvalidGrant is returned when a refresh token is unknown, expired or issued to another client
+var ErrOAuthInvalidGrant = errors.New("invalid_grant")
+
+// ErrOAuthInvalidRedirectURI is returned when a client registers a redirect URI one-mcp will not redirect to
+var ErrOAuthInvalidRedirectURI = errors.New("invalid redirect URI")
+
+// OAuthClient is an MCP client registered with one-mcp's authorization server through dynamic client
+// registration. Public clients (token endpoint auth method "none") have no secret; for confidential clients
+// only the SHA-256 hash of the secret is stored.
+type OAuthClient struct {
+	thing.BaseModel
+	ClientID                string `db:"client_id,index:idx_oauth_client_client_id" json:"client_id"`
+	ClientSecretHash        string `db:"client_secret_hash" json:"-"`
+	ClientName              string `db:"client_name" json:"client_name"`
+	RedirectURIsJSON        string `db:"redirect_uris" json:"redirect_uris_json"` // JSON array of registered redirect URIs
+	TokenEndpointAuthMethod string `db:"token_endpoint_auth_method" json:"token_endpoint_auth_method"`
+}
+
+// TableName sets the table name for the OAuthClient model
+func (c *OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// OAuthToken is an access token issued to an MCP client on behalf of a user, with the refresh token that
+// renews it. Only hashes of the tokens are stored.
+type OAuthToken struct {
+	thing.BaseModel
+	UserID           int64     `db:"user_id,index:idx_oauth_token_user" json:"user_id"`
+	ClientID         string    `db:"client_id" json:"client_id"`
+	AccessTokenHash  string    `db:"access_token_hash,index:idx_oauth_token_access" json:"-"`
+	RefreshTokenHash string    `db:"refresh_token_hash,index:idx_oauth_token_refresh" json:"-"`
+	Scope            string    `db:"scope" json:"scope"`
+	Resource         string    `db:"resource" json:"resource"` // RFC 8707 resource the token was requested for, if any
+	ExpiresAt        time.Time `db:"expires_at" json:"expires_at"`
+	RefreshExpiresAt time.Time `db:"refresh_expires_at" json:"refresh_expires_at"`
+}
+
+// TableName sets the table name for the OAuthToken model
+func (t *OAuthToken) TableName() string {
+	return "oauth_tokens"
+}
+
+var OAuthClientDB *thing.Thing[*OAuthClient]
+var OAuthTokenDB *thing.Thing[*OAuthToken]
+
+// OAuthServerInit initializes the OAuthClientDB and OAuthTokenDB
+func OAuthServerInit() error {
+	var err error
+	OAuthClientDB, err = thing.Use[*OAuthClient]()
+	if err != nil {
+		return err
+	}
+	OAuthTokenDB, err = thing.Use[*OAuthToken]()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetRedirectURIs returns the redirect URIs the client registered
+func (c *OAuthClient) GetRedirectURIs() []string {
+	var uris []string
+	if err := json.Unmarshal([]byte(c.RedirectURIsJSON), &uris); err != nil {
+		return nil
+	}
+	return uris
+}
+
+// AllowsRedirectURI reports whether a redirect URI of an authorization request was registered by the client.
+// URIs must match exactly, except that the port of loopback redirect URIs may vary (RFC 8252 section 7.3).
+func (c *OAuthClient) AllowsRedirectURI(redirectURI string) bool {
+	requested, err := url.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+	for _, registered := range c.GetRedirectURIs() {
+		if registered == redirectURI {
+			return true
+		}
+		allowed, err := url.Parse(registered)
+		if err != nil || !isLoopbackRedirect(allowed) || !isLoopbackRedirect(requested) {
+			continue
+		}
+		if allowed.Hostname() == requested.Hostname() && allowed.Path == requested.Path && allowed.RawQuery == requested.RawQuery {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPublic reports whether the client authenticates without a secret
+func (c *OAuthClient) IsPublic() bool {
+	return c.TokenEndpointAuthMethod == OAuthAuthMethodNone
+}
+
+// ValidateSecret checks the secret a confidential client presented at the token endpoint
+func (c *OAuthClient) ValidateSecret(secret string) bool {
+	return c.ClientSecretHash != "" && secret != "" && hashAPIKey(secret) == c.ClientSecretHash
+}
+
+func isLoopbackRedirect(u *url.URL) bool {
+	host := u.Hostname()
+	return u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")
+}
+
+// validateOAuthRedirectURI accepts HTTPS URIs, HTTP loopback URIs and private-use schemes of native apps
+func validateOAuthRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Scheme == "" || u.Fragment != "" {
+		return fmt.Errorf("%w: %s", ErrOAuthInvalidRedirectURI, redirectURI)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("%w: %s", ErrOAuthInvalidRedirectURI, redirectURI)
+		}
+	case "http":
+		if !isLoopbackRedirect(u) {
+			return fmt.Errorf("%w: HTTP is only allowed for loopback addresses: %s", ErrOAuthInvalidRedirectURI, redirectURI)
+		}
+	case "javascript", "data", "file":
+		return fmt.Errorf("%w: unsupported scheme: %s", ErrOAuthInvalidRedirectURI, redirectURI)
+	}
+	return nil
+}
+
+// RegisterOAuthClient registers an MCP client and returns it with its plaintext secret, empty for public clients
+func RegisterOAuthClient(clientName string, redirectURIs []string, authMethod string) (*OAuthClient, string, error) {
+	if len(redirectURIs) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one redirect URI is required", ErrOAuthInvalidRedirectURI)
+	}
+	for _, redirectURI := range redirectURIs {
+		if err := validateOAuthRedirectURI(redirectURI); err != nil {
+			return nil, "", err
+		}
+	}
+	switch authMethod {
+	case "":
+		authMethod = OAuthAuthMethodClientSecretBasic // Default of RFC 7591
+	case OAuthAuthMethodNone, OAuthAuthMethodClientSecretPost, OAuthAuthMethodClientSecretBasic:
+	default:
+		return nil, "", fmt.Errorf("unsupported token endpoint auth method: %s", authMethod)
+	}
+	redirectURIsJSON, err := json.Marshal(redirectURIs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := &OAuthClient{
+		ClientID:                OAuthClientIDPrefix + common.GetUUID(),
+		ClientName:              clientName,
+		RedirectURIsJSON:        string(redirectURIsJSON),
+		TokenEndpointAuthMethod: authMethod,
+	}
+	secret := ""
+	if !client.IsPublic() {
+		secret = common.GetUUID() + common.GetUUID()
+		client.ClientSecretHash = hashAPIKey(secret)
+	}
+	if err := OAuthClientDB.Save(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// GetOAuthClient returns a registered client by its client ID
+func GetOAuthClient(clientID string) (*OAuthClient, error) {
+	if clientID == "" {
+		return nil, ErrRecordNotFound
+	}
+	clients, err := OAuthClientDB.Where("client_id = ?", clientID).Fetch(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(clients) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return clients[0], nil
+}
+
+// IssueOAuthToken creates an access and refresh token for a user of a client and returns them in plaintext
+func IssueOAuthToken(userID int64, clientID, scope, resource string) (*OAuthToken, string, string, error) {
+	accessToken := OAuthAccessTokenPrefix + common.GetUUID() + common.GetUUID()
+	refreshToken := OAuthRefreshTokenPrefix + common.GetUUID() + common.GetUUID()
+	now := time.Now()
+	token := &OAuthToken{
+		UserID:           userID,
+		ClientID:         clientID,
+		AccessTokenHash:  hashAPIKey(accessToken),
+		RefreshTokenHash: hashAPIKey(refreshToken),
+		Scope:            scope,
+		Resource:         resource,
+		ExpiresAt:        now.Add(OAuthAccessTokenTTL),
+		RefreshExpiresAt: now.Add(OAuthRefreshTokenTTL),
+	}
+	if err := OAuthTokenDB.Save(token); err != nil {
+		return nil, "", "", err
+	}
+	return token, accessToken, refreshToken, nil
+}
+
+// ValidateOAuthAccessToken looks up a plaintext access token and returns it with its enabled user.
+// Expired tokens and tokens of disabled users are rejected.
+func ValidateOAuthAccessToken(accessToken string) (*OAuthToken, *User) {
+	if !strings.HasPrefix(accessToken, OAuthAccessTokenPrefix) {
+		return nil, nil
+	}
+	tokens, err := OAuthTokenDB.Where("access_token_hash = ?", hashAPIKey(accessToken)).Fetch(0, 1)
+	if err != nil || len(tokens) == 0 {
+		return nil, nil
+	}
+	token := tokens[0]
+	if time.Now().After(token.ExpiresAt) {
+		return nil, nil
+	}
+	user, err := UserDB.ByID(token.UserID)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		return nil, nil
+	}
+	return token, user
+}
+
+// RefreshOAuthToken exchanges a refresh token of a client for new tokens. Refresh tokens are rotated: the
+// old pair is deleted, so a leaked refresh token can be used at most once.
+func RefreshOAuthToken(refreshToken, clientID string) (*OAuthToken, string, string, error) {
+	if !strings.HasPrefix(refreshToken, OAuthRefreshTokenPrefix) {
+		return nil, "", "", ErrOAuthInvalidGrant
+	}
+	tokens, err := OAuthTokenDB.Where("refresh_token_hash = ?", hashAPIKey(refreshToken)).Fetch(0, 1)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if len(tokens) == 0 {
+		return nil, "", "", ErrOAuthInvalidGrant
+	}
+	old := tokens[0]
+	if old.ClientID != clientID || time.Now().After(old.RefreshExpiresAt) {
+		return nil, "", "", ErrOAuthInvalidGrant
+	}
+	user, err := UserDB.ByID(old.UserID)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		return nil, "", "", ErrOAuthInvalidGrant
+	}
+	if err := OAuthTokenDB.Delete(old); err != nil {
+		return nil, "", "", err
+	}
+	return IssueOAuthToken(old.UserID, old.ClientID, old.Scope, old.Resource)
+}
+
+// PurgeExpiredOAuthTokens deletes token pairs whose refresh token has expired; their access token expired before.
+// Authorization codes are not stored here: they live in the cache, which drops them after their TTL.
+func PurgeExpiredOAuthTokens(now time.Time) (int, error) {
+	tokens, err := OAuthTokenDB.Where("refresh_expires_at < ?", now).All()
+	if err != nil {
+		return 0, err
+	}
+	for i, t := range tokens {
+		if err := OAuthTokenDB.Delete(t); err != nil {
+			return i, err
+		}
+	}
+	return len(tokens), nil
+}
+
+// RevokeOAuthToken deletes the token pair an access or refresh token belongs to (RFC 7009).
+// Unknown tokens are not an error.
+func RevokeOAuthToken(token, clientID string) error {
+	column := ""
+	switch {
+	case strings.HasPrefix(token, OAuthAccessTokenPrefix):
+		column = "access_token_hash"
+	case strings.HasPrefix(token, OAuthRefreshTokenPrefix):
+		column = "refresh_token_hash"
+	default:
+		return nil
+	}
+	tokens, err := OAuthTokenDB.Where(column+" = ?", hashAPIKey(token)).All()
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if clientID != "" && t.ClientID != clientID {
+			continue
+		}
+		if err := OAuthTokenDB.Delete(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeExpiredOAuthTokens(t *testing.T) {
+	setupStatsTestDB(t)
+
+	expired, _, _, err := IssueOAuthToken(1, "omc_client", "mcp", "")
+	require.NoError(t, err)
+	// Access token expired, refresh token still good
+	refreshable, _, _, err := IssueOAuthToken(1, "omc_client", "mcp", "")
+	require.NoError(t, err)
+
+	purged, err := PurgeExpiredOAuthTokens(time.Now().Add(OAuthAccessTokenTTL + time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged, "tokens that can still be refreshed are kept")
+
+	refreshable.RefreshExpiresAt = time.Now().Add(2 * OAuthRefreshTokenTTL)
+	require.NoError(t, OAuthTokenDB.Save(refreshable))
+	purged, err = PurgeExpiredOAuthTokens(time.Now().Add(OAuthRefreshTokenTTL + time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = OAuthTokenDB.ByID(expired.ID)
+	assert.Error(t, err)
+	_, err = OAuthTokenDB.ByID(refreshable.ID)
+	assert.NoError(t, err)
+}
@@ -56,6 +56,15 @@ func InitOptionMap() error {
 	common.OptionMap["Port"] = strconv.Itoa(*common.Port)
 	common.OptionMap["RegisterEnabled"] = strconv.FormatBool(common.RegisterEnabled)
 	common.OptionMap["EnableGzip"] = strconv.FormatBool(*common.EnableGzip)
+	common.OptionMap["StatsRetentionDays"] = strconv.Itoa(common.DefaultStatsRetentionDays)
+	common.OptionMap["StatsHourlyRetentionDays"] = strconv.Itoa(common.DefaultStatsHourlyRetentionDays)
+	common.OptionMap["CircuitBreakerThreshold"] = strconv.Itoa(common.DefaultCircuitBreakerThreshold)
+	common.OptionMap["CircuitBreakerCooldownSeconds"] = strconv.Itoa(common.DefaultCircuitBreakerCooldownSeconds)
+	common.OptionMap["UserInstanceIdleTimeoutMinutes"] = strconv.Itoa(common.DefaultUserInstanceIdleTimeoutMinutes)
+	common.OptionMap["MaxUserInstances"] = strconv.Itoa(common.DefaultMaxUserInstances)
+	common.OptionMap["MaxUserInstancesPerService"] = strconv.Itoa(common.DefaultMaxUserInstancesPerService)
+	common.OptionMap["StdioMaxRestarts"] = strconv.Itoa(common.DefaultStdioMaxRestarts)
+	common.OptionMap["MCPRegistryURL"] = common.DefaultMCPRegistryURL
 
 	if err := InitOptionMapFromDB(); err != nil {
 		common.SysError(fmt.Sprintf("Failed to initialize option map from database: %v", err))
@@ -0,0 +1,564 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/burugo/thing"
+)
+
+// StatGranularity is the bucket size of a ProxyStatRollup
+type StatGranularity string
+
+const (
+	StatGranularityHour StatGranularity = "hour"
+	StatGranularityDay  StatGranularity = "day"
+)
+
+// rollupLatencyBucketsMs are the upper bounds of the latency histogram kept with every rollup.
+// Percentiles of merged rollups (several users, tools or hours) are estimated from the merged histogram.
+var rollupLatencyBucketsMs = []int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 120000, 300000}
+
+// ProxyStatRollup aggregates ProxyRequestStat rows of one service, user and tool over an hour or a day.
+// Analytics read rollups instead of raw rows so that raw rows can be pruned by the retention policy.
+type ProxyStatRollup struct {
+	thing.BaseModel
+	Granularity          StatGranularity `db:"granularity,index" json:"granularity"`
+	BucketStart          time.Time       `db:"bucket_start,index" json:"bucket_start"`
+	ServiceID            int64           `db:"service_id,index" json:"service_id"`
+	ServiceName          string          `db:"service_name" json:"service_name"`
+	UserID               int64           `db:"user_id" json:"user_id"`
+	ToolName             string          `db:"tool_name" json:"tool_name"`
+	Count                int64           `db:"count" json:"count"`
+	ErrorCount           int64           `db:"error_count" json:"error_count"`
+	JSONRPCErrorCount    int64           `db:"jsonrpc_error_count" json:"jsonrpc_error_count"`
+	ToolErrorCount       int64           `db:"tool_error_count" json:"tool_error_count"`
+	TotalLatencyMs       int64           `db:"total_latency_ms" json:"total_latency_ms"`
+	MaxLatencyMs         int64           `db:"max_latency_ms" json:"max_latency_ms"`
+	LatencyP50Ms         int64           `db:"latency_p50_ms" json:"latency_p50_ms"`
+	LatencyP95Ms         int64           `db:"latency_p95_ms" json:"latency_p95_ms"`
+	LatencyP99Ms         int64           `db:"latency_p99_ms" json:"latency_p99_ms"`
+	RequestBytes         int64           `db:"request_bytes" json:"request_bytes"`
+	ResponseBytes        int64           `db:"response_bytes" json:"response_bytes"`
+	LatencyHistogramJSON string          `db:"latency_histogram" json:"-"` // JSON array of counts per rollupLatencyBucketsMs bucket, plus overflow
+}
+
+// TableName specifies the database table name for ProxyStatRollup.
+func (r *ProxyStatRollup) TableName() string {
+	return "proxy_stat_rollups"
+}
+
+var ProxyStatRollupDB *thing.Thing[*ProxyStatRollup]
+
+// ProxyStatRollupInit initializes the ProxyStatRollupDB
+func ProxyStatRollupInit() error {
+	var err error
+	ProxyStatRollupDB, err = thing.Use[*ProxyStatRollup]()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// latencyHistogram counts latencies per rollupLatencyBucketsMs bucket; the last slot counts overflows
+type latencyHistogram []int64
+
+func newLatencyHistogram() latencyHistogram {
+	return make(latencyHistogram, len(rollupLatencyBucketsMs)+1)
+}
+
+func (h latencyHistogram) observe(latencyMs int64) {
+	i := sort.Search(len(rollupLatencyBucketsMs), func(i int) bool { return rollupLatencyBucketsMs[i] >= latencyMs })
+	h[i]++
+}
+
+func (h latencyHistogram) merge(other latencyHistogram) {
+	for i := range h {
+		if i < len(other) {
+			h[i] += other[i]
+		}
+	}
+}
+
+// percentile estimates the p-th percentile (0-1) as the upper bound of the bucket holding it, capped at maxMs
+func (h latencyHistogram) percentile(p float64, maxMs int64) int64 {
+	var total int64
+	for _, n := range h {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(float64(total) * p)
+	if rank >= total {
+		rank = total - 1
+	}
+	var cumulative int64
+	for i, n := range h {
+		cumulative += n
+		if cumulative > rank {
+			if i < len(rollupLatencyBucketsMs) && rollupLatencyBucketsMs[i] < maxMs {
+				return rollupLatencyBucketsMs[i]
+			}
+			return maxMs
+		}
+	}
+	return maxMs
+}
+
+// histogram decodes the stored latency histogram
+func (r *ProxyStatRollup) histogram() latencyHistogram {
+	h := newLatencyHistogram()
+	if r.LatencyHistogramJSON == "" {
+		return h
+	}
+	var stored []int64
+	if err := json.Unmarshal([]byte(r.LatencyHistogramJSON), &stored); err != nil {
+		return h
+	}
+	h.merge(stored)
+	return h
+}
+
+func (r *ProxyStatRollup) setHistogram(h latencyHistogram) {
+	data, _ := json.Marshal(h)
+	r.LatencyHistogramJSON = string(data)
+}
+
+type rollupKey struct {
+	serviceID int64
+	userID    int64
+	toolName  string
+}
+
+// sortedLatencyPercentile returns the p-th percentile (0-1) of latencies sorted ascending
+func sortedLatencyPercentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(float64(len(sorted)) * p)
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+// buildRollupsFromStats aggregates raw stats into rollups per service, user and tool with exact percentiles
+func buildRollupsFromStats(granularity StatGranularity, bucketStart time.Time, stats []*ProxyRequestStat) []*ProxyStatRollup {
+	rollups := make(map[rollupKey]*ProxyStatRollup)
+	latencies := make(map[rollupKey][]int64)
+	histograms := make(map[rollupKey]latencyHistogram)
+	var keys []rollupKey
+
+	for _, stat := range stats {
+		key := rollupKey{serviceID: stat.ServiceID, userID: stat.UserID, toolName: stat.ToolName}
+		rollup, ok := rollups[key]
+		if !ok {
+			rollup = &ProxyStatRollup{
+				Granularity: granularity,
+				BucketStart: bucketStart,
+				ServiceID:   stat.ServiceID,
+				ServiceName: stat.ServiceName,
+				UserID:      stat.UserID,
+				ToolName:    stat.ToolName,
+			}
+			rollups[key] = rollup
+			histograms[key] = newLatencyHistogram()
+			keys = append(keys, key)
+		}
+		rollup.Count++
+		if !stat.Success {
+			rollup.ErrorCount++
+		}
+		if stat.JSONRPCError != 0 {
+			rollup.JSONRPCErrorCount++
+		}
+		if stat.ToolIsError {
+			rollup.ToolErrorCount++
+		}
+		rollup.TotalLatencyMs += stat.ResponseTimeMs
+		if stat.ResponseTimeMs > rollup.MaxLatencyMs {
+			rollup.MaxLatencyMs = stat.ResponseTimeMs
+		}
+		rollup.RequestBytes += stat.RequestBytes
+		rollup.ResponseBytes += stat.ResponseBytes
+		latencies[key] = append(latencies[key], stat.ResponseTimeMs)
+		histograms[key].observe(stat.ResponseTimeMs)
+	}
+
+	result := make([]*ProxyStatRollup, 0, len(keys))
+	for _, key := range keys {
+		rollup := rollups[key]
+		sorted := latencies[key]
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		rollup.LatencyP50Ms = sortedLatencyPercentile(sorted, 0.50)
+		rollup.LatencyP95Ms = sortedLatencyPercentile(sorted, 0.95)
+		rollup.LatencyP99Ms = sortedLatencyPercentile(sorted, 0.99)
+		rollup.setHistogram(histograms[key])
+		result = append(result, rollup)
+	}
+	return result
+}
+
+// RollupSummary is the merged view of several rollups, e.g. one time bucket or one tool over a time range
+type RollupSummary struct {
+	Count         int64
+	ErrorCount    int64
+	JSONRPCErrors int64
+	ToolErrors    int64
+	TotalLatency  int64
+	MaxLatencyMs  int64
+	RequestBytes  int64
+	ResponseBytes int64
+	histogram     latencyHistogram
+}
+
+// Add merges a rollup into the summary
+func (s *RollupSummary) Add(r *ProxyStatRollup) {
+	if s.histogram == nil {
+		s.histogram = newLatencyHistogram()
+	}
+	s.Count += r.Count
+	s.ErrorCount += r.ErrorCount
+	s.JSONRPCErrors += r.JSONRPCErrorCount
+	s.ToolErrors += r.ToolErrorCount
+	s.TotalLatency += r.TotalLatencyMs
+	if r.MaxLatencyMs > s.MaxLatencyMs {
+		s.MaxLatencyMs = r.MaxLatencyMs
+	}
+	s.RequestBytes += r.RequestBytes
+	s.ResponseBytes += r.ResponseBytes
+	s.histogram.merge(r.histogram())
+}
+
+// AvgLatencyMs returns the mean latency of the merged rollups
+func (s *RollupSummary) AvgLatencyMs() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.TotalLatency) / float64(s.Count)
+}
+
+// ErrorRatePercentage returns the share of failed requests in percent
+func (s *RollupSummary) ErrorRatePercentage() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.ErrorCount) / float64(s.Count) * 100
+}
+
+// LatencyPercentileMs estimates a latency percentile (0-1) from the merged histograms
+func (s *RollupSummary) LatencyPercentileMs(p float64) int64 {
+	if s.histogram == nil {
+		return 0
+	}
+	return s.histogram.percentile(p, s.MaxLatencyMs)
+}
+
+// mergeRollups combines rollups of the same service, user and tool into rollups of a coarser bucket
+func mergeRollups(granularity StatGranularity, bucketStart time.Time, rows []*ProxyStatRollup) []*ProxyStatRollup {
+	summaries := make(map[rollupKey]*RollupSummary)
+	templates := make(map[rollupKey]*ProxyStatRollup)
+	var keys []rollupKey
+	for _, row := range rows {
+		key := rollupKey{serviceID: row.ServiceID, userID: row.UserID, toolName: row.ToolName}
+		if _, ok := summaries[key]; !ok {
+			summaries[key] = &RollupSummary{}
+			templates[key] = row
+			keys = append(keys, key)
+		}
+		summaries[key].Add(row)
+	}
+
+	result := make([]*ProxyStatRollup, 0, len(keys))
+	for _, key := range keys {
+		s, tmpl := summaries[key], templates[key]
+		rollup := &ProxyStatRollup{
+			Granularity:       granularity,
+			BucketStart:       bucketStart,
+			ServiceID:         tmpl.ServiceID,
+			ServiceName:       tmpl.ServiceName,
+			UserID:            tmpl.UserID,
+			ToolName:          tmpl.ToolName,
+			Count:             s.Count,
+			ErrorCount:        s.ErrorCount,
+			JSONRPCErrorCount: s.JSONRPCErrors,
+			ToolErrorCount:    s.ToolErrors,
+			TotalLatencyMs:    s.TotalLatency,
+			MaxLatencyMs:      s.MaxLatencyMs,
+			LatencyP50Ms:      s.LatencyPercentileMs(0.50),
+			LatencyP95Ms:      s.LatencyPercentileMs(0.95),
+			LatencyP99Ms:      s.LatencyPercentileMs(0.99),
+			RequestBytes:      s.RequestBytes,
+			ResponseBytes:     s.ResponseBytes,
+		}
+		rollup.setHistogram(s.histogram)
+		result = append(result, rollup)
+	}
+	return result
+}
+
+// StartOfStatDay returns the start of the local day containing t; daily rollups use local days.
+// Days are merged from whole UTC hours, so in time zones whose offset is not a whole number of hours (e.g. UTC+5:30)
+// the hour that straddles local midnight is counted in the day it starts in. Changing the server time zone does
+// not move days that were already rolled up.
+func StartOfStatDay(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// replaceRollups deletes the rollups of a bucket and saves new ones, so re-running a bucket is idempotent
+func replaceRollups(granularity StatGranularity, bucketStart time.Time, rollups []*ProxyStatRollup) error {
+	existing, err := ProxyStatRollupDB.Where("granularity = ? AND bucket_start = ?", granularity, bucketStart).All()
+	if err != nil {
+		return err
+	}
+	for _, old := range existing {
+		if err := ProxyStatRollupDB.Delete(old); err != nil {
+			return err
+		}
+	}
+	for _, rollup := range rollups {
+		if err := ProxyStatRollupDB.Save(rollup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latestRollupBucket returns the start of the most recent rollup of a granularity
+func latestRollupBucket(granularity StatGranularity) (time.Time, bool, error) {
+	rows, err := ProxyStatRollupDB.Where("granularity = ?", granularity).Order("bucket_start DESC").Fetch(0, 1)
+	if err != nil || len(rows) == 0 {
+		return time.Time{}, false, err
+	}
+	return rows[0].BucketStart, true, nil
+}
+
+// RollupWatermark returns the end of the last rolled up hour; raw rows at or after it have no rollup yet
+func RollupWatermark() (time.Time, error) {
+	latest, found, err := latestRollupBucket(StatGranularityHour)
+	if err != nil || !found {
+		return time.Time{}, err
+	}
+	return latest.Add(time.Hour), nil
+}
+
+// RunStatRollups rolls up every complete hour and day that has not been rolled up yet.
+// Empty hours are skipped by jumping to the next raw row, so long idle periods cost a single query.
+func RunStatRollups(now time.Time) (int, error) {
+	statThing, err := GetProxyRequestStatThing()
+	if err != nil {
+		return 0, err
+	}
+	currentHour := now.Truncate(time.Hour)
+	rolled := 0
+
+	cursor, err := RollupWatermark()
+	if err != nil {
+		return rolled, err
+	}
+	for {
+		next, err := statThing.Where("created_at >= ?", cursor).Order("created_at ASC").Fetch(0, 1)
+		if err != nil {
+			return rolled, err
+		}
+		if len(next) == 0 {
+			break
+		}
+		hour := next[0].CreatedAt.Truncate(time.Hour)
+		if !hour.Before(currentHour) {
+			break
+		}
+		stats, err := statThing.Where("created_at >= ? AND created_at < ?", hour, hour.Add(time.Hour)).All()
+		if err != nil {
+			return rolled, err
+		}
+		if err := replaceRollups(StatGranularityHour, hour, buildRollupsFromStats(StatGranularityHour, hour, stats)); err != nil {
+			return rolled, fmt.Errorf("roll up hour %s: %w", hour.Format(time.RFC3339), err)
+		}
+		rolled++
+		cursor = hour.Add(time.Hour)
+	}
+
+	// Days are rolled up from hourly rollups once every hour of the day is complete
+	currentDay := StartOfStatDay(now)
+	dayCursor := time.Time{}
+	if latestDay, found, err := latestRollupBucket(StatGranularityDay); err != nil {
+		return rolled, err
+	} else if found {
+		dayCursor = StartOfStatDay(latestDay).AddDate(0, 0, 1)
+	}
+	for {
+		next, err := ProxyStatRollupDB.Where("granularity = ? AND bucket_start >= ?", StatGranularityHour, dayCursor).Order("bucket_start ASC").Fetch(0, 1)
+		if err != nil {
+			return rolled, err
+		}
+		if len(next) == 0 {
+			break
+		}
+		day := StartOfStatDay(next[0].BucketStart)
+		if !day.Before(currentDay) {
+			break
+		}
+		dayEnd := day.AddDate(0, 0, 1)
+		hourly, err := ProxyStatRollupDB.Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", StatGranularityHour, day, dayEnd).All()
+		if err != nil {
+			return rolled, err
+		}
+		if err := replaceRollups(StatGranularityDay, day, mergeRollups(StatGranularityDay, day, hourly)); err != nil {
+			return rolled, fmt.Errorf("roll up day %s: %w", day.Format("2006-01-02"), err)
+		}
+		rolled++
+		dayCursor = dayEnd
+	}
+	return rolled, nil
+}
+
+// PruneStats deletes raw stats older than rawRetention and hourly rollups older than hourlyRetention.
+// A zero retention keeps rows forever. Raw rows that have not been rolled up yet are never deleted.
+func PruneStats(now time.Time, rawRetention, hourlyRetention time.Duration) error {
+	db := thing.GlobalDB()
+	if db == nil {
+		return fmt.Errorf("database is not initialized")
+	}
+	ctx := context.Background()
+
+	if rawRetention > 0 {
+		cutoff := now.Add(-rawRetention)
+		watermark, err := RollupWatermark()
+		if err != nil {
+			return err
+		}
+		if watermark.Before(cutoff) {
+			cutoff = watermark
+		}
+		result, err := db.Exec(ctx, "DELETE FROM proxy_request_stats WHERE created_at < ?", cutoff)
+		if err != nil {
+			return fmt.Errorf("prune raw stats: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			common.SysLog(fmt.Sprintf("[StatsRetention] Pruned %d raw request stats older than %s", n, cutoff.Format(time.RFC3339)))
+		}
+	}
+
+	if hourlyRetention > 0 {
+		cutoff := now.Add(-hourlyRetention)
+		result, err := db.Exec(ctx, "DELETE FROM proxy_stat_rollups WHERE granularity = ? AND bucket_start < ?", StatGranularityHour, cutoff)
+		if err != nil {
+			return fmt.Errorf("prune hourly rollups: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			common.SysLog(fmt.Sprintf("[StatsRetention] Pruned %d hourly rollups older than %s", n, cutoff.Format(time.RFC3339)))
+		}
+	}
+	return nil
+}
+
+// QueryStatRollups returns rollups of the given granularity whose bucket lies in [from, to), for one service
+// (serviceID > 0) or all services. Buckets that have not been rolled up yet, such as the current hour and day,
+// are computed on the fly from raw rows and hourly rollups so results are always up to date. The daily view reads
+// stored daily rollups first and only reads hourly rows for the days after the last of them.
+func QueryStatRollups(granularity StatGranularity, from, to time.Time, serviceID int64) ([]*ProxyStatRollup, error) {
+	if granularity == StatGranularityHour {
+		return queryHourlyRollups(from, to, serviceID)
+	}
+
+	// Daily view: stored daily rollups, and days without one (e.g. today) merged from the hourly view
+	dayFrom := StartOfStatDay(from)
+	where, args := statServiceFilter("granularity = ? AND bucket_start >= ? AND bucket_start < ?", []interface{}{StatGranularityDay, dayFrom, to}, serviceID)
+	daily, err := ProxyStatRollupDB.Where(where, args...).Order("bucket_start ASC").All()
+	if err != nil {
+		return nil, err
+	}
+	// Days are rolled up in order, so no day before the last stored one is missing its rollup
+	hourlyFrom := dayFrom
+	storedDays := make(map[time.Time]bool)
+	for _, row := range daily {
+		day := StartOfStatDay(row.BucketStart)
+		storedDays[day] = true
+		if next := day.AddDate(0, 0, 1); next.After(hourlyFrom) {
+			hourlyFrom = next
+		}
+	}
+	if !hourlyFrom.Before(to) {
+		return daily, nil
+	}
+
+	hourly, err := queryHourlyRollups(hourlyFrom, to, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	hourlyByDay := make(map[time.Time][]*ProxyStatRollup)
+	var days []time.Time
+	for _, row := range hourly {
+		day := StartOfStatDay(row.BucketStart)
+		if storedDays[day] {
+			continue
+		}
+		if _, ok := hourlyByDay[day]; !ok {
+			days = append(days, day)
+		}
+		hourlyByDay[day] = append(hourlyByDay[day], row)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	for _, day := range days {
+		daily = append(daily, mergeRollups(StatGranularityDay, day, hourlyByDay[day])...)
+	}
+	return daily, nil
+}
+
+// statServiceFilter narrows a query to one service when serviceID > 0
+func statServiceFilter(where string, args []interface{}, serviceID int64) (string, []interface{}) {
+	if serviceID > 0 {
+		return where + " AND service_id = ?", append(args, serviceID)
+	}
+	return where, args
+}
+
+// queryHourlyRollups returns the stored hourly rollups in [from, to) plus the tail of raw rows after the watermark
+// rolled up on the fly
+func queryHourlyRollups(from, to time.Time, serviceID int64) ([]*ProxyStatRollup, error) {
+	watermark, err := RollupWatermark()
+	if err != nil {
+		return nil, err
+	}
+	where, args := statServiceFilter("granularity = ? AND bucket_start >= ? AND bucket_start < ?", []interface{}{StatGranularityHour, from, to}, serviceID)
+	hourly, err := ProxyStatRollupDB.Where(where, args...).Order("bucket_start ASC").All()
+	if err != nil {
+		return nil, err
+	}
+
+	statThing, err := GetProxyRequestStatThing()
+	if err != nil {
+		return nil, err
+	}
+	tailFrom := watermark
+	if tailFrom.Before(from) {
+		tailFrom = from
+	}
+	where, args = statServiceFilter("created_at >= ? AND created_at < ?", []interface{}{tailFrom, to}, serviceID)
+	tail, err := statThing.Where(where, args...).All()
+	if err != nil {
+		return nil, err
+	}
+	byHour := make(map[time.Time][]*ProxyRequestStat)
+	var hours []time.Time
+	for _, stat := range tail {
+		hour := stat.CreatedAt.Truncate(time.Hour)
+		if _, ok := byHour[hour]; !ok {
+			hours = append(hours, hour)
+		}
+		byHour[hour] = append(byHour[hour], stat)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+	for _, hour := range hours {
+		hourly = append(hourly, buildRollupsFromStats(StatGranularityHour, hour, byHour[hour])...)
+	}
+	return hourly, nil
+}
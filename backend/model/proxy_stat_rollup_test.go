@@ -0,0 +1,111 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupStatsTestDB(t *testing.T) {
+	originalPath := common.SQLitePath
+	common.SQLitePath = ":memory:"
+	require.NoError(t, InitDB())
+	t.Cleanup(func() {
+		common.SQLitePath = originalPath
+		common.OptionMap = make(map[string]string)
+	})
+}
+
+func saveStatAt(t *testing.T, at time.Time, tool string, latencyMs int64, success bool) {
+	statThing, err := GetProxyRequestStatThing()
+	require.NoError(t, err)
+	stat := &ProxyRequestStat{ServiceID: 1, ServiceName: "github", UserID: 2, Method: "tools/call", ToolName: tool, ResponseTimeMs: latencyMs, Success: success, StatusCode: 200}
+	stat.CreatedAt = at
+	require.NoError(t, statThing.Save(stat))
+	// Save sets CreatedAt for new rows; backdate it for the test
+	stat.CreatedAt = at
+	require.NoError(t, statThing.Save(stat))
+}
+
+func TestRunStatRollupsAndQuery(t *testing.T) {
+	setupStatsTestDB(t)
+
+	now := time.Now()
+	yesterday := StartOfStatDay(now).AddDate(0, 0, -1).Add(10 * time.Hour)
+	saveStatAt(t, yesterday, "search", 40, true)
+	saveStatAt(t, yesterday.Add(10*time.Minute), "search", 60, false)
+	saveStatAt(t, yesterday.Add(time.Hour), "deploy", 900, true)
+	saveStatAt(t, now, "search", 20, true) // current hour, not rolled up yet
+
+	rolled, err := RunStatRollups(now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, rolled, "two hours and one day")
+
+	rolled, err = RunStatRollups(now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, rolled, "rolling up is incremental")
+
+	hourly, err := QueryStatRollups(StatGranularityHour, yesterday.Add(-time.Hour), now.Add(time.Minute), 1)
+	require.NoError(t, err)
+	var total int64
+	for _, r := range hourly {
+		total += r.Count
+	}
+	assert.Equal(t, int64(4), total, "stored hourly rollups plus the live tail")
+
+	daily, err := QueryStatRollups(StatGranularityDay, yesterday.Add(-time.Hour), now.Add(time.Minute), 1)
+	require.NoError(t, err)
+	byDayTool := make(map[string]*ProxyStatRollup)
+	for _, r := range daily {
+		byDayTool[StartOfStatDay(r.BucketStart).Format("2006-01-02")+"/"+r.ToolName] = r
+	}
+	search := byDayTool[StartOfStatDay(yesterday).Format("2006-01-02")+"/search"]
+	require.NotNil(t, search)
+	assert.Equal(t, int64(2), search.Count)
+	assert.Equal(t, int64(1), search.ErrorCount)
+	assert.Equal(t, int64(100), search.TotalLatencyMs)
+	today := byDayTool[StartOfStatDay(now).Format("2006-01-02")+"/search"]
+	require.NotNil(t, today, "today is merged on the fly")
+	assert.Equal(t, int64(1), today.Count)
+
+	// Raw rows that are rolled up and past retention are pruned, the live tail is kept
+	require.NoError(t, PruneStats(now, time.Hour, 0))
+	statThing, _ := GetProxyRequestStatThing()
+	remaining, err := statThing.Where("service_id = ?", 1).All()
+	require.NoError(t, err)
+	assert.Len(t, remaining, 1)
+
+	// Stored days are read from their daily rollup once the hourly rows are pruned
+	require.NoError(t, PruneStats(now, 0, time.Minute))
+	daily, err = QueryStatRollups(StatGranularityDay, yesterday.Add(-time.Hour), now.Add(time.Minute), 1)
+	require.NoError(t, err)
+	var yesterdayCount int64
+	for _, r := range daily {
+		if StartOfStatDay(r.BucketStart).Equal(StartOfStatDay(yesterday)) {
+			yesterdayCount += r.Count
+		}
+	}
+	assert.Equal(t, int64(3), yesterdayCount)
+}
+
+func TestRollupSummaryPercentiles(t *testing.T) {
+	var summary RollupSummary
+	rows := buildRollupsFromStats(StatGranularityHour, time.Now(), []*ProxyRequestStat{
+		{ServiceID: 1, ToolName: "a", ResponseTimeMs: 8, Success: true},
+		{ServiceID: 1, ToolName: "a", ResponseTimeMs: 80, Success: true},
+		{ServiceID: 1, ToolName: "b", ResponseTimeMs: 4000, Success: false},
+	})
+	require.Len(t, rows, 2)
+	for _, r := range rows {
+		summary.Add(r)
+	}
+	assert.Equal(t, int64(3), summary.Count)
+	assert.Equal(t, int64(10), summary.LatencyPercentileMs(0.10))
+	assert.Equal(t, int64(100), summary.LatencyPercentileMs(0.50))
+	assert.Equal(t, int64(4000), summary.LatencyPercentileMs(0.99), "capped at the observed maximum")
+	assert.InDelta(t, 33.33, summary.ErrorRatePercentage(), 0.01)
+}
@@ -33,7 +33,12 @@ type ProxyRequestStat struct {
 	RequestPath     string           `db:"request_path"`
 	ResponseTimeMs  int64            `db:"response_time_ms"`
 	StatusCode      int              `db:"status_code"`
-	Success         bool             `db:"success,index"`
+	Success         bool             `db:"success,index"`                // HTTP 2xx without JSON-RPC error and without a tool isError result
+	ToolName        string           `db:"tool_name,index,default:''"`   // Upstream tool name for tools/call
+	JSONRPCError    int              `db:"jsonrpc_error_code,default:0"` // JSON-RPC error code of the response, 0 if none or unknown
+	RequestBytes    int64            `db:"request_bytes,default:0"`      // Size of the JSON-RPC request body
+	ResponseBytes   int64            `db:"response_bytes,default:0"`     // Size of the response (the stream event for the SSE transport)
+	ToolIsError     bool             `db:"tool_is_error,default:false"`  // The tool result had isError set
 	// CreatedAt from BaseModel will be used for the timestamp of the request
 }
 
@@ -75,27 +80,17 @@ func GetProxyRequestStatThing() (*thing.Thing[*ProxyRequestStat], error) {
 	return proxyRequestStatThing, nil
 }
 
-// RecordRequestStat creates and saves a ProxyRequestStat entry.
+// RecordRequestStat saves a ProxyRequestStat entry and updates the daily request counters in cache.
 // It will degrade gracefully (log and not save) if the ORM instance is not initialized.
-func RecordRequestStat(serviceID int64, serviceName string, userID int64, reqType ProxyRequestType, method string, requestPath string, responseTimeMs int64, statusCode int, success bool) {
+func RecordRequestStat(stat ProxyRequestStat) {
+	serviceID, serviceName, userID, statusCode := stat.ServiceID, stat.ServiceName, stat.UserID, stat.StatusCode
+
 	statThing, err := GetProxyRequestStatThing()
 	if err != nil {
 		common.SysError(fmt.Sprintf("Failed to get ProxyRequestStatThing, cannot record stat: %v", err))
 		return
 	}
 
-	stat := ProxyRequestStat{
-		ServiceID:      serviceID,
-		ServiceName:    serviceName,
-		UserID:         userID,
-		RequestType:    reqType,
-		Method:         method,
-		RequestPath:    requestPath,
-		ResponseTimeMs: responseTimeMs,
-		StatusCode:     statusCode,
-		Success:        success,
-	}
-
 	if err := statThing.Save(&stat); err != nil {
 		common.SysError(fmt.Sprintf("Error saving ProxyRequestStat: %v", err))
 		// Do not return here, try to update cache even if DB save fails for some reason?
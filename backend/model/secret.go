@@ -0,0 +1,225 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"one-mcp/backend/common"
+
+	"github.com/burugo/thing"
+)
+
+var registerSecretHooksOnce sync.Once
+
+// transformJSONMapValues applies fn to every value of a JSON object of strings
+func transformJSONMapValues(raw string, fn func(string) (string, error)) (string, error) {
+	if raw == "" || raw == "{}" {
+		return raw, nil
+	}
+	var values map[string]string
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return "", err
+	}
+	for k, v := range values {
+		transformed, err := fn(v)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", k, err)
+		}
+		values[k] = transformed
+	}
+	out, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// transformOAuthClientSecret applies fn to the client secret of an OAuthJSON, leaving the other fields as they are
+func transformOAuthClientSecret(raw string, fn func(string) (string, error)) (string, error) {
+	if raw == "" || raw == "{}" {
+		return raw, nil
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		return "", err
+	}
+	secret, ok := config["client_secret"].(string)
+	if !ok || secret == "" {
+		return raw, nil
+	}
+	transformed, err := fn(secret)
+	if err != nil {
+		return "", fmt.Errorf("client_secret: %w", err)
+	}
+	config["client_secret"] = transformed
+	out, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// EncryptJSONMapValues encrypts every value of a JSON object such as DefaultEnvsJSON or HeadersJSON
+func EncryptJSONMapValues(raw string) (string, error) {
+	return transformJSONMapValues(raw, common.EncryptSecret)
+}
+
+// DecryptJSONMapValues decrypts every value of a JSON object such as DefaultEnvsJSON or HeadersJSON
+func DecryptJSONMapValues(raw string) (string, error) {
+	return transformJSONMapValues(raw, common.DecryptSecret)
+}
+
+// DecryptJSONMap decrypts a JSON object of strings into a map
+func DecryptJSONMap(raw string) (map[string]string, error) {
+	values := make(map[string]string)
+	if raw == "" || raw == "{}" {
+		return values, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		plaintext, err := common.DecryptSecret(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		values[k] = plaintext
+	}
+	return values, nil
+}
+
+// encryptSecretsBeforeSave encrypts secret-bearing columns of models before they are written
+func encryptSecretsBeforeSave(ctx context.Context, eventType thing.EventType, m interface{}, eventData interface{}) error {
+	if !common.SecretEncryptionEnabled() {
+		return nil
+	}
+	switch v := m.(type) {
+	case *MCPService:
+		// Malformed JSON is stored as-is (it cannot be used at runtime either) rather than failing the save
+		if envs, err := EncryptJSONMapValues(v.DefaultEnvsJSON); err == nil {
+			v.DefaultEnvsJSON = envs
+		} else {
+			common.SysError(fmt.Sprintf("Failed to encrypt default envs of service %s: %v", v.Name, err))
+		}
+		if headers, err := EncryptJSONMapValues(v.HeadersJSON); err == nil {
+			v.HeadersJSON = headers
+		} else {
+			common.SysError(fmt.Sprintf("Failed to encrypt headers of service %s: %v", v.Name, err))
+		}
+		if oauth, err := transformOAuthClientSecret(v.OAuthJSON, common.EncryptSecret); err == nil {
+			v.OAuthJSON = oauth
+		} else {
+			common.SysError(fmt.Sprintf("Failed to encrypt OAuth client secret of service %s: %v", v.Name, err))
+		}
+	case *UpstreamOAuthToken:
+		for _, field := range []*string{&v.AccessToken, &v.RefreshToken, &v.ClientSecret} {
+			value, err := common.EncryptSecret(*field)
+			if err != nil {
+				return fmt.Errorf("encrypt OAuth token of user %d for service %d: %w", v.UserID, v.ServiceID, err)
+			}
+			*field = value
+		}
+	case *UserConfig:
+		value, err := common.EncryptSecret(v.Value)
+		if err != nil {
+			return fmt.Errorf("encrypt user config %d: %w", v.ConfigID, err)
+		}
+		v.Value = value
+	}
+	return nil
+}
+
+// registerSecretHooks makes encryption at rest transparent for every writer of the secret columns
+func registerSecretHooks() {
+	registerSecretHooksOnce.Do(func() {
+		thing.RegisterListener(thing.EventTypeBeforeSave, encryptSecretsBeforeSave)
+		if !common.SecretEncryptionEnabled() {
+			common.SysLog("WARNING: SECRET_MASTER_KEY is not set, env vars and headers are stored in plaintext")
+		}
+	})
+}
+
+// RotateSecrets re-wraps every stored secret with the current master key.
+// Values written before encryption was enabled are encrypted as well. It returns the number of updated rows.
+func RotateSecrets() (int, error) {
+	if !common.SecretEncryptionEnabled() {
+		return 0, fmt.Errorf("SECRET_MASTER_KEY must be set to rotate secrets")
+	}
+	updated := 0
+
+	services, err := MCPServiceDB.Order("id ASC").All()
+	if err != nil {
+		return updated, err
+	}
+	for _, svc := range services {
+		envs, err := transformJSONMapValues(svc.DefaultEnvsJSON, common.RewrapSecret)
+		if err != nil {
+			return updated, fmt.Errorf("rotate default envs of service %s: %w", svc.Name, err)
+		}
+		headers, err := transformJSONMapValues(svc.HeadersJSON, common.RewrapSecret)
+		if err != nil {
+			return updated, fmt.Errorf("rotate headers of service %s: %w", svc.Name, err)
+		}
+		oauth, err := transformOAuthClientSecret(svc.OAuthJSON, common.RewrapSecret)
+		if err != nil {
+			return updated, fmt.Errorf("rotate OAuth client secret of service %s: %w", svc.Name, err)
+		}
+		if envs == svc.DefaultEnvsJSON && headers == svc.HeadersJSON && oauth == svc.OAuthJSON {
+			continue
+		}
+		svc.DefaultEnvsJSON = envs
+		svc.HeadersJSON = headers
+		svc.OAuthJSON = oauth
+		if err := MCPServiceDB.Save(svc); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	configs, err := UserConfigDB.Order("id ASC").All()
+	if err != nil {
+		return updated, err
+	}
+	for _, uc := range configs {
+		value, err := common.RewrapSecret(uc.Value)
+		if err != nil {
+			return updated, fmt.Errorf("rotate user config %d: %w", uc.ID, err)
+		}
+		if value == uc.Value {
+			continue
+		}
+		uc.Value = value
+		if err := UserConfigDB.Save(uc); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	tokens, err := UpstreamOAuthTokenDB.Order("id ASC").All()
+	if err != nil {
+		return updated, err
+	}
+	for _, token := range tokens {
+		changed := false
+		for _, field := range []*string{&token.AccessToken, &token.RefreshToken, &token.ClientSecret} {
+			value, err := common.RewrapSecret(*field)
+			if err != nil {
+				return updated, fmt.Errorf("rotate OAuth token %d: %w", token.ID, err)
+			}
+			if value != *field {
+				*field = value
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := UpstreamOAuthTokenDB.Save(token); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"testing"
+
+	"one-mcp/backend/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretEncryptionAndRotation(t *testing.T) {
+	defer common.SetMasterKeys("")
+
+	common.SetMasterKeys("old-master-key")
+	encrypted, err := EncryptJSONMapValues(`{"GITHUB_TOKEN":"ghp_1234567890"}`)
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "ghp_1234567890")
+
+	values, err := DecryptJSONMap(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "ghp_1234567890", values["GITHUB_TOKEN"])
+
+	// Rotate: the old key only decrypts, the new key wraps
+	common.SetMasterKeys("new-master-key", "old-master-key")
+	rotated, err := transformJSONMapValues(encrypted, common.RewrapSecret)
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, rotated)
+
+	common.SetMasterKeys("new-master-key")
+	_, err = DecryptJSONMap(encrypted)
+	assert.Error(t, err, "values wrapped with a retired key cannot be read")
+	values, err = DecryptJSONMap(rotated)
+	require.NoError(t, err)
+	assert.Equal(t, "ghp_1234567890", values["GITHUB_TOKEN"])
+
+	// Plaintext written before encryption was enabled stays readable
+	values, err = DecryptJSONMap(`{"API_URL":"https://example.com"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", values["API_URL"])
+}
+
+func TestMaskSecret(t *testing.T) {
+	assert.Equal(t, "", common.MaskSecret(""))
+	assert.Equal(t, common.SecretMask, common.MaskSecret("short"))
+	assert.Equal(t, common.SecretMask+"7890", common.MaskSecret("ghp_1234567890"))
+	assert.True(t, common.IsMaskedSecret(common.MaskSecret("ghp_1234567890")))
+	assert.False(t, common.IsMaskedSecret("ghp_1234567890"))
+}
@@ -0,0 +1,165 @@
+package model
+
+import (
+	"errors"
+	"path"
+
+	"github.com/burugo/thing"
+)
+
+// ToolPolicyScope defines who a tool policy applies to
+type ToolPolicyScope string
+
+const (
+	// ToolPolicyScopeService applies to every user of the service
+	ToolPolicyScopeService ToolPolicyScope = "service"
+	// ToolPolicyScopeRole applies to users with the given role
+	ToolPolicyScopeRole ToolPolicyScope = "role"
+	// ToolPolicyScopeUser applies to a single user
+	ToolPolicyScopeUser ToolPolicyScope = "user"
+)
+
+// ToolPolicyAction defines whether a matching tool is allowed or denied
+type ToolPolicyAction string
+
+const (
+	ToolPolicyAllow ToolPolicyAction = "allow"
+	ToolPolicyDeny  ToolPolicyAction = "deny"
+)
+
+// ToolPolicy restricts which upstream tools of a service a user may list and call.
+// ToolName supports shell-style wildcards (e.g. "delete_*", "*").
+type ToolPolicy struct {
+	thing.BaseModel
+	ServiceID int64            `db:"service_id,index:idx_tool_policy_service" json:"service_id"`
+	Scope     ToolPolicyScope  `db:"scope" json:"scope"`
+	UserID    int64            `db:"user_id" json:"user_id"`
+	Role      int              `db:"role" json:"role"`
+	ToolName  string           `db:"tool_name" json:"tool_name"`
+	Action    ToolPolicyAction `db:"action" json:"action"`
+}
+
+// TableName sets the table name for the ToolPolicy model
+func (p *ToolPolicy) TableName() string {
+	return "tool_policies"
+}
+
+var ToolPolicyDB *thing.Thing[*ToolPolicy]
+
+// ToolPolicyInit initializes the ToolPolicyDB
+func ToolPolicyInit() error {
+	var err error
+	ToolPolicyDB, err = thing.Use[*ToolPolicy]()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate checks that the policy has a known scope, action and a tool pattern
+func (p *ToolPolicy) Validate() error {
+	if p.ServiceID <= 0 {
+		return errors.New("service_id is required")
+	}
+	if p.ToolName == "" {
+		return errors.New("tool_name is required")
+	}
+	if _, err := path.Match(p.ToolName, ""); err != nil {
+		return errors.New("tool_name is not a valid pattern")
+	}
+	switch p.Action {
+	case ToolPolicyAllow, ToolPolicyDeny:
+	default:
+		return errors.New("action must be allow or deny")
+	}
+	switch p.Scope {
+	case ToolPolicyScopeService:
+	case ToolPolicyScopeRole:
+	case ToolPolicyScopeUser:
+		if p.UserID <= 0 {
+			return errors.New("user_id is required for user scope")
+		}
+	default:
+		return errors.New("scope must be service, role or user")
+	}
+	return nil
+}
+
+// matches reports whether the policy pattern matches the tool name
+func (p *ToolPolicy) matches(toolName string) bool {
+	matched, err := path.Match(p.ToolName, toolName)
+	return err == nil && matched
+}
+
+// appliesTo reports whether the policy applies to the given user and role
+func (p *ToolPolicy) appliesTo(userID int64, role int) bool {
+	switch p.Scope {
+	case ToolPolicyScopeUser:
+		return p.UserID == userID
+	case ToolPolicyScopeRole:
+		return p.Role == role
+	case ToolPolicyScopeService:
+		return true
+	}
+	return false
+}
+
+// GetToolPoliciesByService returns all tool policies of a service
+func GetToolPoliciesByService(serviceID int64) ([]*ToolPolicy, error) {
+	return ToolPolicyDB.Where("service_id = ?", serviceID).All()
+}
+
+// GetAllToolPolicies returns every tool policy
+func GetAllToolPolicies() ([]*ToolPolicy, error) {
+	return ToolPolicyDB.Order("service_id ASC").All()
+}
+
+// GetToolPolicyByID returns a tool policy by its ID
+func GetToolPolicyByID(id int64) (*ToolPolicy, error) {
+	return ToolPolicyDB.ByID(id)
+}
+
+// SaveToolPolicy creates or updates a tool policy
+func SaveToolPolicy(policy *ToolPolicy) error {
+	return ToolPolicyDB.Save(policy)
+}
+
+// DeleteToolPolicy deletes a tool policy
+func DeleteToolPolicy(id int64) error {
+	policy, err := ToolPolicyDB.ByID(id)
+	if err != nil {
+		return err
+	}
+	return ToolPolicyDB.Delete(policy)
+}
+
+// IsToolAllowed evaluates the policies of one service for a user.
+// The most specific scope with a rule matching the tool decides (user > role > service), and within
+// that scope deny wins over allow. User and role allow rules are only exceptions to denies; a service
+// allow rule makes the service rules an allowlist, so tools no rule matches are denied. Without a service
+// allow rule unmatched tools are allowed.
+func IsToolAllowed(policies []*ToolPolicy, userID int64, role int, toolName string) bool {
+	hasAllowlist := false
+	for _, scope := range []ToolPolicyScope{ToolPolicyScopeUser, ToolPolicyScopeRole, ToolPolicyScopeService} {
+		matched := false
+		denied := false
+		for _, p := range policies {
+			if p.Scope != scope || !p.appliesTo(userID, role) {
+				continue
+			}
+			if p.Action == ToolPolicyAllow && scope == ToolPolicyScopeService {
+				hasAllowlist = true
+			}
+			if p.matches(toolName) {
+				matched = true
+				if p.Action == ToolPolicyDeny {
+					denied = true
+				}
+			}
+		}
+		if matched {
+			return !denied
+		}
+	}
+	return !hasAllowlist
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsToolAllowed(t *testing.T) {
+	const internRole = 1
+	policies := []*ToolPolicy{
+		{ServiceID: 1, Scope: ToolPolicyScopeRole, Role: internRole, ToolName: "delete_*", Action: ToolPolicyDeny},
+		{ServiceID: 1, Scope: ToolPolicyScopeUser, UserID: 42, ToolName: "delete_repository", Action: ToolPolicyAllow},
+	}
+
+	assert.True(t, IsToolAllowed(nil, 7, internRole, "delete_repository"), "no policies allows everything")
+	assert.False(t, IsToolAllowed(policies, 7, internRole, "delete_repository"), "role deny applies")
+	assert.True(t, IsToolAllowed(policies, 7, internRole, "create_issue"), "unmatched tool is allowed without allowlist")
+	assert.True(t, IsToolAllowed(policies, 42, internRole, "delete_repository"), "user allow overrides role deny")
+	assert.True(t, IsToolAllowed(policies, 42, internRole, "create_issue"), "user allow is only an exception, not an allowlist")
+	assert.True(t, IsToolAllowed(policies, 7, 10, "delete_repository"), "role policy does not apply to other roles")
+
+	allowlist := []*ToolPolicy{
+		{ServiceID: 1, Scope: ToolPolicyScopeService, ToolName: "search_*", Action: ToolPolicyAllow},
+		{ServiceID: 1, Scope: ToolPolicyScopeService, ToolName: "search_secrets", Action: ToolPolicyDeny},
+	}
+	assert.True(t, IsToolAllowed(allowlist, 7, internRole, "search_code"))
+	assert.False(t, IsToolAllowed(allowlist, 7, internRole, "search_secrets"), "deny wins within a scope")
+	assert.False(t, IsToolAllowed(allowlist, 7, internRole, "push_files"))
+
+	allowlist = append(allowlist, &ToolPolicy{ServiceID: 1, Scope: ToolPolicyScopeUser, UserID: 42, ToolName: "push_files", Action: ToolPolicyAllow})
+	assert.True(t, IsToolAllowed(allowlist, 42, internRole, "push_files"), "user allow extends the service allowlist")
+	assert.False(t, IsToolAllowed(allowlist, 42, internRole, "delete_repository"))
+}
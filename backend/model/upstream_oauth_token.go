@@ -0,0 +1,100 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"one-mcp/backend/common"
+
+	"github.com/burugo/thing"
+)
+
+// UpstreamOAuthToken is the OAuth token a user obtained for a remote service whose OAuthJSON enables OAuth.
+// Tokens and the client secret are encrypted at rest; the getters return them decrypted.
+type UpstreamOAuthToken struct {
+	thing.BaseModel
+	UserID       int64     `db:"user_id,index:idx_upstream_oauth_user_service" json:"user_id"`
+	ServiceID    int64     `db:"service_id,index:idx_upstream_oauth_user_service" json:"service_id"`
+	AccessToken  string    `db:"access_token" json:"-"`
+	RefreshToken string    `db:"refresh_token" json:"-"`
+	TokenType    string    `db:"token_type" json:"token_type"`
+	Scope        string    `db:"scope" json:"scope"`
+	ExpiresAt    time.Time `db:"expires_at" json:"expires_at"` // Zero value means the token does not expire
+	ClientID     string    `db:"client_id" json:"client_id"`   // Client the token was issued to, registered dynamically if the service has none
+	ClientSecret string    `db:"client_secret" json:"-"`
+}
+
+// TableName sets the table name for the UpstreamOAuthToken model
+func (t *UpstreamOAuthToken) TableName() string {
+	return "upstream_oauth_tokens"
+}
+
+var UpstreamOAuthTokenDB *thing.Thing[*UpstreamOAuthToken]
+
+// UpstreamOAuthTokenInit initializes the UpstreamOAuthTokenDB
+func UpstreamOAuthTokenInit() error {
+	var err error
+	UpstreamOAuthTokenDB, err = thing.Use[*UpstreamOAuthToken]()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetUpstreamOAuthToken returns the decrypted token of a user for a service, ErrRecordNotFound if there is none
+func GetUpstreamOAuthToken(userID, serviceID int64) (*UpstreamOAuthToken, error) {
+	tokens, err := UpstreamOAuthTokenDB.Where("user_id = ? AND service_id = ?", userID, serviceID).Fetch(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	token := *tokens[0] // Decrypt a copy, the fetched model may be cached
+	for _, field := range []*string{&token.AccessToken, &token.RefreshToken, &token.ClientSecret} {
+		plaintext, err := common.DecryptSecret(*field)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt OAuth token of user %d for service %d: %w", userID, serviceID, err)
+		}
+		*field = plaintext
+	}
+	return &token, nil
+}
+
+// SaveUpstreamOAuthToken creates or replaces the token of a user for a service
+func SaveUpstreamOAuthToken(token *UpstreamOAuthToken) error {
+	existingTokens, err := UpstreamOAuthTokenDB.Where("user_id = ? AND service_id = ?", token.UserID, token.ServiceID).Fetch(0, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(existingTokens) > 0 {
+		// Update existing record
+		existing := existingTokens[0]
+		existing.AccessToken = token.AccessToken
+		existing.RefreshToken = token.RefreshToken
+		existing.TokenType = token.TokenType
+		existing.Scope = token.Scope
+		existing.ExpiresAt = token.ExpiresAt
+		existing.ClientID = token.ClientID
+		existing.ClientSecret = token.ClientSecret
+		return UpstreamOAuthTokenDB.Save(existing)
+	}
+
+	// Create new record
+	return UpstreamOAuthTokenDB.Save(token)
+}
+
+// DeleteUpstreamOAuthToken removes the token of a user for a service, if any
+func DeleteUpstreamOAuthToken(userID, serviceID int64) error {
+	tokens, err := UpstreamOAuthTokenDB.Where("user_id = ? AND service_id = ?", userID, serviceID).All()
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := UpstreamOAuthTokenDB.Delete(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -128,12 +128,21 @@ func GetUserConfigsWithDetails(userID int64) ([]map[string]interface{}, error) {
 			continue
 		}
 
+		// Secret values never leave the server in plaintext
+		value, err := common.DecryptSecret(config.Value)
+		if err != nil {
+			value = ""
+		}
+		if configService.Type == ConfigTypeSecret {
+			value = common.MaskSecret(value)
+		}
+
 		configMap := map[string]interface{}{
 			"id":         config.ID,
 			"user_id":    config.UserID,
 			"service":    service,
 			"config":     configService,
-			"value":      config.Value,
+			"value":      value,
 			"created_at": config.CreatedAt,
 			"updated_at": config.UpdatedAt,
 		}
@@ -148,6 +157,16 @@ func GetUserConfigsWithDetails(userID int64) ([]map[string]interface{}, error) {
 // for a specific user and service.
 // It joins UserConfig with ConfigService to get the actual ENV variable names (keys).
 func GetUserSpecificEnvs(userID int64, mcpServiceID int64) (map[string]string, error) {
+	return getUserSpecificValues(userID, mcpServiceID, false)
+}
+
+// GetUserSpecificHeaders retrieves the HTTP headers a user overrides for a remote service, keyed by header name
+func GetUserSpecificHeaders(userID int64, mcpServiceID int64) (map[string]string, error) {
+	return getUserSpecificValues(userID, mcpServiceID, true)
+}
+
+// getUserSpecificValues returns the values a user set for the env var (or, with headers, the header) options of a service
+func getUserSpecificValues(userID int64, mcpServiceID int64, headers bool) (map[string]string, error) {
 	if UserConfigDB == nil || ConfigServiceDB == nil {
 		return nil, errors.New("database connections not initialized for UserConfigDB or ConfigServiceDB")
 	}
@@ -178,12 +197,21 @@ func GetUserSpecificEnvs(userID int64, mcpServiceID int64) (map[string]string, e
 			continue
 		}
 
+		if configService.IsHeader != headers {
+			continue
+		}
+
 		// Ensure the fetched ConfigService's Key is not empty.
 		if configService.Key == "" {
 			common.SysLog(fmt.Sprintf("WARN: ConfigService with ID %d (for UserConfig ID %d) has an empty Key. Skipping this entry.", configService.ID, uc.ID))
 			continue
 		}
-		envMap[configService.Key] = uc.Value
+		value, err := common.DecryptSecret(uc.Value)
+		if err != nil {
+			common.SysError(fmt.Sprintf("Error decrypting UserConfig ID %d (UserID %d, MCPServiceID %d): %v. Skipping this entry.", uc.ID, userID, mcpServiceID, err))
+			continue
+		}
+		envMap[configService.Key] = value
 	}
 
 	return envMap, nil
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two npm (semver) or PyPI (PEP 440) release versions and returns -1, 0 or 1. Numeric
+// components are compared as numbers; a pre-release such as 1.2.0-beta.1 or 1.2.0rc1 sorts before 1.2.0.
+func CompareVersions(a, b string) int {
+	aRelease, aPre := splitVersion(a)
+	bRelease, bPre := splitVersion(b)
+	for i := 0; i < max(len(aRelease), len(bRelease)); i++ {
+		var x, y int
+		if i < len(aRelease) {
+			x = aRelease[i]
+		}
+		if i < len(bRelease) {
+			y = bRelease[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
+
+// splitVersion returns the numeric release components of a version and its pre-release suffix. Build metadata
+// (+build) is ignored.
+func splitVersion(version string) ([]int, string) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	version, _, _ = strings.Cut(version, "+")
+	var release []int
+	for version != "" {
+		end := 0
+		for end < len(version) && version[end] >= '0' && version[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			break
+		}
+		n, _ := strconv.Atoi(version[:end])
+		release = append(release, n)
+		version = version[end:]
+		if !strings.HasPrefix(version, ".") {
+			break
+		}
+		version = version[1:]
+	}
+	return release, strings.TrimLeft(version, "-.")
+}
+
+// SetLatestVersion records the newest released version of the package and whether it is newer than the
+// installed one. Services without a pinned version follow the latest release on their own and are not flagged.
+func (s *MCPService) SetLatestVersion(latest string) {
+	s.LatestVersion = latest
+	switch s.InstalledVersion {
+	case "", "latest", "installing":
+		s.UpdateAvailable = false
+	default:
+		s.UpdateAvailable = latest != "" && CompareVersions(latest, s.InstalledVersion) > 0
+	}
+}
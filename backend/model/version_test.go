@@ -0,0 +1,44 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"v2.0.0", "1.99.0", 1},
+		{"1.2", "1.2.0", 0},
+		{"1.2.0-beta.1", "1.2.0", -1},
+		{"1.2.0rc1", "1.2.0", -1},
+		{"1.2.0b1", "1.2.0rc1", -1},
+		{"1.2.0+build.5", "1.2.0", 0},
+		{"2025.4.1", "2025.10.1", -1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CompareVersions(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+		assert.Equal(t, -tt.want, CompareVersions(tt.b, tt.a), "%s vs %s", tt.b, tt.a)
+	}
+}
+
+func TestSetLatestVersion(t *testing.T) {
+	svc := &MCPService{InstalledVersion: "1.2.3"}
+	svc.SetLatestVersion("1.3.0")
+	assert.True(t, svc.UpdateAvailable)
+	assert.Equal(t, "1.3.0", svc.LatestVersion)
+
+	svc.SetLatestVersion("1.2.3-rc.1")
+	assert.False(t, svc.UpdateAvailable, "the pre-release is older than the installed release")
+	svc.InstalledVersion = "1.4.0"
+	svc.SetLatestVersion("1.3.0")
+	assert.False(t, svc.UpdateAvailable, "no downgrades")
+	svc.InstalledVersion = "latest"
+	svc.SetLatestVersion("2.0.0")
+	assert.False(t, svc.UpdateAvailable)
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"one-mcp/backend/model"
+)
+
+// ClientType is an MCP client whose configuration file format one-mcp can export
+type ClientType string
+
+const (
+	ClientClaudeDesktop ClientType = "claude_desktop"
+	ClientCursor        ClientType = "cursor"
+	ClientVSCode        ClientType = "vscode"
+	ClientWindsurf      ClientType = "windsurf"
+	ClientGeneric       ClientType = "generic" // A plain streamable HTTP entry for other clients
+
+	// AggregateServerName is the entry name of the aggregate endpoint in exported configurations
+	AggregateServerName = "one-mcp"
+)
+
+// ClientTypes lists the exportable clients in display order
+var ClientTypes = []ClientType{ClientClaudeDesktop, ClientCursor, ClientVSCode, ClientWindsurf, ClientGeneric}
+
+// clientConfigFiles is where each client reads its configuration, shown next to the export
+var clientConfigFiles = map[ClientType]string{
+	ClientClaudeDesktop: "claude_desktop_config.json",
+	ClientCursor:        "~/.cursor/mcp.json or .cursor/mcp.json",
+	ClientVSCode:        ".vscode/mcp.json",
+	ClientWindsurf:      "~/.codeium/windsurf/mcp_config.json",
+	ClientGeneric:       "mcp.json",
+}
+
+// ClientConfigFile returns where the client reads its configuration
+func ClientConfigFile(client ClientType) string {
+	return clientConfigFiles[client]
+}
+
+// ProxyEndpoint is one MCP endpoint of one-mcp to be written into a client configuration
+type ProxyEndpoint struct {
+	Name    string
+	URL     string            // Streamable HTTP endpoint, /proxy/<name>/mcp
+	Service *model.MCPService // Nil for the aggregate endpoint
+}
+
+// NewProxyEndpoint returns the streamable HTTP endpoint of a service, or of the aggregate endpoint for a nil service
+func NewProxyEndpoint(serverAddress string, svc *model.MCPService) ProxyEndpoint {
+	if svc == nil {
+		return ProxyEndpoint{Name: AggregateServerName, URL: serverAddress + "/proxy/_all/mcp"}
+	}
+	return ProxyEndpoint{Name: svc.Name, URL: serverAddress + "/proxy/" + url.PathEscape(svc.Name) + "/mcp", Service: svc}
+}
+
+// BuildClientConfig returns the configuration document of a client connecting to the endpoints with the key.
+// A service can replace its generated entry through its ClientConfigTemplates, whose template_string is a JSON
+// object in which {{url}}, {{key}} and {{name}} are substituted.
+func BuildClientConfig(client ClientType, endpoints []ProxyEndpoint, key string) (map[string]interface{}, error) {
+	servers := make(map[string]interface{}, len(endpoints))
+	for _, endpoint := range endpoints {
+		entry, err := clientServerEntry(client, endpoint, key)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", endpoint.Name, err)
+		}
+		servers[endpoint.Name] = entry
+	}
+	// VS Code names the map "servers"; the other clients follow Claude Desktop
+	if client == ClientVSCode {
+		return map[string]interface{}{"servers": servers}, nil
+	}
+	return map[string]interface{}{"mcpServers": servers}, nil
+}
+
+func clientServerEntry(client ClientType, endpoint ProxyEndpoint, key string) (interface{}, error) {
+	if endpoint.Service != nil {
+		templates, err := endpoint.Service.GetClientConfigTemplates()
+		if err != nil {
+			return nil, fmt.Errorf("invalid client config templates: %w", err)
+		}
+		if detail, ok := templates[string(client)]; ok && strings.TrimSpace(detail.TemplateString) != "" {
+			return renderClientTemplate(detail.TemplateString, endpoint, key)
+		}
+	}
+
+	headers := map[string]string{}
+	if key != "" {
+		headers["Authorization"] = "Bearer " + key
+	}
+	switch client {
+	case ClientClaudeDesktop:
+		// Claude Desktop only launches stdio servers; mcp-remote bridges them to the HTTP endpoint. The header is
+		// passed through an environment variable because spaces in arguments break on Windows.
+		args := []interface{}{"-y", "mcp-remote", endpoint.URL}
+		entry := map[string]interface{}{"command": "npx", "args": args}
+		if key != "" {
+			entry["args"] = append(args, "--header", "Authorization:${ONE_MCP_AUTH_HEADER}")
+			entry["env"] = map[string]string{"ONE_MCP_AUTH_HEADER": "Bearer " + key}
+		}
+		return entry, nil
+	case ClientCursor:
+		return map[string]interface{}{"url": endpoint.URL, "headers": headers}, nil
+	case ClientVSCode:
+		return map[string]interface{}{"type": "http", "url": endpoint.URL, "headers": headers}, nil
+	case ClientWindsurf:
+		return map[string]interface{}{"serverUrl": endpoint.URL, "headers": headers}, nil
+	case ClientGeneric:
+		return map[string]interface{}{"type": "streamableHttp", "url": endpoint.URL, "headers": headers}, nil
+	}
+	return nil, fmt.Errorf("unsupported client type: %s", client)
+}
+
+func renderClientTemplate(template string, endpoint ProxyEndpoint, key string) (interface{}, error) {
+	// Values are JSON-escaped so they can sit inside the template's string literals
+	escape := func(value string) string {
+		data, _ := json.Marshal(value)
+		return string(data[1 : len(data)-1])
+	}
+	rendered := strings.NewReplacer(
+		"{{url}}", escape(endpoint.URL),
+		"{{key}}", escape(key),
+		"{{name}}", escape(endpoint.Name),
+	).Replace(template)
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(rendered), &entry); err != nil {
+		return nil, fmt.Errorf("invalid client config template: %w", err)
+	}
+	return entry, nil
+}
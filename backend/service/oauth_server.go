@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+
+	"github.com/burugo/thing"
+)
+
+const (
+	// OAuthScopeMCP is the only scope of tokens issued to MCP clients; it grants the user's proxy access
+	OAuthScopeMCP = "mcp"
+	// OAuthCodeChallengeMethod is the only PKCE method accepted, as required by OAuth 2.1
+	OAuthCodeChallengeMethod = "S256"
+
+	// oauthAuthorizationRequestTTL is how long a user has to log in and approve a client
+	oauthAuthorizationRequestTTL = 10 * time.Minute
+	// oauthAuthorizationCodeTTL is how long a client has to exchange an authorization code; the cache drops
+	// codes that were never exchanged once it passes
+	oauthAuthorizationCodeTTL = 5 * time.Minute
+)
+
+// OAuthResourcePath is the path of the MCP endpoints one-mcp protects; access tokens are only good for them
+const OAuthResourcePath = "/proxy"
+
+// OAuthIssuer returns the issuer of one-mcp's authorization server: the configured server address, or the
+// address the request was made to
+func OAuthIssuer(r *http.Request) string {
+	if address := strings.TrimRight(common.GetServerAddress(), "/"); address != "" {
+		return address
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ValidateOAuthResource checks the RFC 8707 resource of an authorization or token request. It must name the
+// MCP endpoints of this server: the issuer, its /proxy path or an endpoint below it.
+func ValidateOAuthResource(issuer, resource string) error {
+	u, err := url.Parse(resource)
+	target := strings.TrimRight(resource, "/")
+	if err != nil || !u.IsAbs() || u.RawQuery != "" || u.Fragment != "" || (u.Path != "" && path.Clean(u.Path) != strings.TrimRight(u.Path, "/")) ||
+		(target != issuer && !OAuthResourceCovers(issuer+OAuthResourcePath, target)) {
+		return &OAuthError{Code: "invalid_target", Description: "resource must be an MCP endpoint of " + issuer + OAuthResourcePath}
+	}
+	return nil
+}
+
+// OAuthResourceCovers reports whether a token bound to resource may be used at requestURL: the resource itself
+// or a path below it. A token without a resource is not bound.
+func OAuthResourceCovers(resource, requestURL string) bool {
+	if resource == "" {
+		return true
+	}
+	resource = strings.TrimRight(resource, "/")
+	return requestURL == resource || strings.HasPrefix(requestURL, resource+"/")
+}
+
+// OAuthError is an error of the authorization server, reported to clients with its RFC 6749 error code
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// ErrOAuthAuthorizationRequestInvalid is returned for an authorization request that is unknown, expired or
+// already approved or denied
+var ErrOAuthAuthorizationRequestInvalid = errors.New("invalid or expired authorization request")
+
+// OAuthAuthorizationRequest is a validated request of an MCP client to be authorized by a user. It is kept in
+// the cache while the user logs in.
+type OAuthAuthorizationRequest struct {
+	ClientID      string `json:"client_id"`
+	ClientName    string `json:"client_name"`
+	RedirectURI   string `json:"redirect_uri"`
+	State         string `json:"state,omitempty"`
+	CodeChallenge string `json:"code_challenge"`
+	Scope         string `json:"scope"`
+	Resource      string `json:"resource,omitempty"`
+}
+
+// oauthAuthorizationCode is what an authorization code stands for until the client exchanges it
+type oauthAuthorizationCode struct {
+	OAuthAuthorizationRequest
+	UserID int64 `json:"user_id"`
+}
+
+// SaveOAuthAuthorizationRequest keeps a validated authorization request and returns its ID
+func SaveOAuthAuthorizationRequest(ctx context.Context, request *OAuthAuthorizationRequest) (string, error) {
+	cacheClient := thing.Cache()
+	if cacheClient == nil {
+		return "", errors.New("cache is not available to keep the authorization request")
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	requestID := common.GetUUID()
+	if err := cacheClient.Set(ctx, oauthAuthorizationRequestKey(requestID), string(data), oauthAuthorizationRequestTTL); err != nil {
+		return "", err
+	}
+	return requestID, nil
+}
+
+// GetOAuthAuthorizationRequest returns a pending authorization request
+func GetOAuthAuthorizationRequest(ctx context.Context, requestID string) (*OAuthAuthorizationRequest, error) {
+	cacheClient := thing.Cache()
+	if cacheClient == nil || requestID == "" {
+		return nil, ErrOAuthAuthorizationRequestInvalid
+	}
+	raw, err := cacheClient.Get(ctx, oauthAuthorizationRequestKey(requestID))
+	if err != nil || raw == "" {
+		return nil, ErrOAuthAuthorizationRequestInvalid
+	}
+	var request OAuthAuthorizationRequest
+	if err := json.Unmarshal([]byte(raw), &request); err != nil {
+		return nil, ErrOAuthAuthorizationRequestInvalid
+	}
+	return &request, nil
+}
+
+// takeOAuthAuthorizationRequest returns a pending authorization request and forgets it, so it is answered once
+func takeOAuthAuthorizationRequest(ctx context.Context, requestID string) (*OAuthAuthorizationRequest, error) {
+	request, err := GetOAuthAuthorizationRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := thing.Cache().Delete(ctx, oauthAuthorizationRequestKey(requestID)); err != nil {
+		common.SysError(fmt.Sprintf("[OAuthServer] Failed to delete authorization request: %v", err))
+	}
+	return request, nil
+}
+
+// ApproveOAuthAuthorizationRequest issues an authorization code of the user for a pending request and returns
+// the client redirect URI that delivers it
+func ApproveOAuthAuthorizationRequest(ctx context.Context, requestID string, userID int64) (string, error) {
+	request, err := takeOAuthAuthorizationRequest(ctx, requestID)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(oauthAuthorizationCode{OAuthAuthorizationRequest: *request, UserID: userID})
+	if err != nil {
+		return "", err
+	}
+	code := common.GetUUID() + common.GetUUID()
+	if err := thing.Cache().Set(ctx, oauthAuthorizationCodeKey(code), string(data), oauthAuthorizationCodeTTL); err != nil {
+		return "", err
+	}
+	common.SysLog(fmt.Sprintf("[OAuthServer] User %d authorized client %s (%s)", userID, request.ClientID, request.ClientName))
+	return OAuthRedirectURL(request.RedirectURI, request.State, url.Values{"code": {code}})
+}
+
+// DenyOAuthAuthorizationRequest forgets a pending request and returns the client redirect URI that reports the
+// denial
+func DenyOAuthAuthorizationRequest(ctx context.Context, requestID string) (string, error) {
+	request, err := takeOAuthAuthorizationRequest(ctx, requestID)
+	if err != nil {
+		return "", err
+	}
+	return OAuthRedirectURL(request.RedirectURI, request.State, url.Values{
+		"error":             {"access_denied"},
+		"error_description": {"The user denied the authorization request"},
+	})
+}
+
+// ExchangeOAuthAuthorizationCode redeems an authorization code for tokens. The code is single-use and must be
+// presented by the client it was issued to, with the same redirect URI and the PKCE verifier of its challenge.
+// A resource, when given, must be the one that was authorized, if any; the tokens are bound to it.
+func ExchangeOAuthAuthorizationCode(ctx context.Context, code, clientID, redirectURI, codeVerifier, resource string) (*model.OAuthToken, string, string, error) {
+	invalidGrant := &OAuthError{Code: "invalid_grant", Description: "The authorization code is invalid or expired"}
+	cacheClient := thing.Cache()
+	if cacheClient == nil || code == "" {
+		return nil, "", "", invalidGrant
+	}
+	raw, err := cacheClient.Get(ctx, oauthAuthorizationCodeKey(code))
+	if err != nil || raw == "" {
+		return nil, "", "", invalidGrant
+	}
+	// A code can only be used once, whether or not the exchange succeeds
+	if err := cacheClient.Delete(ctx, oauthAuthorizationCodeKey(code)); err != nil {
+		common.SysError(fmt.Sprintf("[OAuthServer] Failed to delete authorization code: %v", err))
+	}
+	var issued oauthAuthorizationCode
+	if err := json.Unmarshal([]byte(raw), &issued); err != nil {
+		return nil, "", "", invalidGrant
+	}
+	// The redirect URI may be omitted when the client registered only one and omitted it from the authorization
+	if issued.ClientID != clientID || (redirectURI != "" && issued.RedirectURI != redirectURI) {
+		return nil, "", "", invalidGrant
+	}
+	if !VerifyPKCE(codeVerifier, issued.CodeChallenge) {
+		return nil, "", "", &OAuthError{Code: "invalid_grant", Description: "The code verifier does not match the code challenge"}
+	}
+	if issued.Resource == "" {
+		issued.Resource = resource
+	} else if resource != "" && strings.TrimRight(resource, "/") != strings.TrimRight(issued.Resource, "/") {
+		return nil, "", "", &OAuthError{Code: "invalid_target", Description: "The resource does not match the authorized resource"}
+	}
+	return model.IssueOAuthToken(issued.UserID, issued.ClientID, issued.Scope, issued.Resource)
+}
+
+// VerifyPKCE checks a code verifier against an S256 code challenge (RFC 7636)
+func VerifyPKCE(codeVerifier, codeChallenge string) bool {
+	if len(codeVerifier) < 43 || len(codeVerifier) > 128 || codeChallenge == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
+
+// OAuthRedirectURL adds the state and response parameters to a client redirect URI
+func OAuthRedirectURL(redirectURI, state string, params url.Values) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func oauthAuthorizationRequestKey(requestID string) string {
+	return "oauth_authorization_request:" + requestID
+}
+
+func oauthAuthorizationCodeKey(code string) string {
+	return "oauth_authorization_code:" + code
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/model"
+)
+
+// statsMaintenanceInterval is how often request stats are rolled up and pruned
+const statsMaintenanceInterval = 5 * time.Minute
+
+// StartStatsMaintenance rolls up request stats into hourly and daily buckets, applies the retention policy
+// and purges expired OAuth tokens, once at startup and then every statsMaintenanceInterval until ctx is cancelled.
+func StartStatsMaintenance(ctx context.Context) {
+	go func() {
+		RunStatsMaintenance(time.Now())
+		ticker := time.NewTicker(statsMaintenanceInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				RunStatsMaintenance(now)
+			}
+		}
+	}()
+}
+
+// RunStatsMaintenance performs a single rollup and prune pass
+func RunStatsMaintenance(now time.Time) {
+	rolled, err := model.RunStatRollups(now)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[StatsRollup] Failed to roll up request stats: %v", err))
+		// Pruning only deletes rows that are already rolled up, so it is still safe to continue
+	} else if rolled > 0 {
+		common.SysLog(fmt.Sprintf("[StatsRollup] Rolled up %d buckets", rolled))
+	}
+
+	rawRetention := time.Duration(common.GetStatsRetentionDays()) * 24 * time.Hour
+	hourlyRetention := time.Duration(common.GetStatsHourlyRetentionDays()) * 24 * time.Hour
+	if err := model.PruneStats(now, rawRetention, hourlyRetention); err != nil {
+		common.SysError(fmt.Sprintf("[StatsRetention] Failed to prune request stats: %v", err))
+	}
+
+	if purged, err := model.PurgeExpiredOAuthTokens(now); err != nil {
+		common.SysError(fmt.Sprintf("[OAuth] Failed to purge expired tokens: %v", err))
+	} else if purged > 0 {
+		common.SysLog(fmt.Sprintf("[OAuth] Purged %d expired tokens", purged))
+	}
+}
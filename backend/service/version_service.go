@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"one-mcp/backend/common"
+	"one-mcp/backend/library/market"
+	"one-mcp/backend/library/proxy"
+	"one-mcp/backend/model"
+)
+
+// versionCheckInterval is how often installed npm and PyPI packages are compared with their latest releases
+const versionCheckInterval = 6 * time.Hour
+
+// upgradeRestartTimeout bounds restarting a service on a new version and checking its health
+const upgradeRestartTimeout = 2 * time.Minute
+
+var (
+	// ErrUpgradeNotSupported is returned for services that are not npm or PyPI packages
+	ErrUpgradeNotSupported = errors.New("only npm and PyPI services can be upgraded")
+	// ErrUpgradeInProgress is returned while the service is being installed or upgraded
+	ErrUpgradeInProgress = errors.New("an installation or upgrade of the service is already in progress")
+	// ErrAlreadyUpToDate is returned when the service already runs the requested version
+	ErrAlreadyUpToDate = errors.New("the service already runs this version")
+)
+
+// StartVersionChecks compares the installed versions of npm and PyPI services with their latest releases, once
+// at startup and then every versionCheckInterval until ctx is cancelled.
+func StartVersionChecks(ctx context.Context) {
+	go func() {
+		RunVersionChecks(ctx)
+		ticker := time.NewTicker(versionCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				RunVersionChecks(ctx)
+			}
+		}
+	}()
+}
+
+// RunVersionChecks records the latest version of every upgradable service and whether an update is available.
+// It returns the number of services with an update available.
+func RunVersionChecks(ctx context.Context) int {
+	services, err := model.GetAllServices()
+	if err != nil {
+		common.SysError(fmt.Sprintf("[VersionCheck] Failed to list services: %v", err))
+		return 0
+	}
+	available := 0
+	for _, svc := range services {
+		if !isUpgradable(svc) {
+			continue
+		}
+		latest, err := market.GetLatestVersion(ctx, svc.PackageManager, svc.SourcePackageName)
+		if err != nil {
+			common.SysError(fmt.Sprintf("[VersionCheck] Failed to get the latest version of %s: %v", svc.SourcePackageName, err))
+			continue
+		}
+		// Copy the fetched service so the cached one is not changed if saving fails
+		updated := *svc
+		updated.SetLatestVersion(latest)
+		if updated.UpdateAvailable {
+			available++
+		}
+		if updated.LatestVersion == svc.LatestVersion && updated.UpdateAvailable == svc.UpdateAvailable {
+			continue
+		}
+		if err := model.UpdateService(&updated); err != nil {
+			common.SysError(fmt.Sprintf("[VersionCheck] Failed to save the latest version of service %s: %v", svc.Name, err))
+		} else if updated.UpdateAvailable {
+			common.SysLog(fmt.Sprintf("[VersionCheck] Update available for service %s: %s -> %s", svc.Name, svc.InstalledVersion, latest))
+		}
+	}
+	return available
+}
+
+// isUpgradable reports whether the service runs an npm or PyPI package through npx or uvx
+func isUpgradable(svc *model.MCPService) bool {
+	if svc.Deleted || svc.Type != model.ServiceTypeStdio || svc.SourcePackageName == "" {
+		return false
+	}
+	switch svc.PackageManager {
+	case "npm", "pypi", "uv", "pip":
+		return true
+	}
+	return false
+}
+
+// UpgradeService reinstalls a service at version, the latest release if empty, through the InstallationManager.
+// The new version must pass Initialize before the service switches to it; its instances are then restarted, and
+// the service is rolled back to the previous version if it fails its health check. It returns the target version.
+func UpgradeService(ctx context.Context, serviceID int64, version string, userID int64) (string, error) {
+	svc, err := model.GetServiceByID(serviceID)
+	if err != nil {
+		return "", err
+	}
+	if !isUpgradable(svc) {
+		return "", ErrUpgradeNotSupported
+	}
+	installationManager := market.GetInstallationManager()
+	if task, exists := installationManager.GetTaskStatus(serviceID); exists &&
+		(task.Status == market.StatusPending || task.Status == market.StatusInstalling) {
+		return "", ErrUpgradeInProgress
+	}
+
+	if version == "" || version == "latest" {
+		version, err = market.GetLatestVersion(ctx, svc.PackageManager, svc.SourcePackageName)
+		if err != nil {
+			return "", err
+		}
+	}
+	if version == svc.InstalledVersion {
+		return "", ErrAlreadyUpToDate
+	}
+
+	var args []string
+	if svc.ArgsJSON != "" {
+		if err := json.Unmarshal([]byte(svc.ArgsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid args of service %s: %w", svc.Name, err)
+		}
+	}
+	envVars, err := model.DecryptJSONMap(svc.DefaultEnvsJSON)
+	if err != nil {
+		return "", err
+	}
+
+	previousVersion, previousArgsJSON := svc.InstalledVersion, svc.ArgsJSON
+	installationManager.SubmitTask(market.InstallationTask{
+		ServiceID:      svc.ID,
+		UserID:         userID,
+		PackageName:    svc.SourcePackageName,
+		PackageManager: svc.PackageManager,
+		Version:        version,
+		Command:        svc.Command,
+		Args:           market.PinPackageArgs(svc.PackageManager, svc.SourcePackageName, version, args),
+		EnvVars:        envVars,
+		Upgrade:        true,
+		OnInstalled: func(task market.InstallationTask) {
+			restartUpgradedService(task.ServiceID, previousVersion, previousArgsJSON)
+		},
+	})
+	common.SysLog(fmt.Sprintf("[Upgrade] Upgrading service %s from %s to %s", svc.Name, previousVersion, version))
+	return version, nil
+}
+
+// restartUpgradedService restarts the instances of a service on its new version and rolls it back to the
+// previous version and arguments if the new instance does not become healthy
+func restartUpgradedService(serviceID int64, previousVersion, previousArgsJSON string) {
+	ctx, cancel := context.WithTimeout(context.Background(), upgradeRestartTimeout)
+	defer cancel()
+
+	svc, err := model.GetServiceByID(serviceID)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[Upgrade] Failed to load upgraded service %d: %v", serviceID, err))
+		return
+	}
+	serviceManager := proxy.GetServiceManager()
+	if err := serviceManager.ReloadService(ctx, svc); err != nil {
+		common.SysError(fmt.Sprintf("[Upgrade] Failed to restart service %s: %v", svc.Name, err))
+	}
+	if !svc.Enabled {
+		// Disabled services have no instances; the new version starts when the service is enabled
+		return
+	}
+
+	health, err := serviceManager.ForceCheckServiceHealth(serviceID)
+	if err == nil && health.Status == proxy.StatusHealthy {
+		common.SysLog(fmt.Sprintf("[Upgrade] Service %s upgraded to %s", svc.Name, svc.InstalledVersion))
+		return
+	}
+	if err == nil {
+		err = errors.New(health.ErrorMessage)
+	}
+	common.SysError(fmt.Sprintf("[Upgrade] Service %s is unhealthy on %s, rolling back to %s: %v", svc.Name, svc.InstalledVersion, previousVersion, err))
+
+	rollback := *svc
+	rollback.InstalledVersion = previousVersion
+	rollback.ArgsJSON = previousArgsJSON
+	rollback.SetLatestVersion(svc.LatestVersion)
+	if err := model.UpdateService(&rollback); err != nil {
+		common.SysError(fmt.Sprintf("[Upgrade] Failed to roll back service %s: %v", svc.Name, err))
+		return
+	}
+	if err := serviceManager.ReloadService(ctx, &rollback); err != nil {
+		common.SysError(fmt.Sprintf("[Upgrade] Failed to restart service %s after rolling back: %v", svc.Name, err))
+	}
+}
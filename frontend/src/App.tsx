@@ -5,7 +5,7 @@ import { Dialog, DialogContent, DialogDescription, DialogFooter, DialogHeader, D
 import { Input } from '@/components/ui/input'
 import { Toaster } from '@/components/ui/toaster'
 import { useToast } from '@/hooks/use-toast'
-import { Settings, User, Home, BarChart, Globe, Package, Users } from 'lucide-react'
+import { Settings, User, Home, BarChart, Globe, Package, Users, Server } from 'lucide-react'
 import { LoginDialog } from './components/ui/login-dialog'
 import { ThemeToggle } from './components/ui/theme-toggle'
 import { MarketPage } from './pages/MarketPage'
@@ -15,6 +15,7 @@ import { AnalyticsPage } from './pages/AnalyticsPage'
 import { ProfilePage } from './pages/ProfilePage'
 import { PreferencesPage } from './pages/PreferencesPage'
 import { UsersPage } from './pages/UsersPage'
+import { InstancesPage } from './pages/InstancesPage'
 import Login from '@/pages/Login'
 import { OAuthCallback } from './pages/OAuthCallback'
 import { toastEmitter } from '@/utils/api'
@@ -124,6 +125,13 @@ const AppLayout = () => {
                 <span className={`${location.pathname.startsWith('/users') ? 'text-primary' : 'text-muted-foreground'}`}>{t('nav.users')}</span>
               </NavLink>
             )}
+            {/* 实例管理 - 仅管理员可见 */}
+            {currentUser && currentUser.role && currentUser.role >= 10 && (
+              <NavLink to="/instances">
+                <Server className={`h-4 w-4 ${location.pathname.startsWith('/instances') ? 'text-primary' : 'text-muted-foreground'}`} />
+                <span className={`${location.pathname.startsWith('/instances') ? 'text-primary' : 'text-muted-foreground'}`}>{t('nav.instances')}</span>
+              </NavLink>
+            )}
             <div className="my-4 border-t border-border"></div>
             <NavLink to="/profile">
               <User className={`h-4 w-4 ${location.pathname.startsWith('/profile') ? 'text-primary' : 'text-muted-foreground'}`} />
@@ -216,6 +224,7 @@ const AppContent = () => {
         <Route path="market" element={<PrivateRoute><MarketPage /></PrivateRoute>} />
         <Route path="analytics" element={<PrivateRoute><AnalyticsPage /></PrivateRoute>} />
         <Route path="users" element={<PrivateRoute><UsersPage /></PrivateRoute>} />
+        <Route path="instances" element={<PrivateRoute><InstancesPage /></PrivateRoute>} />
         <Route path="profile" element={<PrivateRoute><ProfilePage /></PrivateRoute>} />
         <Route path="preferences" element={<PrivateRoute><PreferencesPage /></PrivateRoute>} />
         <Route path="api" element={<div>API Page Content</div>} />
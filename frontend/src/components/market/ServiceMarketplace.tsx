@@ -18,6 +18,7 @@ export function ServiceMarketplace({ onSelectService }: { onSelectService: (serv
         searchTerm,
         searchResults,
         isSearching,
+        showingRecommended,
         setSearchTerm,
         searchServices,
         fetchInstalledServices,
@@ -44,9 +45,8 @@ export function ServiceMarketplace({ onSelectService }: { onSelectService: (serv
     // Effect to fetch services when activeMarketTab changes or on initial load. --> Changed to: Effect for initial load only.
     useEffect(() => {
         // This will be called on initial load.
-        // searchServices in the store uses the initial activeMarketTab ('npm') 
-        // and initial searchTerm (empty), which clears results.
-        // This provides an empty state for the initially active tab, awaiting user search.
+        // searchServices in the store uses the initial activeMarketTab ('npm')
+        // and initial searchTerm (empty), which lists the recommended catalog until the user searches.
         searchServices();
     }, [searchServices]); // Now only depends on stable searchServices, so runs once on mount.
 
@@ -192,6 +192,14 @@ export function ServiceMarketplace({ onSelectService }: { onSelectService: (serv
             </Tabs>
             */}
 
+            {/* 搜索词为空时展示推荐目录 */}
+            {showingRecommended && displayedServices.length > 0 && (
+                <div>
+                    <h3 className="text-xl font-semibold">{t('serviceMarketplace.recommendedTitle')}</h3>
+                    <p className="text-sm text-muted-foreground">{t('serviceMarketplace.recommendedDescription')}</p>
+                </div>
+            )}
+
             <div className="grid gap-6 grid-cols-1 md:grid-cols-2 lg:grid-cols-3">
                 {displayedServices.map(service => (
                     <ServiceCard
@@ -0,0 +1,216 @@
+import { useEffect, useState } from 'react';
+import { Button } from '@/components/ui/button';
+import { Table, TableBody, TableHead, TableHeader, TableRow, TableCell } from '@/components/ui/table';
+import { Badge } from '@/components/ui/badge';
+import { useToast } from '@/hooks/use-toast';
+import { Power, RefreshCw, RotateCcw } from 'lucide-react';
+import api, { APIResponse } from '@/utils/api';
+import { ConfirmDialog } from '@/components/ui/ConfirmDialog';
+import { useTranslation } from 'react-i18next';
+
+interface MCPInstance {
+    cache_key: string;
+    service_id: number;
+    service_name: string;
+    service_type: string;
+    user_id?: number;
+    pid?: number;
+    created_at: string;
+    last_used_at: string;
+    active_requests: number;
+    tool_count: number;
+    prompt_count: number;
+    resource_count: number;
+    resource_template_count: number;
+}
+
+export function InstancesPage() {
+    const { t } = useTranslation();
+    const { toast } = useToast();
+    const [instances, setInstances] = useState<MCPInstance[]>([]);
+    const [loading, setLoading] = useState(true);
+    const [busyKey, setBusyKey] = useState<string | null>(null);
+    const [pendingShutdownKey, setPendingShutdownKey] = useState<string | null>(null);
+
+    // 获取运行中的实例
+    const fetchInstances = async () => {
+        setLoading(true);
+        try {
+            const response = await api.get('/mcp_services/instances') as APIResponse<MCPInstance[]>;
+            if (response.success) {
+                setInstances(response.data || []);
+            } else {
+                toast({
+                    title: t('instancesPage.messages.fetchFailed'),
+                    description: response.message || t('instancesPage.messages.unknownError'),
+                    variant: 'destructive'
+                });
+            }
+        } catch (error: any) {
+            toast({
+                title: t('instancesPage.messages.fetchFailed'),
+                description: error.message || t('instancesPage.messages.networkError'),
+                variant: 'destructive'
+            });
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    useEffect(() => {
+        fetchInstances();
+    }, []);
+
+    // 关闭或重启单个实例
+    const runInstanceAction = async (key: string, action: 'shutdown' | 'restart') => {
+        setBusyKey(key);
+        const path = `/mcp_services/instances/${encodeURIComponent(key)}`;
+        try {
+            const response = (action === 'restart'
+                ? await api.post(`${path}/restart`)
+                : await api.delete(path)) as APIResponse<any>;
+            if (response.success) {
+                toast({
+                    title: t('instancesPage.messages.operationSuccess'),
+                    description: action === 'restart' ? t('instancesPage.messages.restarted') : t('instancesPage.messages.shutDown')
+                });
+            } else {
+                toast({
+                    title: t('instancesPage.messages.operationFailed'),
+                    description: response.message || t('instancesPage.messages.unknownError'),
+                    variant: 'destructive'
+                });
+            }
+        } catch (error: any) {
+            toast({
+                title: t('instancesPage.messages.operationFailed'),
+                description: error?.response?.data?.message || error.message || t('instancesPage.messages.networkError'),
+                variant: 'destructive'
+            });
+        } finally {
+            setBusyKey(null);
+            fetchInstances();
+        }
+    };
+
+    const handleShutdownConfirm = async () => {
+        if (!pendingShutdownKey) return;
+        const key = pendingShutdownKey;
+        setPendingShutdownKey(null);
+        await runInstanceAction(key, 'shutdown');
+    };
+
+    const formatTime = (value: string) => value ? new Date(value).toLocaleString() : '-';
+
+    return (
+        <div className="w-full space-y-6">
+            <div className="flex justify-between items-center">
+                <div>
+                    <h2 className="text-3xl font-bold tracking-tight">{t('instancesPage.title')}</h2>
+                    <p className="text-muted-foreground mt-1">{t('instancesPage.description')}</p>
+                </div>
+                <Button variant="outline" onClick={fetchInstances} disabled={loading}>
+                    <RefreshCw className="w-4 h-4 mr-2" />
+                    {t('instancesPage.refresh')}
+                </Button>
+            </div>
+
+            {/* 实例列表表格 */}
+            <div className="border rounded-lg">
+                <Table>
+                    <TableHeader>
+                        <TableRow>
+                            <TableHead>{t('instancesPage.service')}</TableHead>
+                            <TableHead>{t('instancesPage.owner')}</TableHead>
+                            <TableHead>{t('instancesPage.pid')}</TableHead>
+                            <TableHead>{t('instancesPage.capabilities')}</TableHead>
+                            <TableHead>{t('instancesPage.createdAt')}</TableHead>
+                            <TableHead>{t('instancesPage.lastUsedAt')}</TableHead>
+                            <TableHead>{t('instancesPage.activeRequests')}</TableHead>
+                            <TableHead>{t('instancesPage.actions')}</TableHead>
+                        </TableRow>
+                    </TableHeader>
+                    <TableBody>
+                        {loading ? (
+                            <TableRow>
+                                <TableCell colSpan={8} className="text-center py-8">
+                                    {t('instancesPage.loading')}
+                                </TableCell>
+                            </TableRow>
+                        ) : instances.length === 0 ? (
+                            <TableRow>
+                                <TableCell colSpan={8} className="text-center py-8 text-muted-foreground">
+                                    {t('instancesPage.noInstancesFound')}
+                                </TableCell>
+                            </TableRow>
+                        ) : (
+                            instances.map((instance) => (
+                                <TableRow key={instance.cache_key}>
+                                    <TableCell>
+                                        <div className="font-medium">{instance.service_name}</div>
+                                        <div className="text-xs text-muted-foreground">{instance.cache_key}</div>
+                                    </TableCell>
+                                    <TableCell>
+                                        {instance.user_id ? (
+                                            <Badge variant="secondary">{t('instancesPage.user', { id: instance.user_id })}</Badge>
+                                        ) : (
+                                            <Badge>{t('instancesPage.shared')}</Badge>
+                                        )}
+                                    </TableCell>
+                                    <TableCell>{instance.pid || '-'}</TableCell>
+                                    <TableCell>
+                                        <span className="text-sm text-muted-foreground">
+                                            {t('instancesPage.counts', {
+                                                tools: instance.tool_count,
+                                                prompts: instance.prompt_count,
+                                                resources: instance.resource_count + instance.resource_template_count
+                                            })}
+                                        </span>
+                                    </TableCell>
+                                    <TableCell>{formatTime(instance.created_at)}</TableCell>
+                                    <TableCell>{formatTime(instance.last_used_at)}</TableCell>
+                                    <TableCell>{instance.active_requests}</TableCell>
+                                    <TableCell>
+                                        <div className="flex items-center space-x-2">
+                                            <Button
+                                                variant="outline"
+                                                size="sm"
+                                                onClick={() => runInstanceAction(instance.cache_key, 'restart')}
+                                                disabled={busyKey === instance.cache_key}
+                                                title={t('instancesPage.restart')}
+                                            >
+                                                <RotateCcw className="w-4 h-4" />
+                                            </Button>
+                                            <Button
+                                                variant="outline"
+                                                size="sm"
+                                                onClick={() => setPendingShutdownKey(instance.cache_key)}
+                                                disabled={busyKey === instance.cache_key}
+                                                title={t('instancesPage.shutdown')}
+                                                className="text-red-500 hover:text-red-700"
+                                            >
+                                                <Power className="w-4 h-4" />
+                                            </Button>
+                                        </div>
+                                    </TableCell>
+                                </TableRow>
+                            ))
+                        )}
+                    </TableBody>
+                </Table>
+            </div>
+
+            {/* 关闭确认对话框 */}
+            <ConfirmDialog
+                isOpen={pendingShutdownKey !== null}
+                onOpenChange={(open) => { if (!open) setPendingShutdownKey(null); }}
+                title={t('instancesPage.confirmShutdownTitle')}
+                description={t('instancesPage.confirmShutdownDescription')}
+                confirmText={t('instancesPage.shutdown')}
+                cancelText={t('instancesPage.cancel')}
+                onConfirm={handleShutdownConfirm}
+                confirmButtonVariant="destructive"
+            />
+        </div>
+    );
+}
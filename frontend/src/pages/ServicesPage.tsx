@@ -3,9 +3,9 @@ import { Card, CardContent, CardFooter, CardHeader, CardTitle } from '@/componen
 import { Button } from '@/components/ui/button';
 import { Table, TableBody, TableHead, TableHeader, TableRow, TableCell } from '@/components/ui/table';
 import { Tabs, TabsContent, TabsList, TabsTrigger } from '@/components/ui/tabs';
-import { Search, PlusCircle, Trash2, Plus, RotateCcw, Grid, List, Upload } from 'lucide-react';
+import { Search, PlusCircle, Trash2, Plus, RotateCcw, Grid, List, Upload, KeyRound } from 'lucide-react';
 import { useToast } from '@/hooks/use-toast';
-import { useNavigate } from 'react-router-dom';
+import { useNavigate, useSearchParams } from 'react-router-dom';
 import { useMarketStore, ServiceType } from '@/store/marketStore';
 import ServiceConfigModal from '@/components/market/ServiceConfigModal';
 import CustomServiceModal, { CustomServiceData } from '@/components/market/CustomServiceModal';
@@ -27,6 +27,7 @@ export function ServicesPage() {
     const { t } = useTranslation();
     const { toast } = useToast();
     const navigate = useNavigate();
+    const [searchParams, setSearchParams] = useSearchParams();
     const { currentUser } = useAuth();
     const { installedServices: globalInstalledServices, fetchInstalledServices, uninstallService, toggleService, checkServiceHealth } = useMarketStore();
     const [configModalOpen, setConfigModalOpen] = useState(false);
@@ -41,6 +42,7 @@ export function ServicesPage() {
     const [autoFillEnv, setAutoFillEnv] = useState('');
 
     const hasFetched = useRef(false);
+    const handledOAuthResult = useRef(false);
 
     // 检查用户是否是管理员(role >= 10)
     const isAdmin = currentUser?.role && currentUser.role >= 10;
@@ -52,6 +54,58 @@ export function ServicesPage() {
         }
     }, [fetchInstalledServices]);
 
+    // 上游 OAuth 回调跳转回来后，由当前登录用户确认完成授权
+    useEffect(() => {
+        const result = searchParams.get('upstream_oauth');
+        if (!result || handledOAuthResult.current) return;
+        handledOAuthResult.current = true;
+        const state = searchParams.get('state');
+        const serviceName = searchParams.get('service') || '';
+        setSearchParams({}, { replace: true });
+
+        if (result === 'confirm' && state) {
+            const completeAuthorization = async () => {
+                try {
+                    const res = await api.post('/oauth/upstream/complete', { state }) as APIResponse<any>;
+                    if (!res.success) {
+                        throw new Error(res.message);
+                    }
+                    toast({ title: t('services.upstreamOAuthAuthorized', { name: serviceName }) });
+                } catch (error: any) {
+                    toast({
+                        title: t('services.upstreamOAuthFailed'),
+                        description: error?.response?.data?.message || error?.message,
+                        variant: 'destructive'
+                    });
+                }
+            };
+            completeAuthorization();
+        } else if (result === 'error') {
+            toast({
+                title: t('services.upstreamOAuthFailed'),
+                description: searchParams.get('message') || '',
+                variant: 'destructive'
+            });
+        }
+    }, [searchParams, setSearchParams, toast, t]);
+
+    // 跳转到上游的授权页面，授权完成后回调会带着 upstream_oauth=confirm 回到本页
+    const handleAuthorizeUpstream = async (serviceId: string) => {
+        try {
+            const res = await api.get(`/mcp_services/${serviceId}/oauth/authorize`) as APIResponse<any>;
+            if (!res.success || !res.data?.authorization_url) {
+                throw new Error(res.message);
+            }
+            window.location.href = res.data.authorization_url;
+        } catch (error: any) {
+            toast({
+                title: t('services.upstreamOAuthFailed'),
+                description: error?.response?.data?.message || error?.message,
+                variant: 'destructive'
+            });
+        }
+    };
+
     const allServices = globalInstalledServices;
     const activeServices = globalInstalledServices.filter(s => s.enabled === true);
     const inactiveServices = globalInstalledServices.filter(s => s.enabled === false);
@@ -442,6 +496,17 @@ export function ServicesPage() {
                                     >
                                         {t('services.configure')}
                                     </Button>
+                                    {service.oauth_enabled && (
+                                        <Button
+                                            variant="outline"
+                                            size="sm"
+                                            onClick={() => handleAuthorizeUpstream(service.id)}
+                                            title={t('services.authorizeUpstreamHint')}
+                                        >
+                                            <KeyRound className="w-4 h-4 mr-1" />
+                                            {t('services.authorizeUpstream')}
+                                        </Button>
+                                    )}
                                     {isAdmin && (
                                         <button
                                             className="p-1 rounded hover:bg-red-100 text-red-500"
@@ -540,7 +605,15 @@ export function ServicesPage() {
                     )}
                 </CardContent>
                 <CardFooter className="flex justify-between items-end mt-auto">
-                    <Button variant="outline" size="sm" className="h-6" onClick={() => { setSelectedService(service); setConfigModalOpen(true); }}>{t('services.configure')}</Button>
+                    <div className="flex items-center space-x-2">
+                        <Button variant="outline" size="sm" className="h-6" onClick={() => { setSelectedService(service); setConfigModalOpen(true); }}>{t('services.configure')}</Button>
+                        {service.oauth_enabled && (
+                            <Button variant="outline" size="sm" className="h-6" onClick={() => handleAuthorizeUpstream(service.id)} title={t('services.authorizeUpstreamHint')}>
+                                <KeyRound className="w-3 h-3 mr-1" />
+                                {t('services.authorizeUpstream')}
+                            </Button>
+                        )}
+                    </div>
                     <Switch
                         checked={service.enabled || false}
                         onCheckedChange={() => handleToggleService(service.id)}
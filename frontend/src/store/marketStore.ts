@@ -28,6 +28,8 @@ export interface ServiceType {
     rpd_limit?: number;
     user_daily_request_count?: number;
     remaining_requests?: number;
+    // 是否需要用户授权上游 OAuth
+    oauth_enabled?: boolean;
 }
 
 // 详细服务类型定义
@@ -80,6 +82,7 @@ interface MarketState {
     searchTerm: string;
     searchResults: ServiceType[];
     isSearching: boolean;
+    showingRecommended: boolean; // 搜索词为空时展示推荐目录
     activeMarketTab: MarketSource; // 新增：当前激活的市场选项卡
 
     // 已安装服务
@@ -99,6 +102,7 @@ interface MarketState {
     setActiveMarketTab: (tab: MarketSource) => void; // 新增：设置激活的市场选项卡
     searchServices: (sourceArg?: 'installed') => Promise<void>; // 修改 searchServices 签名
     fetchInstalledServices: () => Promise<void>;
+    fetchRecommendedServices: () => Promise<void>;
     selectService: (serviceId: string) => void;
     fetchServiceDetails: (serviceId: string, packageName?: string, packageManager?: string) => Promise<void>;
     clearSelectedService: () => void;
@@ -118,6 +122,7 @@ export const useMarketStore = create<MarketState>((set, get) => ({
     searchTerm: '',
     searchResults: [],
     isSearching: false,
+    showingRecommended: false,
     activeMarketTab: 'npm', // 新增：初始化 activeMarketTab
     installedServices: [],
     selectedService: null,
@@ -131,7 +136,7 @@ export const useMarketStore = create<MarketState>((set, get) => ({
     setActiveMarketTab: (tab) => set({ activeMarketTab: tab }), // 新增：实现 setActiveMarketTab
 
     searchServices: async (sourceArg) => { // Renamed param from 'source' to 'sourceArg' to avoid conflict if any local var named 'source'
-        const { searchTerm, fetchInstalledServices, activeMarketTab } = get();
+        const { searchTerm, fetchInstalledServices, fetchRecommendedServices, activeMarketTab } = get();
         set({ isSearching: true });
 
         // 如果是请求已安装的服务
@@ -141,9 +146,10 @@ export const useMarketStore = create<MarketState>((set, get) => ({
             return;
         }
 
-        // 如果搜索词为空 (且不是请求已安装服务)，则清空结果并停止
+        // 如果搜索词为空 (且不是请求已安装服务)，则展示推荐目录
         if (!searchTerm) {
-            set({ searchResults: [], isSearching: false });
+            await fetchRecommendedServices();
+            set({ isSearching: false });
             return;
         }
 
@@ -205,9 +211,9 @@ export const useMarketStore = create<MarketState>((set, get) => ({
                             readme: item.readme || '',
                         };
                     });
-                    set({ searchResults: mappedResults });
+                    set({ searchResults: mappedResults, showingRecommended: false });
                 } else {
-                    set({ searchResults: [] });
+                    set({ searchResults: [], showingRecommended: false });
                 }
             } else {
                 throw new Error(response.message || 'Failed to search services');
@@ -220,6 +226,40 @@ export const useMarketStore = create<MarketState>((set, get) => ({
         }
     },
 
+    fetchRecommendedServices: async () => {
+        try {
+            const response = await api.get('/mcp_market/catalog') as APIResponse<any>;
+            if (response.success && Array.isArray(response.data)) {
+                // 推荐目录条目按条目名安装，来源为 recommended
+                const recommendedServices: ServiceType[] = response.data.map((item: any) => ({
+                    id: item.name + '-recommended',
+                    name: item.name,
+                    display_name: item.display_name || item.name,
+                    version: '',
+                    description: item.description || '',
+                    source: 'recommended',
+                    homepage: item.homepage,
+                    isInstalled: item.is_installed || false,
+                    installed_service_id: item.installed_service_id,
+                    envVars: item.env_vars ? item.env_vars.map((envDef: any) => ({
+                        name: envDef.name,
+                        description: envDef.description,
+                        isSecret: envDef.is_secret,
+                        isRequired: !envDef.optional,
+                        defaultValue: envDef.default_value,
+                        value: envDef.default_value || ''
+                    })) : [],
+                }));
+                set({ searchResults: recommendedServices, showingRecommended: true });
+            } else {
+                throw new Error(response.message || 'Failed to fetch recommended services');
+            }
+        } catch (error) {
+            console.error('Fetch recommended services error:', error);
+            set({ searchResults: [], showingRecommended: false });
+        }
+    },
+
     fetchInstalledServices: async () => {
         set({ isSearching: true });
 
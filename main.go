@@ -4,6 +4,7 @@ import (
 	"context"
 	"embed"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -15,8 +16,11 @@ import (
 	"one-mcp/backend/api/route"
 	"one-mcp/backend/common"
 	"one-mcp/backend/common/i18n"
+	"one-mcp/backend/library/declarative"
+	"one-mcp/backend/library/market"
 	"one-mcp/backend/library/proxy"
 	"one-mcp/backend/model"
+	"one-mcp/backend/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,6 +35,10 @@ var indexPage []byte
 var versionFileContent string
 
 func main() {
+	// one-mcp runs itself as the wrapper that applies the sandbox limits of a stdio process
+	if len(os.Args) > 1 && os.Args[1] == proxy.SandboxExecCommand {
+		proxy.SandboxExec(os.Args[2:])
+	}
 	// Set version from embedded file at the very beginning
 	common.Version = strings.TrimSpace(versionFileContent)
 	flag.Parse()
@@ -64,6 +72,28 @@ func main() {
 		}
 	}()
 
+	if *common.RotateMasterKey {
+		updated, err := model.RotateSecrets()
+		if err != nil {
+			common.FatalLog("failed to rotate master key: " + err.Error())
+		}
+		common.SysLog("Master key rotation finished, " + strconv.Itoa(updated) + " records re-encrypted")
+		return
+	}
+
+	// Apply the declarative configuration before the service manager starts the declared services
+	if *common.ConfigFile != "" {
+		plan, err := declarative.Reconcile(context.Background(), *common.ConfigFile, *common.ConfigDryRun)
+		if err != nil {
+			common.FatalLog("failed to apply configuration file: " + err.Error())
+		}
+		if *common.ConfigDryRun {
+			fmt.Println(plan.String())
+			return
+		}
+		setupConfigReload(*common.ConfigFile)
+	}
+
 	// Initialize i18n
 	localesPath := "./backend/locales"
 	// In Docker environment, try absolute path if relative path fails
@@ -85,6 +115,11 @@ func main() {
 	// 	// Depending on severity, might os.Exit(1) or just log
 	// }
 
+	// Seed the recommended catalog from the bundled templates on first start
+	if err := market.SeedRecommendedCatalog(); err != nil {
+		common.SysError("Failed to seed the recommended catalog: " + err.Error())
+	}
+
 	// Initialize service manager
 	serviceManager := proxy.GetServiceManager()
 	go func() {
@@ -95,6 +130,12 @@ func main() {
 		}
 	}()
 
+	// Roll up request stats and apply the retention policy in the background
+	service.StartStatsMaintenance(context.Background())
+
+	// Compare installed npm and PyPI packages with their latest releases in the background
+	service.StartVersionChecks(context.Background())
+
 	// Initialize HTTP server
 	server := gin.Default()
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
@@ -114,6 +155,21 @@ func main() {
 	}
 }
 
+// setupConfigReload applies the configuration file again whenever the process receives SIGHUP
+func setupConfigReload(path string) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	go func() {
+		for range c {
+			common.SysLog("Reloading configuration file " + path)
+			if _, err := declarative.Reconcile(context.Background(), path, false); err != nil {
+				common.SysError("Failed to apply configuration file: " + err.Error())
+			}
+		}
+	}()
+}
+
 // setupGracefulShutdown registers signal handlers to ensure clean shutdown
 func setupGracefulShutdown() {
 	c := make(chan os.Signal, 1)